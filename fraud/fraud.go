@@ -0,0 +1,80 @@
+package fraud
+
+import "time"
+
+type Decision string
+
+const (
+    Allow Decision = "allow"
+    Hold  Decision = "hold"
+    Block Decision = "block"
+)
+
+// severity orders decisions so the strictest outcome of all rules wins.
+var severity = map[Decision]int{Allow: 0, Hold: 1, Block: 2}
+
+// Transfer describes an outgoing transfer to another user, with the amount converted to rubles.
+// For a transfer to another bank ToAccountID and ToUserID are 0 and the recipient is given by
+// ToBIC and ToAccountNumber.
+type Transfer struct {
+    UserID          int
+    FromAccountID   int
+    ToAccountID     int
+    ToUserID        int
+    ToBIC           string
+    ToAccountNumber string
+    AmountRub       float64
+    At              time.Time
+}
+
+type Result struct {
+    Decision Decision `json:"decision"`
+    Reasons  []string `json:"reasons,omitempty"`
+}
+
+// History gives rules access to the sender's past activity. Amounts are in rubles.
+type History interface {
+    HasTransferredTo(userID, toAccountID int) (bool, error)
+    HasTransferredToExternal(userID int, bic, accountNumber string) (bool, error)
+    CountOutgoingSince(userID int, since time.Time) (int, error)
+    AverageOutgoingSince(userID int, since time.Time) (float64, int, error)
+    LastPasswordChange(userID int) (*time.Time, error)
+    LastNewDeviceLogin(userID int) (*time.Time, error)
+}
+
+type Rule interface {
+    Name() string
+    // Evaluate returns Allow when the rule does not apply, otherwise Hold or Block with a reason.
+    Evaluate(t Transfer) (Decision, string, error)
+}
+
+type Engine interface {
+    Evaluate(t Transfer) (*Result, error)
+}
+
+type engine struct {
+    rules []Rule
+}
+
+func NewEngine(rules ...Rule) Engine {
+    return &engine{rules: rules}
+}
+
+// Evaluate runs every rule and returns the strictest decision together with the reasons of all rules that fired.
+func (e *engine) Evaluate(t Transfer) (*Result, error) {
+    result := &Result{Decision: Allow}
+    for _, rule := range e.rules {
+        decision, reason, err := rule.Evaluate(t)
+        if err != nil {
+            return nil, err
+        }
+        if decision == Allow {
+            continue
+        }
+        result.Reasons = append(result.Reasons, rule.Name()+": "+reason)
+        if severity[decision] > severity[result.Decision] {
+            result.Decision = decision
+        }
+    }
+    return result, nil
+}
@@ -0,0 +1,123 @@
+package fraud
+
+import (
+    "fmt"
+    "time"
+)
+
+// DefaultRules returns the rule set used for transfer screening.
+func DefaultRules(h History) []Rule {
+    return []Rule{
+        &newRecipientRule{history: h, threshold: 50000},
+        &rapidSuccessionRule{history: h, window: 10 * time.Minute, holdCount: 5, blockCount: 10},
+        &securityChangeRule{history: h, window: 24 * time.Hour, threshold: 10000},
+        &unusualAmountRule{history: h, lookback: 90 * 24 * time.Hour, minHistory: 5, multiplier: 5, floor: 20000},
+    }
+}
+
+// newRecipientRule holds large transfers to an account the user has never paid before.
+type newRecipientRule struct {
+    history   History
+    threshold float64
+}
+
+func (r *newRecipientRule) Name() string { return "new_recipient_large_amount" }
+
+func (r *newRecipientRule) Evaluate(t Transfer) (Decision, string, error) {
+    if t.AmountRub < r.threshold {
+        return Allow, "", nil
+    }
+    var known bool
+    var err error
+    if t.ToAccountID == 0 {
+        known, err = r.history.HasTransferredToExternal(t.UserID, t.ToBIC, t.ToAccountNumber)
+    } else {
+        known, err = r.history.HasTransferredTo(t.UserID, t.ToAccountID)
+    }
+    if err != nil || known {
+        return Allow, "", err
+    }
+    return Hold, fmt.Sprintf("first transfer to this recipient is %.2f RUB", t.AmountRub), nil
+}
+
+// rapidSuccessionRule catches bursts of outgoing transfers, typical of a drained account.
+type rapidSuccessionRule struct {
+    history    History
+    window     time.Duration
+    holdCount  int
+    blockCount int
+}
+
+func (r *rapidSuccessionRule) Name() string { return "rapid_succession" }
+
+func (r *rapidSuccessionRule) Evaluate(t Transfer) (Decision, string, error) {
+    count, err := r.history.CountOutgoingSince(t.UserID, t.At.Add(-r.window))
+    if err != nil {
+        return Allow, "", err
+    }
+    // count does not include the transfer being evaluated
+    reason := fmt.Sprintf("%d transfers in the last %s", count+1, r.window)
+    switch {
+    case count+1 >= r.blockCount:
+        return Block, reason, nil
+    case count+1 >= r.holdCount:
+        return Hold, reason, nil
+    }
+    return Allow, "", nil
+}
+
+// securityChangeRule holds sizeable transfers made shortly after a password change or a login
+// from a new device, when an account takeover is most likely.
+type securityChangeRule struct {
+    history   History
+    window    time.Duration
+    threshold float64
+}
+
+func (r *securityChangeRule) Name() string { return "recent_security_change" }
+
+func (r *securityChangeRule) Evaluate(t Transfer) (Decision, string, error) {
+    if t.AmountRub < r.threshold {
+        return Allow, "", nil
+    }
+    changed, err := r.history.LastPasswordChange(t.UserID)
+    if err != nil {
+        return Allow, "", err
+    }
+    if changed != nil && t.At.Sub(*changed) < r.window {
+        return Hold, "password changed " + t.At.Sub(*changed).Round(time.Minute).String() + " ago", nil
+    }
+    login, err := r.history.LastNewDeviceLogin(t.UserID)
+    if err != nil {
+        return Allow, "", err
+    }
+    if login != nil && t.At.Sub(*login) < r.window {
+        return Hold, "login from a new device " + t.At.Sub(*login).Round(time.Minute).String() + " ago", nil
+    }
+    return Allow, "", nil
+}
+
+// unusualAmountRule holds transfers far above what the user normally sends.
+type unusualAmountRule struct {
+    history    History
+    lookback   time.Duration
+    minHistory int
+    multiplier float64
+    floor      float64 // amounts below this are never considered unusual
+}
+
+func (r *unusualAmountRule) Name() string { return "unusual_amount" }
+
+func (r *unusualAmountRule) Evaluate(t Transfer) (Decision, string, error) {
+    if t.AmountRub < r.floor {
+        return Allow, "", nil
+    }
+    avg, count, err := r.history.AverageOutgoingSince(t.UserID, t.At.Add(-r.lookback))
+    if err != nil || count < r.minHistory || avg <= 0 {
+        return Allow, "", err
+    }
+    if t.AmountRub > avg*r.multiplier {
+        return Hold, fmt.Sprintf("amount is %.1fx the average of %.2f RUB", t.AmountRub/avg, avg), nil
+    }
+    return Allow, "", nil
+}
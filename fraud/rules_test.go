@@ -0,0 +1,116 @@
+package fraud
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+type fakeHistory struct {
+    known          bool
+    knownExternal  bool // for transfers to other banks
+    recent         int // outgoing transfers inside the rapid succession window
+    average        float64
+    averageCount   int
+    passwordChange *time.Time
+    newDevice      *time.Time
+}
+
+func (h *fakeHistory) HasTransferredTo(userID, toAccountID int) (bool, error) {
+    return h.known, nil
+}
+
+func (h *fakeHistory) HasTransferredToExternal(userID int, bic, accountNumber string) (bool, error) {
+    return h.knownExternal, nil
+}
+
+func (h *fakeHistory) CountOutgoingSince(userID int, since time.Time) (int, error) {
+    return h.recent, nil
+}
+
+func (h *fakeHistory) AverageOutgoingSince(userID int, since time.Time) (float64, int, error) {
+    return h.average, h.averageCount, nil
+}
+
+func (h *fakeHistory) LastPasswordChange(userID int) (*time.Time, error) {
+    return h.passwordChange, nil
+}
+
+func (h *fakeHistory) LastNewDeviceLogin(userID int) (*time.Time, error) {
+    return h.newDevice, nil
+}
+
+func TestDefaultRules(t *testing.T) {
+    now := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+    ago := func(d time.Duration) *time.Time {
+        at := now.Add(-d)
+        return &at
+    }
+    tests := []struct {
+        name        string
+        history     fakeHistory
+        external    bool
+        amount      float64
+        want        Decision
+        wantReasons []string
+    }{
+        {name: "small transfer to a known recipient", history: fakeHistory{known: true}, amount: 1000, want: Allow},
+        {name: "large first transfer", amount: 50000, want: Hold, wantReasons: []string{"new_recipient_large_amount"}},
+        {name: "large transfer to a known recipient", history: fakeHistory{known: true}, amount: 50000, want: Allow},
+        {name: "large first transfer to another bank", history: fakeHistory{known: true}, external: true, amount: 50000, want: Hold, wantReasons: []string{"new_recipient_large_amount"}},
+        {name: "large transfer to a known account at another bank", history: fakeHistory{knownExternal: true}, external: true, amount: 50000, want: Allow},
+        {name: "fifth transfer in ten minutes", history: fakeHistory{known: true, recent: 4}, amount: 100, want: Hold, wantReasons: []string{"rapid_succession"}},
+        {name: "tenth transfer in ten minutes", history: fakeHistory{known: true, recent: 9}, amount: 100, want: Block, wantReasons: []string{"rapid_succession"}},
+        {
+            name:    "after a password change",
+            history: fakeHistory{known: true, passwordChange: ago(2 * time.Hour)},
+            amount:  10000, want: Hold, wantReasons: []string{"recent_security_change: password changed 2h0m0s ago"},
+        },
+        {name: "password changed long ago", history: fakeHistory{known: true, passwordChange: ago(48 * time.Hour)}, amount: 10000, want: Allow},
+        {name: "small amount after a password change", history: fakeHistory{known: true, passwordChange: ago(time.Hour)}, amount: 9999, want: Allow},
+        {
+            name:    "after a new device login",
+            history: fakeHistory{known: true, newDevice: ago(30 * time.Minute)},
+            amount:  20000, want: Hold, wantReasons: []string{"recent_security_change: login from a new device"},
+        },
+        {
+            name:    "far above the average",
+            history: fakeHistory{known: true, average: 5000, averageCount: 5},
+            amount:  25001, want: Hold, wantReasons: []string{"unusual_amount"},
+        },
+        {name: "average with too little history", history: fakeHistory{known: true, average: 5000, averageCount: 4}, amount: 40000, want: Allow},
+        {name: "below the unusual amount floor", history: fakeHistory{known: true, average: 1000, averageCount: 10}, amount: 19999, want: Allow},
+        {
+            name:    "strictest decision wins and all reasons are kept",
+            history: fakeHistory{recent: 9, average: 1000, averageCount: 10},
+            amount:  60000, want: Block,
+            wantReasons: []string{"new_recipient_large_amount", "rapid_succession", "unusual_amount"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            history := tt.history
+            engine := NewEngine(DefaultRules(&history)...)
+            transfer := Transfer{UserID: 1, FromAccountID: 1, ToAccountID: 2, ToUserID: 2, AmountRub: tt.amount, At: now}
+            if tt.external {
+                transfer.ToAccountID, transfer.ToUserID = 0, 0
+                transfer.ToBIC, transfer.ToAccountNumber = "044525225", "40702810438000034726"
+            }
+            result, err := engine.Evaluate(transfer)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if result.Decision != tt.want {
+                t.Errorf("decision = %s (%v), want %s", result.Decision, result.Reasons, tt.want)
+            }
+            if len(result.Reasons) != len(tt.wantReasons) {
+                t.Fatalf("reasons = %v, want %v", result.Reasons, tt.wantReasons)
+            }
+            for i, want := range tt.wantReasons {
+                if !strings.HasPrefix(result.Reasons[i], want) {
+                    t.Errorf("reason %d = %q, want it to start with %q", i, result.Reasons[i], want)
+                }
+            }
+        })
+    }
+}
@@ -3,11 +3,12 @@ module banking_service_project
 go 1.23
 
 require (
-    github.com/gorilla/mux v1.8.0
-    github.com/lib/pq v1.10.4
-    github.com/golang-jwt/jwt/v5 v5.0.2
-    github.com/sirupsen/logrus v1.10.0
-    golang.org/x/crypto v0.10.0
-    gopkg.in/gomail.v2 v2.0.0
-    github.com/beevik/etree v1.1.0
+	github.com/beevik/etree v1.1.0
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/gorilla/mux v1.8.0
+	github.com/lib/pq v1.10.4
+	golang.org/x/crypto v0.10.0
+	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
 )
+
+require gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
@@ -2,90 +2,56 @@ package handlers
 
 import (
     "encoding/json"
+    "errors"
+    "io"
     "net/http"
     "strconv"
-    "strings"
 
+    "github.com/gorilla/mux"
+
+    "banking_service_project/middleware"
     "banking_service_project/services"
+    "banking_service_project/utils"
 )
 
-type Handler struct {
-    authService     services.AuthService
-    accountService  services.AccountService
-    cardService     services.CardService
-    transferService services.TransferService
-    creditService   services.CreditService
-    analyticsService services.AnalyticsService
-    externalService services.ExternalService
-}
-
-func NewHandler(authS services.AuthService, accountS services.AccountService, cardS services.CardService, transferS services.TransferService, creditS services.CreditService, analyticsS services.AnalyticsService, externalS services.ExternalService) *Handler {
-    return &Handler{
-        authService:      authS,
-        accountService:   accountS,
-        cardService:      cardS,
-        transferService:  transferS,
-        creditService:    creditS,
-        analyticsService: analyticsS,
-        externalService:  externalS,
-    }
-}
+func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
 
-func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
     type request struct {
-        Username string `json:"username"`
-        Email    string `json:"email"`
-        Password string `json:"password"`
+        Currency string `json:"currency"`
+        Product  string `json:"product"`
     }
+    // The body is optional; accounts default to current accounts in rubles.
     var req request
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
         http.Error(w, "Invalid request", http.StatusBadRequest)
         return
     }
-
-    user, err := h.authService.Register(req.Username, req.Email, req.Password)
-    if err != nil {
+    account, err := h.accountService.CreateAccount(userID, req.Currency, req.Product)
+    if errors.Is(err, services.ErrInvalidCurrency) || errors.Is(err, services.ErrUnknownProduct) || errors.Is(err, services.ErrProductCurrency) {
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(user)
-}
-
-func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-    type request struct {
-        Email    string `json:"email"`
-        Password string `json:"password"`
-    }
-    var req request
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request", http.StatusBadRequest)
-        return
-    }
-    token, err := h.authService.Login(req.Email, req.Password)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusUnauthorized)
+        http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"token": token})
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(account)
 }
 
-func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    account, err := h.accountService.CreateAccount(userID)
+func (h *Handler) GetAccountProducts(w http.ResponseWriter, r *http.Request) {
+    products, err := h.accountService.ListProducts()
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(account)
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(products)
 }
 
 func (h *Handler) GetUserAccounts(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
+    userID := middleware.UserID(r.Context())
     accounts, err := h.accountService.GetUserAccounts(userID)
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -95,129 +61,111 @@ func (h *Handler) GetUserAccounts(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(accounts)
 }
 
-func (h *Handler) CreateCard(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    // For simplicity, assume accountID is passed as query parameter
-    accountIDStr := r.URL.Query().Get("account_id")
-    if accountIDStr == "" {
-        http.Error(w, "account_id is required", http.StatusBadRequest)
+func (h *Handler) PredictBalance(w http.ResponseWriter, r *http.Request) {
+    accountID, ok := h.pathAccount(w, r)
+    if !ok {
         return
     }
-    accountID, _ := strconv.Atoi(accountIDStr)
-
-    card, err := h.cardService.CreateCard(accountID)
+    // For simplicity, days parameter as query
+    daysStr := r.URL.Query().Get("days")
+    days, _ := strconv.Atoi(daysStr)
+    prediction, err := h.analyticsService.PredictBalance(accountID, days)
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(card)
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]float64{"prediction": prediction})
 }
 
-func (h *Handler) GetUserCards(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    // For simplicity, assume accountID is passed as query parameter
-    accountIDStr := r.URL.Query().Get("account_id")
-    if accountIDStr == "" {
-        http.Error(w, "account_id is required", http.StatusBadRequest)
+func (h *Handler) SetDefaultAccount(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    accountID, ok := h.pathAccount(w, r)
+    if !ok {
+        return
+    }
+    err := h.accountService.SetDefaultAccount(userID, accountID)
+    if writeAccountStatusError(w, err) {
         return
     }
-    accountID, _ := strconv.Atoi(accountIDStr)
-
-    cards, err := h.cardService.GetCards(accountID)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        http.Error(w, err.Error(), http.StatusNotFound)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(cards)
+    w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-
+func (h *Handler) CloseAccount(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    accountID, ok := h.pathAccount(w, r)
+    if !ok {
+        return
+    }
     type request struct {
-        FromAccountID int     `json:"from_account_id"`
-        ToAccountID   int     `json:"to_account_id"`
-        Amount        float64 `json:"amount"`
+        TargetAccountID     int    `json:"target_account_id"`
+        TargetAccountNumber string `json:"target_account_number"`
     }
     var req request
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
         http.Error(w, "Invalid request", http.StatusBadRequest)
         return
     }
-    tx, err := h.transferService.Transfer(req.FromAccountID, req.ToAccountID, req.Amount)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
+    targetAccountID, ok := h.bodyAccount(w, req.TargetAccountID, req.TargetAccountNumber)
+    if !ok {
+        return
+    }
+    account, err := h.accountService.CloseAccount(userID, accountID, targetAccountID)
+    if writeAccountStatusError(w, err) {
+        return
+    }
+    if errors.Is(err, services.ErrAccountHasCredits) || errors.Is(err, services.ErrAccountHasTransfers) || errors.Is(err, services.ErrNegativeBalance) {
+        http.Error(w, err.Error(), http.StatusConflict)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(tx)
-}
-
-func (h *Handler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    // For simplicity, fixed current month and year
-    stats, err := h.analyticsService.GetMonthlyStats(userID, int(time.Now().Month()), time.Now().Year())
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
     w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(stats)
+    json.NewEncoder(w).Encode(account)
 }
 
-func (h *Handler) GetCreditSchedule(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    creditID, _ := strconv.Atoi(vars["creditId"])
-    schedule, err := h.creditService.GetSchedule(creditID)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
+// writeAccountStatusError answers 403 if err is an AccountStatusError.
+func writeAccountStatusError(w http.ResponseWriter, err error) bool {
+    var statusErr *services.AccountStatusError
+    if !errors.As(err, &statusErr) {
+        return false
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(schedule)
+    http.Error(w, statusErr.Error(), http.StatusForbidden)
+    return true
 }
 
-func (h *Handler) PredictBalance(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    accountID, _ := strconv.Atoi(vars["accountId"])
-    // For simplicity, days parameter as query
-    daysStr := r.URL.Query().Get("days")
-    days, _ := strconv.Atoi(daysStr)
-    prediction, err := h.analyticsService.PredictBalance(accountID, days)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
+// pathAccount reads the {accountId} path variable, which may be an account id or an account number.
+func (h *Handler) pathAccount(w http.ResponseWriter, r *http.Request) (int, bool) {
+    ref := mux.Vars(r)["accountId"]
+    if !utils.IsAccountNumber(ref) {
+        return pathID(w, r, "accountId")
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]float64{"prediction": prediction})
+    return h.accountByNumber(w, ref)
 }
 
-func (h *Handler) ApplyCredit(w http.ResponseWriter, r *http.Request) {
-    type request struct {
-        AccountID   int     `json:"account_id"`
-        Principal   float64 `json:"principal"`
-        AnnualRate  float64 `json:"annual_rate"`
-        TermMonths  int     `json:"term_months"`
+// bodyAccount picks the account a request body refers to: by number if one is given, by id otherwise.
+func (h *Handler) bodyAccount(w http.ResponseWriter, id int, number string) (int, bool) {
+    if number == "" {
+        return id, true
     }
-    var req request
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request", http.StatusBadRequest)
-        return
+    if !utils.IsAccountNumber(number) {
+        http.Error(w, "account number must be 20 digits", http.StatusBadRequest)
+        return 0, false
     }
-    credit, schedule, err := h.creditService.ApplyCredit(req.AccountID, req.Principal, req.AnnualRate, req.TermMonths)
+    return h.accountByNumber(w, number)
+}
+
+func (h *Handler) accountByNumber(w http.ResponseWriter, number string) (int, bool) {
+    acc, err := h.accountService.GetAccountByNumber(number)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
+        http.Error(w, "account not found", http.StatusNotFound)
+        return 0, false
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(map[string]interface{}{
-        "credit":   credit,
-        "schedule": schedule,
-    })
+    return acc.ID, true
 }
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gorilla/mux"
+
+    "banking_service_project/middleware"
+    "banking_service_project/services"
+)
+
+func actor(r *http.Request) services.Actor {
+    return services.Actor{UserID: middleware.UserID(r.Context()), IP: clientIP(r)}
+}
+
+// pathID reads a numeric path variable and answers 400 if it is not one.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+    id, err := strconv.Atoi(mux.Vars(r)[name])
+    if err != nil {
+        http.Error(w, "Invalid "+name, http.StatusBadRequest)
+        return 0, false
+    }
+    return id, true
+}
+
+// decodeReason reads {"reason": "..."} from the request body.
+func decodeReason(w http.ResponseWriter, r *http.Request) (string, bool) {
+    var req struct {
+        Reason string `json:"reason"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return "", false
+    }
+    return req.Reason, true
+}
+
+func (h *Handler) AdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+    users, err := h.adminService.SearchUsers(actor(r), r.URL.Query().Get("q"))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(users)
+}
+
+func (h *Handler) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+    userID, ok := pathID(w, r, "userId")
+    if !ok {
+        return
+    }
+    user, err := h.adminService.GetUser(actor(r), userID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(user)
+}
+
+func (h *Handler) AdminGetUserAccounts(w http.ResponseWriter, r *http.Request) {
+    userID, ok := pathID(w, r, "userId")
+    if !ok {
+        return
+    }
+    accounts, err := h.adminService.GetUserAccounts(actor(r), userID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(accounts)
+}
+
+func (h *Handler) AdminSetUserRoles(w http.ResponseWriter, r *http.Request) {
+    userID, ok := pathID(w, r, "userId")
+    if !ok {
+        return
+    }
+    var req struct {
+        Roles []string `json:"roles"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    err := h.adminService.SetUserRoles(actor(r), userID, req.Roles)
+    if errors.Is(err, services.ErrUnknownRole) || errors.Is(err, services.ErrOwnAdminRole) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminGetAccountTransactions(w http.ResponseWriter, r *http.Request) {
+    accountID, ok := h.pathAccount(w, r)
+    if !ok {
+        return
+    }
+    txs, err := h.adminService.GetAccountTransactions(actor(r), accountID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(txs)
+}
+
+func (h *Handler) AdminSetAccountStatus(w http.ResponseWriter, r *http.Request) {
+    accountID, ok := h.pathAccount(w, r)
+    if !ok {
+        return
+    }
+    var req struct {
+        Status string `json:"status"`
+        Reason string `json:"reason"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    err := h.adminService.SetAccountStatus(actor(r), accountID, req.Status, req.Reason)
+    if writeAccountStatusError(w, err) {
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminListHeldTransfers(w http.ResponseWriter, r *http.Request) {
+    held, err := h.adminService.ListHeldTransfers(actor(r), r.URL.Query().Get("status"))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(held)
+}
+
+func (h *Handler) AdminApproveHeldTransfer(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    tx, err := h.adminService.ApproveHeldTransfer(actor(r), id)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(tx)
+}
+
+func (h *Handler) AdminRejectHeldTransfer(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    reason, ok := decodeReason(w, r)
+    if !ok {
+        return
+    }
+    if err := h.adminService.RejectHeldTransfer(actor(r), id, reason); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminListAMLCases(w http.ResponseWriter, r *http.Request) {
+    cases, err := h.adminService.ListAMLCases(actor(r), r.URL.Query().Get("status"))
+    if errors.Is(err, services.ErrInvalidAMLCaseStatus) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(cases)
+}
+
+func (h *Handler) AdminExportAMLCases(w http.ResponseWriter, r *http.Request) {
+    since := time.Now().AddDate(0, 0, -30)
+    if v := r.URL.Query().Get("since"); v != "" {
+        parsed, err := time.Parse("2006-01-02", v)
+        if err != nil {
+            http.Error(w, "since must be YYYY-MM-DD", http.StatusBadRequest)
+            return
+        }
+        since = parsed
+    }
+    report, err := h.adminService.ExportAMLCases(actor(r), since)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    w.Header().Set("Content-Disposition", `attachment; filename="sar_`+since.Format("20060102")+`.csv"`)
+    w.WriteHeader(http.StatusOK)
+    w.Write(report)
+}
+
+func (h *Handler) AdminGetAMLCase(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    c, err := h.adminService.GetAMLCase(actor(r), id)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(c)
+}
+
+func (h *Handler) AdminCloseAMLCase(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    reason, ok := decodeReason(w, r)
+    if !ok {
+        return
+    }
+    if err := h.adminService.CloseAMLCase(actor(r), id, reason); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminListAudit(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    actorID, _ := strconv.Atoi(q.Get("actor_id"))
+    since := time.Now().AddDate(0, 0, -30)
+    if v := q.Get("since"); v != "" {
+        parsed, err := time.Parse("2006-01-02", v)
+        if err != nil {
+            http.Error(w, "since must be YYYY-MM-DD", http.StatusBadRequest)
+            return
+        }
+        since = parsed
+    }
+    limit := 100
+    if v := q.Get("limit"); v != "" {
+        parsed, err := strconv.Atoi(v)
+        if err != nil || parsed < 1 || parsed > 1000 {
+            http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+            return
+        }
+        limit = parsed
+    }
+    entries, err := h.adminService.ListAudit(actorID, since, limit)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(entries)
+}
@@ -2,10 +2,14 @@ package handlers
 
 import (
     "encoding/json"
+    "errors"
+    "log"
+    "math"
+    "net"
     "net/http"
     "strconv"
-    "strings"
 
+    "banking_service_project/middleware"
     "banking_service_project/services"
 )
 
@@ -17,9 +21,18 @@ type Handler struct {
     creditService   services.CreditService
     analyticsService services.AnalyticsService
     externalService services.ExternalService
+    rateService     services.RateService
+    scheduledTransferService services.ScheduledTransferService
+    limitService    services.LimitService
+    userService     services.UserService
+    adminService    services.AdminService
+    externalTransferService services.ExternalTransferService
+    webhookService  services.WebhookService
+    notificationService services.NotificationService
+    creditReminderService services.CreditReminderService
 }
 
-func NewHandler(authS services.AuthService, accountS services.AccountService, cardS services.CardService, transferS services.TransferService, creditS services.CreditService, analyticsS services.AnalyticsService, externalS services.ExternalService) *Handler {
+func NewHandler(authS services.AuthService, accountS services.AccountService, cardS services.CardService, transferS services.TransferService, creditS services.CreditService, analyticsS services.AnalyticsService, externalS services.ExternalService, rateS services.RateService, scheduledTransferS services.ScheduledTransferService, limitS services.LimitService, userS services.UserService, adminS services.AdminService, externalTransferS services.ExternalTransferService, webhookS services.WebhookService, notificationS services.NotificationService, creditReminderS services.CreditReminderService) *Handler {
     return &Handler{
         authService:      authS,
         accountService:   accountS,
@@ -28,6 +41,15 @@ func NewHandler(authS services.AuthService, accountS services.AccountService, ca
         creditService:    creditS,
         analyticsService: analyticsS,
         externalService:  externalS,
+        rateService:      rateS,
+        scheduledTransferService: scheduledTransferS,
+        limitService:     limitS,
+        userService:      userS,
+        adminService:     adminS,
+        externalTransferService: externalTransferS,
+        webhookService:   webhookS,
+        notificationService: notificationS,
+        creditReminderService: creditReminderS,
     }
 }
 
@@ -36,6 +58,8 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
         Username string `json:"username"`
         Email    string `json:"email"`
         Password string `json:"password"`
+        FullName string `json:"full_name"`
+        Phone    string `json:"phone"`
     }
     var req request
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -43,7 +67,10 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    user, err := h.authService.Register(req.Username, req.Email, req.Password)
+    user, err := h.authService.Register(req.Username, req.Email, req.Password, req.FullName, req.Phone)
+    if writePasswordPolicyError(w, err) {
+        return
+    }
     if err != nil {
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
@@ -62,162 +89,205 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "Invalid request", http.StatusBadRequest)
         return
     }
-    token, err := h.authService.Login(req.Email, req.Password)
-    if err != nil {
+    tokens, err := h.authService.Login(req.Email, req.Password, clientIP(r), r.UserAgent())
+    var mfaErr *services.MFARequiredError
+    if errors.As(err, &mfaErr) {
+        w.WriteHeader(http.StatusOK)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "mfa_required": true,
+            "mfa_token":    mfaErr.ChallengeToken,
+            "expires_in":   mfaErr.ExpiresIn,
+        })
+        return
+    }
+    if writeThrottled(w, err) {
+        return
+    }
+    if errors.Is(err, services.ErrInvalidCredentials) {
         http.Error(w, err.Error(), http.StatusUnauthorized)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"token": token})
-}
-
-func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    account, err := h.accountService.CreateAccount(userID)
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(account)
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(tokens)
+}
+
+// writePasswordPolicyError answers 400 with every broken rule if err is a PasswordPolicyError.
+func writePasswordPolicyError(w http.ResponseWriter, err error) bool {
+    var policyErr *services.PasswordPolicyError
+    if !errors.As(err, &policyErr) {
+        return false
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusBadRequest)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "error":      "password does not meet the policy",
+        "violations": policyErr.Violations,
+    })
+    return true
+}
+
+// writeThrottled answers 429 with Retry-After if err is a LoginThrottledError.
+func writeThrottled(w http.ResponseWriter, err error) bool {
+    var throttled *services.LoginThrottledError
+    if !errors.As(err, &throttled) {
+        return false
+    }
+    seconds := int(math.Ceil(throttled.RetryAfter.Seconds()))
+    w.Header().Set("Retry-After", strconv.Itoa(seconds))
+    http.Error(w, throttled.Error(), http.StatusTooManyRequests)
+    return true
 }
 
-func (h *Handler) GetUserAccounts(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    accounts, err := h.accountService.GetUserAccounts(userID)
+func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+    type request struct {
+        RefreshToken string `json:"refresh_token"`
+    }
+    var req request
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    tokens, err := h.authService.Refresh(req.RefreshToken)
+    if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) || errors.Is(err, services.ErrUserClosed) {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
     w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(accounts)
+    json.NewEncoder(w).Encode(tokens)
 }
 
-func (h *Handler) CreateCard(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    // For simplicity, assume accountID is passed as query parameter
-    accountIDStr := r.URL.Query().Get("account_id")
-    if accountIDStr == "" {
-        http.Error(w, "account_id is required", http.StatusBadRequest)
+// Logout revokes the access token of the request and, when the body carries it, the session's refresh token.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+    claims := middleware.Claims(r.Context())
+
+    type request struct {
+        RefreshToken string `json:"refresh_token"`
+    }
+    var req request
+    if r.ContentLength != 0 {
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            http.Error(w, "Invalid request", http.StatusBadRequest)
+            return
+        }
+    }
+    err := h.authService.Logout(claims.UserID, claims.ID, claims.ExpiresAt.Time, req.RefreshToken)
+    if errors.Is(err, services.ErrInvalidRefreshToken) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
-    accountID, _ := strconv.Atoi(accountIDStr)
-
-    card, err := h.cardService.CreateCard(accountID)
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(card)
+    w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) GetUserCards(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    // For simplicity, assume accountID is passed as query parameter
-    accountIDStr := r.URL.Query().Get("account_id")
-    if accountIDStr == "" {
-        http.Error(w, "account_id is required", http.StatusBadRequest)
-        return
-    }
-    accountID, _ := strconv.Atoi(accountIDStr)
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+    claims := middleware.Claims(r.Context())
 
-    cards, err := h.cardService.GetCards(accountID)
-    if err != nil {
+    if err := h.authService.LogoutAll(claims.UserID, claims.ID, claims.ExpiresAt.Time); err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(cards)
+    w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
     type request struct {
-        FromAccountID int     `json:"from_account_id"`
-        ToAccountID   int     `json:"to_account_id"`
-        Amount        float64 `json:"amount"`
+        Token string `json:"token"`
     }
     var req request
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
         http.Error(w, "Invalid request", http.StatusBadRequest)
         return
     }
-    tx, err := h.transferService.Transfer(req.FromAccountID, req.ToAccountID, req.Amount)
-    if err != nil {
+    err := h.authService.VerifyEmail(req.Token)
+    if errors.Is(err, services.ErrInvalidUserToken) {
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(tx)
-}
-
-func (h *Handler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    // For simplicity, fixed current month and year
-    stats, err := h.analyticsService.GetMonthlyStats(userID, int(time.Now().Month()), time.Now().Year())
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(stats)
+    w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) GetCreditSchedule(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    creditID, _ := strconv.Atoi(vars["creditId"])
-    schedule, err := h.creditService.GetSchedule(creditID)
+func (h *Handler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    err := h.authService.SendVerificationEmail(userID)
+    if errors.Is(err, services.ErrEmailAlreadyVerified) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(schedule)
+    w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) PredictBalance(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    accountID, _ := strconv.Atoi(vars["accountId"])
-    // For simplicity, days parameter as query
-    daysStr := r.URL.Query().Get("days")
-    days, _ := strconv.Atoi(daysStr)
-    prediction, err := h.analyticsService.PredictBalance(accountID, days)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+// ForgotPassword always answers 202 so the response does not tell whether the email is registered.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+    type request struct {
+        Email string `json:"email"`
+    }
+    var req request
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]float64{"prediction": prediction})
+    if err := h.authService.ForgotPassword(req.Email); err != nil {
+        log.Printf("Failed to send password reset email: %v", err)
+    }
+    w.WriteHeader(http.StatusAccepted)
 }
 
-func (h *Handler) ApplyCredit(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
     type request struct {
-        AccountID   int     `json:"account_id"`
-        Principal   float64 `json:"principal"`
-        AnnualRate  float64 `json:"annual_rate"`
-        TermMonths  int     `json:"term_months"`
+        Token    string `json:"token"`
+        Password string `json:"password"`
     }
     var req request
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Password == "" {
         http.Error(w, "Invalid request", http.StatusBadRequest)
         return
     }
-    credit, schedule, err := h.creditService.ApplyCredit(req.AccountID, req.Principal, req.AnnualRate, req.TermMonths)
-    if err != nil {
+    err := h.authService.ResetPassword(req.Token, req.Password)
+    if writePasswordPolicyError(w, err) {
+        return
+    }
+    if errors.Is(err, services.ErrInvalidUserToken) {
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(map[string]interface{}{
-        "credit":   credit,
-        "schedule": schedule,
-    })
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// GetJWKS publishes the public keys that access tokens can be verified with.
+func (h *Handler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "public, max-age=300")
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(h.authService.JWKS())
+}
+
+func clientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
 }
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+
+    "banking_service_project/middleware"
+    "banking_service_project/services"
+)
+
+func (h *Handler) CreateExternalTransfer(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    type request struct {
+        services.ExternalTransferRequest
+        FromAccountNumber string `json:"from_account_number"`
+    }
+    var req request
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    fromAccountID, ok := h.bodyAccount(w, req.FromAccountID, req.FromAccountNumber)
+    if !ok {
+        return
+    }
+    req.FromAccountID = fromAccountID
+
+    // Ownership comes first, so the second-factor answer reveals nothing about other users' accounts
+    acc, err := h.accountService.GetAccountByID(fromAccountID)
+    if err != nil || acc.UserID != userID {
+        http.Error(w, "from account not found", http.StatusBadRequest)
+        return
+    }
+
+    needsOTP, err := h.transferService.RequiresSecondFactor(fromAccountID, 0, req.Amount)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if needsOTP && !h.requireSecondFactor(w, r, userID) {
+        return
+    }
+
+    transfer, err := h.externalTransferService.Create(userID, req.ExternalTransferRequest)
+    if errors.Is(err, services.ErrExternalTransfersDisabled) {
+        http.Error(w, err.Error(), http.StatusServiceUnavailable)
+        return
+    }
+    var heldErr *services.TransferHeldError
+    if errors.As(err, &heldErr) {
+        w.WriteHeader(http.StatusAccepted)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status":           "held_for_review",
+            "held_transfer_id": heldErr.HeldTransferID,
+        })
+        return
+    }
+    if errors.Is(err, services.ErrTransferBlocked) || errors.Is(err, services.ErrEmailNotVerified) || errors.Is(err, services.ErrDepositLocked) {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if writeAccountStatusError(w, err) || writeLimitError(w, err) {
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusAccepted)
+    json.NewEncoder(w).Encode(transfer)
+}
+
+func (h *Handler) GetExternalTransfers(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    transfers, err := h.externalTransferService.List(userID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(transfers)
+}
+
+func (h *Handler) GetExternalTransfer(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    transfer, err := h.externalTransferService.Get(userID, id)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(transfer)
+}
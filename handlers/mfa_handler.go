@@ -0,0 +1,133 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+
+    "banking_service_project/middleware"
+    "banking_service_project/services"
+)
+
+// otpHeader carries the TOTP code for operations that require a second factor.
+const otpHeader = "X-OTP-Code"
+
+func (h *Handler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+    type request struct {
+        MFAToken     string `json:"mfa_token"`
+        Code         string `json:"code"`
+        RecoveryCode string `json:"recovery_code"`
+    }
+    var req request
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    tokens, err := h.authService.CompleteMFALogin(req.MFAToken, req.Code, req.RecoveryCode, clientIP(r), r.UserAgent())
+    if writeThrottled(w, err) {
+        return
+    }
+    if errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrInvalidMFACode) {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(tokens)
+}
+
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    enrollment, err := h.authService.EnrollTOTP(userID)
+    if errors.Is(err, services.ErrTOTPAlreadyEnabled) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(enrollment)
+}
+
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    type request struct {
+        Code string `json:"code"`
+    }
+    var req request
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    codes, err := h.authService.ConfirmTOTP(userID, req.Code)
+    if errors.Is(err, services.ErrTOTPAlreadyEnabled) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if errors.Is(err, services.ErrTOTPNotEnrolled) || errors.Is(err, services.ErrInvalidMFACode) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    codes, err := h.authService.RegenerateRecoveryCodes(userID, r.Header.Get(otpHeader))
+    if errors.Is(err, services.ErrMFARequired) || errors.Is(err, services.ErrInvalidMFACode) {
+        writeSecondFactorError(w, err)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// requireSecondFactor checks the TOTP or emailed code from the request header and writes the error
+// response if it is missing or wrong.
+func (h *Handler) requireSecondFactor(w http.ResponseWriter, r *http.Request, userID int) bool {
+    err := h.authService.VerifySecondFactor(userID, r.Header.Get(otpHeader))
+    if errors.Is(err, services.ErrMFARequired) || errors.Is(err, services.ErrInvalidMFACode) ||
+        errors.Is(err, services.ErrOperationCodeSent) || errors.Is(err, services.ErrInvalidOperationCode) {
+        writeSecondFactorError(w, err)
+        return false
+    }
+    if errors.Is(err, services.ErrEmailNotVerified) {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return false
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return false
+    }
+    return true
+}
+
+// writeSecondFactorError tells the client which code to send: from the authenticator app ("totp")
+// or from the email just sent ("email").
+func writeSecondFactorError(w http.ResponseWriter, err error) {
+    method := "totp"
+    if errors.Is(err, services.ErrOperationCodeSent) || errors.Is(err, services.ErrInvalidOperationCode) {
+        method = "email"
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusForbidden)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "error":        err.Error(),
+        "mfa_required": true,
+        "mfa_method":   method,
+    })
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+
+    "banking_service_project/middleware"
+    "banking_service_project/models"
+    "banking_service_project/services"
+)
+
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    user, err := h.userService.GetProfile(userID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(user)
+}
+
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    var req services.ProfileUpdate
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    user, err := h.userService.UpdateProfile(userID, req)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(user)
+}
+
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+    claims := middleware.Claims(r.Context())
+    type request struct {
+        CurrentPassword string `json:"current_password"`
+        NewPassword     string `json:"new_password"`
+    }
+    var req request
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewPassword == "" {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    err := h.userService.ChangePassword(claims.UserID, claims.SessionID, req.CurrentPassword, req.NewPassword)
+    if writePasswordPolicyError(w, err) {
+        return
+    }
+    if errors.Is(err, services.ErrInvalidCredentials) {
+        http.Error(w, "current password is incorrect", http.StatusForbidden)
+        return
+    }
+    if errors.Is(err, services.ErrSamePassword) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) CloseProfile(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    type request struct {
+        Password string `json:"password"`
+    }
+    var req request
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    err := h.userService.CloseProfile(userID, req.Password)
+    if errors.Is(err, services.ErrInvalidCredentials) {
+        http.Error(w, "password is incorrect", http.StatusForbidden)
+        return
+    }
+    if errors.Is(err, services.ErrNonZeroBalance) || errors.Is(err, services.ErrOpenCredits) || errors.Is(err, services.ErrAccountHasTransfers) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    prefs, err := h.notificationService.GetPreferences(userID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(prefs)
+}
+
+func (h *Handler) SetNotificationPreference(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    var req models.NotificationPreference
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    err := h.notificationService.SetPreference(userID, req.Category, req.Channel, req.Enabled)
+    if errors.Is(err, services.ErrMandatoryNotification) {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    h.GetNotificationPreferences(w, r)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+func (h *Handler) GetRates(w http.ResponseWriter, r *http.Request) {
+    date := time.Now()
+    if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+        parsed, err := time.Parse("2006-01-02", dateStr)
+        if err != nil {
+            http.Error(w, "date must be in YYYY-MM-DD format", http.StatusBadRequest)
+            return
+        }
+        date = parsed
+    }
+    rates, err := h.rateService.GetRates(date)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "date":  date.Format("2006-01-02"),
+        "rates": rates,
+    })
+}
+
+func (h *Handler) GetRateHistory(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    // For simplicity, default to the last 30 days
+    to := time.Now()
+    from := to.AddDate(0, 0, -30)
+    var err error
+    if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+        if from, err = time.Parse("2006-01-02", fromStr); err != nil {
+            http.Error(w, "from must be in YYYY-MM-DD format", http.StatusBadRequest)
+            return
+        }
+    }
+    if toStr := r.URL.Query().Get("to"); toStr != "" {
+        if to, err = time.Parse("2006-01-02", toStr); err != nil {
+            http.Error(w, "to must be in YYYY-MM-DD format", http.StatusBadRequest)
+            return
+        }
+    }
+    history, err := h.rateService.GetHistory(vars["currency"], from, to)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(history)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+
+    "banking_service_project/middleware"
+    "banking_service_project/models"
+)
+
+func (h *Handler) CreateScheduledTransfer(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+
+    type request struct {
+        FromAccountID     int        `json:"from_account_id"`
+        FromAccountNumber string     `json:"from_account_number"`
+        ToAccountID       int        `json:"to_account_id"`
+        ToAccountNumber   string     `json:"to_account_number"`
+        Amount            float64    `json:"amount"`
+        Frequency         string     `json:"frequency"`
+        StartAt           time.Time  `json:"start_at"`
+        DayOfMonth        int        `json:"day_of_month"`
+        EndDate           *time.Time `json:"end_date"`
+    }
+    var req request
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    fromAccountID, ok := h.bodyAccount(w, req.FromAccountID, req.FromAccountNumber)
+    if !ok {
+        return
+    }
+    toAccountID, ok := h.bodyAccount(w, req.ToAccountID, req.ToAccountNumber)
+    if !ok {
+        return
+    }
+
+    // Runs happen without the user, so the second factor is asked for when the transfer is set up
+    acc, err := h.accountService.GetAccountByID(fromAccountID)
+    if err != nil || acc.UserID != userID {
+        http.Error(w, "from account not found", http.StatusBadRequest)
+        return
+    }
+    needsOTP, err := h.transferService.RequiresSecondFactor(fromAccountID, toAccountID, req.Amount)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if needsOTP && !h.requireSecondFactor(w, r, userID) {
+        return
+    }
+
+    st := &models.ScheduledTransfer{
+        FromAccountID: fromAccountID,
+        ToAccountID:   toAccountID,
+        Amount:        req.Amount,
+        Frequency:     req.Frequency,
+        DayOfMonth:    req.DayOfMonth,
+        NextRunAt:     req.StartAt,
+        EndDate:       req.EndDate,
+    }
+    if err := h.scheduledTransferService.Create(userID, st); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(st)
+}
+
+func (h *Handler) GetScheduledTransfers(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    transfers, err := h.scheduledTransferService.List(userID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(transfers)
+}
+
+func (h *Handler) GetScheduledTransferRuns(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    runs, err := h.scheduledTransferService.GetRuns(userID, id)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(runs)
+}
+
+func (h *Handler) CancelScheduledTransfer(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    if err := h.scheduledTransferService.Cancel(userID, id); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ResumeScheduledTransfer(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    if err := h.scheduledTransferService.Resume(userID, id); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -2,222 +2,135 @@ package handlers
 
 import (
     "encoding/json"
+    "errors"
     "net/http"
-    "strconv"
-    "strings"
 
+    "banking_service_project/middleware"
+    "banking_service_project/models"
     "banking_service_project/services"
 )
 
-type Handler struct {
-    authService     services.AuthService
-    accountService  services.AccountService
-    cardService     services.CardService
-    transferService services.TransferService
-    creditService   services.CreditService
-    analyticsService services.AnalyticsService
-    externalService services.ExternalService
-}
-
-func NewHandler(authS services.AuthService, accountS services.AccountService, cardS services.CardService, transferS services.TransferService, creditS services.CreditService, analyticsS services.AnalyticsService, externalS services.ExternalService) *Handler {
-    return &Handler{
-        authService:      authS,
-        accountService:   accountS,
-        cardService:      cardS,
-        transferService:  transferS,
-        creditService:    creditS,
-        analyticsService: analyticsS,
-        externalService:  externalS,
-    }
-}
+func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
 
-func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+    // The recipient is either a raw account id or a username, email, phone number or account number
     type request struct {
-        Username string `json:"username"`
-        Email    string `json:"email"`
-        Password string `json:"password"`
+        FromAccountID     int     `json:"from_account_id"`
+        FromAccountNumber string  `json:"from_account_number"`
+        ToAccountID       int     `json:"to_account_id"`
+        Recipient         string  `json:"recipient"`
+        Amount            float64 `json:"amount"`
     }
     var req request
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
         http.Error(w, "Invalid request", http.StatusBadRequest)
         return
     }
-
-    user, err := h.authService.Register(req.Username, req.Email, req.Password)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
+    fromAccountID, ok := h.bodyAccount(w, req.FromAccountID, req.FromAccountNumber)
+    if !ok {
         return
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(user)
-}
 
-func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-    type request struct {
-        Email    string `json:"email"`
-        Password string `json:"password"`
-    }
-    var req request
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request", http.StatusBadRequest)
+    // Ownership comes first, so the second-factor answer reveals nothing about other users' accounts
+    acc, err := h.accountService.GetAccountByID(fromAccountID)
+    if err != nil || acc.UserID != userID {
+        http.Error(w, "from account not found", http.StatusBadRequest)
         return
     }
-    token, err := h.authService.Login(req.Email, req.Password)
+
+    toAccountID := req.ToAccountID
+    if req.Recipient != "" {
+        toAccountID = 0
+    }
+    needsOTP, err := h.transferService.RequiresSecondFactor(fromAccountID, toAccountID, req.Amount)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusUnauthorized)
+        http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"token": token})
-}
-
-func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    account, err := h.accountService.CreateAccount(userID)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    if needsOTP && !h.requireSecondFactor(w, r, userID) {
         return
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(account)
-}
 
-func (h *Handler) GetUserAccounts(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    accounts, err := h.accountService.GetUserAccounts(userID)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    var tx *models.Transaction
+    if req.Recipient != "" {
+        tx, err = h.transferService.TransferToRecipient(userID, fromAccountID, req.Recipient, req.Amount)
+    } else {
+        tx, err = h.transferService.Transfer(fromAccountID, req.ToAccountID, req.Amount)
+    }
+    var heldErr *services.TransferHeldError
+    if errors.As(err, &heldErr) {
+        w.WriteHeader(http.StatusAccepted)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status":           "held_for_review",
+            "held_transfer_id": heldErr.HeldTransferID,
+        })
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(accounts)
-}
-
-func (h *Handler) CreateCard(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    // For simplicity, assume accountID is passed as query parameter
-    accountIDStr := r.URL.Query().Get("account_id")
-    if accountIDStr == "" {
-        http.Error(w, "account_id is required", http.StatusBadRequest)
+    if errors.Is(err, services.ErrTransferBlocked) || errors.Is(err, services.ErrEmailNotVerified) || errors.Is(err, services.ErrDepositLocked) {
+        http.Error(w, err.Error(), http.StatusForbidden)
         return
     }
-    accountID, _ := strconv.Atoi(accountIDStr)
-
-    card, err := h.cardService.CreateCard(accountID)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    if writeAccountStatusError(w, err) {
         return
     }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(card)
-}
-
-func (h *Handler) GetUserCards(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    // For simplicity, assume accountID is passed as query parameter
-    accountIDStr := r.URL.Query().Get("account_id")
-    if accountIDStr == "" {
-        http.Error(w, "account_id is required", http.StatusBadRequest)
+    if writeLimitError(w, err) {
         return
     }
-    accountID, _ := strconv.Atoi(accountIDStr)
-
-    cards, err := h.cardService.GetCards(accountID)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
     w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(cards)
+    json.NewEncoder(w).Encode(tx)
 }
 
-func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
+// writeLimitError answers 422 with the limit details if err is a LimitError.
+func writeLimitError(w http.ResponseWriter, err error) bool {
+    var limitErr *services.LimitError
+    if !errors.As(err, &limitErr) {
+        return false
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusUnprocessableEntity)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "error":      limitErr.Error(),
+        "limit_type": limitErr.Type,
+        "limit":      limitErr.Limit,
+        "remaining":  limitErr.Remaining,
+        "currency":   limitErr.Currency,
+    })
+    return true
+}
 
+func (h *Handler) PreviewTransfer(w http.ResponseWriter, r *http.Request) {
     type request struct {
-        FromAccountID int     `json:"from_account_id"`
-        ToAccountID   int     `json:"to_account_id"`
-        Amount        float64 `json:"amount"`
+        Recipient string `json:"recipient"`
     }
     var req request
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
         http.Error(w, "Invalid request", http.StatusBadRequest)
         return
     }
-    tx, err := h.transferService.Transfer(req.FromAccountID, req.ToAccountID, req.Amount)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
-    }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(tx)
-}
-
-func (h *Handler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
-    userIDStr := r.Context().Value("userID").(string)
-    userID, _ := strconv.Atoi(userIDStr)
-    // For simplicity, fixed current month and year
-    stats, err := h.analyticsService.GetMonthlyStats(userID, int(time.Now().Month()), time.Now().Year())
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    preview, err := h.transferService.PreviewRecipient(req.Recipient)
+    if errors.Is(err, services.ErrRecipientNotFound) {
+        http.Error(w, err.Error(), http.StatusNotFound)
         return
     }
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(stats)
-}
-
-func (h *Handler) GetCreditSchedule(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    creditID, _ := strconv.Atoi(vars["creditId"])
-    schedule, err := h.creditService.GetSchedule(creditID)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
     w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(schedule)
+    json.NewEncoder(w).Encode(preview)
 }
 
-func (h *Handler) PredictBalance(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    accountID, _ := strconv.Atoi(vars["accountId"])
-    // For simplicity, days parameter as query
-    daysStr := r.URL.Query().Get("days")
-    days, _ := strconv.Atoi(daysStr)
-    prediction, err := h.analyticsService.PredictBalance(accountID, days)
+func (h *Handler) GetTransferLimits(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    usage, err := h.limitService.GetUsage(userID)
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
     w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]float64{"prediction": prediction})
-}
-
-func (h *Handler) ApplyCredit(w http.ResponseWriter, r *http.Request) {
-    type request struct {
-        AccountID   int     `json:"account_id"`
-        Principal   float64 `json:"principal"`
-        AnnualRate  float64 `json:"annual_rate"`
-        TermMonths  int     `json:"term_months"`
-    }
-    var req request
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request", http.StatusBadRequest)
-        return
-    }
-    credit, schedule, err := h.creditService.ApplyCredit(req.AccountID, req.Principal, req.AnnualRate, req.TermMonths)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
-    }
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(map[string]interface{}{
-        "credit":   credit,
-        "schedule": schedule,
-    })
+    json.NewEncoder(w).Encode(usage)
 }
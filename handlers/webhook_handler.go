@@ -0,0 +1,131 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+
+    "banking_service_project/middleware"
+    "banking_service_project/models"
+)
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    var req struct {
+        URL        string   `json:"url"`
+        EventTypes []string `json:"event_types"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request", http.StatusBadRequest)
+        return
+    }
+    endpoint, err := h.webhookService.CreateEndpoint(userID, req.URL, req.EventTypes)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(endpoint)
+}
+
+func (h *Handler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    endpoints, err := h.webhookService.ListEndpoints(userID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(endpoints)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    if err := h.webhookService.DeleteEndpoint(userID, id); err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) EnableWebhook(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    endpoint, err := h.webhookService.EnableEndpoint(userID, id)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(endpoint)
+}
+
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    limit := 50
+    if v := r.URL.Query().Get("limit"); v != "" {
+        parsed, err := strconv.Atoi(v)
+        if err != nil || parsed < 1 || parsed > 500 {
+            http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+            return
+        }
+        limit = parsed
+    }
+    deliveries, err := h.webhookService.ListDeliveries(userID, id, limit)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(deliveries)
+}
+
+func (h *Handler) GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    deliveryID, ok := pathID(w, r, "deliveryId")
+    if !ok {
+        return
+    }
+    delivery, attempts, err := h.webhookService.GetDelivery(userID, id, deliveryID)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(struct {
+        *models.WebhookDelivery
+        AttemptLog []models.WebhookAttempt `json:"attempt_log"`
+    }{delivery, attempts})
+}
+
+func (h *Handler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+    userID := middleware.UserID(r.Context())
+    id, ok := pathID(w, r, "id")
+    if !ok {
+        return
+    }
+    deliveryID, ok := pathID(w, r, "deliveryId")
+    if !ok {
+        return
+    }
+    if err := h.webhookService.Redeliver(userID, id, deliveryID); err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    w.WriteHeader(http.StatusAccepted)
+}
@@ -5,30 +5,101 @@ import (
     "log"
     "net/http"
     "os"
+    "strconv"
     "time"
 
     "github.com/gorilla/mux"
     _ "github.com/lib/pq"
 
+    "banking_service_project/fraud"
     "banking_service_project/handlers"
     "banking_service_project/middleware"
+    "banking_service_project/models"
     "banking_service_project/repositories"
     "banking_service_project/services"
+    "banking_service_project/utils"
 )
 
 func main() {
     // Load environment variables
     dbURL := os.Getenv("DATABASE_URL")
-    jwtSecret := os.Getenv("JWT_SECRET")
+    jwtKeysDir := os.Getenv("JWT_KEYS_DIR")
     pgpPrivateKeyPath := os.Getenv("PGP_PRIVATE_KEY_PATH")
     pgpPublicKeyPath := os.Getenv("PGP_PUBLIC_KEY_PATH")
     smtpHost := os.Getenv("SMTP_HOST")
     smtpPort := os.Getenv("SMTP_PORT")
     smtpUser := os.Getenv("SMTP_USER")
     smtpPass := os.Getenv("SMTP_PASS")
+    amlExportDir := os.Getenv("AML_EXPORT_DIR")
+    appBaseURL := os.Getenv("APP_BASE_URL")
+    bankBIC := os.Getenv("BANK_BIC")
+    clearingDir := os.Getenv("CLEARING_DIR")
+    transferNotifyThreshold := 1000.0
+    if v := os.Getenv("TRANSFER_NOTIFY_THRESHOLD"); v != "" {
+        parsed, err := strconv.ParseFloat(v, 64)
+        if err != nil || parsed < 0 {
+            log.Fatal("TRANSFER_NOTIFY_THRESHOLD must be a non-negative amount in rubles")
+        }
+        transferNotifyThreshold = parsed
+    }
+    creditReminderDays := 3
+    if v := os.Getenv("CREDIT_REMINDER_DAYS"); v != "" {
+        parsed, err := strconv.Atoi(v)
+        if err != nil || parsed < 1 {
+            log.Fatal("CREDIT_REMINDER_DAYS must be a positive number of days")
+        }
+        creditReminderDays = parsed
+    }
+    fxSpread := 1.0
+    if v := os.Getenv("FX_SPREAD"); v != "" {
+        parsed, err := strconv.ParseFloat(v, 64)
+        if err != nil || parsed < 0 || parsed >= 100 {
+            log.Fatal("FX_SPREAD must be a percentage between 0 and 100")
+        }
+        fxSpread = parsed
+    }
+    jwtKeyOverlap := time.Hour
+    if v := os.Getenv("JWT_KEY_OVERLAP"); v != "" {
+        parsed, err := time.ParseDuration(v)
+        if err != nil || parsed < 0 {
+            log.Fatal("JWT_KEY_OVERLAP must be a non-negative duration, e.g. 1h")
+        }
+        jwtKeyOverlap = parsed
+    }
+
+    passwordPolicy := &services.PasswordPolicy{MinLength: 10, MinCharClasses: 3}
+    if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+        parsed, err := strconv.Atoi(v)
+        if err != nil || parsed < 1 {
+            log.Fatal("PASSWORD_MIN_LENGTH must be a positive integer")
+        }
+        passwordPolicy.MinLength = parsed
+    }
+    if v := os.Getenv("PASSWORD_MIN_CHAR_CLASSES"); v != "" {
+        parsed, err := strconv.Atoi(v)
+        if err != nil || parsed < 1 || parsed > 4 {
+            log.Fatal("PASSWORD_MIN_CHAR_CLASSES must be between 1 and 4")
+        }
+        passwordPolicy.MinCharClasses = parsed
+    }
+    if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+        breached, err := utils.LoadBreachedPasswords(path)
+        if err != nil {
+            log.Fatalf("Error loading breached passwords: %v", err)
+        }
+        log.Printf("Loaded %d breached password hashes", breached.Len())
+        passwordPolicy.Breached = breached
+    }
 
-    if dbURL == "" || jwtSecret == "" {
-        log.Fatal("DATABASE_URL and JWT_SECRET must be set")
+    if dbURL == "" || jwtKeysDir == "" {
+        log.Fatal("DATABASE_URL and JWT_KEYS_DIR must be set")
+    }
+    if !utils.ValidBIC(bankBIC) {
+        log.Fatal("BANK_BIC must be set to the bank's 9-digit BIC")
+    }
+    keyRing, err := utils.LoadKeyRing(jwtKeysDir, jwtKeyOverlap)
+    if err != nil {
+        log.Fatalf("Error loading JWT signing keys: %v", err)
     }
 
     // Connect to Postgres
@@ -45,22 +116,92 @@ func main() {
     // Initialize repositories
     userRepo := repositories.NewUserRepository(db)
     accountRepo := repositories.NewAccountRepository(db)
+    accountProductRepo := repositories.NewAccountProductRepository(db)
+    externalTransferRepo := repositories.NewExternalTransferRepository(db)
     cardRepo := repositories.NewCardRepository(db)
     transactionRepo := repositories.NewTransactionRepository(db)
     creditRepo := repositories.NewCreditRepository(db)
     scheduleRepo := repositories.NewPaymentScheduleRepository(db)
+    fxRateRepo := repositories.NewFXRateRepository(db)
+    scheduledTransferRepo := repositories.NewScheduledTransferRepository(db)
+    transferLimitRepo := repositories.NewTransferLimitRepository(db)
+    loginEventRepo := repositories.NewLoginEventRepository(db)
+    heldTransferRepo := repositories.NewHeldTransferRepository(db)
+    amlCaseRepo := repositories.NewAMLCaseRepository(db)
+    auditRepo := repositories.NewAuditRepository(db)
+    tokenRepo := repositories.NewTokenRepository(db)
+    recoveryCodeRepo := repositories.NewRecoveryCodeRepository(db)
+    userTokenRepo := repositories.NewUserTokenRepository(db)
+    loginThrottleRepo := repositories.NewLoginThrottleRepository(db)
+    outboxRepo := repositories.NewOutboxRepository(db)
+    webhookRepo := repositories.NewWebhookRepository(db)
+    notificationRepo := repositories.NewNotificationRepository(db)
+    transferDigestRepo := repositories.NewTransferDigestRepository(db)
+    creditCommunicationRepo := repositories.NewCreditCommunicationRepository(db)
+    store := repositories.NewStore(db)
 
     // Initialize services
-    authService := services.NewAuthService(userRepo, jwtSecret)
-    accountService := services.NewAccountService(accountRepo, transactionRepo)
-    cardService := services.NewCardService(cardRepo, accountRepo, pgpPublicKeyPath, pgpPrivateKeyPath)
-    transferService := services.NewTransferService(accountRepo, transactionRepo)
-    creditService := services.NewCreditService(creditRepo, scheduleRepo, accountRepo)
-    analyticsService := services.NewAnalyticsService(transactionRepo)
+    eventDispatcher := services.NewEventDispatcher(outboxRepo)
     externalService := services.NewExternalService(smtpHost, smtpPort, smtpUser, smtpPass, pgpPublicKeyPath, pgpPrivateKeyPath)
+    emailChannel := services.NewEmailChannel(externalService)
+    if path := os.Getenv("NOTIFICATION_LOG_FILE"); path != "" {
+        emailChannel = services.NewFileChannel(emailChannel, path)
+    }
+    notificationService, err := services.NewNotificationService(notificationRepo, userRepo, emailChannel)
+    if err != nil {
+        log.Fatalf("Error loading notification templates: %v", err)
+    }
+    authService := services.NewAuthService(userRepo, loginEventRepo, tokenRepo, recoveryCodeRepo, userTokenRepo, loginThrottleRepo, notificationService, keyRing, passwordPolicy, appBaseURL)
+    userService := services.NewUserService(userRepo, tokenRepo, store, authService, notificationService, passwordPolicy)
+    cardService := services.NewCardService(cardRepo, accountRepo, store, pgpPublicKeyPath, pgpPrivateKeyPath)
+    rateService := services.NewRateService(fxRateRepo, externalService)
+    limitService := services.NewLimitService(transferLimitRepo, userRepo, accountRepo, transactionRepo, rateService)
+    fraudEngine := fraud.NewEngine(fraud.DefaultRules(services.NewFraudHistory(transactionRepo, userRepo, loginEventRepo, externalTransferRepo, rateService))...)
+    transferService := services.NewTransferService(accountRepo, userRepo, heldTransferRepo, limitService, fraudEngine, rateService, store, fxSpread)
+    interestService := services.NewInterestService(accountRepo, accountProductRepo, externalService, store)
+    accountService := services.NewAccountService(accountRepo, transactionRepo, userRepo, creditRepo, accountProductRepo, externalTransferRepo, transferService, interestService, store, bankBIC)
+    creditService := services.NewCreditService(creditRepo, scheduleRepo, accountRepo, store)
+    creditReminderService := services.NewCreditReminderService(scheduleRepo, creditRepo, accountRepo, creditCommunicationRepo, notificationService, creditReminderDays)
+    analyticsService := services.NewAnalyticsService(transactionRepo)
+    scheduledTransferService := services.NewScheduledTransferService(scheduledTransferRepo, accountRepo, userRepo, transferService, notificationService)
+    amlService := services.NewAMLService(amlCaseRepo, transactionRepo, accountRepo, externalTransferRepo, rateService, store)
+    var clearingGateway services.ClearingGateway
+    if clearingDir != "" {
+        clearingGateway, err = services.NewFileClearingGateway(clearingDir, os.Getenv("CLEARING_AUTO_SETTLE") == "true")
+        if err != nil {
+            log.Fatalf("Error setting up the clearing gateway: %v", err)
+        }
+    }
+    externalTransferService := services.NewExternalTransferService(externalTransferRepo, accountRepo, userRepo, limitService, fraudEngine, store, clearingGateway, bankBIC)
+    adminService := services.NewAdminService(userRepo, accountRepo, transactionRepo, auditRepo, accountService, transferService, amlService, store)
+
+    if err := accountService.AssignMissingNumbers(); err != nil {
+        log.Fatalf("Error assigning account numbers: %v", err)
+    }
+
+    webhookService := services.NewWebhookService(webhookRepo, externalService, os.Getenv("WEBHOOK_ALLOW_INSECURE") == "true")
+    for _, eventType := range services.WebhookEventTypes {
+        eventDispatcher.Subscribe(eventType, "webhooks", webhookService.HandleEvent)
+    }
+    transferNotifier := services.NewTransferNotifier(notificationService, transferDigestRepo, accountRepo, userRepo, rateService, transferNotifyThreshold)
+    eventDispatcher.Subscribe(services.EventTransferCompleted, "transfer_notifications", transferNotifier.HandleEvent)
+
+    // Background jobs
+    keyRing.StartReload(time.Minute)
+    rateService.StartIngestion(6 * time.Hour)
+    scheduledTransferService.StartWorker(time.Minute)
+    amlService.StartMonitoring(24*time.Hour, amlExportDir)
+    interestService.StartAccrual(time.Hour)
+    externalTransferService.StartWorker(time.Minute)
+    creditService.StartOverdueCheck(time.Hour)
+    creditReminderService.StartReminders(time.Hour)
+    eventDispatcher.StartWorker(5 * time.Second)
+    notificationService.StartWorker(30 * time.Second)
+    transferNotifier.StartDigests(time.Hour)
+    webhookService.StartWorker(10 * time.Second)
 
     // Initialize handlers
-    h := handlers.NewHandler(authService, accountService, cardService, transferService, creditService, analyticsService, externalService)
+    h := handlers.NewHandler(authService, accountService, cardService, transferService, creditService, analyticsService, externalService, rateService, scheduledTransferService, limitService, userService, adminService, externalTransferService, webhookService, notificationService, creditReminderService)
 
     // Setup router
     r := mux.NewRouter()
@@ -68,20 +209,84 @@ func main() {
     // Public routes
     r.HandleFunc("/register", h.Register).Methods("POST")
     r.HandleFunc("/login", h.Login).Methods("POST")
+    r.HandleFunc("/login/mfa", h.LoginMFA).Methods("POST")
+    r.HandleFunc("/token/refresh", h.RefreshToken).Methods("POST")
+    r.HandleFunc("/email/verify", h.VerifyEmail).Methods("POST")
+    r.HandleFunc("/password/forgot", h.ForgotPassword).Methods("POST")
+    r.HandleFunc("/password/reset", h.ResetPassword).Methods("POST")
+    r.HandleFunc("/rates", h.GetRates).Methods("GET")
+    r.HandleFunc("/rates/{currency}/history", h.GetRateHistory).Methods("GET")
+    r.HandleFunc("/.well-known/jwks.json", h.GetJWKS).Methods("GET")
 
     // Protected routes
     authRouter := r.PathPrefix("/").Subrouter()
-    authRouter.Use(middleware.AuthMiddleware(jwtSecret))
+    authRouter.Use(middleware.AuthMiddleware(authService))
+
+    authRouter.HandleFunc("/logout", h.Logout).Methods("POST")
+    authRouter.HandleFunc("/logout/all", h.LogoutAll).Methods("POST")
+    authRouter.HandleFunc("/email/verify/resend", h.ResendVerificationEmail).Methods("POST")
+    authRouter.HandleFunc("/me", h.GetProfile).Methods("GET")
+    authRouter.HandleFunc("/me", h.UpdateProfile).Methods("PATCH")
+    authRouter.HandleFunc("/me/password", h.ChangePassword).Methods("POST")
+    authRouter.HandleFunc("/me/close", h.CloseProfile).Methods("POST")
+    authRouter.HandleFunc("/me/notifications", h.GetNotificationPreferences).Methods("GET")
+    authRouter.HandleFunc("/me/notifications", h.SetNotificationPreference).Methods("PUT")
+    authRouter.HandleFunc("/2fa/enroll", h.EnrollTOTP).Methods("POST")
+    authRouter.HandleFunc("/2fa/confirm", h.ConfirmTOTP).Methods("POST")
+    authRouter.HandleFunc("/2fa/recovery-codes", h.RegenerateRecoveryCodes).Methods("POST")
 
     authRouter.HandleFunc("/accounts", h.CreateAccount).Methods("POST")
     authRouter.HandleFunc("/accounts", h.GetUserAccounts).Methods("GET")
+    authRouter.HandleFunc("/account-products", h.GetAccountProducts).Methods("GET")
     authRouter.HandleFunc("/cards", h.CreateCard).Methods("POST")
     authRouter.HandleFunc("/cards", h.GetUserCards).Methods("GET")
+    authRouter.HandleFunc("/cards/{cardId}/reveal", h.RevealCard).Methods("POST")
+    authRouter.HandleFunc("/accounts/{accountId}/default", h.SetDefaultAccount).Methods("PUT")
+    authRouter.HandleFunc("/accounts/{accountId}/close", h.CloseAccount).Methods("POST")
     authRouter.HandleFunc("/transfer", h.Transfer).Methods("POST")
+    authRouter.HandleFunc("/transfer/preview", h.PreviewTransfer).Methods("POST")
+    authRouter.HandleFunc("/transfers/external", h.CreateExternalTransfer).Methods("POST")
+    authRouter.HandleFunc("/transfers/external", h.GetExternalTransfers).Methods("GET")
+    authRouter.HandleFunc("/transfers/external/{id}", h.GetExternalTransfer).Methods("GET")
+    authRouter.HandleFunc("/limits", h.GetTransferLimits).Methods("GET")
+    authRouter.HandleFunc("/webhooks", h.CreateWebhook).Methods("POST")
+    authRouter.HandleFunc("/webhooks", h.GetWebhooks).Methods("GET")
+    authRouter.HandleFunc("/webhooks/{id}", h.DeleteWebhook).Methods("DELETE")
+    authRouter.HandleFunc("/webhooks/{id}/enable", h.EnableWebhook).Methods("POST")
+    authRouter.HandleFunc("/webhooks/{id}/deliveries", h.GetWebhookDeliveries).Methods("GET")
+    authRouter.HandleFunc("/webhooks/{id}/deliveries/{deliveryId}", h.GetWebhookDelivery).Methods("GET")
+    authRouter.HandleFunc("/webhooks/{id}/deliveries/{deliveryId}/redeliver", h.RedeliverWebhook).Methods("POST")
+    authRouter.HandleFunc("/scheduled-transfers", h.CreateScheduledTransfer).Methods("POST")
+    authRouter.HandleFunc("/scheduled-transfers", h.GetScheduledTransfers).Methods("GET")
+    authRouter.HandleFunc("/scheduled-transfers/{id}/runs", h.GetScheduledTransferRuns).Methods("GET")
+    authRouter.HandleFunc("/scheduled-transfers/{id}/cancel", h.CancelScheduledTransfer).Methods("POST")
+    authRouter.HandleFunc("/scheduled-transfers/{id}/resume", h.ResumeScheduledTransfer).Methods("POST")
     authRouter.HandleFunc("/analytics", h.GetAnalytics).Methods("GET")
     authRouter.HandleFunc("/credits/{creditId}/schedule", h.GetCreditSchedule).Methods("GET")
+    authRouter.HandleFunc("/credits/{creditId}/communications", h.GetCreditCommunications).Methods("GET")
     authRouter.HandleFunc("/accounts/{accountId}/predict", h.PredictBalance).Methods("GET")
     authRouter.HandleFunc("/credits/apply", h.ApplyCredit).Methods("POST")
+    authRouter.HandleFunc("/credits/{creditId}/pay", h.PayCreditInstallment).Methods("POST")
+
+    // Staff routes; every call is written to the audit log
+    staff := middleware.RequireRole(adminService, models.RoleSupport, models.RoleCompliance, models.RoleAdmin)
+    compliance := middleware.RequireRole(adminService, models.RoleCompliance, models.RoleAdmin)
+    admin := middleware.RequireRole(adminService, models.RoleAdmin)
+    adminRouter := authRouter.PathPrefix("/admin").Subrouter()
+    adminRouter.Handle("/users", staff(http.HandlerFunc(h.AdminSearchUsers))).Methods("GET")
+    adminRouter.Handle("/users/{userId}", staff(http.HandlerFunc(h.AdminGetUser))).Methods("GET")
+    adminRouter.Handle("/users/{userId}/accounts", staff(http.HandlerFunc(h.AdminGetUserAccounts))).Methods("GET")
+    adminRouter.Handle("/users/{userId}/roles", admin(http.HandlerFunc(h.AdminSetUserRoles))).Methods("PUT")
+    adminRouter.Handle("/accounts/{accountId}/transactions", staff(http.HandlerFunc(h.AdminGetAccountTransactions))).Methods("GET")
+    adminRouter.Handle("/accounts/{accountId}/status", compliance(http.HandlerFunc(h.AdminSetAccountStatus))).Methods("PUT")
+    adminRouter.Handle("/held-transfers", compliance(http.HandlerFunc(h.AdminListHeldTransfers))).Methods("GET")
+    adminRouter.Handle("/held-transfers/{id}/approve", compliance(http.HandlerFunc(h.AdminApproveHeldTransfer))).Methods("POST")
+    adminRouter.Handle("/held-transfers/{id}/reject", compliance(http.HandlerFunc(h.AdminRejectHeldTransfer))).Methods("POST")
+    adminRouter.Handle("/aml-cases", compliance(http.HandlerFunc(h.AdminListAMLCases))).Methods("GET")
+    adminRouter.Handle("/aml-cases/export", compliance(http.HandlerFunc(h.AdminExportAMLCases))).Methods("GET")
+    adminRouter.Handle("/aml-cases/{id}", compliance(http.HandlerFunc(h.AdminGetAMLCase))).Methods("GET")
+    adminRouter.Handle("/aml-cases/{id}/close", compliance(http.HandlerFunc(h.AdminCloseAMLCase))).Methods("POST")
+    adminRouter.Handle("/audit", admin(http.HandlerFunc(h.AdminListAudit))).Methods("GET")
 
     // Start server
     serverPort := os.Getenv("PORT")
@@ -2,9 +2,30 @@ package models
 
 import "time"
 
+const DefaultCurrency = "RUB"
+
+const (
+    AccountActive       = "active"
+    AccountFrozen       = "frozen"        // no money in or out, set by staff during an investigation
+    AccountDebitBlocked = "debit_blocked" // money can come in but not go out
+    AccountClosed       = "closed"
+)
+
 type Account struct {
-    ID        int       `json:"id"`
-    UserID    int       `json:"user_id"`
-    Balance   float64   `json:"balance"`
-    CreatedAt time.Time `json:"created_at"`
+    ID                int        `json:"id"`
+    UserID            int        `json:"user_id"`
+    Number            string     `json:"number"` // 20-digit account number, see utils.GenerateAccountNumber
+    Balance           float64    `json:"balance"`
+    Currency          string     `json:"currency"`
+    Type              string     `json:"type"`
+    ProductID         *int       `json:"product_id,omitempty"`
+    InterestRate      float64    `json:"interest_rate"`                 // annual percent currently applied
+    MaturesAt         *time.Time `json:"matures_at,omitempty"`          // deposits only
+    AccruedInterest   float64    `json:"accrued_interest"`              // accrued but not yet paid out
+    InterestAccruedTo *time.Time `json:"interest_accrued_to,omitempty"` // last day interest was accrued for
+    Status            string     `json:"status"`
+    StatusReason      string     `json:"status_reason,omitempty"`
+    StatusChangedBy   *int       `json:"status_changed_by,omitempty"` // user ID of the customer or staff member
+    StatusChangedAt   *time.Time `json:"status_changed_at,omitempty"`
+    CreatedAt         time.Time  `json:"created_at"`
 }
@@ -0,0 +1,25 @@
+package models
+
+const (
+    AccountTypeCurrent = "current"
+    AccountTypeSavings = "savings" // interest on the daily balance, money can be taken out any time
+    AccountTypeDeposit = "deposit" // interest for a fixed term; taking money out early closes it at a reduced rate
+)
+
+// AccountProduct describes a savings or deposit product customers can open an account for.
+// Current accounts have no product.
+type AccountProduct struct {
+    ID       int    `json:"id"`
+    Code     string `json:"code"`
+    Name     string `json:"name"`
+    Type     string `json:"type"`
+    Currency string `json:"currency"`
+    // Annual rate in percent. If KeyRateSpread is set, the rate is the CBR key rate plus the
+    // spread instead (re-read daily for savings, fixed at opening for deposits) and InterestRate
+    // is only used when the key rate cannot be fetched at opening.
+    InterestRate        float64  `json:"interest_rate"`
+    KeyRateSpread       *float64 `json:"key_rate_spread,omitempty"`
+    TermMonths          int      `json:"term_months,omitempty"`
+    EarlyWithdrawalRate float64  `json:"early_withdrawal_rate,omitempty"` // annual rate for deposits closed before maturity
+    Active              bool     `json:"active"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+    AMLStructuring = "structuring"
+    AMLRapidInOut  = "rapid_in_out"
+    AMLCircular    = "circular"
+
+    AMLCaseOpen   = "open"
+    AMLCaseClosed = "closed"
+)
+
+type AMLCase struct {
+    ID             int       `json:"id"`
+    Type           string    `json:"type"`
+    Status         string    `json:"status"`
+    Summary        string    `json:"summary"`
+    AccountIDs     []int     `json:"account_ids"`
+    TransactionIDs []int     `json:"transaction_ids"`
+    TotalAmount    float64   `json:"total_amount"` // rubles
+    CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AuditEntry records one action of a staff member in the admin API.
+type AuditEntry struct {
+    ID         int       `json:"id"`
+    ActorID    int       `json:"actor_id"`
+    Action     string    `json:"action"`      // e.g. account.freeze, held_transfer.approve
+    TargetType string    `json:"target_type"` // user, account, held_transfer, aml_case
+    TargetID   int       `json:"target_id,omitempty"`
+    Details    string    `json:"details,omitempty"`
+    IP         string    `json:"ip"`
+    CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "github.com/golang-jwt/jwt/v5"
+
+const (
+    TokenIssuer   = "banking_service_project"
+    TokenAudience = "banking_api"
+    MFAAudience   = "banking_mfa" // challenge tokens between the password and the 2FA step of login
+
+    RoleCustomer   = "customer"
+    RoleSupport    = "support"    // reads customer data to answer requests
+    RoleCompliance = "compliance" // freezes accounts and decides on held transfers and AML cases
+    RoleAdmin      = "admin"      // everything, including granting roles
+)
+
+var Roles = []string{RoleCustomer, RoleSupport, RoleCompliance, RoleAdmin}
+
+// Claims are carried by access tokens. Subject holds the decimal user ID and must match UserID;
+// SessionID is the refresh token family the access token was issued for.
+type Claims struct {
+    UserID    int      `json:"uid"`
+    Roles     []string `json:"roles"`
+    SessionID string   `json:"sid"`
+    jwt.RegisteredClaims
+}
+
+func (c *Claims) HasRole(role string) bool {
+    for _, r := range c.Roles {
+        if r == role {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Kinds of messages sent to a borrower about an installment. Each is sent at most once per
+// installment.
+const (
+    CreditReminder        = "reminder"
+    CreditDueInsufficient = "due_insufficient"
+    CreditOverdue1        = "overdue_1"
+    CreditOverdue7        = "overdue_7"
+    CreditOverdue30       = "overdue_30"
+)
+
+// CreditCommunication records a reminder or dunning notice sent about an installment of a credit.
+type CreditCommunication struct {
+    ID            int       `json:"id"`
+    CreditID      int       `json:"credit_id"`
+    InstallmentID int       `json:"installment_id"`
+    UserID        int       `json:"user_id"`
+    Kind          string    `json:"kind"`
+    Template      string    `json:"template"`
+    Amount        float64   `json:"amount"`
+    Currency      string    `json:"currency"`
+    DueDate       time.Time `json:"due_date"`
+    SentAt        time.Time `json:"sent_at"`
+}
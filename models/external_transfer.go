@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+const (
+    ExternalHeld       = "held"       // debited, waiting for a staff decision after fraud screening
+    ExternalPending    = "pending"    // debited from the account, waiting to be submitted to clearing
+    ExternalSubmitting = "submitting" // claimed by the worker, being handed to the clearing gateway
+    ExternalSubmitted  = "submitted"  // accepted by the clearing gateway, waiting for the outcome
+    ExternalSettled    = "settled"
+    ExternalReturned   = "returned" // rejected or never submitted; the money went back to the account
+)
+
+// ExternalTransfer is an outgoing transfer to an account at another bank. The table of these doubles
+// as the outbox the clearing worker submits from.
+type ExternalTransfer struct {
+    ID                    int       `json:"id"`
+    UserID                int       `json:"user_id"`
+    FromAccountID         int       `json:"from_account_id"`
+    Amount                float64   `json:"amount"`
+    Currency              string    `json:"currency"`
+    BIC                   string    `json:"bic"`
+    AccountNumber         string    `json:"account_number"`
+    RecipientName         string    `json:"recipient_name"`
+    Purpose               string    `json:"purpose"`
+    Status                string    `json:"status"`
+    GatewayRef            string    `json:"gateway_ref,omitempty"`
+    ReturnReason          string    `json:"return_reason,omitempty"`
+    TransactionID         int       `json:"transaction_id"`
+    ReversalTransactionID *int      `json:"reversal_transaction_id,omitempty"`
+    Attempts              int       `json:"-"`
+    LastError             string    `json:"-"`
+    NextAttemptAt         time.Time `json:"-"`
+    CreatedAt             time.Time `json:"created_at"`
+    UpdatedAt             time.Time `json:"updated_at"`
+}
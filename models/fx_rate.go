@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type FXRate struct {
+    ID        int       `json:"-"`
+    Date      time.Time `json:"date"`
+    Currency  string    `json:"currency"`
+    Nominal   int       `json:"nominal"`
+    Rate      float64   `json:"rate"` // rubles per Nominal units
+    CreatedAt time.Time `json:"-"`
+    FetchedAt time.Time `json:"-"` // last time the CBR returned this rate
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+    HeldPending  = "pending"
+    HeldApproved = "approved"
+    HeldRejected = "rejected"
+)
+
+// HeldTransfer is a transfer stopped by fraud screening and waiting for a staff decision. A held
+// transfer to another bank has ExternalTransferID set and ToAccountID 0; its amount has already
+// been debited.
+type HeldTransfer struct {
+    ID                 int        `json:"id"`
+    UserID             int        `json:"user_id"`
+    FromAccountID      int        `json:"from_account_id"`
+    ToAccountID        int        `json:"to_account_id,omitempty"`
+    ExternalTransferID *int       `json:"external_transfer_id,omitempty"`
+    Amount             float64    `json:"amount"`
+    Reasons            []string   `json:"reasons"`
+    Status             string     `json:"status"`
+    TransactionID      *int       `json:"transaction_id,omitempty"`
+    CreatedAt          time.Time  `json:"created_at"`
+    DecidedAt          *time.Time `json:"decided_at,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type LoginEvent struct {
+    ID        int       `json:"id"`
+    UserID    int       `json:"user_id"`
+    IP        string    `json:"ip"`
+    UserAgent string    `json:"user_agent"`
+    DeviceID  string    `json:"device_id"`
+    NewDevice bool      `json:"new_device"`
+    CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for a key: "email:<address>" or "ip:<address>".
+type LoginThrottle struct {
+    Key           string     `json:"key"`
+    Failures      int        `json:"failures"`
+    LastFailureAt time.Time  `json:"last_failure_at"`
+    LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+const (
+    NotificationPending = "pending"
+    NotificationSent    = "sent"
+    NotificationFailed  = "failed" // gave up after too many attempts, or a one-time link was not sent
+)
+
+// Notification categories group templates for the user's channel preferences.
+const (
+    NotificationSecurity  = "security" // account access; cannot be turned off
+    NotificationTransfers = "transfers"
+    NotificationCredits   = "credits"
+)
+
+// Notification is a rendered message queued for one channel. The body is cleared once the message
+// is sent or given up on. Messages with one-time links are not queued; their rows only record the
+// sending and never have a body.
+type Notification struct {
+    ID            int        `json:"id"`
+    UserID        int        `json:"user_id"`
+    Template      string     `json:"template"`
+    Channel       string     `json:"channel"`
+    Recipient     string     `json:"recipient"`
+    Subject       string     `json:"subject"`
+    TextBody      string     `json:"-"`
+    HTMLBody      string     `json:"-"`
+    Status        string     `json:"status"`
+    Attempts      int        `json:"attempts"`
+    LastError     string     `json:"last_error,omitempty"`
+    NextAttemptAt time.Time  `json:"next_attempt_at"`
+    CreatedAt     time.Time  `json:"created_at"`
+    SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// NotificationPreference turns a category off or on for a channel. Without a stored preference
+// the category is on.
+type NotificationPreference struct {
+    UserID   int    `json:"-"`
+    Category string `json:"category"`
+    Channel  string `json:"channel"`
+    Enabled  bool   `json:"enabled"`
+}
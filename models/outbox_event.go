@@ -0,0 +1,26 @@
+package models
+
+import (
+    "encoding/json"
+    "time"
+)
+
+const (
+    OutboxPending    = "pending"
+    OutboxDispatched = "dispatched" // every subscriber has handled it
+    OutboxFailed     = "failed"     // gave up after too many attempts
+)
+
+// OutboxEvent is a domain event stored in the same transaction as the change it describes and
+// delivered to subscribers afterwards.
+type OutboxEvent struct {
+    ID            int             `json:"id"`
+    Type          string          `json:"type"`
+    Payload       json.RawMessage `json:"payload"`
+    Status        string          `json:"status"`
+    Attempts      int             `json:"attempts"`
+    LastError     string          `json:"last_error,omitempty"`
+    NextAttemptAt time.Time       `json:"next_attempt_at"`
+    CreatedAt     time.Time       `json:"created_at"`
+    DispatchedAt  *time.Time      `json:"dispatched_at,omitempty"`
+}
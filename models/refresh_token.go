@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RefreshToken is stored by hash only. Every refresh replaces the token with a new one from the same
+// family, so a second use of an already rotated token exposes a leak and revokes the whole family.
+type RefreshToken struct {
+    ID              int        `json:"id"`
+    UserID          int        `json:"user_id"`
+    FamilyID        string     `json:"family_id"`
+    TokenHash       string     `json:"-"`
+    AccessJTI       string     `json:"-"` // access token issued together with this refresh token
+    AccessExpiresAt time.Time  `json:"-"`
+    ExpiresAt       time.Time  `json:"expires_at"`
+    CreatedAt       time.Time  `json:"created_at"`
+    UsedAt          *time.Time `json:"used_at,omitempty"`
+    RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+}
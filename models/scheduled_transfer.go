@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+const (
+    FrequencyOnce    = "once"
+    FrequencyDaily   = "daily"
+    FrequencyWeekly  = "weekly"
+    FrequencyMonthly = "monthly"
+
+    ScheduleActive    = "active"
+    SchedulePaused    = "paused"
+    ScheduleCompleted = "completed"
+    ScheduleCancelled = "cancelled"
+)
+
+type ScheduledTransfer struct {
+    ID            int        `json:"id"`
+    UserID        int        `json:"user_id"`
+    FromAccountID int        `json:"from_account_id"`
+    ToAccountID   int        `json:"to_account_id"`
+    Amount        float64    `json:"amount"`
+    Frequency     string     `json:"frequency"`               // once, daily, weekly, monthly
+    DayOfMonth    int        `json:"day_of_month,omitempty"`  // monthly only; clamped to the month's last day
+    NextRunAt     time.Time  `json:"next_run_at"`
+    RetryAt       *time.Time `json:"retry_at,omitempty"`
+    EndDate       *time.Time `json:"end_date,omitempty"`
+    Status        string     `json:"status"`
+    FailureCount  int        `json:"failure_count"`
+    CreatedAt     time.Time  `json:"created_at"`
+}
+
+type ScheduledTransferRun struct {
+    ID                  int       `json:"id"`
+    ScheduledTransferID int       `json:"scheduled_transfer_id"`
+    TransactionID       *int      `json:"transaction_id,omitempty"`
+    Success             bool      `json:"success"`
+    Error               string    `json:"error,omitempty"`
+    RunAt               time.Time `json:"run_at"`
+}
@@ -4,11 +4,26 @@ import (
     "time"
 )
 
+const (
+    TxTransfer         = "transfer"
+    TxAccountClosure   = "account_closure"   // remaining balance moved out of an account being closed
+    TxCreditPayment    = "credit_payment"    // installment paid to the bank; ToAccountID is 0
+    TxInterest         = "interest"          // interest paid by the bank; FromAccountID is 0
+    TxInterestReversal = "interest_reversal" // interest taken back when a deposit is closed early; ToAccountID is 0
+    TxExternalTransfer = "external_transfer" // sent to another bank, see ExternalTransfer; ToAccountID is 0
+    TxExternalReturn   = "external_return"   // an external transfer coming back; FromAccountID is 0
+)
+
 type Transaction struct {
     ID            int       `json:"id"`
     FromAccountID int       `json:"from_account_id"`
     ToAccountID   int       `json:"to_account_id"`
     Amount        float64   `json:"amount"`
+    Currency      string    `json:"currency"`
+    ToAmount      float64   `json:"to_amount"`
+    ToCurrency    string    `json:"to_currency"`
+    ExchangeRate  float64   `json:"exchange_rate"`
+    FXSpread      float64   `json:"fx_spread"` // percent, 0 for same-currency transfers
     CreatedAt     time.Time `json:"created_at"`
-    Type          string    `json:"type"` // deposit, withdrawal, transfer
+    Type          string    `json:"type"`
 }
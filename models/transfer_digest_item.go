@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// TransferDigestItem is a transfer too small for its own notification, waiting for the user's
+// daily digest. Amount and Balance are in Currency, the currency of the user's account.
+type TransferDigestItem struct {
+    ID            int        `json:"id"`
+    UserID        int        `json:"user_id"`
+    TransactionID int        `json:"transaction_id"`
+    Incoming      bool       `json:"incoming"`
+    AccountNumber string     `json:"account_number"`
+    Counterparty  string     `json:"counterparty"`
+    Amount        float64    `json:"amount"`
+    Currency      string     `json:"currency"`
+    Balance       float64    `json:"balance"`
+    At            time.Time  `json:"at"`
+    SentAt        *time.Time `json:"sent_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+const (
+    TierStandard = "standard"
+    TierPremium  = "premium"
+)
+
+// TransferLimits are expressed in rubles; a zero cap means the cap is not enforced.
+type TransferLimits struct {
+    Tier                string  `json:"tier"`
+    MinAmount           float64 `json:"min_amount"`
+    MaxAmount           float64 `json:"max_amount"`
+    DailyUser           float64 `json:"daily_user"`
+    MonthlyUser         float64 `json:"monthly_user"`
+    DailyAccount        float64 `json:"daily_account"`
+    MonthlyAccount      float64 `json:"monthly_account"`
+    DailyCounterparty   float64 `json:"daily_counterparty"`
+    MonthlyCounterparty float64 `json:"monthly_counterparty"`
+}
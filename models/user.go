@@ -2,10 +2,24 @@ package models
 
 import "time"
 
+const DefaultLanguage = "ru"
+
 type User struct {
-    ID        int       `json:"id"`
-    Username  string    `json:"username"`
-    Email     string    `json:"email"`
-    Password  string    `json:"-"`
-    CreatedAt time.Time `json:"created_at"`
+    ID                int        `json:"id"`
+    Username          string     `json:"username"`
+    Email             string     `json:"email"`
+    Phone             string     `json:"phone,omitempty"`
+    FullName          string     `json:"full_name,omitempty"`
+    PreferredLanguage string     `json:"preferred_language"`
+    Password          string     `json:"-"`
+    Tier              string     `json:"tier"`
+    Roles             []string   `json:"roles"`
+    PasswordChangedAt *time.Time `json:"-"`
+    EmailVerifiedAt   *time.Time `json:"email_verified_at,omitempty"`
+    DefaultAccountID  *int       `json:"default_account_id,omitempty"`
+    TOTPSecret        string     `json:"-"`
+    TOTPEnabled       bool       `json:"totp_enabled"`
+    TOTPLastStep      int64      `json:"-"` // last accepted TOTP time step, to refuse replayed codes
+    ClosedAt          *time.Time `json:"closed_at,omitempty"`
+    CreatedAt         time.Time  `json:"created_at"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+    TokenEmailVerification = "email_verification"
+    TokenPasswordReset     = "password_reset"
+    TokenOperationCode     = "operation_code" // second factor for users without 2FA
+)
+
+// UserToken is a single-use token or code sent to the user by email. Only its hash is stored.
+type UserToken struct {
+    ID        int        `json:"id"`
+    UserID    int        `json:"user_id"`
+    Purpose   string     `json:"purpose"`
+    TokenHash string     `json:"-"`
+    ExpiresAt time.Time  `json:"expires_at"`
+    UsedAt    *time.Time `json:"used_at,omitempty"`
+    CreatedAt time.Time  `json:"created_at"`
+}
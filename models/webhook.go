@@ -0,0 +1,52 @@
+package models
+
+import (
+    "encoding/json"
+    "time"
+)
+
+const (
+    WebhookDeliveryPending   = "pending"
+    WebhookDeliveryDelivered = "delivered"
+    WebhookDeliveryFailed    = "failed" // gave up after too many attempts
+)
+
+// WebhookEndpoint is a URL a customer registered to receive events about their accounts.
+type WebhookEndpoint struct {
+    ID             int        `json:"id"`
+    UserID         int        `json:"user_id"`
+    URL            string     `json:"url"`
+    EventTypes     []string   `json:"event_types"`
+    Secret         string     `json:"secret,omitempty"` // only shown when the endpoint is created
+    Active         bool       `json:"active"`
+    FailingSince   *time.Time `json:"failing_since,omitempty"`
+    DisabledReason string     `json:"disabled_reason,omitempty"`
+    CreatedAt      time.Time  `json:"created_at"`
+}
+
+// WebhookDelivery is one event to be sent to one endpoint.
+type WebhookDelivery struct {
+    ID               int             `json:"id"`
+    EndpointID       int             `json:"endpoint_id"`
+    EventID          int             `json:"event_id"`
+    EventType        string          `json:"event_type"`
+    Payload          json.RawMessage `json:"payload"`
+    Status           string          `json:"status"`
+    Attempts         int             `json:"attempts"`
+    LastResponseCode *int            `json:"last_response_code,omitempty"`
+    LastError        string          `json:"last_error,omitempty"`
+    NextAttemptAt    time.Time       `json:"next_attempt_at"`
+    CreatedAt        time.Time       `json:"created_at"`
+    DeliveredAt      *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// WebhookAttempt is a single HTTP request made for a delivery. ResponseCode is nil when no
+// response was received.
+type WebhookAttempt struct {
+    ID           int       `json:"id"`
+    DeliveryID   int       `json:"delivery_id"`
+    ResponseCode *int      `json:"response_code,omitempty"`
+    Error        string    `json:"error,omitempty"`
+    DurationMS   int       `json:"duration_ms"`
+    AttemptedAt  time.Time `json:"attempted_at"`
+}
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+    "database/sql"
+    "errors"
+
+    "banking_service_project/models"
+)
+
+type AccountProductRepository interface {
+    ListActive() ([]models.AccountProduct, error)
+    GetByID(id int) (*models.AccountProduct, error)
+    GetByCode(code string) (*models.AccountProduct, error)
+}
+
+type accountProductRepository struct {
+    db *sql.DB
+}
+
+func NewAccountProductRepository(db *sql.DB) AccountProductRepository {
+    return &accountProductRepository{db: db}
+}
+
+const accountProductColumns = `id, code, name, type, currency, interest_rate, key_rate_spread, term_months, early_withdrawal_rate, active`
+
+func (r *accountProductRepository) ListActive() ([]models.AccountProduct, error) {
+    query := `SELECT ` + accountProductColumns + ` FROM account_products WHERE active ORDER BY type, id`
+    rows, err := r.db.Query(query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var products []models.AccountProduct
+    for rows.Next() {
+        var p models.AccountProduct
+        if err := scanAccountProduct(rows, &p); err != nil {
+            return nil, err
+        }
+        products = append(products, p)
+    }
+    return products, rows.Err()
+}
+
+func (r *accountProductRepository) GetByID(id int) (*models.AccountProduct, error) {
+    return r.getOne(`SELECT `+accountProductColumns+` FROM account_products WHERE id=$1`, id)
+}
+
+func (r *accountProductRepository) GetByCode(code string) (*models.AccountProduct, error) {
+    return r.getOne(`SELECT `+accountProductColumns+` FROM account_products WHERE code=$1`, code)
+}
+
+func (r *accountProductRepository) getOne(query string, arg interface{}) (*models.AccountProduct, error) {
+    p := &models.AccountProduct{}
+    err := scanAccountProduct(r.db.QueryRow(query, arg), p)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("account product not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return p, nil
+}
+
+func scanAccountProduct(row rowScanner, p *models.AccountProduct) error {
+    var spread sql.NullFloat64
+    if err := row.Scan(&p.ID, &p.Code, &p.Name, &p.Type, &p.Currency, &p.InterestRate, &spread, &p.TermMonths, &p.EarlyWithdrawalRate, &p.Active); err != nil {
+        return err
+    }
+    if spread.Valid {
+        p.KeyRateSpread = &spread.Float64
+    }
+    return nil
+}
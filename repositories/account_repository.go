@@ -5,6 +5,8 @@ import (
     "errors"
     "time"
 
+    "github.com/lib/pq"
+
     "banking_service_project/models"
 )
 
@@ -12,21 +14,45 @@ type AccountRepository interface {
     Create(account *models.Account) error
     GetByUserID(userID int) ([]models.Account, error)
     GetByID(accountID int) (*models.Account, error)
-    UpdateBalance(accountID int, newBalance float64) error
+    GetByNumber(number string) (*models.Account, error)
+    NumberExists(number string) (bool, error)
+    GetWithoutNumber() ([]models.Account, error)
+    SetNumber(accountID int, number string) error
+    GetForUpdate(ownerID int, accountIDs ...int) (map[int]*models.Account, error)
+    AddToBalance(accountID int, delta float64) (float64, error)
+    EndOfDayBalance(accountID int, day time.Time) (float64, error)
+    SetStatus(accountID int, status, reason string, changedBy int) error
+    GetInterestBearing() ([]models.Account, error)
+    UpdateInterest(accountID int, accrued float64, accruedTo time.Time, rate float64) error
 }
 
 type accountRepository struct {
-    db *sql.DB
+    db dbtx
 }
 
 func NewAccountRepository(db *sql.DB) AccountRepository {
     return &accountRepository{db: db}
 }
 
+const accountColumns = `id, user_id, number, balance, currency, type, product_id, interest_rate, matures_at, accrued_interest, interest_accrued_to,
+    status, status_reason, status_changed_by, status_changed_at, created_at`
+
 func (r *accountRepository) Create(account *models.Account) error {
-    query := `INSERT INTO accounts (user_id, balance, created_at) VALUES ($1, $2, $3) RETURNING id`
+    query := `INSERT INTO accounts (user_id, number, balance, currency, type, product_id, interest_rate, matures_at, interest_accrued_to, status, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
     account.CreatedAt = time.Now()
-    err := r.db.QueryRow(query, account.UserID, account.Balance, account.CreatedAt).Scan(&account.ID)
+    if account.Type == "" {
+        account.Type = models.AccountTypeCurrent
+    }
+    if account.Status == "" {
+        account.Status = models.AccountActive
+    }
+    var productID sql.NullInt64
+    if account.ProductID != nil {
+        productID = sql.NullInt64{Int64: int64(*account.ProductID), Valid: true}
+    }
+    err := r.db.QueryRow(query, account.UserID, account.Number, account.Balance, account.Currency, account.Type, productID, account.InterestRate,
+        account.MaturesAt, account.InterestAccruedTo, account.Status, account.CreatedAt).Scan(&account.ID)
     if err != nil {
         return err
     }
@@ -34,7 +60,7 @@ func (r *accountRepository) Create(account *models.Account) error {
 }
 
 func (r *accountRepository) GetByUserID(userID int) ([]models.Account, error) {
-    query := `SELECT id, user_id, balance, created_at FROM accounts WHERE user_id=$1`
+    query := `SELECT ` + accountColumns + ` FROM accounts WHERE user_id=$1`
     rows, err := r.db.Query(query, userID)
     if err != nil {
         return nil, err
@@ -44,7 +70,7 @@ func (r *accountRepository) GetByUserID(userID int) ([]models.Account, error) {
     var accounts []models.Account
     for rows.Next() {
         var acc models.Account
-        if err := rows.Scan(&acc.ID, &acc.UserID, &acc.Balance, &acc.CreatedAt); err != nil {
+        if err := scanAccount(rows, &acc); err != nil {
             return nil, err
         }
         accounts = append(accounts, acc)
@@ -54,8 +80,21 @@ func (r *accountRepository) GetByUserID(userID int) ([]models.Account, error) {
 
 func (r *accountRepository) GetByID(accountID int) (*models.Account, error) {
     account := &models.Account{}
-    query := `SELECT id, user_id, balance, created_at FROM accounts WHERE id=$1`
-    err := r.db.QueryRow(query, accountID).Scan(&account.ID, &account.UserID, &account.Balance, &account.CreatedAt)
+    query := `SELECT ` + accountColumns + ` FROM accounts WHERE id=$1`
+    err := scanAccount(r.db.QueryRow(query, accountID), account)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("account not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return account, nil
+}
+
+func (r *accountRepository) GetByNumber(number string) (*models.Account, error) {
+    account := &models.Account{}
+    query := `SELECT ` + accountColumns + ` FROM accounts WHERE number=$1`
+    err := scanAccount(r.db.QueryRow(query, number), account)
     if err == sql.ErrNoRows {
         return nil, errors.New("account not found")
     }
@@ -65,8 +104,160 @@ func (r *accountRepository) GetByID(accountID int) (*models.Account, error) {
     return account, nil
 }
 
-func (r *accountRepository) UpdateBalance(accountID int, newBalance float64) error {
-    query := `UPDATE accounts SET balance=$1 WHERE id=$2`
-    _, err := r.db.Exec(query, newBalance, accountID)
+func (r *accountRepository) NumberExists(number string) (bool, error) {
+    var exists bool
+    err := r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM accounts WHERE number=$1)`, number).Scan(&exists)
+    return exists, err
+}
+
+// GetWithoutNumber returns accounts opened before account numbers were introduced.
+func (r *accountRepository) GetWithoutNumber() ([]models.Account, error) {
+    query := `SELECT ` + accountColumns + ` FROM accounts WHERE number IS NULL ORDER BY id`
+    rows, err := r.db.Query(query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var accounts []models.Account
+    for rows.Next() {
+        var acc models.Account
+        if err := scanAccount(rows, &acc); err != nil {
+            return nil, err
+        }
+        accounts = append(accounts, acc)
+    }
+    return accounts, rows.Err()
+}
+
+func (r *accountRepository) SetNumber(accountID int, number string) error {
+    _, err := r.db.Exec(`UPDATE accounts SET number=$1 WHERE id=$2 AND number IS NULL`, number, accountID)
     return err
 }
+
+// GetForUpdate locks the given accounts, and every account of ownerID unless it is 0, until the
+// transaction ends. Rows are locked in id order, so concurrent transactions cannot deadlock on them.
+func (r *accountRepository) GetForUpdate(ownerID int, accountIDs ...int) (map[int]*models.Account, error) {
+    query := `SELECT ` + accountColumns + ` FROM accounts WHERE id = ANY($1) OR user_id=$2 ORDER BY id FOR UPDATE`
+    rows, err := r.db.Query(query, pq.Array(accountIDs), ownerID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    accounts := make(map[int]*models.Account)
+    for rows.Next() {
+        acc := &models.Account{}
+        if err := scanAccount(rows, acc); err != nil {
+            return nil, err
+        }
+        accounts[acc.ID] = acc
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    for _, id := range accountIDs {
+        if accounts[id] == nil {
+            return nil, errors.New("account not found")
+        }
+    }
+    return accounts, nil
+}
+
+// AddToBalance changes the balance by delta relative to its current value and returns the new one.
+// The day's opening and closing balances are kept in account_daily_balances for EndOfDayBalance.
+func (r *accountRepository) AddToBalance(accountID int, delta float64) (float64, error) {
+    query := `WITH updated AS (UPDATE accounts SET balance=balance+$1 WHERE id=$2 RETURNING id, balance)
+        INSERT INTO account_daily_balances (account_id, day, opening_balance, closing_balance)
+        SELECT id, $3, balance-$1, balance FROM updated
+        ON CONFLICT (account_id, day) DO UPDATE SET closing_balance=EXCLUDED.closing_balance
+        RETURNING closing_balance`
+    now := time.Now()
+    today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+    var balance float64
+    err := r.db.QueryRow(query, delta, accountID, today).Scan(&balance)
+    if err == sql.ErrNoRows {
+        return 0, errors.New("account not found")
+    }
+    return balance, err
+}
+
+// EndOfDayBalance returns the balance the account had at the end of day: the closing balance of the
+// last day with changes up to it, else the opening balance of the first day with changes after it,
+// else the current balance.
+func (r *accountRepository) EndOfDayBalance(accountID int, day time.Time) (float64, error) {
+    query := `SELECT COALESCE(
+        (SELECT closing_balance FROM account_daily_balances WHERE account_id=$1 AND day<=$2 ORDER BY day DESC LIMIT 1),
+        (SELECT opening_balance FROM account_daily_balances WHERE account_id=$1 AND day>$2 ORDER BY day LIMIT 1),
+        (SELECT balance FROM accounts WHERE id=$1))`
+    var balance sql.NullFloat64
+    if err := r.db.QueryRow(query, accountID, day).Scan(&balance); err != nil {
+        return 0, err
+    }
+    if !balance.Valid {
+        return 0, errors.New("account not found")
+    }
+    return balance.Float64, nil
+}
+
+func (r *accountRepository) SetStatus(accountID int, status, reason string, changedBy int) error {
+    query := `UPDATE accounts SET status=$1, status_reason=$2, status_changed_by=$3, status_changed_at=$4 WHERE id=$5`
+    _, err := r.db.Exec(query, status, nullString(reason), changedBy, time.Now(), accountID)
+    return err
+}
+
+// GetInterestBearing returns the savings and deposit accounts that are not closed.
+func (r *accountRepository) GetInterestBearing() ([]models.Account, error) {
+    query := `SELECT ` + accountColumns + ` FROM accounts WHERE type <> 'current' AND status <> 'closed' ORDER BY id`
+    rows, err := r.db.Query(query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var accounts []models.Account
+    for rows.Next() {
+        var acc models.Account
+        if err := scanAccount(rows, &acc); err != nil {
+            return nil, err
+        }
+        accounts = append(accounts, acc)
+    }
+    return accounts, rows.Err()
+}
+
+func (r *accountRepository) UpdateInterest(accountID int, accrued float64, accruedTo time.Time, rate float64) error {
+    query := `UPDATE accounts SET accrued_interest=$1, interest_accrued_to=$2, interest_rate=$3 WHERE id=$4`
+    _, err := r.db.Exec(query, accrued, accruedTo, rate, accountID)
+    return err
+}
+
+func scanAccount(row rowScanner, acc *models.Account) error {
+    var productID, changedBy sql.NullInt64
+    var maturesAt, accruedTo, changedAt sql.NullTime
+    var number, reason sql.NullString
+    if err := row.Scan(&acc.ID, &acc.UserID, &number, &acc.Balance, &acc.Currency, &acc.Type, &productID, &acc.InterestRate, &maturesAt,
+        &acc.AccruedInterest, &accruedTo, &acc.Status, &reason, &changedBy, &changedAt, &acc.CreatedAt); err != nil {
+        return err
+    }
+    acc.Number = number.String
+    if productID.Valid {
+        id := int(productID.Int64)
+        acc.ProductID = &id
+    }
+    if maturesAt.Valid {
+        acc.MaturesAt = &maturesAt.Time
+    }
+    if accruedTo.Valid {
+        acc.InterestAccruedTo = &accruedTo.Time
+    }
+    acc.StatusReason = reason.String
+    if changedBy.Valid {
+        id := int(changedBy.Int64)
+        acc.StatusChangedBy = &id
+    }
+    if changedAt.Valid {
+        acc.StatusChangedAt = &changedAt.Time
+    }
+    return nil
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/lib/pq"
+
+    "banking_service_project/models"
+)
+
+type AMLCaseRepository interface {
+    Create(c *models.AMLCase) error
+    GetByID(id int) (*models.AMLCase, error)
+    GetCreatedSince(since time.Time) ([]models.AMLCase, error)
+    GetByStatus(status string) ([]models.AMLCase, error)
+    UpdateStatus(id int, status string) error
+    CoversTransactions(caseType string, transactionIDs []int) (bool, error)
+}
+
+type amlCaseRepository struct {
+    db dbtx
+}
+
+func NewAMLCaseRepository(db *sql.DB) AMLCaseRepository {
+    return &amlCaseRepository{db: db}
+}
+
+const amlCaseColumns = `c.id, c.type, c.status, c.summary, c.account_ids, c.total_amount, c.created_at,
+    ARRAY(SELECT transaction_id FROM aml_case_transactions WHERE case_id = c.id ORDER BY transaction_id)`
+
+func (r *amlCaseRepository) Create(c *models.AMLCase) error {
+    query := `INSERT INTO aml_cases (type, status, summary, account_ids, total_amount, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+    c.CreatedAt = time.Now()
+    if err := r.db.QueryRow(query, c.Type, c.Status, c.Summary, pq.Array(c.AccountIDs), c.TotalAmount, c.CreatedAt).Scan(&c.ID); err != nil {
+        return err
+    }
+    for _, txID := range c.TransactionIDs {
+        if _, err := r.db.Exec(`INSERT INTO aml_case_transactions (case_id, transaction_id) VALUES ($1, $2)`, c.ID, txID); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r *amlCaseRepository) GetByID(id int) (*models.AMLCase, error) {
+    query := `SELECT ` + amlCaseColumns + ` FROM aml_cases c WHERE c.id=$1`
+    c := &models.AMLCase{}
+    err := scanAMLCase(r.db.QueryRow(query, id), c)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("aml case not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+func (r *amlCaseRepository) GetCreatedSince(since time.Time) ([]models.AMLCase, error) {
+    return r.list(`SELECT `+amlCaseColumns+` FROM aml_cases c WHERE c.created_at >= $1 ORDER BY c.id`, since)
+}
+
+func (r *amlCaseRepository) GetByStatus(status string) ([]models.AMLCase, error) {
+    return r.list(`SELECT `+amlCaseColumns+` FROM aml_cases c WHERE c.status=$1 ORDER BY c.id DESC`, status)
+}
+
+func (r *amlCaseRepository) list(query string, args ...interface{}) ([]models.AMLCase, error) {
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var cases []models.AMLCase
+    for rows.Next() {
+        var c models.AMLCase
+        if err := scanAMLCase(rows, &c); err != nil {
+            return nil, err
+        }
+        cases = append(cases, c)
+    }
+    return cases, rows.Err()
+}
+
+func (r *amlCaseRepository) UpdateStatus(id int, status string) error {
+    _, err := r.db.Exec(`UPDATE aml_cases SET status=$1 WHERE id=$2`, status, id)
+    return err
+}
+
+// CoversTransactions reports whether every given transaction is already linked to a case of the type,
+// so repeated scans over overlapping windows do not open duplicate cases.
+func (r *amlCaseRepository) CoversTransactions(caseType string, transactionIDs []int) (bool, error) {
+    query := `SELECT COUNT(DISTINCT ct.transaction_id) FROM aml_case_transactions ct
+        JOIN aml_cases c ON c.id = ct.case_id
+        WHERE c.type=$1 AND ct.transaction_id = ANY($2)`
+    var count int
+    if err := r.db.QueryRow(query, caseType, pq.Array(transactionIDs)).Scan(&count); err != nil {
+        return false, err
+    }
+    return count == len(transactionIDs), nil
+}
+
+func scanAMLCase(row rowScanner, c *models.AMLCase) error {
+    var accountIDs, transactionIDs pq.Int64Array
+    if err := row.Scan(&c.ID, &c.Type, &c.Status, &c.Summary, &accountIDs, &c.TotalAmount, &c.CreatedAt, &transactionIDs); err != nil {
+        return err
+    }
+    c.AccountIDs = toInts(accountIDs)
+    c.TransactionIDs = toInts(transactionIDs)
+    return nil
+}
+
+func toInts(values pq.Int64Array) []int {
+    ints := make([]int, len(values))
+    for i, v := range values {
+        ints[i] = int(v)
+    }
+    return ints
+}
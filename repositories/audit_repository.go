@@ -0,0 +1,53 @@
+package repositories
+
+import (
+    "database/sql"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type AuditRepository interface {
+    Create(entry *models.AuditEntry) error
+    List(actorID int, since time.Time, limit int) ([]models.AuditEntry, error)
+}
+
+type auditRepository struct {
+    db dbtx
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+    return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(entry *models.AuditEntry) error {
+    query := `INSERT INTO audit_log (actor_id, action, target_type, target_id, details, ip, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+    entry.CreatedAt = time.Now()
+    return r.db.QueryRow(query, entry.ActorID, entry.Action, entry.TargetType, nullInt(entry.TargetID), nullString(entry.Details), entry.IP, entry.CreatedAt).Scan(&entry.ID)
+}
+
+// List returns the newest entries first; actorID 0 means all staff members.
+func (r *auditRepository) List(actorID int, since time.Time, limit int) ([]models.AuditEntry, error) {
+    query := `SELECT id, actor_id, action, target_type, target_id, details, ip, created_at FROM audit_log
+        WHERE ($1 = 0 OR actor_id = $1) AND created_at >= $2
+        ORDER BY id DESC LIMIT $3`
+    rows, err := r.db.Query(query, actorID, since, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    entries := []models.AuditEntry{}
+    for rows.Next() {
+        var e models.AuditEntry
+        var targetID sql.NullInt64
+        var details sql.NullString
+        if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetType, &targetID, &details, &e.IP, &e.CreatedAt); err != nil {
+            return nil, err
+        }
+        e.TargetID = int(targetID.Int64)
+        e.Details = details.String
+        entries = append(entries, e)
+    }
+    return entries, rows.Err()
+}
@@ -2,6 +2,7 @@ package repositories
 
 import (
     "database/sql"
+    "errors"
     "time"
 
     "banking_service_project/models"
@@ -9,11 +10,12 @@ import (
 
 type CardRepository interface {
     Create(card *models.Card) error
+    GetByID(id int) (*models.Card, error)
     GetByAccountID(accountID int) ([]models.Card, error)
 }
 
 type cardRepository struct {
-    db *sql.DB
+    db dbtx
 }
 
 func NewCardRepository(db *sql.DB) CardRepository {
@@ -30,6 +32,19 @@ func (r *cardRepository) Create(card *models.Card) error {
     return nil
 }
 
+func (r *cardRepository) GetByID(id int) (*models.Card, error) {
+    query := `SELECT id, account_id, encrypted_number, encrypted_cvv, expires_at, created_at FROM cards WHERE id=$1`
+    c := &models.Card{}
+    err := r.db.QueryRow(query, id).Scan(&c.ID, &c.AccountID, &c.EncryptedNumber, &c.EncryptedCVV, &c.ExpiresAt, &c.CreatedAt)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("card not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
 func (r *cardRepository) GetByAccountID(accountID int) ([]models.Card, error) {
     query := `SELECT id, account_id, encrypted_number, encrypted_cvv, expires_at, created_at FROM cards WHERE account_id=$1`
     rows, err := r.db.Query(query, accountID)
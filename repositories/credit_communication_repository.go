@@ -0,0 +1,61 @@
+package repositories
+
+import (
+    "database/sql"
+
+    "banking_service_project/models"
+)
+
+type CreditCommunicationRepository interface {
+    Record(c *models.CreditCommunication) (bool, error)
+    Remove(id int) error
+    GetByCredit(creditID int) ([]models.CreditCommunication, error)
+}
+
+type creditCommunicationRepository struct {
+    db *sql.DB
+}
+
+func NewCreditCommunicationRepository(db *sql.DB) CreditCommunicationRepository {
+    return &creditCommunicationRepository{db: db}
+}
+
+// Record reports false if a message of this kind was already sent about the installment.
+func (r *creditCommunicationRepository) Record(c *models.CreditCommunication) (bool, error) {
+    query := `INSERT INTO credit_communications (credit_id, installment_id, user_id, kind, template, amount, currency, due_date, sent_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (installment_id, kind) DO NOTHING RETURNING id`
+    err := r.db.QueryRow(query, c.CreditID, c.InstallmentID, c.UserID, c.Kind, c.Template, c.Amount, c.Currency, c.DueDate, c.SentAt).Scan(&c.ID)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return true, nil
+}
+
+func (r *creditCommunicationRepository) Remove(id int) error {
+    _, err := r.db.Exec(`DELETE FROM credit_communications WHERE id=$1`, id)
+    return err
+}
+
+func (r *creditCommunicationRepository) GetByCredit(creditID int) ([]models.CreditCommunication, error) {
+    query := `SELECT id, credit_id, installment_id, user_id, kind, template, amount, currency, due_date, sent_at
+        FROM credit_communications WHERE credit_id=$1 ORDER BY sent_at, id`
+    rows, err := r.db.Query(query, creditID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var comms []models.CreditCommunication
+    for rows.Next() {
+        var c models.CreditCommunication
+        if err := rows.Scan(&c.ID, &c.CreditID, &c.InstallmentID, &c.UserID, &c.Kind, &c.Template, &c.Amount, &c.Currency,
+            &c.DueDate, &c.SentAt); err != nil {
+            return nil, err
+        }
+        comms = append(comms, c)
+    }
+    return comms, rows.Err()
+}
@@ -10,10 +10,12 @@ import (
 type CreditRepository interface {
     Create(credit *models.Credit) error
     GetByID(creditID int) (*models.Credit, error)
+    CountOpenByUser(userID int) (int, error)
+    CountOpenByAccount(accountID int) (int, error)
 }
 
 type creditRepository struct {
-    db *sql.DB
+    db dbtx
 }
 
 func NewCreditRepository(db *sql.DB) CreditRepository {
@@ -21,9 +23,9 @@ func NewCreditRepository(db *sql.DB) CreditRepository {
 }
 
 func (r *creditRepository) Create(credit *models.Credit) error {
-    query := `INSERT INTO credits (account_id, principal, interest_rate, term_months, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+    query := `INSERT INTO credits (account_id, principal, currency, interest_rate, term_months, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
     credit.CreatedAt = time.Now()
-    err := r.db.QueryRow(query, credit.AccountID, credit.Principal, credit.InterestRate, credit.TermMonths, credit.CreatedAt).Scan(&credit.ID)
+    err := r.db.QueryRow(query, credit.AccountID, credit.Principal, credit.Currency, credit.InterestRate, credit.TermMonths, credit.CreatedAt).Scan(&credit.ID)
     if err != nil {
         return err
     }
@@ -32,10 +34,30 @@ func (r *creditRepository) Create(credit *models.Credit) error {
 
 func (r *creditRepository) GetByID(creditID int) (*models.Credit, error) {
     credit := &models.Credit{}
-    query := `SELECT id, account_id, principal, interest_rate, term_months, created_at FROM credits WHERE id=$1`
-    err := r.db.QueryRow(query, creditID).Scan(&credit.ID, &credit.AccountID, &credit.Principal, &credit.InterestRate, &credit.TermMonths, &credit.CreatedAt)
+    query := `SELECT id, account_id, principal, currency, interest_rate, term_months, created_at FROM credits WHERE id=$1`
+    err := r.db.QueryRow(query, creditID).Scan(&credit.ID, &credit.AccountID, &credit.Principal, &credit.Currency, &credit.InterestRate, &credit.TermMonths, &credit.CreatedAt)
     if err != nil {
         return nil, err
     }
     return credit, nil
 }
+
+// CountOpenByUser counts the user's credits that still have unpaid scheduled payments.
+func (r *creditRepository) CountOpenByUser(userID int) (int, error) {
+    query := `SELECT COUNT(DISTINCT c.id) FROM credits c
+        JOIN accounts a ON a.id = c.account_id
+        JOIN payment_schedules p ON p.credit_id = c.id
+        WHERE a.user_id=$1 AND NOT p.paid`
+    var count int
+    err := r.db.QueryRow(query, userID).Scan(&count)
+    return count, err
+}
+
+func (r *creditRepository) CountOpenByAccount(accountID int) (int, error) {
+    query := `SELECT COUNT(DISTINCT c.id) FROM credits c
+        JOIN payment_schedules p ON p.credit_id = c.id
+        WHERE c.account_id=$1 AND NOT p.paid`
+    var count int
+    err := r.db.QueryRow(query, accountID).Scan(&count)
+    return count, err
+}
@@ -0,0 +1,197 @@
+package repositories
+
+import (
+    "database/sql"
+    "errors"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type ExternalTransferRepository interface {
+    Create(t *models.ExternalTransfer) error
+    GetByID(id int) (*models.ExternalTransfer, error)
+    GetByUserID(userID int) ([]models.ExternalTransfer, error)
+    GetByTransactionID(transactionID int) (*models.ExternalTransfer, error)
+    GetDue(now, staleBefore time.Time) ([]models.ExternalTransfer, error)
+    GetSubmitted() ([]models.ExternalTransfer, error)
+    CountOpenByAccount(accountID int) (int, error)
+    HasTransferredTo(userID int, bic, accountNumber string) (bool, error)
+    Claim(t *models.ExternalTransfer) (bool, error)
+    MarkSubmitted(id int, gatewayRef string) (bool, error)
+    RecordFailedAttempt(id, attempts int, lastError string, nextAttemptAt time.Time) error
+    Finish(id int, status, returnReason string) (bool, error)
+    SetReversal(id, transactionID int) error
+    Release(id int) (bool, error)
+}
+
+type externalTransferRepository struct {
+    db dbtx
+}
+
+func NewExternalTransferRepository(db *sql.DB) ExternalTransferRepository {
+    return &externalTransferRepository{db: db}
+}
+
+const externalTransferColumns = `id, user_id, from_account_id, amount, currency, bic, account_number, recipient_name, purpose, status,
+    gateway_ref, return_reason, transaction_id, reversal_transaction_id, attempts, last_error, next_attempt_at, created_at, updated_at`
+
+func (r *externalTransferRepository) Create(t *models.ExternalTransfer) error {
+    query := `INSERT INTO external_transfers (user_id, from_account_id, amount, currency, bic, account_number, recipient_name, purpose,
+        status, transaction_id, next_attempt_at, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $12) RETURNING id`
+    t.CreatedAt = time.Now()
+    t.UpdatedAt = t.CreatedAt
+    if t.Status == "" {
+        t.Status = models.ExternalPending
+    }
+    if t.NextAttemptAt.IsZero() {
+        t.NextAttemptAt = t.CreatedAt
+    }
+    return r.db.QueryRow(query, t.UserID, t.FromAccountID, t.Amount, t.Currency, t.BIC, t.AccountNumber, t.RecipientName, t.Purpose,
+        t.Status, t.TransactionID, t.NextAttemptAt, t.CreatedAt).Scan(&t.ID)
+}
+
+func (r *externalTransferRepository) GetByID(id int) (*models.ExternalTransfer, error) {
+    t := &models.ExternalTransfer{}
+    err := scanExternalTransfer(r.db.QueryRow(`SELECT `+externalTransferColumns+` FROM external_transfers WHERE id=$1`, id), t)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("external transfer not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+// GetByTransactionID returns the transfer the debiting transaction belongs to.
+func (r *externalTransferRepository) GetByTransactionID(transactionID int) (*models.ExternalTransfer, error) {
+    t := &models.ExternalTransfer{}
+    err := scanExternalTransfer(r.db.QueryRow(`SELECT `+externalTransferColumns+` FROM external_transfers WHERE transaction_id=$1`, transactionID), t)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("external transfer not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+func (r *externalTransferRepository) GetByUserID(userID int) ([]models.ExternalTransfer, error) {
+    return r.list(`SELECT `+externalTransferColumns+` FROM external_transfers WHERE user_id=$1 ORDER BY created_at DESC`, userID)
+}
+
+// GetDue returns pending transfers whose next submission attempt is due, and transfers claimed for
+// submission before staleBefore whose worker never recorded the outcome.
+func (r *externalTransferRepository) GetDue(now, staleBefore time.Time) ([]models.ExternalTransfer, error) {
+    return r.list(`SELECT `+externalTransferColumns+` FROM external_transfers
+        WHERE (status='pending' AND next_attempt_at <= $1) OR (status='submitting' AND updated_at < $2) ORDER BY id`, now, staleBefore)
+}
+
+func (r *externalTransferRepository) GetSubmitted() ([]models.ExternalTransfer, error) {
+    return r.list(`SELECT ` + externalTransferColumns + ` FROM external_transfers WHERE status='submitted' ORDER BY id`)
+}
+
+// CountOpenByAccount counts transfers from the account that are neither settled nor returned yet.
+func (r *externalTransferRepository) CountOpenByAccount(accountID int) (int, error) {
+    var count int
+    err := r.db.QueryRow(`SELECT COUNT(*) FROM external_transfers WHERE from_account_id=$1 AND status IN ('held', 'pending', 'submitting', 'submitted')`, accountID).Scan(&count)
+    return count, err
+}
+
+// HasTransferredTo reports whether the user has sent money to the account at another bank before;
+// held and returned transfers do not count.
+func (r *externalTransferRepository) HasTransferredTo(userID int, bic, accountNumber string) (bool, error) {
+    query := `SELECT EXISTS(SELECT 1 FROM external_transfers
+        WHERE user_id=$1 AND bic=$2 AND account_number=$3 AND status IN ('pending', 'submitting', 'submitted', 'settled'))`
+    var exists bool
+    err := r.db.QueryRow(query, userID, bic, accountNumber).Scan(&exists)
+    return exists, err
+}
+
+// Claim moves a transfer returned by GetDue to submitting, so no other worker submits it; false
+// means it has changed since it was read.
+func (r *externalTransferRepository) Claim(t *models.ExternalTransfer) (bool, error) {
+    query := `UPDATE external_transfers SET status='submitting', updated_at=$1 WHERE id=$2 AND status=$3 AND updated_at=$4`
+    now := time.Now()
+    ok, err := r.update(query, now, t.ID, t.Status, t.UpdatedAt)
+    if ok {
+        t.Status = models.ExternalSubmitting
+        t.UpdatedAt = now
+    }
+    return ok, err
+}
+
+// MarkSubmitted moves a claimed transfer to submitted; false means it was not being submitted any more.
+func (r *externalTransferRepository) MarkSubmitted(id int, gatewayRef string) (bool, error) {
+    query := `UPDATE external_transfers SET status='submitted', gateway_ref=$1, attempts=attempts+1, updated_at=$2 WHERE id=$3 AND status='submitting'`
+    return r.update(query, gatewayRef, time.Now(), id)
+}
+
+// RecordFailedAttempt puts a claimed transfer back to pending until nextAttemptAt.
+func (r *externalTransferRepository) RecordFailedAttempt(id, attempts int, lastError string, nextAttemptAt time.Time) error {
+    query := `UPDATE external_transfers SET status='pending', attempts=$1, last_error=$2, next_attempt_at=$3, updated_at=$4 WHERE id=$5 AND status='submitting'`
+    _, err := r.db.Exec(query, attempts, lastError, nextAttemptAt, time.Now(), id)
+    return err
+}
+
+// Finish settles or returns a transfer that is still open; false means another run got there first.
+func (r *externalTransferRepository) Finish(id int, status, returnReason string) (bool, error) {
+    query := `UPDATE external_transfers SET status=$1, return_reason=$2, updated_at=$3 WHERE id=$4 AND status IN ('held', 'pending', 'submitting', 'submitted')`
+    return r.update(query, status, nullString(returnReason), time.Now(), id)
+}
+
+func (r *externalTransferRepository) SetReversal(id, transactionID int) error {
+    _, err := r.db.Exec(`UPDATE external_transfers SET reversal_transaction_id=$1, updated_at=$2 WHERE id=$3`, transactionID, time.Now(), id)
+    return err
+}
+
+// Release queues a held transfer for submission once staff approve it; false means it was not held.
+func (r *externalTransferRepository) Release(id int) (bool, error) {
+    now := time.Now()
+    return r.update(`UPDATE external_transfers SET status='pending', next_attempt_at=$1, updated_at=$1 WHERE id=$2 AND status='held'`, now, id)
+}
+
+func (r *externalTransferRepository) update(query string, args ...interface{}) (bool, error) {
+    res, err := r.db.Exec(query, args...)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n == 1, err
+}
+
+func (r *externalTransferRepository) list(query string, args ...interface{}) ([]models.ExternalTransfer, error) {
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var transfers []models.ExternalTransfer
+    for rows.Next() {
+        var t models.ExternalTransfer
+        if err := scanExternalTransfer(rows, &t); err != nil {
+            return nil, err
+        }
+        transfers = append(transfers, t)
+    }
+    return transfers, rows.Err()
+}
+
+func scanExternalTransfer(row rowScanner, t *models.ExternalTransfer) error {
+    var gatewayRef, returnReason, lastError sql.NullString
+    var reversalID sql.NullInt64
+    if err := row.Scan(&t.ID, &t.UserID, &t.FromAccountID, &t.Amount, &t.Currency, &t.BIC, &t.AccountNumber, &t.RecipientName, &t.Purpose,
+        &t.Status, &gatewayRef, &returnReason, &t.TransactionID, &reversalID, &t.Attempts, &lastError, &t.NextAttemptAt, &t.CreatedAt, &t.UpdatedAt); err != nil {
+        return err
+    }
+    t.GatewayRef = gatewayRef.String
+    t.ReturnReason = returnReason.String
+    t.LastError = lastError.String
+    if reversalID.Valid {
+        id := int(reversalID.Int64)
+        t.ReversalTransactionID = &id
+    }
+    return nil
+}
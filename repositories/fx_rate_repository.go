@@ -0,0 +1,104 @@
+package repositories
+
+import (
+    "database/sql"
+    "errors"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type FXRateRepository interface {
+    Upsert(rate *models.FXRate) error
+    GetOnDate(date time.Time) ([]models.FXRate, error)
+    GetRate(currency string, date time.Time) (*models.FXRate, error)
+    GetSeries(currency string, from, to time.Time) ([]models.FXRate, error)
+    LastFetchedAt() (time.Time, error)
+}
+
+type fxRateRepository struct {
+    db *sql.DB
+}
+
+func NewFXRateRepository(db *sql.DB) FXRateRepository {
+    return &fxRateRepository{db: db}
+}
+
+func (r *fxRateRepository) Upsert(rate *models.FXRate) error {
+    query := `INSERT INTO fx_rates (rate_date, currency, nominal, rate, created_at, fetched_at) VALUES ($1, $2, $3, $4, $5, $5)
+        ON CONFLICT (rate_date, currency) DO UPDATE SET nominal = EXCLUDED.nominal, rate = EXCLUDED.rate, fetched_at = EXCLUDED.fetched_at
+        RETURNING id`
+    rate.CreatedAt = time.Now()
+    rate.FetchedAt = rate.CreatedAt
+    return r.db.QueryRow(query, rate.Date, rate.Currency, rate.Nominal, rate.Rate, rate.CreatedAt).Scan(&rate.ID)
+}
+
+// LastFetchedAt returns when rates were last loaded from the CBR, or the zero time if never.
+func (r *fxRateRepository) LastFetchedAt() (time.Time, error) {
+    var at sql.NullTime
+    if err := r.db.QueryRow(`SELECT MAX(fetched_at) FROM fx_rates`).Scan(&at); err != nil {
+        return time.Time{}, err
+    }
+    return at.Time, nil
+}
+
+// GetOnDate returns the last rates published on or before date.
+func (r *fxRateRepository) GetOnDate(date time.Time) ([]models.FXRate, error) {
+    query := `SELECT id, rate_date, currency, nominal, rate, created_at FROM fx_rates
+        WHERE rate_date = (SELECT MAX(rate_date) FROM fx_rates WHERE rate_date <= $1)
+        ORDER BY currency`
+    rows, err := r.db.Query(query, date)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var rates []models.FXRate
+    for rows.Next() {
+        var fr models.FXRate
+        if err := rows.Scan(&fr.ID, &fr.Date, &fr.Currency, &fr.Nominal, &fr.Rate, &fr.CreatedAt); err != nil {
+            return nil, err
+        }
+        rates = append(rates, fr)
+    }
+    return rates, nil
+}
+
+// GetRate returns the last rate for currency published on or before date.
+func (r *fxRateRepository) GetRate(currency string, date time.Time) (*models.FXRate, error) {
+    fr := &models.FXRate{}
+    query := `SELECT id, rate_date, currency, nominal, rate, created_at FROM fx_rates
+        WHERE currency=$1 AND rate_date <= $2 ORDER BY rate_date DESC LIMIT 1`
+    err := r.db.QueryRow(query, currency, date).Scan(&fr.ID, &fr.Date, &fr.Currency, &fr.Nominal, &fr.Rate, &fr.CreatedAt)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("exchange rate not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return fr, nil
+}
+
+// GetSeries returns the rates for currency published between from and to, preceded by the last
+// rate published before from so callers can fill leading gaps.
+func (r *fxRateRepository) GetSeries(currency string, from, to time.Time) ([]models.FXRate, error) {
+    query := `SELECT id, rate_date, currency, nominal, rate, created_at FROM fx_rates
+        WHERE currency=$1 AND rate_date <= $3
+          AND rate_date >= COALESCE((SELECT MAX(rate_date) FROM fx_rates WHERE currency=$1 AND rate_date <= $2), $2)
+        ORDER BY rate_date`
+    rows, err := r.db.Query(query, currency, from, to)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var rates []models.FXRate
+    for rows.Next() {
+        var fr models.FXRate
+        if err := rows.Scan(&fr.ID, &fr.Date, &fr.Currency, &fr.Nominal, &fr.Rate, &fr.CreatedAt); err != nil {
+            return nil, err
+        }
+        rates = append(rates, fr)
+    }
+    return rates, nil
+}
@@ -0,0 +1,105 @@
+package repositories
+
+import (
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/lib/pq"
+
+    "banking_service_project/models"
+)
+
+type HeldTransferRepository interface {
+    Create(ht *models.HeldTransfer) error
+    GetByID(id int) (*models.HeldTransfer, error)
+    GetByStatus(status string) ([]models.HeldTransfer, error)
+    Decide(id int, status string, transactionID *int) (bool, error)
+}
+
+type heldTransferRepository struct {
+    db dbtx
+}
+
+func NewHeldTransferRepository(db *sql.DB) HeldTransferRepository {
+    return &heldTransferRepository{db: db}
+}
+
+const heldTransferColumns = `id, user_id, from_account_id, to_account_id, external_transfer_id, amount, reasons, status, transaction_id, created_at, decided_at`
+
+func (r *heldTransferRepository) Create(ht *models.HeldTransfer) error {
+    query := `INSERT INTO held_transfers (user_id, from_account_id, to_account_id, external_transfer_id, amount, reasons, status, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+    ht.CreatedAt = time.Now()
+    return r.db.QueryRow(query, ht.UserID, ht.FromAccountID, nullInt(ht.ToAccountID), ht.ExternalTransferID, ht.Amount, pq.Array(ht.Reasons), ht.Status,
+        ht.CreatedAt).Scan(&ht.ID)
+}
+
+func (r *heldTransferRepository) GetByID(id int) (*models.HeldTransfer, error) {
+    query := `SELECT ` + heldTransferColumns + ` FROM held_transfers WHERE id=$1`
+    ht := &models.HeldTransfer{}
+    err := scanHeldTransfer(r.db.QueryRow(query, id), ht)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("held transfer not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return ht, nil
+}
+
+func (r *heldTransferRepository) GetByStatus(status string) ([]models.HeldTransfer, error) {
+    query := `SELECT ` + heldTransferColumns + ` FROM held_transfers WHERE status=$1 ORDER BY created_at`
+    rows, err := r.db.Query(query, status)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var held []models.HeldTransfer
+    for rows.Next() {
+        var ht models.HeldTransfer
+        if err := scanHeldTransfer(rows, &ht); err != nil {
+            return nil, err
+        }
+        held = append(held, ht)
+    }
+    return held, nil
+}
+
+// Decide records the staff decision; it reports false if the transfer is no longer pending.
+func (r *heldTransferRepository) Decide(id int, status string, transactionID *int) (bool, error) {
+    query := `UPDATE held_transfers SET status=$1, transaction_id=$2, decided_at=$3 WHERE id=$4 AND status='pending'`
+    res, err := r.db.Exec(query, status, transactionID, time.Now(), id)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n == 1, nil
+}
+
+func scanHeldTransfer(row rowScanner, ht *models.HeldTransfer) error {
+    var toAccountID, externalID, txID sql.NullInt64
+    var decidedAt sql.NullTime
+    err := row.Scan(&ht.ID, &ht.UserID, &ht.FromAccountID, &toAccountID, &externalID, &ht.Amount, pq.Array(&ht.Reasons), &ht.Status, &txID,
+        &ht.CreatedAt, &decidedAt)
+    if err != nil {
+        return err
+    }
+    ht.ToAccountID = int(toAccountID.Int64)
+    if externalID.Valid {
+        id := int(externalID.Int64)
+        ht.ExternalTransferID = &id
+    }
+    if txID.Valid {
+        id := int(txID.Int64)
+        ht.TransactionID = &id
+    }
+    if decidedAt.Valid {
+        ht.DecidedAt = &decidedAt.Time
+    }
+    return nil
+}
@@ -0,0 +1,55 @@
+package repositories
+
+import (
+    "database/sql"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type LoginEventRepository interface {
+    Create(event *models.LoginEvent) error
+    HasDevice(userID int, deviceID string) (bool, error)
+    HasAny(userID int) (bool, error)
+    LastNewDevice(userID int) (*time.Time, error)
+}
+
+type loginEventRepository struct {
+    db *sql.DB
+}
+
+func NewLoginEventRepository(db *sql.DB) LoginEventRepository {
+    return &loginEventRepository{db: db}
+}
+
+func (r *loginEventRepository) Create(event *models.LoginEvent) error {
+    query := `INSERT INTO login_events (user_id, ip, user_agent, device_id, new_device, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+    event.CreatedAt = time.Now()
+    return r.db.QueryRow(query, event.UserID, event.IP, event.UserAgent, event.DeviceID, event.NewDevice, event.CreatedAt).Scan(&event.ID)
+}
+
+func (r *loginEventRepository) HasDevice(userID int, deviceID string) (bool, error) {
+    var exists bool
+    query := `SELECT EXISTS(SELECT 1 FROM login_events WHERE user_id=$1 AND device_id=$2)`
+    err := r.db.QueryRow(query, userID, deviceID).Scan(&exists)
+    return exists, err
+}
+
+func (r *loginEventRepository) HasAny(userID int) (bool, error) {
+    var exists bool
+    query := `SELECT EXISTS(SELECT 1 FROM login_events WHERE user_id=$1)`
+    err := r.db.QueryRow(query, userID).Scan(&exists)
+    return exists, err
+}
+
+func (r *loginEventRepository) LastNewDevice(userID int) (*time.Time, error) {
+    var last sql.NullTime
+    query := `SELECT MAX(created_at) FROM login_events WHERE user_id=$1 AND new_device`
+    if err := r.db.QueryRow(query, userID).Scan(&last); err != nil {
+        return nil, err
+    }
+    if !last.Valid {
+        return nil, nil
+    }
+    return &last.Time, nil
+}
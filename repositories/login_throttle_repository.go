@@ -0,0 +1,66 @@
+package repositories
+
+import (
+    "database/sql"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type LoginThrottleRepository interface {
+    Get(key string) (*models.LoginThrottle, error)
+    RecordFailure(key string, now, resetBefore time.Time) (*models.LoginThrottle, error)
+    Lock(key string, until time.Time) error
+    Reset(key string) error
+}
+
+type loginThrottleRepository struct {
+    db *sql.DB
+}
+
+func NewLoginThrottleRepository(db *sql.DB) LoginThrottleRepository {
+    return &loginThrottleRepository{db: db}
+}
+
+// Get returns nil without an error when the key has no recorded failures.
+func (r *loginThrottleRepository) Get(key string) (*models.LoginThrottle, error) {
+    query := `SELECT key, failures, last_failure_at, locked_until FROM login_throttles WHERE key=$1`
+    t, err := scanLoginThrottle(r.db.QueryRow(query, key))
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return t, err
+}
+
+// RecordFailure increments the counter; a counter whose last failure is older than resetBefore
+// starts over from one.
+func (r *loginThrottleRepository) RecordFailure(key string, now, resetBefore time.Time) (*models.LoginThrottle, error) {
+    query := `INSERT INTO login_throttles (key, failures, last_failure_at) VALUES ($1, 1, $2)
+        ON CONFLICT (key) DO UPDATE SET
+            failures = CASE WHEN login_throttles.last_failure_at < $3 THEN 1 ELSE login_throttles.failures + 1 END,
+            last_failure_at = $2
+        RETURNING key, failures, last_failure_at, locked_until`
+    return scanLoginThrottle(r.db.QueryRow(query, key, now, resetBefore))
+}
+
+func (r *loginThrottleRepository) Lock(key string, until time.Time) error {
+    _, err := r.db.Exec(`UPDATE login_throttles SET locked_until=$1 WHERE key=$2`, until, key)
+    return err
+}
+
+func (r *loginThrottleRepository) Reset(key string) error {
+    _, err := r.db.Exec(`DELETE FROM login_throttles WHERE key=$1`, key)
+    return err
+}
+
+func scanLoginThrottle(row rowScanner) (*models.LoginThrottle, error) {
+    t := &models.LoginThrottle{}
+    var lockedUntil sql.NullTime
+    if err := row.Scan(&t.Key, &t.Failures, &t.LastFailureAt, &lockedUntil); err != nil {
+        return nil, err
+    }
+    if lockedUntil.Valid {
+        t.LockedUntil = &lockedUntil.Time
+    }
+    return t, nil
+}
@@ -0,0 +1,115 @@
+package repositories
+
+import (
+    "database/sql"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type NotificationRepository interface {
+    Enqueue(n *models.Notification) error
+    Record(n *models.Notification) error
+    GetDue(now time.Time, limit int) ([]models.Notification, error)
+    MarkSent(id, attempts int, at time.Time) error
+    RecordFailure(id, attempts int, lastError string, next time.Time, failed bool) error
+    GetPreferences(userID int) ([]models.NotificationPreference, error)
+    SetPreference(p *models.NotificationPreference) error
+}
+
+type notificationRepository struct {
+    db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) NotificationRepository {
+    return &notificationRepository{db: db}
+}
+
+func (r *notificationRepository) Enqueue(n *models.Notification) error {
+    query := `INSERT INTO notifications (user_id, template, channel, recipient, subject, text_body, html_body, status, next_attempt_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9) RETURNING id`
+    n.CreatedAt = time.Now()
+    n.NextAttemptAt = n.CreatedAt
+    n.Status = models.NotificationPending
+    return r.db.QueryRow(query, n.UserID, n.Template, n.Channel, n.Recipient, n.Subject, n.TextBody, nullString(n.HTMLBody),
+        n.Status, n.CreatedAt).Scan(&n.ID)
+}
+
+// Record stores a notification that was sent without the queue, with n.Status sent or failed. The
+// body is not stored.
+func (r *notificationRepository) Record(n *models.Notification) error {
+    query := `INSERT INTO notifications (user_id, template, channel, recipient, subject, status, attempts, last_error, next_attempt_at, created_at, sent_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $10) RETURNING id`
+    n.CreatedAt = time.Now()
+    n.NextAttemptAt = n.CreatedAt
+    if n.Status == models.NotificationSent {
+        n.SentAt = &n.CreatedAt
+    }
+    return r.db.QueryRow(query, n.UserID, n.Template, n.Channel, n.Recipient, n.Subject, n.Status, n.Attempts, nullString(n.LastError),
+        n.CreatedAt, n.SentAt).Scan(&n.ID)
+}
+
+func (r *notificationRepository) GetDue(now time.Time, limit int) ([]models.Notification, error) {
+    query := `SELECT id, user_id, template, channel, recipient, subject, text_body, html_body, status, attempts, last_error, next_attempt_at, created_at
+        FROM notifications WHERE status='pending' AND next_attempt_at <= $1 ORDER BY id LIMIT $2`
+    rows, err := r.db.Query(query, now, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var notifications []models.Notification
+    for rows.Next() {
+        var n models.Notification
+        var text, html, lastError sql.NullString
+        if err := rows.Scan(&n.ID, &n.UserID, &n.Template, &n.Channel, &n.Recipient, &n.Subject, &text, &html, &n.Status, &n.Attempts,
+            &lastError, &n.NextAttemptAt, &n.CreatedAt); err != nil {
+            return nil, err
+        }
+        n.TextBody = text.String
+        n.HTMLBody = html.String
+        n.LastError = lastError.String
+        notifications = append(notifications, n)
+    }
+    return notifications, rows.Err()
+}
+
+func (r *notificationRepository) MarkSent(id, attempts int, at time.Time) error {
+    query := `UPDATE notifications SET status='sent', attempts=$1, sent_at=$2, last_error=NULL, text_body=NULL, html_body=NULL WHERE id=$3`
+    _, err := r.db.Exec(query, attempts, at, id)
+    return err
+}
+
+func (r *notificationRepository) RecordFailure(id, attempts int, lastError string, next time.Time, failed bool) error {
+    query := `UPDATE notifications SET status='pending', attempts=$1, last_error=$2, next_attempt_at=$3 WHERE id=$4`
+    if failed {
+        query = `UPDATE notifications SET status='failed', attempts=$1, last_error=$2, next_attempt_at=$3, text_body=NULL, html_body=NULL WHERE id=$4`
+    }
+    _, err := r.db.Exec(query, attempts, lastError, next, id)
+    return err
+}
+
+func (r *notificationRepository) GetPreferences(userID int) ([]models.NotificationPreference, error) {
+    rows, err := r.db.Query(`SELECT user_id, category, channel, enabled FROM notification_preferences WHERE user_id=$1 ORDER BY category, channel`, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var prefs []models.NotificationPreference
+    for rows.Next() {
+        var p models.NotificationPreference
+        if err := rows.Scan(&p.UserID, &p.Category, &p.Channel, &p.Enabled); err != nil {
+            return nil, err
+        }
+        prefs = append(prefs, p)
+    }
+    return prefs, rows.Err()
+}
+
+func (r *notificationRepository) SetPreference(p *models.NotificationPreference) error {
+    query := `INSERT INTO notification_preferences (user_id, category, channel, enabled) VALUES ($1, $2, $3, $4)
+        ON CONFLICT (user_id, category, channel) DO UPDATE SET enabled=EXCLUDED.enabled`
+    _, err := r.db.Exec(query, p.UserID, p.Category, p.Channel, p.Enabled)
+    return err
+}
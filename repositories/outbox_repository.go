@@ -0,0 +1,103 @@
+package repositories
+
+import (
+    "database/sql"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type OutboxRepository interface {
+    Add(event *models.OutboxEvent) error
+    GetDue(now time.Time, limit int) ([]models.OutboxEvent, error)
+    GetDeliveredSubscribers(eventID int) (map[string]bool, error)
+    MarkDelivered(eventID int, subscriber string) error
+    MarkDispatched(eventID int) error
+    RecordFailure(eventID, attempts int, lastError string, nextAttemptAt time.Time, failed bool) error
+}
+
+type outboxRepository struct {
+    db dbtx
+}
+
+func NewOutboxRepository(db *sql.DB) OutboxRepository {
+    return &outboxRepository{db: db}
+}
+
+func (r *outboxRepository) Add(event *models.OutboxEvent) error {
+    query := `INSERT INTO outbox_events (type, payload, status, next_attempt_at, created_at) VALUES ($1, $2, $3, $4, $4) RETURNING id`
+    event.CreatedAt = time.Now()
+    event.NextAttemptAt = event.CreatedAt
+    event.Status = models.OutboxPending
+    return r.db.QueryRow(query, event.Type, []byte(event.Payload), event.Status, event.CreatedAt).Scan(&event.ID)
+}
+
+// GetDue returns pending events whose next delivery attempt is due, oldest first.
+func (r *outboxRepository) GetDue(now time.Time, limit int) ([]models.OutboxEvent, error) {
+    query := `SELECT id, type, payload, status, attempts, last_error, next_attempt_at, created_at, dispatched_at
+        FROM outbox_events WHERE status='pending' AND next_attempt_at <= $1 ORDER BY id LIMIT $2`
+    rows, err := r.db.Query(query, now, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var events []models.OutboxEvent
+    for rows.Next() {
+        var e models.OutboxEvent
+        var payload []byte
+        var lastError sql.NullString
+        var dispatchedAt sql.NullTime
+        if err := rows.Scan(&e.ID, &e.Type, &payload, &e.Status, &e.Attempts, &lastError, &e.NextAttemptAt, &e.CreatedAt, &dispatchedAt); err != nil {
+            return nil, err
+        }
+        e.Payload = payload
+        e.LastError = lastError.String
+        if dispatchedAt.Valid {
+            e.DispatchedAt = &dispatchedAt.Time
+        }
+        events = append(events, e)
+    }
+    return events, rows.Err()
+}
+
+// GetDeliveredSubscribers returns the subscribers that have already handled the event, so a retry
+// only goes to the ones that failed.
+func (r *outboxRepository) GetDeliveredSubscribers(eventID int) (map[string]bool, error) {
+    rows, err := r.db.Query(`SELECT subscriber FROM outbox_deliveries WHERE event_id=$1`, eventID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    delivered := make(map[string]bool)
+    for rows.Next() {
+        var subscriber string
+        if err := rows.Scan(&subscriber); err != nil {
+            return nil, err
+        }
+        delivered[subscriber] = true
+    }
+    return delivered, rows.Err()
+}
+
+func (r *outboxRepository) MarkDelivered(eventID int, subscriber string) error {
+    query := `INSERT INTO outbox_deliveries (event_id, subscriber, delivered_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+    _, err := r.db.Exec(query, eventID, subscriber, time.Now())
+    return err
+}
+
+func (r *outboxRepository) MarkDispatched(eventID int) error {
+    _, err := r.db.Exec(`UPDATE outbox_events SET status='dispatched', dispatched_at=$1 WHERE id=$2`, time.Now(), eventID)
+    return err
+}
+
+func (r *outboxRepository) RecordFailure(eventID, attempts int, lastError string, nextAttemptAt time.Time, failed bool) error {
+    status := models.OutboxPending
+    if failed {
+        status = models.OutboxFailed
+    }
+    query := `UPDATE outbox_events SET status=$1, attempts=$2, last_error=$3, next_attempt_at=$4 WHERE id=$5`
+    _, err := r.db.Exec(query, status, attempts, lastError, nextAttemptAt, eventID)
+    return err
+}
@@ -10,10 +10,15 @@ import (
 type PaymentScheduleRepository interface {
     Create(schedule *models.PaymentSchedule) error
     GetByCreditID(creditID int) ([]models.PaymentSchedule, error)
+    GetNextUnpaid(creditID int) (*models.PaymentSchedule, error)
+    MarkPaid(id int) (bool, error)
+    GetNewlyOverdue(before time.Time) ([]models.PaymentSchedule, error)
+    MarkOverdue(id int, at time.Time) (bool, error)
+    GetUnpaidDueBefore(before time.Time) ([]models.PaymentSchedule, error)
 }
 
 type paymentScheduleRepository struct {
-    db *sql.DB
+    db dbtx
 }
 
 func NewPaymentScheduleRepository(db *sql.DB) PaymentScheduleRepository {
@@ -47,3 +52,85 @@ func (r *paymentScheduleRepository) GetByCreditID(creditID int) ([]models.Paymen
     }
     return schedules, nil
 }
+
+// GetNextUnpaid returns the earliest unpaid installment, or nil if the credit is repaid.
+func (r *paymentScheduleRepository) GetNextUnpaid(creditID int) (*models.PaymentSchedule, error) {
+    query := `SELECT id, credit_id, due_date, amount, paid FROM payment_schedules WHERE credit_id=$1 AND NOT paid ORDER BY due_date, id LIMIT 1`
+    var ps models.PaymentSchedule
+    err := r.db.QueryRow(query, creditID).Scan(&ps.ID, &ps.CreditID, &ps.DueDate, &ps.Amount, &ps.Paid)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &ps, nil
+}
+
+// MarkPaid reports false if the installment was already paid.
+func (r *paymentScheduleRepository) MarkPaid(id int) (bool, error) {
+    res, err := r.db.Exec(`UPDATE payment_schedules SET paid=TRUE WHERE id=$1 AND NOT paid`, id)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n == 1, nil
+}
+
+// GetNewlyOverdue returns unpaid installments due before the given time that have not been marked
+// overdue yet.
+func (r *paymentScheduleRepository) GetNewlyOverdue(before time.Time) ([]models.PaymentSchedule, error) {
+    query := `SELECT id, credit_id, due_date, amount, paid FROM payment_schedules
+        WHERE NOT paid AND due_date < $1 AND overdue_at IS NULL ORDER BY due_date, id`
+    rows, err := r.db.Query(query, before)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var schedules []models.PaymentSchedule
+    for rows.Next() {
+        var ps models.PaymentSchedule
+        if err := rows.Scan(&ps.ID, &ps.CreditID, &ps.DueDate, &ps.Amount, &ps.Paid); err != nil {
+            return nil, err
+        }
+        schedules = append(schedules, ps)
+    }
+    return schedules, rows.Err()
+}
+
+// MarkOverdue reports false if the installment was already marked or has been paid meanwhile.
+func (r *paymentScheduleRepository) MarkOverdue(id int, at time.Time) (bool, error) {
+    res, err := r.db.Exec(`UPDATE payment_schedules SET overdue_at=$1 WHERE id=$2 AND overdue_at IS NULL AND NOT paid`, at, id)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n == 1, nil
+}
+
+// GetUnpaidDueBefore returns unpaid installments of every credit due before the given time.
+func (r *paymentScheduleRepository) GetUnpaidDueBefore(before time.Time) ([]models.PaymentSchedule, error) {
+    query := `SELECT id, credit_id, due_date, amount, paid FROM payment_schedules WHERE NOT paid AND due_date < $1 ORDER BY due_date, id`
+    rows, err := r.db.Query(query, before)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var schedules []models.PaymentSchedule
+    for rows.Next() {
+        var ps models.PaymentSchedule
+        if err := rows.Scan(&ps.ID, &ps.CreditID, &ps.DueDate, &ps.Amount, &ps.Paid); err != nil {
+            return nil, err
+        }
+        schedules = append(schedules, ps)
+    }
+    return schedules, rows.Err()
+}
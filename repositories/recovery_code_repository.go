@@ -0,0 +1,53 @@
+package repositories
+
+import (
+    "database/sql"
+    "time"
+)
+
+// RecoveryCodeRepository stores hashes of one-time 2FA recovery codes.
+type RecoveryCodeRepository interface {
+    Replace(userID int, codeHashes []string) error
+    Use(userID int, codeHash string) (bool, error)
+}
+
+type recoveryCodeRepository struct {
+    db *sql.DB
+}
+
+func NewRecoveryCodeRepository(db *sql.DB) RecoveryCodeRepository {
+    return &recoveryCodeRepository{db: db}
+}
+
+// Replace drops the user's previous codes and stores the new set.
+func (r *recoveryCodeRepository) Replace(userID int, codeHashes []string) error {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id=$1`, userID); err != nil {
+        return err
+    }
+    now := time.Now()
+    for _, hash := range codeHashes {
+        if _, err := tx.Exec(`INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, $3)`, userID, hash, now); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+// Use marks a code as used and reports false if it does not exist or was used before.
+func (r *recoveryCodeRepository) Use(userID int, codeHash string) (bool, error) {
+    res, err := r.db.Exec(`UPDATE mfa_recovery_codes SET used_at=$1 WHERE user_id=$2 AND code_hash=$3 AND used_at IS NULL`, time.Now(), userID, codeHash)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n == 1, nil
+}
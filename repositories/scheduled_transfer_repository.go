@@ -0,0 +1,154 @@
+package repositories
+
+import (
+    "database/sql"
+    "errors"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type ScheduledTransferRepository interface {
+    Create(st *models.ScheduledTransfer) error
+    GetByID(id int) (*models.ScheduledTransfer, error)
+    GetByUserID(userID int) ([]models.ScheduledTransfer, error)
+    GetDue(now time.Time) ([]models.ScheduledTransfer, error)
+    Update(st *models.ScheduledTransfer) error
+    Advance(st *models.ScheduledTransfer, dueAt time.Time) (bool, error)
+    CreateRun(run *models.ScheduledTransferRun) error
+    GetRuns(scheduledTransferID int) ([]models.ScheduledTransferRun, error)
+}
+
+type scheduledTransferRepository struct {
+    db dbtx
+}
+
+func NewScheduledTransferRepository(db *sql.DB) ScheduledTransferRepository {
+    return &scheduledTransferRepository{db: db}
+}
+
+const scheduledTransferColumns = `id, user_id, from_account_id, to_account_id, amount, frequency, day_of_month, next_run_at, retry_at, end_date, status, failure_count, created_at`
+
+func (r *scheduledTransferRepository) Create(st *models.ScheduledTransfer) error {
+    query := `INSERT INTO scheduled_transfers (user_id, from_account_id, to_account_id, amount, frequency, day_of_month, next_run_at, end_date, status, failure_count, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+    st.CreatedAt = time.Now()
+    return r.db.QueryRow(query, st.UserID, st.FromAccountID, st.ToAccountID, st.Amount, st.Frequency, st.DayOfMonth,
+        st.NextRunAt, st.EndDate, st.Status, st.FailureCount, st.CreatedAt).Scan(&st.ID)
+}
+
+func (r *scheduledTransferRepository) GetByID(id int) (*models.ScheduledTransfer, error) {
+    query := `SELECT ` + scheduledTransferColumns + ` FROM scheduled_transfers WHERE id=$1`
+    st := &models.ScheduledTransfer{}
+    err := scanScheduledTransfer(r.db.QueryRow(query, id), st)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("scheduled transfer not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return st, nil
+}
+
+func (r *scheduledTransferRepository) GetByUserID(userID int) ([]models.ScheduledTransfer, error) {
+    query := `SELECT ` + scheduledTransferColumns + ` FROM scheduled_transfers WHERE user_id=$1 ORDER BY id`
+    return r.query(query, userID)
+}
+
+// GetDue returns active schedules whose next run (or pending retry) is at or before now.
+func (r *scheduledTransferRepository) GetDue(now time.Time) ([]models.ScheduledTransfer, error) {
+    query := `SELECT ` + scheduledTransferColumns + ` FROM scheduled_transfers
+        WHERE status='active' AND COALESCE(retry_at, next_run_at) <= $1 ORDER BY id`
+    return r.query(query, now)
+}
+
+func (r *scheduledTransferRepository) Update(st *models.ScheduledTransfer) error {
+    query := `UPDATE scheduled_transfers SET next_run_at=$1, retry_at=$2, status=$3, failure_count=$4 WHERE id=$5`
+    _, err := r.db.Exec(query, st.NextRunAt, st.RetryAt, st.Status, st.FailureCount, st.ID)
+    return err
+}
+
+// Advance saves the outcome of the run that was due at dueAt. It reports false if that run has
+// already been handled, by another worker or a user's change to the schedule.
+func (r *scheduledTransferRepository) Advance(st *models.ScheduledTransfer, dueAt time.Time) (bool, error) {
+    query := `UPDATE scheduled_transfers SET next_run_at=$1, retry_at=$2, status=$3, failure_count=$4
+        WHERE id=$5 AND status='active' AND COALESCE(retry_at, next_run_at)=$6`
+    res, err := r.db.Exec(query, st.NextRunAt, st.RetryAt, st.Status, st.FailureCount, st.ID, dueAt)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n == 1, nil
+}
+
+func (r *scheduledTransferRepository) CreateRun(run *models.ScheduledTransferRun) error {
+    query := `INSERT INTO scheduled_transfer_runs (scheduled_transfer_id, transaction_id, success, error, run_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+    run.RunAt = time.Now()
+    return r.db.QueryRow(query, run.ScheduledTransferID, run.TransactionID, run.Success, run.Error, run.RunAt).Scan(&run.ID)
+}
+
+func (r *scheduledTransferRepository) GetRuns(scheduledTransferID int) ([]models.ScheduledTransferRun, error) {
+    query := `SELECT id, scheduled_transfer_id, transaction_id, success, error, run_at FROM scheduled_transfer_runs
+        WHERE scheduled_transfer_id=$1 ORDER BY run_at DESC`
+    rows, err := r.db.Query(query, scheduledTransferID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var runs []models.ScheduledTransferRun
+    for rows.Next() {
+        var run models.ScheduledTransferRun
+        var txID sql.NullInt64
+        if err := rows.Scan(&run.ID, &run.ScheduledTransferID, &txID, &run.Success, &run.Error, &run.RunAt); err != nil {
+            return nil, err
+        }
+        if txID.Valid {
+            id := int(txID.Int64)
+            run.TransactionID = &id
+        }
+        runs = append(runs, run)
+    }
+    return runs, nil
+}
+
+func (r *scheduledTransferRepository) query(query string, args ...interface{}) ([]models.ScheduledTransfer, error) {
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var transfers []models.ScheduledTransfer
+    for rows.Next() {
+        var st models.ScheduledTransfer
+        if err := scanScheduledTransfer(rows, &st); err != nil {
+            return nil, err
+        }
+        transfers = append(transfers, st)
+    }
+    return transfers, nil
+}
+
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+func scanScheduledTransfer(row rowScanner, st *models.ScheduledTransfer) error {
+    var retryAt, endDate sql.NullTime
+    err := row.Scan(&st.ID, &st.UserID, &st.FromAccountID, &st.ToAccountID, &st.Amount, &st.Frequency, &st.DayOfMonth,
+        &st.NextRunAt, &retryAt, &endDate, &st.Status, &st.FailureCount, &st.CreatedAt)
+    if err != nil {
+        return err
+    }
+    if retryAt.Valid {
+        st.RetryAt = &retryAt.Time
+    }
+    if endDate.Valid {
+        st.EndDate = &endDate.Time
+    }
+    return nil
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import "database/sql"
+
+// dbtx is the part of *sql.DB and *sql.Tx the repositories use, so the same repository code runs
+// inside and outside a transaction.
+type dbtx interface {
+    Exec(query string, args ...interface{}) (sql.Result, error)
+    Query(query string, args ...interface{}) (*sql.Rows, error)
+    QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Tx holds repositories bound to one database transaction.
+type Tx struct {
+    Accounts          AccountRepository
+    Transactions      TransactionRepository
+    Credits           CreditRepository
+    Schedules         PaymentScheduleRepository
+    Cards             CardRepository
+    ExternalTransfers ExternalTransferRepository
+    HeldTransfers     HeldTransferRepository
+    Scheduled         ScheduledTransferRepository
+    Users             UserRepository
+    Tokens            TokenRepository
+    AMLCases          AMLCaseRepository
+    Audit             AuditRepository
+    Outbox            OutboxRepository
+}
+
+// Store runs a business change and the events it publishes in one transaction: fn's changes are
+// committed if it returns nil and rolled back otherwise.
+type Store interface {
+    InTx(fn func(tx *Tx) error) error
+}
+
+type store struct {
+    db *sql.DB
+}
+
+func NewStore(db *sql.DB) Store {
+    return &store{db: db}
+}
+
+func (s *store) InTx(fn func(tx *Tx) error) error {
+    sqlTx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer sqlTx.Rollback()
+
+    tx := &Tx{
+        Accounts:          &accountRepository{db: sqlTx},
+        Transactions:      &transactionRepository{db: sqlTx},
+        Credits:           &creditRepository{db: sqlTx},
+        Schedules:         &paymentScheduleRepository{db: sqlTx},
+        Cards:             &cardRepository{db: sqlTx},
+        ExternalTransfers: &externalTransferRepository{db: sqlTx},
+        HeldTransfers:     &heldTransferRepository{db: sqlTx},
+        Scheduled:         &scheduledTransferRepository{db: sqlTx},
+        Users:             &userRepository{db: sqlTx},
+        Tokens:            &tokenRepository{db: sqlTx},
+        AMLCases:          &amlCaseRepository{db: sqlTx},
+        Audit:             &auditRepository{db: sqlTx},
+        Outbox:            &outboxRepository{db: sqlTx},
+    }
+    if err := fn(tx); err != nil {
+        return err
+    }
+    return sqlTx.Commit()
+}
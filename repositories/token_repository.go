@@ -0,0 +1,108 @@
+package repositories
+
+import (
+    "database/sql"
+    "errors"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type TokenRepository interface {
+    CreateRefreshToken(t *models.RefreshToken) error
+    GetRefreshTokenByHash(hash string) (*models.RefreshToken, error)
+    MarkRefreshTokenUsed(id int) (bool, error)
+    RevokeFamily(familyID string) error
+    RevokeUserTokens(userID int) error
+    RevokeOtherSessions(userID int, familyID string) error
+    RevokeAccessToken(jti string, expiresAt time.Time) error
+    IsAccessTokenRevoked(jti string) (bool, error)
+}
+
+type tokenRepository struct {
+    db dbtx
+}
+
+func NewTokenRepository(db *sql.DB) TokenRepository {
+    return &tokenRepository{db: db}
+}
+
+func (r *tokenRepository) CreateRefreshToken(t *models.RefreshToken) error {
+    query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_jti, access_expires_at, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+    t.CreatedAt = time.Now()
+    return r.db.QueryRow(query, t.UserID, t.FamilyID, t.TokenHash, t.AccessJTI, t.AccessExpiresAt, t.ExpiresAt, t.CreatedAt).Scan(&t.ID)
+}
+
+func (r *tokenRepository) GetRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+    query := `SELECT id, user_id, family_id, token_hash, access_jti, access_expires_at, expires_at, created_at, used_at, revoked_at FROM refresh_tokens WHERE token_hash=$1`
+    t := &models.RefreshToken{}
+    var usedAt, revokedAt sql.NullTime
+    err := r.db.QueryRow(query, hash).Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.AccessJTI, &t.AccessExpiresAt, &t.ExpiresAt, &t.CreatedAt, &usedAt, &revokedAt)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("refresh token not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    if usedAt.Valid {
+        t.UsedAt = &usedAt.Time
+    }
+    if revokedAt.Valid {
+        t.RevokedAt = &revokedAt.Time
+    }
+    return t, nil
+}
+
+// MarkRefreshTokenUsed reports false if the token was already used or revoked, so two concurrent
+// refreshes with the same token cannot both succeed.
+func (r *tokenRepository) MarkRefreshTokenUsed(id int) (bool, error) {
+    res, err := r.db.Exec(`UPDATE refresh_tokens SET used_at=$1 WHERE id=$2 AND used_at IS NULL AND revoked_at IS NULL`, time.Now(), id)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n == 1, nil
+}
+
+func (r *tokenRepository) RevokeFamily(familyID string) error {
+    return r.revoke(`family_id=$2`, familyID)
+}
+
+func (r *tokenRepository) RevokeUserTokens(userID int) error {
+    return r.revoke(`user_id=$2`, userID)
+}
+
+// RevokeOtherSessions revokes every session of the user except the one with familyID.
+func (r *tokenRepository) RevokeOtherSessions(userID int, familyID string) error {
+    return r.revoke(`user_id=$2 AND family_id<>$3`, userID, familyID)
+}
+
+// revoke revokes the matching refresh tokens and denylists the access tokens issued with them
+// that have not expired yet. In where, $1 is the current time and args start at $2. Both happen in
+// one statement, so it works inside and outside a transaction.
+func (r *tokenRepository) revoke(where string, args ...interface{}) error {
+    now := time.Now()
+    args = append([]interface{}{now}, args...)
+    query := `WITH denied AS (
+            INSERT INTO revoked_tokens (jti, expires_at)
+            SELECT access_jti, access_expires_at FROM refresh_tokens WHERE ` + where + ` AND access_expires_at > $1
+            ON CONFLICT (jti) DO NOTHING
+        )
+        UPDATE refresh_tokens SET revoked_at=$1 WHERE ` + where + ` AND revoked_at IS NULL`
+    _, err := r.db.Exec(query, args...)
+    return err
+}
+
+func (r *tokenRepository) RevokeAccessToken(jti string, expiresAt time.Time) error {
+    _, err := r.db.Exec(`INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+    return err
+}
+
+func (r *tokenRepository) IsAccessTokenRevoked(jti string) (bool, error) {
+    var exists bool
+    err := r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti=$1)`, jti).Scan(&exists)
+    return exists, err
+}
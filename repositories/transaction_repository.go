@@ -9,12 +9,20 @@ import (
 
 type TransactionRepository interface {
     Create(tx *models.Transaction) error
+    GetByID(id int) (*models.Transaction, error)
     GetByAccountID(accountID int) ([]models.Transaction, error)
     GetByUserID(userID int) ([]models.Transaction, error)
+    SumOutgoingByUser(userID int, since time.Time) (map[string]float64, error)
+    SumOutgoingByAccount(accountID int, since time.Time) (float64, error)
+    SumOutgoingToAccount(userID, toAccountID int, since time.Time) (map[string]float64, error)
+    CountOutgoingByUser(userID int, since time.Time) (int, error)
+    HasTransferredTo(userID, toAccountID int) (bool, error)
+    SumInterestPaid(accountID int) (float64, error)
+    GetTransfersSince(since time.Time) ([]models.Transaction, error)
 }
 
 type transactionRepository struct {
-    db *sql.DB
+    db dbtx
 }
 
 func NewTransactionRepository(db *sql.DB) TransactionRepository {
@@ -22,17 +30,27 @@ func NewTransactionRepository(db *sql.DB) TransactionRepository {
 }
 
 func (r *transactionRepository) Create(tx *models.Transaction) error {
-    query := `INSERT INTO transactions (from_account_id, to_account_id, amount, type, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+    query := `INSERT INTO transactions (from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, fx_spread, type, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
     tx.CreatedAt = time.Now()
-    err := r.db.QueryRow(query, tx.FromAccountID, tx.ToAccountID, tx.Amount, tx.Type, tx.CreatedAt).Scan(&tx.ID)
+    err := r.db.QueryRow(query, nullInt(tx.FromAccountID), nullInt(tx.ToAccountID), tx.Amount, tx.Currency, tx.ToAmount, tx.ToCurrency, tx.ExchangeRate, tx.FXSpread, tx.Type, tx.CreatedAt).Scan(&tx.ID)
     if err != nil {
         return err
     }
     return nil
 }
 
+func (r *transactionRepository) GetByID(id int) (*models.Transaction, error) {
+    query := `SELECT id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, fx_spread, type, created_at FROM transactions WHERE id=$1`
+    var t models.Transaction
+    err := scanTransaction(r.db.QueryRow(query, id), &t)
+    if err != nil {
+        return nil, err
+    }
+    return &t, nil
+}
+
 func (r *transactionRepository) GetByAccountID(accountID int) ([]models.Transaction, error) {
-    query := `SELECT id, from_account_id, to_account_id, amount, type, created_at FROM transactions WHERE from_account_id=$1 OR to_account_id=$1`
+    query := `SELECT id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, fx_spread, type, created_at FROM transactions WHERE from_account_id=$1 OR to_account_id=$1`
     rows, err := r.db.Query(query, accountID)
     if err != nil {
         return nil, err
@@ -42,7 +60,28 @@ func (r *transactionRepository) GetByAccountID(accountID int) ([]models.Transact
     var transactions []models.Transaction
     for rows.Next() {
         var t models.Transaction
-        if err := rows.Scan(&t.ID, &t.FromAccountID, &t.ToAccountID, &t.Amount, &t.Type, &t.CreatedAt); err != nil {
+        if err := scanTransaction(rows, &t); err != nil {
+            return nil, err
+        }
+        transactions = append(transactions, t)
+    }
+    return transactions, nil
+}
+
+// GetTransfersSince returns transfers between customers and transfers to other banks, oldest first.
+func (r *transactionRepository) GetTransfersSince(since time.Time) ([]models.Transaction, error) {
+    query := `SELECT id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, fx_spread, type, created_at FROM transactions
+        WHERE type IN ('transfer', 'external_transfer') AND created_at >= $1 ORDER BY created_at`
+    rows, err := r.db.Query(query, since)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var transactions []models.Transaction
+    for rows.Next() {
+        var t models.Transaction
+        if err := scanTransaction(rows, &t); err != nil {
             return nil, err
         }
         transactions = append(transactions, t)
@@ -54,3 +93,94 @@ func (r *transactionRepository) GetByUserID(userID int) ([]models.Transaction, e
     // TODO: Implement joining accounts to filter by user
     return nil, nil
 }
+
+// SumOutgoingByUser returns the user's outgoing transfer volume since the given time, per currency,
+// transfers to other banks included. Moves between the user's own accounts are not counted here or
+// in SumOutgoingByAccount.
+func (r *transactionRepository) SumOutgoingByUser(userID int, since time.Time) (map[string]float64, error) {
+    query := `SELECT t.currency, COALESCE(SUM(t.amount), 0) FROM transactions t
+        JOIN accounts fa ON fa.id = t.from_account_id
+        LEFT JOIN accounts ta ON ta.id = t.to_account_id
+        WHERE fa.user_id=$1 AND (t.type='external_transfer' OR (t.type='transfer' AND ta.user_id <> fa.user_id)) AND t.created_at >= $2
+        GROUP BY t.currency`
+    return r.sumByCurrency(query, userID, since)
+}
+
+// SumOutgoingByAccount returns the account's outgoing transfer volume since the given time, in the account's currency.
+func (r *transactionRepository) SumOutgoingByAccount(accountID int, since time.Time) (float64, error) {
+    query := `SELECT COALESCE(SUM(t.amount), 0) FROM transactions t
+        JOIN accounts fa ON fa.id = t.from_account_id
+        LEFT JOIN accounts ta ON ta.id = t.to_account_id
+        WHERE t.from_account_id=$1 AND (t.type='external_transfer' OR (t.type='transfer' AND ta.user_id <> fa.user_id)) AND t.created_at >= $2`
+    var sum float64
+    err := r.db.QueryRow(query, accountID, since).Scan(&sum)
+    return sum, err
+}
+
+// SumOutgoingToAccount returns what the user sent to one counterparty account since the given time, per currency.
+func (r *transactionRepository) SumOutgoingToAccount(userID, toAccountID int, since time.Time) (map[string]float64, error) {
+    query := `SELECT t.currency, COALESCE(SUM(t.amount), 0) FROM transactions t
+        JOIN accounts fa ON fa.id = t.from_account_id
+        WHERE fa.user_id=$1 AND t.to_account_id=$2 AND t.type='transfer' AND t.created_at >= $3
+        GROUP BY t.currency`
+    return r.sumByCurrency(query, userID, toAccountID, since)
+}
+
+// CountOutgoingByUser counts the transfers SumOutgoingByUser adds up.
+func (r *transactionRepository) CountOutgoingByUser(userID int, since time.Time) (int, error) {
+    query := `SELECT COUNT(*) FROM transactions t
+        JOIN accounts fa ON fa.id = t.from_account_id
+        LEFT JOIN accounts ta ON ta.id = t.to_account_id
+        WHERE fa.user_id=$1 AND (t.type='external_transfer' OR (t.type='transfer' AND ta.user_id <> fa.user_id)) AND t.created_at >= $2`
+    var count int
+    err := r.db.QueryRow(query, userID, since).Scan(&count)
+    return count, err
+}
+
+func (r *transactionRepository) HasTransferredTo(userID, toAccountID int) (bool, error) {
+    query := `SELECT EXISTS(SELECT 1 FROM transactions t
+        JOIN accounts fa ON fa.id = t.from_account_id
+        WHERE fa.user_id=$1 AND t.to_account_id=$2 AND t.type='transfer')`
+    var exists bool
+    err := r.db.QueryRow(query, userID, toAccountID).Scan(&exists)
+    return exists, err
+}
+
+// SumInterestPaid returns the interest credited to the account net of reversals.
+func (r *transactionRepository) SumInterestPaid(accountID int) (float64, error) {
+    query := `SELECT COALESCE(SUM(CASE WHEN type='interest' THEN amount ELSE -amount END), 0) FROM transactions
+        WHERE (type='interest' AND to_account_id=$1) OR (type='interest_reversal' AND from_account_id=$1)`
+    var sum float64
+    err := r.db.QueryRow(query, accountID).Scan(&sum)
+    return sum, err
+}
+
+func (r *transactionRepository) sumByCurrency(query string, args ...interface{}) (map[string]float64, error) {
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    sums := make(map[string]float64)
+    for rows.Next() {
+        var currency string
+        var sum float64
+        if err := rows.Scan(&currency, &sum); err != nil {
+            return nil, err
+        }
+        sums[currency] = sum
+    }
+    return sums, nil
+}
+
+// scanTransaction reads a transaction row; a missing side (deposits, payments to the bank) becomes 0.
+func scanTransaction(row rowScanner, t *models.Transaction) error {
+    var fromID, toID sql.NullInt64
+    if err := row.Scan(&t.ID, &fromID, &toID, &t.Amount, &t.Currency, &t.ToAmount, &t.ToCurrency, &t.ExchangeRate, &t.FXSpread, &t.Type, &t.CreatedAt); err != nil {
+        return err
+    }
+    t.FromAccountID = int(fromID.Int64)
+    t.ToAccountID = int(toID.Int64)
+    return nil
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+    "database/sql"
+    "time"
+
+    "github.com/lib/pq"
+
+    "banking_service_project/models"
+)
+
+type TransferDigestRepository interface {
+    Add(item *models.TransferDigestItem) error
+    GetUnsentBefore(before time.Time) ([]models.TransferDigestItem, error)
+    MarkSent(ids []int, at time.Time) error
+}
+
+type transferDigestRepository struct {
+    db *sql.DB
+}
+
+func NewTransferDigestRepository(db *sql.DB) TransferDigestRepository {
+    return &transferDigestRepository{db: db}
+}
+
+// Add ignores a transfer that is already in the user's digest.
+func (r *transferDigestRepository) Add(item *models.TransferDigestItem) error {
+    query := `INSERT INTO transfer_digest_items (user_id, transaction_id, incoming, account_number, counterparty, amount, currency, balance, at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (user_id, transaction_id, incoming) DO NOTHING RETURNING id`
+    err := r.db.QueryRow(query, item.UserID, item.TransactionID, item.Incoming, item.AccountNumber, item.Counterparty, item.Amount, item.Currency,
+        item.Balance, item.At).Scan(&item.ID)
+    if err == sql.ErrNoRows {
+        return nil
+    }
+    return err
+}
+
+// GetUnsentBefore returns items not sent yet that happened before the given time, grouped by user.
+func (r *transferDigestRepository) GetUnsentBefore(before time.Time) ([]models.TransferDigestItem, error) {
+    query := `SELECT id, user_id, transaction_id, incoming, account_number, counterparty, amount, currency, balance, at
+        FROM transfer_digest_items WHERE sent_at IS NULL AND at < $1 ORDER BY user_id, at, id`
+    rows, err := r.db.Query(query, before)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var items []models.TransferDigestItem
+    for rows.Next() {
+        var item models.TransferDigestItem
+        if err := rows.Scan(&item.ID, &item.UserID, &item.TransactionID, &item.Incoming, &item.AccountNumber, &item.Counterparty,
+            &item.Amount, &item.Currency, &item.Balance, &item.At); err != nil {
+            return nil, err
+        }
+        items = append(items, item)
+    }
+    return items, rows.Err()
+}
+
+func (r *transferDigestRepository) MarkSent(ids []int, at time.Time) error {
+    _, err := r.db.Exec(`UPDATE transfer_digest_items SET sent_at=$1 WHERE id = ANY($2)`, at, pq.Array(ids))
+    return err
+}
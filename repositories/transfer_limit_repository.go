@@ -0,0 +1,36 @@
+package repositories
+
+import (
+    "database/sql"
+
+    "banking_service_project/models"
+)
+
+type TransferLimitRepository interface {
+    GetByTier(tier string) (*models.TransferLimits, error)
+}
+
+type transferLimitRepository struct {
+    db *sql.DB
+}
+
+func NewTransferLimitRepository(db *sql.DB) TransferLimitRepository {
+    return &transferLimitRepository{db: db}
+}
+
+// GetByTier returns nil if the tier has no configured limits.
+func (r *transferLimitRepository) GetByTier(tier string) (*models.TransferLimits, error) {
+    l := &models.TransferLimits{}
+    query := `SELECT tier, min_amount, max_amount, daily_user, monthly_user, daily_account, monthly_account, daily_counterparty,
+        monthly_counterparty
+        FROM transfer_limits WHERE tier=$1`
+    err := r.db.QueryRow(query, tier).Scan(&l.Tier, &l.MinAmount, &l.MaxAmount, &l.DailyUser, &l.MonthlyUser,
+        &l.DailyAccount, &l.MonthlyAccount, &l.DailyCounterparty, &l.MonthlyCounterparty)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return l, nil
+}
@@ -3,57 +3,204 @@ package repositories
 import (
     "database/sql"
     "errors"
+    "strings"
     "time"
 
+    "github.com/lib/pq"
+
     "banking_service_project/models"
 )
 
 type UserRepository interface {
     Create(user *models.User) error
+    GetByID(userID int) (*models.User, error)
     GetByEmail(email string) (*models.User, error)
     GetByUsername(username string) (*models.User, error)
+    GetByPhone(phone string) (*models.User, error)
+    SetDefaultAccount(userID, accountID int) error
+    SetTOTPSecret(userID int, secret string) error
+    EnableTOTP(userID int) error
+    UseTOTPStep(userID int, step int64) (bool, error)
+    MarkEmailVerified(userID int) error
+    UpdatePassword(userID int, passwordHash string) error
+    UpdateProfile(user *models.User) error
+    Close(userID int) error
+    SetRoles(userID int, roles []string) error
+    Search(query string, limit int) ([]models.User, error)
 }
 
 type userRepository struct {
-    db *sql.DB
+    db dbtx
 }
 
 func NewUserRepository(db *sql.DB) UserRepository {
     return &userRepository{db: db}
 }
 
+const userColumns = `id, username, email, phone, full_name, preferred_language, password, tier, roles, password_changed_at, email_verified_at, default_account_id, totp_secret, totp_enabled, totp_last_step, closed_at, created_at`
+
 func (r *userRepository) Create(user *models.User) error {
-    query := `INSERT INTO users (username, email, password, created_at) VALUES ($1, $2, $3, $4) RETURNING id`
+    query := `INSERT INTO users (username, email, phone, full_name, preferred_language, password, tier, roles, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
     user.CreatedAt = time.Now()
-    err := r.db.QueryRow(query, user.Username, user.Email, user.Password, user.CreatedAt).Scan(&user.ID)
+    if user.Tier == "" {
+        user.Tier = models.TierStandard
+    }
+    if len(user.Roles) == 0 {
+        user.Roles = []string{models.RoleCustomer}
+    }
+    if user.PreferredLanguage == "" {
+        user.PreferredLanguage = models.DefaultLanguage
+    }
+    err := r.db.QueryRow(query, user.Username, user.Email, nullString(user.Phone), nullString(user.FullName), user.PreferredLanguage, user.Password, user.Tier, pq.Array(user.Roles), user.CreatedAt).Scan(&user.ID)
     if err != nil {
         return err
     }
     return nil
 }
 
+func (r *userRepository) GetByID(userID int) (*models.User, error) {
+    query := `SELECT ` + userColumns + ` FROM users WHERE id=$1`
+    return scanUser(r.db.QueryRow(query, userID))
+}
+
 func (r *userRepository) GetByEmail(email string) (*models.User, error) {
-    user := &models.User{}
-    query := `SELECT id, username, email, password, created_at FROM users WHERE email=$1`
-    err := r.db.QueryRow(query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt)
-    if err == sql.ErrNoRows {
-        return nil, errors.New("user not found")
+    query := `SELECT ` + userColumns + ` FROM users WHERE email=$1`
+    return scanUser(r.db.QueryRow(query, email))
+}
+
+func (r *userRepository) GetByUsername(username string) (*models.User, error) {
+    query := `SELECT ` + userColumns + ` FROM users WHERE username=$1`
+    return scanUser(r.db.QueryRow(query, username))
+}
+
+func (r *userRepository) GetByPhone(phone string) (*models.User, error) {
+    query := `SELECT ` + userColumns + ` FROM users WHERE phone=$1`
+    return scanUser(r.db.QueryRow(query, phone))
+}
+
+func (r *userRepository) SetDefaultAccount(userID, accountID int) error {
+    query := `UPDATE users SET default_account_id=$1 WHERE id=$2`
+    _, err := r.db.Exec(query, accountID, userID)
+    return err
+}
+
+// SetTOTPSecret stores a new, not yet confirmed secret; 2FA stays off until EnableTOTP.
+func (r *userRepository) SetTOTPSecret(userID int, secret string) error {
+    query := `UPDATE users SET totp_secret=$1, totp_enabled=FALSE, totp_last_step=0 WHERE id=$2`
+    _, err := r.db.Exec(query, secret, userID)
+    return err
+}
+
+func (r *userRepository) EnableTOTP(userID int) error {
+    query := `UPDATE users SET totp_enabled=TRUE WHERE id=$1`
+    _, err := r.db.Exec(query, userID)
+    return err
+}
+
+// UseTOTPStep records step as used and reports false if it or a later step was already accepted.
+func (r *userRepository) UseTOTPStep(userID int, step int64) (bool, error) {
+    res, err := r.db.Exec(`UPDATE users SET totp_last_step=$1 WHERE id=$2 AND totp_last_step < $1`, step, userID)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return false, err
     }
+    return n == 1, nil
+}
+
+func (r *userRepository) MarkEmailVerified(userID int) error {
+    query := `UPDATE users SET email_verified_at=$1 WHERE id=$2 AND email_verified_at IS NULL`
+    _, err := r.db.Exec(query, time.Now(), userID)
+    return err
+}
+
+// UpdatePassword also records the change time, which fraud screening takes into account.
+func (r *userRepository) UpdatePassword(userID int, passwordHash string) error {
+    query := `UPDATE users SET password=$1, password_changed_at=$2 WHERE id=$3`
+    _, err := r.db.Exec(query, passwordHash, time.Now(), userID)
+    return err
+}
+
+// UpdateProfile saves the editable profile fields together with email_verified_at, which is
+// cleared when the email changes.
+func (r *userRepository) UpdateProfile(user *models.User) error {
+    query := `UPDATE users SET username=$1, email=$2, phone=$3, full_name=$4, preferred_language=$5, email_verified_at=$6 WHERE id=$7`
+    _, err := r.db.Exec(query, user.Username, user.Email, nullString(user.Phone), nullString(user.FullName), user.PreferredLanguage, user.EmailVerifiedAt, user.ID)
+    return err
+}
+
+func (r *userRepository) Close(userID int) error {
+    query := `UPDATE users SET closed_at=$1 WHERE id=$2 AND closed_at IS NULL`
+    _, err := r.db.Exec(query, time.Now(), userID)
+    return err
+}
+
+func (r *userRepository) SetRoles(userID int, roles []string) error {
+    query := `UPDATE users SET roles=$1 WHERE id=$2`
+    _, err := r.db.Exec(query, pq.Array(roles), userID)
+    return err
+}
+
+// Search finds users whose username, email, phone or full name contains query, case-insensitively.
+func (r *userRepository) Search(query string, limit int) ([]models.User, error) {
+    pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+    rows, err := r.db.Query(`SELECT `+userColumns+` FROM users
+        WHERE username ILIKE $1 OR email ILIKE $1 OR phone ILIKE $1 OR full_name ILIKE $1
+        ORDER BY id LIMIT $2`, pattern, limit)
     if err != nil {
         return nil, err
     }
-    return user, nil
+    defer rows.Close()
+
+    users := []models.User{}
+    for rows.Next() {
+        user, err := scanUser(rows)
+        if err != nil {
+            return nil, err
+        }
+        users = append(users, *user)
+    }
+    return users, rows.Err()
 }
 
-func (r *userRepository) GetByUsername(username string) (*models.User, error) {
+func scanUser(row rowScanner) (*models.User, error) {
     user := &models.User{}
-    query := `SELECT id, username, email, password, created_at FROM users WHERE username=$1`
-    err := r.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt)
+    var phone, fullName sql.NullString
+    var passwordChangedAt, emailVerifiedAt, closedAt sql.NullTime
+    var defaultAccountID sql.NullInt64
+    var totpSecret sql.NullString
+    err := row.Scan(&user.ID, &user.Username, &user.Email, &phone, &fullName, &user.PreferredLanguage, &user.Password, &user.Tier, pq.Array(&user.Roles), &passwordChangedAt, &emailVerifiedAt, &defaultAccountID, &totpSecret, &user.TOTPEnabled, &user.TOTPLastStep, &closedAt, &user.CreatedAt)
     if err == sql.ErrNoRows {
         return nil, errors.New("user not found")
     }
     if err != nil {
         return nil, err
     }
+    user.Phone = phone.String
+    user.FullName = fullName.String
+    user.TOTPSecret = totpSecret.String
+    if passwordChangedAt.Valid {
+        user.PasswordChangedAt = &passwordChangedAt.Time
+    }
+    if emailVerifiedAt.Valid {
+        user.EmailVerifiedAt = &emailVerifiedAt.Time
+    }
+    if closedAt.Valid {
+        user.ClosedAt = &closedAt.Time
+    }
+    if defaultAccountID.Valid {
+        id := int(defaultAccountID.Int64)
+        user.DefaultAccountID = &id
+    }
     return user, nil
 }
+
+func nullString(s string) sql.NullString {
+    return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt(id int) sql.NullInt64 {
+    return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+    "database/sql"
+    "errors"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type UserTokenRepository interface {
+    Create(t *models.UserToken) error
+    GetByHash(purpose, hash string) (*models.UserToken, error)
+    MarkUsed(id int) (bool, error)
+    InvalidateForUser(userID int, purpose string) error
+    DeleteForUser(userID int, purpose string) error
+}
+
+type userTokenRepository struct {
+    db *sql.DB
+}
+
+func NewUserTokenRepository(db *sql.DB) UserTokenRepository {
+    return &userTokenRepository{db: db}
+}
+
+func (r *userTokenRepository) Create(t *models.UserToken) error {
+    query := `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+    t.CreatedAt = time.Now()
+    return r.db.QueryRow(query, t.UserID, t.Purpose, t.TokenHash, t.ExpiresAt, t.CreatedAt).Scan(&t.ID)
+}
+
+func (r *userTokenRepository) GetByHash(purpose, hash string) (*models.UserToken, error) {
+    query := `SELECT id, user_id, purpose, token_hash, expires_at, used_at, created_at FROM user_tokens WHERE purpose=$1 AND token_hash=$2`
+    t := &models.UserToken{}
+    var usedAt sql.NullTime
+    err := r.db.QueryRow(query, purpose, hash).Scan(&t.ID, &t.UserID, &t.Purpose, &t.TokenHash, &t.ExpiresAt, &usedAt, &t.CreatedAt)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("token not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    if usedAt.Valid {
+        t.UsedAt = &usedAt.Time
+    }
+    return t, nil
+}
+
+// MarkUsed reports false if the token was already used, so it cannot be redeemed twice concurrently.
+func (r *userTokenRepository) MarkUsed(id int) (bool, error) {
+    res, err := r.db.Exec(`UPDATE user_tokens SET used_at=$1 WHERE id=$2 AND used_at IS NULL`, time.Now(), id)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n == 1, nil
+}
+
+// InvalidateForUser marks all unused tokens of the purpose as used, e.g. when a newer one is sent.
+func (r *userTokenRepository) InvalidateForUser(userID int, purpose string) error {
+    _, err := r.db.Exec(`UPDATE user_tokens SET used_at=$1 WHERE user_id=$2 AND purpose=$3 AND used_at IS NULL`, time.Now(), userID, purpose)
+    return err
+}
+
+// DeleteForUser removes all tokens of the purpose, used or not. Short codes are replaced this way,
+// as an old row with the same code would clash with the new one.
+func (r *userTokenRepository) DeleteForUser(userID int, purpose string) error {
+    _, err := r.db.Exec(`DELETE FROM user_tokens WHERE user_id=$1 AND purpose=$2`, userID, purpose)
+    return err
+}
@@ -0,0 +1,269 @@
+package repositories
+
+import (
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/lib/pq"
+
+    "banking_service_project/models"
+)
+
+type WebhookRepository interface {
+    CreateEndpoint(e *models.WebhookEndpoint) error
+    GetEndpoint(id int) (*models.WebhookEndpoint, error)
+    GetEndpointsByUser(userID int) ([]models.WebhookEndpoint, error)
+    GetSubscribedEndpoints(userID int, eventType string) ([]models.WebhookEndpoint, error)
+    DeleteEndpoint(id int) error
+    Enable(id int) error
+    Disable(id int, reason string) error
+    ClearFailing(id int) error
+    MarkFailing(id int, at time.Time) (time.Time, error)
+
+    CreateDelivery(d *models.WebhookDelivery) error
+    GetDelivery(id int) (*models.WebhookDelivery, error)
+    GetDeliveriesByEndpoint(endpointID, limit int) ([]models.WebhookDelivery, error)
+    GetDueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error)
+    MarkDelivered(id, attempts, responseCode int, at time.Time) error
+    RecordFailure(id, attempts int, responseCode *int, lastError string, next time.Time, failed bool) error
+    Redeliver(id int, at time.Time) error
+
+    AddAttempt(a *models.WebhookAttempt) error
+    GetAttempts(deliveryID int) ([]models.WebhookAttempt, error)
+}
+
+type webhookRepository struct {
+    db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) WebhookRepository {
+    return &webhookRepository{db: db}
+}
+
+const webhookEndpointColumns = `id, user_id, url, event_types, secret, active, failing_since, disabled_reason, created_at`
+
+const webhookDeliveryColumns = `id, endpoint_id, event_id, event_type, payload, status, attempts, last_response_code, last_error,
+    next_attempt_at, created_at, delivered_at`
+
+func (r *webhookRepository) CreateEndpoint(e *models.WebhookEndpoint) error {
+    query := `INSERT INTO webhook_endpoints (user_id, url, event_types, secret, active, created_at) VALUES ($1, $2, $3, $4, TRUE, $5) RETURNING id`
+    e.CreatedAt = time.Now()
+    e.Active = true
+    return r.db.QueryRow(query, e.UserID, e.URL, pq.Array(e.EventTypes), e.Secret, e.CreatedAt).Scan(&e.ID)
+}
+
+func (r *webhookRepository) GetEndpoint(id int) (*models.WebhookEndpoint, error) {
+    e := &models.WebhookEndpoint{}
+    err := scanWebhookEndpoint(r.db.QueryRow(`SELECT `+webhookEndpointColumns+` FROM webhook_endpoints WHERE id=$1`, id), e)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("webhook not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return e, nil
+}
+
+func (r *webhookRepository) GetEndpointsByUser(userID int) ([]models.WebhookEndpoint, error) {
+    return r.listEndpoints(`SELECT `+webhookEndpointColumns+` FROM webhook_endpoints WHERE user_id=$1 ORDER BY id`, userID)
+}
+
+// GetSubscribedEndpoints returns the user's active endpoints that receive events of eventType.
+func (r *webhookRepository) GetSubscribedEndpoints(userID int, eventType string) ([]models.WebhookEndpoint, error) {
+    return r.listEndpoints(`SELECT `+webhookEndpointColumns+` FROM webhook_endpoints
+        WHERE user_id=$1 AND active AND $2 = ANY(event_types) ORDER BY id`, userID, eventType)
+}
+
+func (r *webhookRepository) DeleteEndpoint(id int) error {
+    _, err := r.db.Exec(`DELETE FROM webhook_endpoints WHERE id=$1`, id)
+    return err
+}
+
+func (r *webhookRepository) Enable(id int) error {
+    _, err := r.db.Exec(`UPDATE webhook_endpoints SET active=TRUE, failing_since=NULL, disabled_reason=NULL WHERE id=$1`, id)
+    return err
+}
+
+func (r *webhookRepository) Disable(id int, reason string) error {
+    _, err := r.db.Exec(`UPDATE webhook_endpoints SET active=FALSE, disabled_reason=$1 WHERE id=$2`, reason, id)
+    return err
+}
+
+func (r *webhookRepository) ClearFailing(id int) error {
+    _, err := r.db.Exec(`UPDATE webhook_endpoints SET failing_since=NULL WHERE id=$1 AND failing_since IS NOT NULL`, id)
+    return err
+}
+
+// MarkFailing records a failed request and returns since when the endpoint has been failing
+// without a single success.
+func (r *webhookRepository) MarkFailing(id int, at time.Time) (time.Time, error) {
+    var since time.Time
+    err := r.db.QueryRow(`UPDATE webhook_endpoints SET failing_since=COALESCE(failing_since, $1) WHERE id=$2 RETURNING failing_since`, at, id).Scan(&since)
+    return since, err
+}
+
+// CreateDelivery does nothing if the event has already been queued for the endpoint, so handling an
+// event twice sends it once.
+func (r *webhookRepository) CreateDelivery(d *models.WebhookDelivery) error {
+    query := `INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $6) ON CONFLICT (endpoint_id, event_id) DO NOTHING RETURNING id`
+    d.CreatedAt = time.Now()
+    d.NextAttemptAt = d.CreatedAt
+    d.Status = models.WebhookDeliveryPending
+    err := r.db.QueryRow(query, d.EndpointID, d.EventID, d.EventType, []byte(d.Payload), d.Status, d.CreatedAt).Scan(&d.ID)
+    if err == sql.ErrNoRows {
+        return nil
+    }
+    return err
+}
+
+func (r *webhookRepository) GetDelivery(id int) (*models.WebhookDelivery, error) {
+    d := &models.WebhookDelivery{}
+    err := scanWebhookDelivery(r.db.QueryRow(`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE id=$1`, id), d)
+    if err == sql.ErrNoRows {
+        return nil, errors.New("delivery not found")
+    }
+    if err != nil {
+        return nil, err
+    }
+    return d, nil
+}
+
+func (r *webhookRepository) GetDeliveriesByEndpoint(endpointID, limit int) ([]models.WebhookDelivery, error) {
+    return r.listDeliveries(`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE endpoint_id=$1
+        ORDER BY id DESC LIMIT $2`, endpointID, limit)
+}
+
+// GetDueDeliveries returns pending deliveries to active endpoints whose next attempt is due.
+func (r *webhookRepository) GetDueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+    return r.listDeliveries(`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+        WHERE status='pending' AND next_attempt_at <= $1
+            AND endpoint_id IN (SELECT id FROM webhook_endpoints WHERE active)
+        ORDER BY id LIMIT $2`, now, limit)
+}
+
+func (r *webhookRepository) MarkDelivered(id, attempts, responseCode int, at time.Time) error {
+    query := `UPDATE webhook_deliveries SET status='delivered', attempts=$1, last_response_code=$2, last_error=NULL, delivered_at=$3 WHERE id=$4`
+    _, err := r.db.Exec(query, attempts, responseCode, at, id)
+    return err
+}
+
+func (r *webhookRepository) RecordFailure(id, attempts int, responseCode *int, lastError string, next time.Time, failed bool) error {
+    status := models.WebhookDeliveryPending
+    if failed {
+        status = models.WebhookDeliveryFailed
+    }
+    query := `UPDATE webhook_deliveries SET status=$1, attempts=$2, last_response_code=$3, last_error=$4, next_attempt_at=$5 WHERE id=$6`
+    _, err := r.db.Exec(query, status, attempts, responseCode, lastError, next, id)
+    return err
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts, whatever its status.
+func (r *webhookRepository) Redeliver(id int, at time.Time) error {
+    _, err := r.db.Exec(`UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=$1 WHERE id=$2`, at, id)
+    return err
+}
+
+func (r *webhookRepository) AddAttempt(a *models.WebhookAttempt) error {
+    query := `INSERT INTO webhook_attempts (delivery_id, response_code, error, duration_ms, attempted_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+    return r.db.QueryRow(query, a.DeliveryID, a.ResponseCode, nullString(a.Error), a.DurationMS, a.AttemptedAt).Scan(&a.ID)
+}
+
+func (r *webhookRepository) GetAttempts(deliveryID int) ([]models.WebhookAttempt, error) {
+    query := `SELECT id, delivery_id, response_code, error, duration_ms, attempted_at FROM webhook_attempts WHERE delivery_id=$1 ORDER BY id`
+    rows, err := r.db.Query(query, deliveryID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var attempts []models.WebhookAttempt
+    for rows.Next() {
+        var a models.WebhookAttempt
+        var code sql.NullInt64
+        var errText sql.NullString
+        if err := rows.Scan(&a.ID, &a.DeliveryID, &code, &errText, &a.DurationMS, &a.AttemptedAt); err != nil {
+            return nil, err
+        }
+        if code.Valid {
+            c := int(code.Int64)
+            a.ResponseCode = &c
+        }
+        a.Error = errText.String
+        attempts = append(attempts, a)
+    }
+    return attempts, rows.Err()
+}
+
+func (r *webhookRepository) listEndpoints(query string, args ...interface{}) ([]models.WebhookEndpoint, error) {
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var endpoints []models.WebhookEndpoint
+    for rows.Next() {
+        var e models.WebhookEndpoint
+        if err := scanWebhookEndpoint(rows, &e); err != nil {
+            return nil, err
+        }
+        endpoints = append(endpoints, e)
+    }
+    return endpoints, rows.Err()
+}
+
+func (r *webhookRepository) listDeliveries(query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var deliveries []models.WebhookDelivery
+    for rows.Next() {
+        var d models.WebhookDelivery
+        if err := scanWebhookDelivery(rows, &d); err != nil {
+            return nil, err
+        }
+        deliveries = append(deliveries, d)
+    }
+    return deliveries, rows.Err()
+}
+
+func scanWebhookEndpoint(row rowScanner, e *models.WebhookEndpoint) error {
+    var failingSince sql.NullTime
+    var reason sql.NullString
+    err := row.Scan(&e.ID, &e.UserID, &e.URL, pq.Array(&e.EventTypes), &e.Secret, &e.Active, &failingSince, &reason, &e.CreatedAt)
+    if err != nil {
+        return err
+    }
+    if failingSince.Valid {
+        e.FailingSince = &failingSince.Time
+    }
+    e.DisabledReason = reason.String
+    return nil
+}
+
+func scanWebhookDelivery(row rowScanner, d *models.WebhookDelivery) error {
+    var payload []byte
+    var code sql.NullInt64
+    var lastError sql.NullString
+    var deliveredAt sql.NullTime
+    err := row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &code, &lastError,
+        &d.NextAttemptAt, &d.CreatedAt, &deliveredAt)
+    if err != nil {
+        return err
+    }
+    d.Payload = payload
+    if code.Valid {
+        c := int(code.Int64)
+        d.LastResponseCode = &c
+    }
+    d.LastError = lastError.String
+    if deliveredAt.Valid {
+        d.DeliveredAt = &deliveredAt.Time
+    }
+    return nil
+}
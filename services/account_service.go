@@ -2,63 +2,380 @@ package services
 
 import (
     "errors"
+    "fmt"
+    "strings"
+    "time"
+
     "banking_service_project/models"
     "banking_service_project/repositories"
+    "banking_service_project/utils"
+)
+
+var (
+    ErrInvalidAccountStatus = errors.New("status must be active, frozen or debit_blocked")
+    ErrAccountHasCredits    = errors.New("credits on this account must be repaid before closing it")
+    ErrAccountHasTransfers  = errors.New("transfers to other banks from this account are still in progress")
+    ErrNegativeBalance      = errors.New("account with a negative balance cannot be closed")
+    ErrUnknownProduct       = errors.New("unknown account product")
+    ErrProductCurrency      = errors.New("currency does not match the product")
+    ErrInsufficientFunds    = errors.New("insufficient funds")
 )
 
+// AccountStatusError is returned when an account's status does not allow the operation.
+type AccountStatusError struct {
+    AccountID int    `json:"account_id"`
+    Status    string `json:"status"`
+}
+
+func (e *AccountStatusError) Error() string {
+    switch e.Status {
+    case models.AccountDebitBlocked:
+        return fmt.Sprintf("debits from account %d are blocked", e.AccountID)
+    case models.AccountClosed:
+        return fmt.Sprintf("account %d is closed", e.AccountID)
+    }
+    return fmt.Sprintf("account %d is %s", e.AccountID, e.Status)
+}
+
+// checkDebit allows money to leave only active accounts, and deposits only once they have matured.
+func checkDebit(acc *models.Account) error {
+    if acc.Status != models.AccountActive {
+        return &AccountStatusError{AccountID: acc.ID, Status: acc.Status}
+    }
+    if acc.Type == models.AccountTypeDeposit && acc.MaturesAt != nil && time.Now().Before(*acc.MaturesAt) {
+        return ErrDepositLocked
+    }
+    return nil
+}
+
+// checkCredit allows money into active and debit-blocked accounts.
+func checkCredit(acc *models.Account) error {
+    if acc.Status != models.AccountActive && acc.Status != models.AccountDebitBlocked {
+        return &AccountStatusError{AccountID: acc.ID, Status: acc.Status}
+    }
+    return nil
+}
+
 type AccountService interface {
-    CreateAccount(userID int) (*models.Account, error)
+    CreateAccount(userID int, currency, productCode string) (*models.Account, error)
+    ListProducts() ([]models.AccountProduct, error)
     GetUserAccounts(userID int) ([]models.Account, error)
     Deposit(accountID int, amount float64) error
     Withdraw(accountID int, amount float64) error
     GetAccountByID(accountID int) (*models.Account, error)
+    GetAccountByNumber(number string) (*models.Account, error)
+    AssignMissingNumbers() error
+    SetDefaultAccount(userID, accountID int) error
+    CloseAccount(userID, accountID, targetAccountID int) (*models.Account, error)
+    SetStatus(accountID int, status, reason string, changedBy int, then func(tx *repositories.Tx) error) error
 }
 
 type accountService struct {
     accountRepo     repositories.AccountRepository
     transactionRepo repositories.TransactionRepository
+    userRepo        repositories.UserRepository
+    creditRepo      repositories.CreditRepository
+    productRepo     repositories.AccountProductRepository
+    externalRepo    repositories.ExternalTransferRepository
+    transferService TransferService
+    interestService InterestService
+    store           repositories.Store
+    bankBIC         string
 }
 
-func NewAccountService(accountRepo repositories.AccountRepository, transactionRepo repositories.TransactionRepository) AccountService {
-    return &accountService{accountRepo: accountRepo, transactionRepo: transactionRepo}
+func NewAccountService(accountRepo repositories.AccountRepository, transactionRepo repositories.TransactionRepository, userRepo repositories.UserRepository, creditRepo repositories.CreditRepository, productRepo repositories.AccountProductRepository, externalRepo repositories.ExternalTransferRepository, transferService TransferService, interestService InterestService, store repositories.Store, bankBIC string) AccountService {
+    return &accountService{
+        accountRepo:     accountRepo,
+        transactionRepo: transactionRepo,
+        userRepo:        userRepo,
+        creditRepo:      creditRepo,
+        productRepo:     productRepo,
+        externalRepo:    externalRepo,
+        transferService: transferService,
+        interestService: interestService,
+        store:           store,
+        bankBIC:         bankBIC,
+    }
 }
 
-func (s *accountService) CreateAccount(userID int) (*models.Account, error) {
+// CreateAccount opens a current account, or a savings or deposit account if productCode is given.
+// The currency may be left empty for products; it defaults to the product's.
+func (s *accountService) CreateAccount(userID int, currency, productCode string) (*models.Account, error) {
+    var product *models.AccountProduct
+    if productCode != "" {
+        p, err := s.productRepo.GetByCode(productCode)
+        if err != nil || !p.Active {
+            return nil, ErrUnknownProduct
+        }
+        product = p
+        if currency == "" {
+            currency = product.Currency
+        }
+    }
+    currency, err := normalizeCurrency(currency)
+    if err != nil {
+        return nil, err
+    }
+    if _, ok := utils.AccountCurrencyCode(currency); !ok {
+        return nil, ErrInvalidCurrency
+    }
     account := &models.Account{
-        UserID:  userID,
-        Balance: 0,
+        UserID:   userID,
+        Balance:  0,
+        Currency: currency,
+        Type:     models.AccountTypeCurrent,
+    }
+    if product != nil {
+        if product.Currency != currency {
+            return nil, ErrProductCurrency
+        }
+        // Interest starts on the opening day's end-of-day balance
+        accruedTo := truncateDay(time.Now()).AddDate(0, 0, -1)
+        account.Type = product.Type
+        account.ProductID = &product.ID
+        account.InterestRate = s.interestService.OpeningRate(product)
+        account.InterestAccruedTo = &accruedTo
+        if product.Type == models.AccountTypeDeposit {
+            maturesAt := truncateDay(time.Now()).AddDate(0, product.TermMonths, 0)
+            account.MaturesAt = &maturesAt
+        }
+    }
+    if account.Number, err = s.newNumber(account); err != nil {
+        return nil, err
     }
     if err := s.accountRepo.Create(account); err != nil {
         return nil, err
     }
+
+    // The first account becomes the one incoming transfers by phone/username/email land on
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    if user.DefaultAccountID == nil {
+        if err := s.userRepo.SetDefaultAccount(userID, account.ID); err != nil {
+            return nil, err
+        }
+    }
     return account, nil
 }
 
+func (s *accountService) ListProducts() ([]models.AccountProduct, error) {
+    return s.productRepo.ListActive()
+}
+
 func (s *accountService) GetUserAccounts(userID int) ([]models.Account, error) {
     return s.accountRepo.GetByUserID(userID)
 }
 
 func (s *accountService) Deposit(accountID int, amount float64) error {
-    acc, err := s.accountRepo.GetByID(accountID)
-    if err != nil {
+    return s.store.InTx(func(tx *repositories.Tx) error {
+        locked, err := tx.Accounts.GetForUpdate(0, accountID)
+        if err != nil {
+            return err
+        }
+        if err := checkCredit(locked[accountID]); err != nil {
+            return err
+        }
+        _, err = tx.Accounts.AddToBalance(accountID, amount)
         return err
-    }
-    newBalance := acc.Balance + amount
-    return s.accountRepo.UpdateBalance(accountID, newBalance)
+    })
 }
 
 func (s *accountService) Withdraw(accountID int, amount float64) error {
-    acc, err := s.accountRepo.GetByID(accountID)
+    return s.store.InTx(func(tx *repositories.Tx) error {
+        locked, err := tx.Accounts.GetForUpdate(0, accountID)
+        if err != nil {
+            return err
+        }
+        acc := locked[accountID]
+        if err := checkDebit(acc); err != nil {
+            return err
+        }
+        if acc.Balance < amount {
+            return ErrInsufficientFunds
+        }
+        _, err = tx.Accounts.AddToBalance(accountID, -amount)
+        return err
+    })
+}
+
+func (s *accountService) GetAccountByID(accountID int) (*models.Account, error) {
+    return s.accountRepo.GetByID(accountID)
+}
+
+func (s *accountService) GetAccountByNumber(number string) (*models.Account, error) {
+    return s.accountRepo.GetByNumber(number)
+}
+
+// AssignMissingNumbers gives a number to accounts opened before account numbers existed.
+func (s *accountService) AssignMissingNumbers() error {
+    accounts, err := s.accountRepo.GetWithoutNumber()
     if err != nil {
         return err
     }
-    if acc.Balance < amount {
-        return errors.New("insufficient funds")
+    for i := range accounts {
+        number, err := s.newNumber(&accounts[i])
+        if err != nil {
+            return fmt.Errorf("account %d: %w", accounts[i].ID, err)
+        }
+        if err := s.accountRepo.SetNumber(accounts[i].ID, number); err != nil {
+            return err
+        }
     }
-    newBalance := acc.Balance - amount
-    return s.accountRepo.UpdateBalance(accountID, newBalance)
+    return nil
 }
 
-func (s *accountService) GetAccountByID(accountID int) (*models.Account, error) {
+// newNumber generates an account number that is not taken yet.
+func (s *accountService) newNumber(acc *models.Account) (string, error) {
+    for attempt := 0; attempt < 10; attempt++ {
+        number, err := utils.GenerateAccountNumber(balanceAccount(acc), acc.Currency, s.bankBIC)
+        if err != nil {
+            return "", err
+        }
+        exists, err := s.accountRepo.NumberExists(number)
+        if err != nil {
+            return "", err
+        }
+        if !exists {
+            return number, nil
+        }
+    }
+    return "", errors.New("could not generate a free account number")
+}
+
+// balanceAccount is the chart-of-accounts prefix for an individual's account: 40817 for current
+// and savings accounts, 42302–42307 for deposits depending on their term.
+func balanceAccount(acc *models.Account) string {
+    if acc.Type != models.AccountTypeDeposit || acc.MaturesAt == nil {
+        return "40817"
+    }
+    opened := acc.CreatedAt
+    if opened.IsZero() {
+        opened = time.Now()
+    }
+    days := acc.MaturesAt.Sub(truncateDay(opened)).Hours() / 24
+    switch {
+    case days <= 30:
+        return "42302"
+    case days <= 90:
+        return "42303"
+    case days <= 180:
+        return "42304"
+    case days <= 366:
+        return "42305"
+    case days <= 3*366:
+        return "42306"
+    }
+    return "42307"
+}
+
+func (s *accountService) SetDefaultAccount(userID, accountID int) error {
+    acc, err := s.accountRepo.GetByID(accountID)
+    if err != nil || acc.UserID != userID {
+        return errors.New("account not found")
+    }
+    if err := checkCredit(acc); err != nil {
+        return err
+    }
+    return s.userRepo.SetDefaultAccount(userID, accountID)
+}
+
+// CloseAccount closes one of the user's accounts, moving what is left on it to targetAccountID,
+// another account of the same user. Only active accounts without unpaid credits can be closed. If
+// the closed account was the default one, the target account takes its place. Accrued interest is
+// paid out first; see InterestService.Settle for deposits closed before maturity. Settling, moving
+// the balance and closing happen in one transaction with both accounts locked.
+func (s *accountService) CloseAccount(userID, accountID, targetAccountID int) (*models.Account, error) {
+    acc, err := s.accountRepo.GetByID(accountID)
+    if err != nil || acc.UserID != userID {
+        return nil, errors.New("account not found")
+    }
+    if targetAccountID == accountID {
+        return nil, errors.New("target account must differ from the closed one")
+    }
+    target, err := s.accountRepo.GetByID(targetAccountID)
+    if err != nil || target.UserID != userID {
+        return nil, errors.New("target account not found")
+    }
+
+    err = s.store.InTx(func(tx *repositories.Tx) error {
+        locked, err := tx.Accounts.GetForUpdate(0, accountID, targetAccountID)
+        if err != nil {
+            return err
+        }
+        acc, target := locked[accountID], locked[targetAccountID]
+        if acc.Status != models.AccountActive {
+            return &AccountStatusError{AccountID: acc.ID, Status: acc.Status}
+        }
+        if acc.Balance < 0 {
+            return ErrNegativeBalance
+        }
+        if err := checkCredit(target); err != nil {
+            return err
+        }
+        openCredits, err := tx.Credits.CountOpenByAccount(accountID)
+        if err != nil {
+            return err
+        }
+        if openCredits > 0 {
+            return ErrAccountHasCredits
+        }
+        openTransfers, err := tx.ExternalTransfers.CountOpenByAccount(accountID)
+        if err != nil {
+            return err
+        }
+        if openTransfers > 0 {
+            return ErrAccountHasTransfers
+        }
+
+        if err := s.interestService.Settle(tx, acc); err != nil {
+            return err
+        }
+        if acc.Balance > 0 {
+            if _, err := s.transferService.Sweep(tx, acc, target); err != nil {
+                return err
+            }
+        }
+        return tx.Accounts.SetStatus(accountID, models.AccountClosed, "closed by the customer", userID)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    if user.DefaultAccountID != nil && *user.DefaultAccountID == accountID {
+        if err := s.userRepo.SetDefaultAccount(userID, targetAccountID); err != nil {
+            return nil, err
+        }
+    }
     return s.accountRepo.GetByID(accountID)
 }
+
+// SetStatus is the staff side of account statuses; closing goes through CloseAccount, and a closed
+// account stays closed. then, if given, runs in the same database transaction as the change.
+func (s *accountService) SetStatus(accountID int, status, reason string, changedBy int, then func(tx *repositories.Tx) error) error {
+    if status != models.AccountActive && status != models.AccountFrozen && status != models.AccountDebitBlocked {
+        return ErrInvalidAccountStatus
+    }
+    reason = strings.TrimSpace(reason)
+    if reason == "" {
+        return ErrReasonRequired
+    }
+    return s.store.InTx(func(tx *repositories.Tx) error {
+        locked, err := tx.Accounts.GetForUpdate(0, accountID)
+        if err != nil {
+            return err
+        }
+        if acc := locked[accountID]; acc.Status == models.AccountClosed {
+            return &AccountStatusError{AccountID: acc.ID, Status: acc.Status}
+        }
+        if err := tx.Accounts.SetStatus(accountID, status, reason, changedBy); err != nil || then == nil {
+            return err
+        }
+        return then(tx)
+    })
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+const adminSearchLimit = 50
+
+var (
+    ErrUnknownRole    = errors.New("unknown role")
+    ErrOwnAdminRole   = errors.New("admins cannot remove their own admin role")
+    ErrReasonRequired = errors.New("reason is required")
+)
+
+// Actor is the staff member performing an admin action, as written to the audit log.
+type Actor struct {
+    UserID int
+    IP     string
+}
+
+// AdminService is the staff side of the bank. Every call is written to the audit log, reads
+// included; a read whose audit entry cannot be stored returns an error instead of the data, and a
+// change is written in the same database transaction as its entry, so neither is saved without the
+// other.
+type AdminService interface {
+    SearchUsers(actor Actor, query string) ([]models.User, error)
+    GetUser(actor Actor, userID int) (*models.User, error)
+    GetUserAccounts(actor Actor, userID int) ([]models.Account, error)
+    GetAccountTransactions(actor Actor, accountID int) ([]models.Transaction, error)
+    SetAccountStatus(actor Actor, accountID int, status, reason string) error
+    ListHeldTransfers(actor Actor, status string) ([]models.HeldTransfer, error)
+    ApproveHeldTransfer(actor Actor, id int) (*models.Transaction, error)
+    RejectHeldTransfer(actor Actor, id int, reason string) error
+    ListAMLCases(actor Actor, status string) ([]models.AMLCase, error)
+    GetAMLCase(actor Actor, id int) (*models.AMLCase, error)
+    ExportAMLCases(actor Actor, since time.Time) ([]byte, error)
+    CloseAMLCase(actor Actor, id int, reason string) error
+    SetUserRoles(actor Actor, userID int, roles []string) error
+    ListAudit(actorID int, since time.Time, limit int) ([]models.AuditEntry, error)
+    RecordDenied(userID int, ip, method, path string) error
+}
+
+type adminService struct {
+    userRepo        repositories.UserRepository
+    accountRepo     repositories.AccountRepository
+    transactionRepo repositories.TransactionRepository
+    auditRepo       repositories.AuditRepository
+    accountService  AccountService
+    transferService TransferService
+    amlService      AMLService
+    store           repositories.Store
+}
+
+func NewAdminService(userRepo repositories.UserRepository, accountRepo repositories.AccountRepository, transactionRepo repositories.TransactionRepository, auditRepo repositories.AuditRepository, accountService AccountService, transferService TransferService, amlService AMLService, store repositories.Store) AdminService {
+    return &adminService{
+        userRepo:        userRepo,
+        accountRepo:     accountRepo,
+        transactionRepo: transactionRepo,
+        auditRepo:       auditRepo,
+        accountService:  accountService,
+        transferService: transferService,
+        amlService:      amlService,
+        store:           store,
+    }
+}
+
+func (s *adminService) SearchUsers(actor Actor, query string) ([]models.User, error) {
+    query = strings.TrimSpace(query)
+    if query == "" {
+        return nil, errors.New("query is required")
+    }
+    users, err := s.userRepo.Search(query, adminSearchLimit)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.audit(actor, "user.search", "user", 0, query); err != nil {
+        return nil, err
+    }
+    return users, nil
+}
+
+func (s *adminService) GetUser(actor Actor, userID int) (*models.User, error) {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.audit(actor, "user.view", "user", userID, ""); err != nil {
+        return nil, err
+    }
+    return user, nil
+}
+
+func (s *adminService) GetUserAccounts(actor Actor, userID int) ([]models.Account, error) {
+    accounts, err := s.accountRepo.GetByUserID(userID)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.audit(actor, "user.accounts.view", "user", userID, ""); err != nil {
+        return nil, err
+    }
+    return accounts, nil
+}
+
+func (s *adminService) GetAccountTransactions(actor Actor, accountID int) ([]models.Transaction, error) {
+    if _, err := s.accountRepo.GetByID(accountID); err != nil {
+        return nil, err
+    }
+    txs, err := s.transactionRepo.GetByAccountID(accountID)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.audit(actor, "account.transactions.view", "account", accountID, ""); err != nil {
+        return nil, err
+    }
+    return txs, nil
+}
+
+func (s *adminService) SetAccountStatus(actor Actor, accountID int, status, reason string) error {
+    return s.accountService.SetStatus(accountID, status, reason, actor.UserID, func(tx *repositories.Tx) error {
+        return auditIn(tx, actor, "account.status."+status, "account", accountID, reason)
+    })
+}
+
+func (s *adminService) ListHeldTransfers(actor Actor, status string) ([]models.HeldTransfer, error) {
+    held, err := s.transferService.ListHeld(status)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.audit(actor, "held_transfer.list", "held_transfer", 0, status); err != nil {
+        return nil, err
+    }
+    return held, nil
+}
+
+func (s *adminService) ApproveHeldTransfer(actor Actor, id int) (*models.Transaction, error) {
+    return s.transferService.ApproveHeld(id, func(dbTx *repositories.Tx, tx *models.Transaction) error {
+        return auditIn(dbTx, actor, "held_transfer.approve", "held_transfer", id, fmt.Sprintf("transaction %d", tx.ID))
+    })
+}
+
+func (s *adminService) RejectHeldTransfer(actor Actor, id int, reason string) error {
+    reason = strings.TrimSpace(reason)
+    if reason == "" {
+        return ErrReasonRequired
+    }
+    return s.transferService.RejectHeld(id, func(tx *repositories.Tx) error {
+        return auditIn(tx, actor, "held_transfer.reject", "held_transfer", id, reason)
+    })
+}
+
+func (s *adminService) ListAMLCases(actor Actor, status string) ([]models.AMLCase, error) {
+    if status == "" {
+        status = models.AMLCaseOpen
+    }
+    cases, err := s.amlService.ListCases(status)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.audit(actor, "aml_case.list", "aml_case", 0, status); err != nil {
+        return nil, err
+    }
+    return cases, nil
+}
+
+// ExportAMLCases renders the cases opened since the given time as the CSV report the monitoring
+// job writes to AML_EXPORT_DIR.
+func (s *adminService) ExportAMLCases(actor Actor, since time.Time) ([]byte, error) {
+    report, err := s.amlService.ExportReports(since)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.audit(actor, "aml_case.export", "aml_case", 0, "since "+since.Format("2006-01-02")); err != nil {
+        return nil, err
+    }
+    return report, nil
+}
+
+func (s *adminService) GetAMLCase(actor Actor, id int) (*models.AMLCase, error) {
+    c, err := s.amlService.GetCase(id)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.audit(actor, "aml_case.view", "aml_case", id, ""); err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+func (s *adminService) CloseAMLCase(actor Actor, id int, reason string) error {
+    reason = strings.TrimSpace(reason)
+    if reason == "" {
+        return ErrReasonRequired
+    }
+    return s.amlService.CloseCase(id, func(tx *repositories.Tx) error {
+        return auditIn(tx, actor, "aml_case.close", "aml_case", id, reason)
+    })
+}
+
+// SetUserRoles replaces the roles of a user and ends their sessions, so a withdrawn role stops
+// working at once instead of when the access token expires.
+func (s *adminService) SetUserRoles(actor Actor, userID int, roles []string) error {
+    known := make(map[string]bool, len(models.Roles))
+    for _, role := range models.Roles {
+        known[role] = true
+    }
+    seen := make(map[string]bool, len(roles))
+    var normalized []string
+    for _, role := range roles {
+        if !known[role] {
+            return fmt.Errorf("%w: %s", ErrUnknownRole, role)
+        }
+        if !seen[role] {
+            seen[role] = true
+            normalized = append(normalized, role)
+        }
+    }
+    if len(normalized) == 0 {
+        normalized = []string{models.RoleCustomer}
+    }
+    if userID == actor.UserID && !seen[models.RoleAdmin] {
+        return ErrOwnAdminRole
+    }
+
+    if _, err := s.userRepo.GetByID(userID); err != nil {
+        return err
+    }
+    return s.store.InTx(func(tx *repositories.Tx) error {
+        if err := tx.Users.SetRoles(userID, normalized); err != nil {
+            return err
+        }
+        if err := tx.Tokens.RevokeUserTokens(userID); err != nil {
+            return err
+        }
+        return auditIn(tx, actor, "user.roles.set", "user", userID, strings.Join(normalized, ","))
+    })
+}
+
+func (s *adminService) ListAudit(actorID int, since time.Time, limit int) ([]models.AuditEntry, error) {
+    return s.auditRepo.List(actorID, since, limit)
+}
+
+// RecordDenied writes a request refused for lack of a role to the audit log.
+func (s *adminService) RecordDenied(userID int, ip, method, path string) error {
+    return s.audit(Actor{UserID: userID, IP: ip}, "access.denied", "route", 0, method+" "+path)
+}
+
+func (s *adminService) audit(actor Actor, action, targetType string, targetID int, details string) error {
+    return s.auditRepo.Create(auditEntry(actor, action, targetType, targetID, details))
+}
+
+// auditIn writes the audit entry of a change in the transaction making it.
+func auditIn(tx *repositories.Tx, actor Actor, action, targetType string, targetID int, details string) error {
+    return tx.Audit.Create(auditEntry(actor, action, targetType, targetID, details))
+}
+
+func auditEntry(actor Actor, action, targetType string, targetID int, details string) *models.AuditEntry {
+    return &models.AuditEntry{
+        ActorID:    actor.UserID,
+        Action:     action,
+        TargetType: targetType,
+        TargetID:   targetID,
+        Details:    details,
+        IP:         actor.IP,
+    }
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+func TestSetUserRolesEndsSessions(t *testing.T) {
+    users := &fakeUserRepo{users: map[int]*models.User{
+        1: {ID: 1, Roles: []string{models.RoleCustomer, models.RoleAdmin}},
+        7: {ID: 7, Roles: []string{models.RoleCustomer, models.RoleCompliance}},
+    }}
+    tokens := &fakeTokenRepo{}
+    audit := &fakeAuditRepo{}
+    store := &fakeStore{tx: &repositories.Tx{Users: users, Tokens: tokens, Audit: audit}}
+    s := NewAdminService(users, nil, nil, audit, nil, nil, nil, store)
+    admin := Actor{UserID: 1, IP: "10.0.0.1"}
+
+    if err := s.SetUserRoles(admin, 7, []string{models.RoleCustomer}); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(users.users[7].Roles, []string{models.RoleCustomer}) {
+        t.Errorf("roles %v, want [customer]", users.users[7].Roles)
+    }
+    if !reflect.DeepEqual(tokens.revokedUsers, []int{7}) {
+        t.Errorf("revoked sessions of %v, want [7]", tokens.revokedUsers)
+    }
+    if len(audit.entries) != 1 || audit.entries[0].Action != "user.roles.set" {
+        t.Errorf("audit %+v, want one user.roles.set entry", audit.entries)
+    }
+
+    if err := s.SetUserRoles(admin, 1, []string{models.RoleCustomer}); !errors.Is(err, ErrOwnAdminRole) {
+        t.Errorf("dropping own admin role: got %v, want ErrOwnAdminRole", err)
+    }
+    if err := s.SetUserRoles(admin, 7, []string{"root"}); !errors.Is(err, ErrUnknownRole) {
+        t.Errorf("unknown role: got %v, want ErrUnknownRole", err)
+    }
+    if len(tokens.revokedUsers) != 1 {
+        t.Errorf("rejected changes revoked sessions: %v", tokens.revokedUsers)
+    }
+}
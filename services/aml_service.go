@@ -0,0 +1,396 @@
+package services
+
+import (
+    "bytes"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+const (
+    amlScanWindow = 30 * 24 * time.Hour
+
+    // Transfers from this amount (in rubles) are subject to mandatory control
+    amlReportingThreshold  = 1000000
+    amlStructuringBand     = 0.9 // "just under" means at least 90% of the threshold
+    amlStructuringMinCount = 3
+    amlStructuringWindow   = 7 * 24 * time.Hour
+
+    amlRapidMinAmount = 100000
+    amlRapidWindow    = 48 * time.Hour
+    amlRapidOutShare  = 0.9
+
+    amlCycleMaxLength = 5
+    amlCycleMinAmount = 10000
+)
+
+var ErrInvalidAMLCaseStatus = errors.New("status must be open or closed")
+
+type AMLService interface {
+    Scan(now time.Time) ([]models.AMLCase, error)
+    ListCases(status string) ([]models.AMLCase, error)
+    GetCase(id int) (*models.AMLCase, error)
+    CloseCase(id int, then func(tx *repositories.Tx) error) error
+    ExportReports(since time.Time) ([]byte, error)
+    StartMonitoring(interval time.Duration, exportDir string)
+}
+
+type amlService struct {
+    amlCaseRepo          repositories.AMLCaseRepository
+    transactionRepo      repositories.TransactionRepository
+    accountRepo          repositories.AccountRepository
+    externalTransferRepo repositories.ExternalTransferRepository
+    rateSource           RateSource
+    store                repositories.Store
+}
+
+func NewAMLService(amlCaseRepo repositories.AMLCaseRepository, transactionRepo repositories.TransactionRepository, accountRepo repositories.AccountRepository, externalTransferRepo repositories.ExternalTransferRepository, rateSource RateSource, store repositories.Store) AMLService {
+    return &amlService{amlCaseRepo: amlCaseRepo, transactionRepo: transactionRepo, accountRepo: accountRepo, externalTransferRepo: externalTransferRepo, rateSource: rateSource, store: store}
+}
+
+// amlTransfer is a transfer with its parties' owners resolved and the amount converted to rubles.
+// Transfers to other banks have no ToAccountID and no ToUserID.
+type amlTransfer struct {
+    models.Transaction
+    FromUserID int
+    ToUserID   int
+    AmountRub  float64
+}
+
+// Scan looks for suspicious patterns in the last amlScanWindow of transfers and opens a case for each
+// finding that is not already covered by an existing case.
+func (s *amlService) Scan(now time.Time) ([]models.AMLCase, error) {
+    transfers, err := s.loadTransfers(now.Add(-amlScanWindow))
+    if err != nil {
+        return nil, err
+    }
+
+    var findings []models.AMLCase
+    findings = append(findings, detectStructuring(transfers)...)
+    findings = append(findings, detectRapidInOut(transfers)...)
+    findings = append(findings, detectCircular(transfers)...)
+
+    var opened []models.AMLCase
+    for i := range findings {
+        c := &findings[i]
+        covered, err := s.amlCaseRepo.CoversTransactions(c.Type, c.TransactionIDs)
+        if err != nil {
+            return nil, err
+        }
+        if covered {
+            continue
+        }
+        c.Status = models.AMLCaseOpen
+        if err := s.amlCaseRepo.Create(c); err != nil {
+            return nil, err
+        }
+        opened = append(opened, *c)
+    }
+    return opened, nil
+}
+
+// ListCases returns the cases with the status, newest first.
+func (s *amlService) ListCases(status string) ([]models.AMLCase, error) {
+    if status != models.AMLCaseOpen && status != models.AMLCaseClosed {
+        return nil, ErrInvalidAMLCaseStatus
+    }
+    return s.amlCaseRepo.GetByStatus(status)
+}
+
+func (s *amlService) GetCase(id int) (*models.AMLCase, error) {
+    return s.amlCaseRepo.GetByID(id)
+}
+
+// CloseCase closes a case; then, if given, runs in the same database transaction.
+func (s *amlService) CloseCase(id int, then func(tx *repositories.Tx) error) error {
+    if _, err := s.amlCaseRepo.GetByID(id); err != nil {
+        return err
+    }
+    return s.store.InTx(func(tx *repositories.Tx) error {
+        if err := tx.AMLCases.UpdateStatus(id, models.AMLCaseClosed); err != nil || then == nil {
+            return err
+        }
+        return then(tx)
+    })
+}
+
+// ExportReports renders the cases opened since the given time as a CSV suspicious activity report,
+// one row per linked transaction. Transfers to other banks carry the payee's BIC and account number.
+func (s *amlService) ExportReports(since time.Time) ([]byte, error) {
+    cases, err := s.amlCaseRepo.GetCreatedSince(since)
+    if err != nil {
+        return nil, err
+    }
+
+    var buf bytes.Buffer
+    w := csv.NewWriter(&buf)
+    w.Write([]string{"case_id", "case_type", "case_status", "opened_at", "summary", "total_amount_rub",
+        "transaction_id", "transaction_date", "from_account_id", "to_account_id", "to_bic", "to_account_number", "amount", "currency"})
+    for _, c := range cases {
+        for _, txID := range c.TransactionIDs {
+            tx, err := s.transactionRepo.GetByID(txID)
+            if err != nil {
+                return nil, err
+            }
+            toAccount, toBIC, toNumber := strconv.Itoa(tx.ToAccountID), "", ""
+            if tx.Type == models.TxExternalTransfer {
+                ext, err := s.externalTransferRepo.GetByTransactionID(tx.ID)
+                if err != nil {
+                    return nil, err
+                }
+                toAccount, toBIC, toNumber = "", ext.BIC, ext.AccountNumber
+            }
+            w.Write([]string{
+                strconv.Itoa(c.ID), c.Type, c.Status, c.CreatedAt.Format(time.RFC3339), c.Summary,
+                strconv.FormatFloat(c.TotalAmount, 'f', 2, 64),
+                strconv.Itoa(tx.ID), tx.CreatedAt.Format(time.RFC3339),
+                strconv.Itoa(tx.FromAccountID), toAccount, toBIC, toNumber,
+                strconv.FormatFloat(tx.Amount, 'f', 2, 64), tx.Currency,
+            })
+        }
+    }
+    w.Flush()
+    if err := w.Error(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+// StartMonitoring runs Scan every interval. When exportDir is set, each run that opens cases writes
+// them to a sar_<timestamp>.csv file there for the compliance team.
+func (s *amlService) StartMonitoring(interval time.Duration, exportDir string) {
+    go func() {
+        for {
+            started := time.Now()
+            opened, err := s.Scan(started)
+            if err != nil {
+                log.Printf("AML scan failed: %v", err)
+            } else if len(opened) > 0 && exportDir != "" {
+                if err := s.writeExport(exportDir, started); err != nil {
+                    log.Printf("AML report export failed: %v", err)
+                }
+            }
+            time.Sleep(interval)
+        }
+    }()
+}
+
+func (s *amlService) writeExport(dir string, since time.Time) error {
+    report, err := s.ExportReports(since)
+    if err != nil {
+        return err
+    }
+    name := filepath.Join(dir, "sar_"+since.Format("20060102_150405")+".csv")
+    return os.WriteFile(name, report, 0600)
+}
+
+func (s *amlService) loadTransfers(since time.Time) ([]amlTransfer, error) {
+    txs, err := s.transactionRepo.GetTransfersSince(since)
+    if err != nil {
+        return nil, err
+    }
+    owners := make(map[int]int)
+    ownerOf := func(accountID int) (int, error) {
+        if userID, ok := owners[accountID]; ok {
+            return userID, nil
+        }
+        acc, err := s.accountRepo.GetByID(accountID)
+        if err != nil {
+            return 0, err
+        }
+        owners[accountID] = acc.UserID
+        return acc.UserID, nil
+    }
+
+    now := time.Now()
+    transfers := make([]amlTransfer, 0, len(txs))
+    for _, tx := range txs {
+        fromUser, err := ownerOf(tx.FromAccountID)
+        if err != nil {
+            return nil, err
+        }
+        toUser := 0
+        if tx.ToAccountID != 0 {
+            if toUser, err = ownerOf(tx.ToAccountID); err != nil {
+                return nil, err
+            }
+        }
+        rate, err := s.rateSource.RubRate(tx.Currency, now)
+        if err != nil {
+            return nil, err
+        }
+        transfers = append(transfers, amlTransfer{
+            Transaction: tx,
+            FromUserID:  fromUser,
+            ToUserID:    toUser,
+            AmountRub:   roundMoney(tx.Amount * rate),
+        })
+    }
+    return transfers, nil
+}
+
+// detectStructuring finds users sending several transfers just under the reporting threshold within
+// a short period, as if splitting a large sum to stay below it.
+func detectStructuring(transfers []amlTransfer) []models.AMLCase {
+    byUser := make(map[int][]amlTransfer)
+    for _, t := range transfers {
+        if t.AmountRub >= amlReportingThreshold*amlStructuringBand && t.AmountRub < amlReportingThreshold {
+            byUser[t.FromUserID] = append(byUser[t.FromUserID], t)
+        }
+    }
+
+    var cases []models.AMLCase
+    for _, userID := range sortedKeys(byUser) {
+        list := byUser[userID]
+        for start := 0; start < len(list); {
+            end := start
+            for end+1 < len(list) && list[end+1].CreatedAt.Sub(list[start].CreatedAt) <= amlStructuringWindow {
+                end++
+            }
+            group := list[start : end+1]
+            if len(group) < amlStructuringMinCount {
+                start++
+                continue
+            }
+            c := newCase(models.AMLStructuring, group)
+            c.Summary = fmt.Sprintf("user %d made %d transfers between %.0f and %.0f RUB within %s",
+                userID, len(group), amlReportingThreshold*amlStructuringBand, float64(amlReportingThreshold), amlStructuringWindow)
+            cases = append(cases, c)
+            start = end + 1
+        }
+    }
+    return cases
+}
+
+// detectRapidInOut finds accounts that pass most of a large incoming transfer on shortly after receiving it.
+func detectRapidInOut(transfers []amlTransfer) []models.AMLCase {
+    outgoing := make(map[int][]amlTransfer)
+    for _, t := range transfers {
+        outgoing[t.FromAccountID] = append(outgoing[t.FromAccountID], t)
+    }
+
+    var cases []models.AMLCase
+    for _, in := range transfers {
+        if in.ToAccountID == 0 || in.AmountRub < amlRapidMinAmount {
+            continue
+        }
+        var out []amlTransfer
+        outSum := 0.0
+        for _, t := range outgoing[in.ToAccountID] {
+            if t.CreatedAt.After(in.CreatedAt) && t.CreatedAt.Sub(in.CreatedAt) <= amlRapidWindow {
+                out = append(out, t)
+                outSum += t.AmountRub
+            }
+        }
+        if outSum < in.AmountRub*amlRapidOutShare {
+            continue
+        }
+        c := newCase(models.AMLRapidInOut, append([]amlTransfer{in}, out...))
+        c.Summary = fmt.Sprintf("account %d received %.2f RUB and sent out %.2f RUB within %s",
+            in.ToAccountID, in.AmountRub, outSum, amlRapidWindow)
+        cases = append(cases, c)
+    }
+    return cases
+}
+
+// detectCircular finds chains of transfers that bring money back to the account it started from
+// through accounts of at least two different users.
+func detectCircular(transfers []amlTransfer) []models.AMLCase {
+    edges := make(map[int]map[int][]amlTransfer)
+    owners := make(map[int]int)
+    for _, t := range transfers {
+        // Money sent to another bank leaves our view, so it cannot be followed around a cycle
+        if t.ToAccountID == 0 || t.AmountRub < amlCycleMinAmount {
+            continue
+        }
+        if edges[t.FromAccountID] == nil {
+            edges[t.FromAccountID] = make(map[int][]amlTransfer)
+        }
+        edges[t.FromAccountID][t.ToAccountID] = append(edges[t.FromAccountID][t.ToAccountID], t)
+        owners[t.FromAccountID] = t.FromUserID
+        owners[t.ToAccountID] = t.ToUserID
+    }
+
+    var cases []models.AMLCase
+    var path []int
+    onPath := make(map[int]bool)
+    var visit func(start, node int)
+    visit = func(start, node int) {
+        path = append(path, node)
+        onPath[node] = true
+        for _, next := range sortedKeys(edges[node]) {
+            // Only walk through accounts above start so each cycle is reported once, from its smallest account
+            if next == start && len(path) >= 2 {
+                if c, ok := cycleCase(path, edges, owners); ok {
+                    cases = append(cases, c)
+                }
+                continue
+            }
+            if next > start && !onPath[next] && len(path) < amlCycleMaxLength {
+                visit(start, next)
+            }
+        }
+        onPath[node] = false
+        path = path[:len(path)-1]
+    }
+    for _, start := range sortedKeys(edges) {
+        visit(start, start)
+    }
+    return cases
+}
+
+func cycleCase(path []int, edges map[int]map[int][]amlTransfer, owners map[int]int) (models.AMLCase, bool) {
+    users := make(map[int]bool)
+    var linked []amlTransfer
+    for i, from := range path {
+        to := path[(i+1)%len(path)]
+        users[owners[from]] = true
+        linked = append(linked, edges[from][to]...)
+    }
+    if len(users) < 2 {
+        return models.AMLCase{}, false
+    }
+    c := newCase(models.AMLCircular, linked)
+    ids := make([]string, len(path))
+    for i, id := range path {
+        ids[i] = strconv.Itoa(id)
+    }
+    c.Summary = "funds moved in a cycle through accounts " + strings.Join(ids, " -> ") + " -> " + ids[0]
+    return c, true
+}
+
+func newCase(caseType string, transfers []amlTransfer) models.AMLCase {
+    c := models.AMLCase{Type: caseType}
+    accounts := make(map[int]bool)
+    for _, t := range transfers {
+        c.TransactionIDs = append(c.TransactionIDs, t.ID)
+        c.TotalAmount += t.AmountRub
+        accounts[t.FromAccountID] = true
+        if t.ToAccountID != 0 {
+            accounts[t.ToAccountID] = true
+        }
+    }
+    c.AccountIDs = sortedKeys(accounts)
+    c.TotalAmount = roundMoney(c.TotalAmount)
+    sort.Ints(c.TransactionIDs)
+    return c
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+    keys := make([]int, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Ints(keys)
+    return keys
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+    "reflect"
+    "testing"
+    "time"
+
+    "banking_service_project/models"
+)
+
+var amlStart = time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+// amlTx builds a transfer of amount rubles from account from (owned by fromUser) to account to
+// (owned by toUser), hours after amlStart.
+func amlTx(id, from, fromUser, to, toUser int, amount float64, hours float64) amlTransfer {
+    return amlTransfer{
+        Transaction: models.Transaction{
+            ID:            id,
+            FromAccountID: from,
+            ToAccountID:   to,
+            Amount:        amount,
+            CreatedAt:     amlStart.Add(time.Duration(hours * float64(time.Hour))),
+        },
+        FromUserID: fromUser,
+        ToUserID:   toUser,
+        AmountRub:  amount,
+    }
+}
+
+func caseTransactionIDs(cases []models.AMLCase) [][]int {
+    ids := make([][]int, len(cases))
+    for i, c := range cases {
+        ids[i] = c.TransactionIDs
+    }
+    return ids
+}
+
+func TestDetectStructuring(t *testing.T) {
+    tests := []struct {
+        name      string
+        transfers []amlTransfer
+        want      [][]int
+    }{
+        {
+            name:      "three transfers just under the threshold in a week",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 950000, 0), amlTx(2, 1, 1, 3, 3, 990000, 24), amlTx(3, 1, 1, 2, 2, 900000, 48)},
+            want:      [][]int{{1, 2, 3}},
+        },
+        {
+            name:      "two are not enough",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 950000, 0), amlTx(2, 1, 1, 2, 2, 950000, 24)},
+        },
+        {
+            name:      "spread over more than a week",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 950000, 0), amlTx(2, 1, 1, 2, 2, 950000, 96), amlTx(3, 1, 1, 2, 2, 950000, 169)},
+        },
+        {
+            name:      "outside the band",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 899999, 0), amlTx(2, 1, 1, 2, 2, 1000000, 1), amlTx(3, 1, 1, 2, 2, 950000, 2)},
+        },
+        {
+            name: "counted per user",
+            transfers: []amlTransfer{
+                amlTx(1, 1, 1, 9, 9, 950000, 0), amlTx(2, 5, 2, 9, 9, 950000, 1), amlTx(3, 1, 1, 9, 9, 950000, 2),
+                amlTx(4, 5, 2, 9, 9, 950000, 3), amlTx(5, 3, 1, 9, 9, 950000, 4),
+            },
+            want: [][]int{{1, 3, 5}},
+        },
+        {
+            name: "a long run is one case",
+            transfers: []amlTransfer{
+                amlTx(1, 1, 1, 2, 2, 950000, 0), amlTx(2, 1, 1, 2, 2, 950000, 10), amlTx(3, 1, 1, 2, 2, 950000, 20),
+                amlTx(4, 1, 1, 2, 2, 950000, 30),
+            },
+            want: [][]int{{1, 2, 3, 4}},
+        },
+    }
+    for _, tt := range tests {
+        got := caseTransactionIDs(detectStructuring(tt.transfers))
+        if len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s: cases %v, want %v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestDetectRapidInOut(t *testing.T) {
+    tests := []struct {
+        name      string
+        transfers []amlTransfer
+        want      [][]int
+    }{
+        {
+            name:      "received and sent on within two days",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 200000, 0), amlTx(2, 2, 2, 3, 3, 190000, 30)},
+            want:      [][]int{{1, 2}},
+        },
+        {
+            name:      "sent on in parts",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 200000, 0), amlTx(2, 2, 2, 3, 3, 100000, 1), amlTx(3, 2, 2, 4, 4, 90000, 2)},
+            want:      [][]int{{1, 2, 3}},
+        },
+        {
+            name:      "sent on to another bank",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 200000, 0), amlTx(2, 2, 2, 0, 0, 195000, 5)},
+            want:      [][]int{{1, 2}},
+        },
+        {
+            name:      "most of it stays",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 200000, 0), amlTx(2, 2, 2, 3, 3, 170000, 1)},
+        },
+        {
+            name:      "sent on too late",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 200000, 0), amlTx(2, 2, 2, 3, 3, 200000, 49)},
+        },
+        {
+            name:      "sent before it was received",
+            transfers: []amlTransfer{amlTx(2, 2, 2, 3, 3, 200000, 0), amlTx(1, 1, 1, 2, 2, 200000, 1)},
+        },
+        {
+            name:      "incoming amount too small",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 99999, 0), amlTx(2, 2, 2, 3, 3, 99999, 1)},
+        },
+    }
+    for _, tt := range tests {
+        got := caseTransactionIDs(detectRapidInOut(tt.transfers))
+        if len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s: cases %v, want %v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestAMLCaseAccountsLeaveOutOtherBanks(t *testing.T) {
+    cases := detectRapidInOut([]amlTransfer{amlTx(1, 1, 1, 2, 2, 200000, 0), amlTx(2, 2, 2, 0, 0, 195000, 5)})
+    if len(cases) != 1 || !reflect.DeepEqual(cases[0].AccountIDs, []int{1, 2}) {
+        t.Fatalf("cases %+v, want one with accounts [1 2]", cases)
+    }
+}
+
+func TestDetectCircular(t *testing.T) {
+    tests := []struct {
+        name        string
+        transfers   []amlTransfer
+        want        [][]int
+        wantSummary string
+    }{
+        {
+            name:        "there and back",
+            transfers:   []amlTransfer{amlTx(1, 1, 1, 2, 2, 50000, 0), amlTx(2, 2, 2, 1, 1, 49000, 1)},
+            want:        [][]int{{1, 2}},
+            wantSummary: "funds moved in a cycle through accounts 1 -> 2 -> 1",
+        },
+        {
+            name:        "through three users",
+            transfers:   []amlTransfer{amlTx(1, 3, 3, 1, 1, 50000, 2), amlTx(2, 1, 1, 2, 2, 50000, 0), amlTx(3, 2, 2, 3, 3, 50000, 1)},
+            want:        [][]int{{1, 2, 3}},
+            wantSummary: "funds moved in a cycle through accounts 1 -> 2 -> 3 -> 1",
+        },
+        {
+            name:      "between accounts of one user",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 1, 50000, 0), amlTx(2, 2, 1, 1, 1, 50000, 1)},
+        },
+        {
+            name:      "one leg too small",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 50000, 0), amlTx(2, 2, 2, 1, 1, 9999, 1)},
+        },
+        {
+            name: "longer than five accounts",
+            transfers: []amlTransfer{
+                amlTx(1, 1, 1, 2, 2, 50000, 0), amlTx(2, 2, 2, 3, 3, 50000, 1), amlTx(3, 3, 3, 4, 4, 50000, 2),
+                amlTx(4, 4, 4, 5, 5, 50000, 3), amlTx(5, 5, 5, 6, 6, 50000, 4), amlTx(6, 6, 6, 1, 1, 50000, 5),
+            },
+        },
+        {
+            name:      "a chain that does not return",
+            transfers: []amlTransfer{amlTx(1, 1, 1, 2, 2, 50000, 0), amlTx(2, 2, 2, 3, 3, 50000, 1)},
+        },
+    }
+    for _, tt := range tests {
+        cases := detectCircular(tt.transfers)
+        got := caseTransactionIDs(cases)
+        if len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s: cases %v, want %v", tt.name, got, tt.want)
+            continue
+        }
+        if tt.wantSummary != "" && cases[0].Summary != tt.wantSummary {
+            t.Errorf("%s: summary %q, want %q", tt.name, cases[0].Summary, tt.wantSummary)
+        }
+    }
+}
@@ -1,8 +1,6 @@
 package services
 
 import (
-    "time"
-
     "banking_service_project/repositories"
 )
 
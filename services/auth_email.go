@@ -0,0 +1,151 @@
+package services
+
+import (
+    "errors"
+    "log"
+    "net/url"
+    "time"
+
+    "golang.org/x/crypto/bcrypt"
+
+    "banking_service_project/models"
+)
+
+const (
+    emailVerificationTTL = 24 * time.Hour
+    passwordResetTTL     = time.Hour
+)
+
+var (
+    ErrInvalidUserToken     = errors.New("invalid or expired token")
+    ErrEmailNotVerified     = errors.New("email address is not verified")
+    ErrEmailAlreadyVerified = errors.New("email address is already verified")
+)
+
+// SendVerificationEmail mails a new verification link; links sent earlier stop working.
+func (s *authService) SendVerificationEmail(userID int) error {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return err
+    }
+    if user.EmailVerifiedAt != nil {
+        return ErrEmailAlreadyVerified
+    }
+    token, err := s.newUserToken(user.ID, models.TokenEmailVerification, emailVerificationTTL)
+    if err != nil {
+        return err
+    }
+    return s.notificationService.Notify(user.ID, TemplateEmailVerification, map[string]interface{}{"Link": s.link("/verify-email", token)})
+}
+
+func (s *authService) VerifyEmail(token string) error {
+    t, err := s.redeemUserToken(models.TokenEmailVerification, token)
+    if err != nil {
+        return err
+    }
+    return s.userRepo.MarkEmailVerified(t.UserID)
+}
+
+// ForgotPassword mails a reset link. Unknown emails are silently ignored so the endpoint does not
+// reveal who has an account.
+func (s *authService) ForgotPassword(email string) error {
+    user, err := s.userRepo.GetByEmail(email)
+    if err != nil || user.ClosedAt != nil {
+        return nil
+    }
+    token, err := s.newUserToken(user.ID, models.TokenPasswordReset, passwordResetTTL)
+    if err != nil {
+        return err
+    }
+    return s.notificationService.Notify(user.ID, TemplatePasswordReset, map[string]interface{}{"Link": s.link("/reset-password", token)})
+}
+
+// ResetPassword sets a new password and logs the user out everywhere. The token stays valid if the
+// new password is rejected by the policy, so the user can try another one.
+func (s *authService) ResetPassword(token, newPassword string) error {
+    t, err := s.findUserToken(models.TokenPasswordReset, token)
+    if err != nil {
+        return err
+    }
+    user, err := s.userRepo.GetByID(t.UserID)
+    if err != nil {
+        return err
+    }
+    if err := s.passwordPolicy.Validate(newPassword, user.Username, user.Email); err != nil {
+        return err
+    }
+    hashedPass, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+    if err != nil {
+        return err
+    }
+    ok, err := s.userTokenRepo.MarkUsed(t.ID)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return ErrInvalidUserToken
+    }
+
+    if err := s.userRepo.UpdatePassword(user.ID, string(hashedPass)); err != nil {
+        return err
+    }
+    if err := s.userTokenRepo.InvalidateForUser(user.ID, models.TokenPasswordReset); err != nil {
+        return err
+    }
+    // Whoever reset the password has shown control of the mailbox
+    if err := s.userRepo.MarkEmailVerified(user.ID); err != nil {
+        log.Printf("Failed to mark email of user %d as verified: %v", user.ID, err)
+    }
+    return s.tokenRepo.RevokeUserTokens(user.ID)
+}
+
+func (s *authService) newUserToken(userID int, purpose string, ttl time.Duration) (string, error) {
+    if err := s.userTokenRepo.InvalidateForUser(userID, purpose); err != nil {
+        return "", err
+    }
+    token, err := randomToken(32)
+    if err != nil {
+        return "", err
+    }
+    t := &models.UserToken{
+        UserID:    userID,
+        Purpose:   purpose,
+        TokenHash: hashToken(token),
+        ExpiresAt: time.Now().Add(ttl),
+    }
+    if err := s.userTokenRepo.Create(t); err != nil {
+        return "", err
+    }
+    return token, nil
+}
+
+func (s *authService) redeemUserToken(purpose, token string) (*models.UserToken, error) {
+    t, err := s.findUserToken(purpose, token)
+    if err != nil {
+        return nil, err
+    }
+    ok, err := s.userTokenRepo.MarkUsed(t.ID)
+    if err != nil {
+        return nil, err
+    }
+    if !ok {
+        return nil, ErrInvalidUserToken
+    }
+    return t, nil
+}
+
+// findUserToken returns an unused, unexpired token without redeeming it.
+func (s *authService) findUserToken(purpose, token string) (*models.UserToken, error) {
+    t, err := s.userTokenRepo.GetByHash(purpose, hashToken(token))
+    if err != nil {
+        return nil, ErrInvalidUserToken
+    }
+    if t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+        return nil, ErrInvalidUserToken
+    }
+    return t, nil
+}
+
+func (s *authService) link(path, token string) string {
+    return s.appBaseURL + path + "?token=" + url.QueryEscape(token)
+}
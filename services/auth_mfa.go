@@ -0,0 +1,306 @@
+package services
+
+import (
+    "crypto/rand"
+    "encoding/base32"
+    "errors"
+    "fmt"
+    "log"
+    "math/big"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+
+    "banking_service_project/models"
+    "banking_service_project/utils"
+)
+
+const (
+    mfaChallengeTTL   = 5 * time.Minute
+    recoveryCodeCount = 10
+    totpIssuer        = "Banking Service"
+    operationCodeTTL  = 10 * time.Minute
+)
+
+var (
+    ErrMFARequired        = errors.New("two-factor authentication required")
+    ErrInvalidMFACode     = errors.New("invalid two-factor code")
+    ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+    ErrTOTPNotEnrolled    = errors.New("two-factor authentication enrollment not started")
+    // Without 2FA, sensitive operations are confirmed with a code sent by email
+    ErrOperationCodeSent    = errors.New("a confirmation code has been sent to your email")
+    ErrInvalidOperationCode = errors.New("invalid or expired confirmation code, request a new one")
+)
+
+// MFARequiredError is returned by Login for users with 2FA: the password was right, and the
+// challenge token has to be exchanged together with a TOTP or recovery code for the real tokens.
+type MFARequiredError struct {
+    ChallengeToken string
+    ExpiresIn      int
+}
+
+func (e *MFARequiredError) Error() string {
+    return ErrMFARequired.Error()
+}
+
+type TOTPEnrollment struct {
+    Secret     string `json:"secret"`
+    OTPAuthURI string `json:"otpauth_uri"`
+}
+
+func (s *authService) mfaChallenge(userID int) error {
+    now := time.Now()
+    jti, err := randomToken(16)
+    if err != nil {
+        return err
+    }
+    token, err := s.sign(&models.Claims{
+        UserID: userID,
+        RegisteredClaims: jwt.RegisteredClaims{
+            ID:        jti,
+            Issuer:    models.TokenIssuer,
+            Audience:  jwt.ClaimStrings{models.MFAAudience},
+            Subject:   strconv.Itoa(userID),
+            ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeTTL)),
+            IssuedAt:  jwt.NewNumericDate(now),
+        },
+    })
+    if err != nil {
+        return err
+    }
+    return &MFARequiredError{ChallengeToken: token, ExpiresIn: int(mfaChallengeTTL.Seconds())}
+}
+
+// CompleteMFALogin finishes a login started with a password. Each challenge token works only once,
+// and is revoked after mfaChallengeMaxFailures wrong codes, so the password has to be entered again.
+func (s *authService) CompleteMFALogin(mfaToken, code, recoveryCode, ip, userAgent string) (*TokenPair, error) {
+    claims, err := s.parse(mfaToken, models.MFAAudience)
+    if err != nil {
+        return nil, err
+    }
+    revoked, err := s.tokenRepo.IsAccessTokenRevoked(claims.ID)
+    if err != nil {
+        return nil, err
+    }
+    if revoked {
+        return nil, ErrInvalidToken
+    }
+    // Wrong codes count towards the same lockout as wrong passwords
+    user, err := s.userRepo.GetByID(claims.UserID)
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    if err := s.throttle.check(user.Email, ip, now); err != nil {
+        return nil, err
+    }
+
+    if recoveryCode != "" {
+        ok, err := s.recoveryRepo.Use(claims.UserID, hashRecoveryCode(recoveryCode))
+        if err != nil {
+            return nil, err
+        }
+        if !ok {
+            return nil, s.wrongChallengeCode(claims, user, ip, now)
+        }
+        log.Printf("User %d logged in with a recovery code", claims.UserID)
+    } else if err := s.verifyTOTP(claims.UserID, code); err != nil {
+        if errors.Is(err, ErrInvalidMFACode) {
+            return nil, s.wrongChallengeCode(claims, user, ip, now)
+        }
+        return nil, err
+    }
+    s.throttle.succeed(user.Email)
+
+    if err := s.tokenRepo.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+        return nil, err
+    }
+    return s.startSession(claims.UserID, ip, userAgent)
+}
+
+// wrongChallengeCode counts a wrong code towards the email lockout and towards the challenge itself.
+func (s *authService) wrongChallengeCode(claims *models.Claims, user *models.User, ip string, now time.Time) error {
+    s.throttle.fail(user.Email, ip, user, now)
+    if s.throttle.failChallenge(claims.ID, now) {
+        if err := s.tokenRepo.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+            return err
+        }
+    }
+    return ErrInvalidMFACode
+}
+
+// EnrollTOTP generates a new secret. 2FA is switched on only after ConfirmTOTP proves the
+// authenticator app was set up correctly.
+func (s *authService) EnrollTOTP(userID int) (*TOTPEnrollment, error) {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    if user.TOTPEnabled {
+        return nil, ErrTOTPAlreadyEnabled
+    }
+    secret, err := utils.GenerateTOTPSecret()
+    if err != nil {
+        return nil, err
+    }
+    if err := s.userRepo.SetTOTPSecret(userID, secret); err != nil {
+        return nil, err
+    }
+    return &TOTPEnrollment{Secret: secret, OTPAuthURI: utils.TOTPURI(totpIssuer, user.Email, secret)}, nil
+}
+
+// ConfirmTOTP enables 2FA after checking the first code and returns the recovery codes. They are
+// shown only this once; only their hashes are kept.
+func (s *authService) ConfirmTOTP(userID int, code string) ([]string, error) {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    if user.TOTPEnabled {
+        return nil, ErrTOTPAlreadyEnabled
+    }
+    if user.TOTPSecret == "" {
+        return nil, ErrTOTPNotEnrolled
+    }
+    if err := s.checkTOTP(user, code); err != nil {
+        return nil, err
+    }
+    codes, err := s.newRecoveryCodes(userID)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.userRepo.EnableTOTP(userID); err != nil {
+        return nil, err
+    }
+    return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, used or not.
+func (s *authService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+    if err := s.verifyTOTP(userID, code); err != nil {
+        return nil, err
+    }
+    return s.newRecoveryCodes(userID)
+}
+
+// VerifySecondFactor checks the second factor for a sensitive operation: a TOTP code for users with
+// 2FA, otherwise a code sent to their confirmed email. Called without a code for such a user, it
+// sends one and returns ErrOperationCodeSent.
+func (s *authService) VerifySecondFactor(userID int, code string) error {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return err
+    }
+    if user.TOTPEnabled {
+        return s.checkTOTP(user, code)
+    }
+    if user.EmailVerifiedAt == nil {
+        return ErrEmailNotVerified
+    }
+    code = strings.TrimSpace(code)
+    if code == "" {
+        return s.sendOperationCode(user)
+    }
+    return s.checkOperationCode(user, code)
+}
+
+// verifyTOTP is VerifySecondFactor for what only an authenticator app can confirm: the login
+// challenge and recovery codes.
+func (s *authService) verifyTOTP(userID int, code string) error {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return err
+    }
+    if !user.TOTPEnabled {
+        return ErrMFARequired
+    }
+    return s.checkTOTP(user, code)
+}
+
+// sendOperationCode mails a six-digit code; codes sent earlier stop working.
+func (s *authService) sendOperationCode(user *models.User) error {
+    if err := s.userTokenRepo.DeleteForUser(user.ID, models.TokenOperationCode); err != nil {
+        return err
+    }
+    n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+    if err != nil {
+        return err
+    }
+    code := fmt.Sprintf("%06d", n.Int64())
+    t := &models.UserToken{
+        UserID:    user.ID,
+        Purpose:   models.TokenOperationCode,
+        TokenHash: hashToken(operationCodeKey(user.ID, code)),
+        ExpiresAt: time.Now().Add(operationCodeTTL),
+    }
+    if err := s.userTokenRepo.Create(t); err != nil {
+        return err
+    }
+    data := map[string]interface{}{"Code": code, "Minutes": int(operationCodeTTL.Minutes())}
+    if err := s.notificationService.Notify(user.ID, TemplateOperationCode, data); err != nil {
+        return err
+    }
+    return ErrOperationCodeSent
+}
+
+// checkOperationCode allows one attempt per code: a wrong one burns the code, so guessing six digits
+// takes a new email every time.
+func (s *authService) checkOperationCode(user *models.User, code string) error {
+    _, err := s.redeemUserToken(models.TokenOperationCode, operationCodeKey(user.ID, code))
+    if err == nil {
+        return nil
+    }
+    if !errors.Is(err, ErrInvalidUserToken) {
+        return err
+    }
+    if err := s.userTokenRepo.InvalidateForUser(user.ID, models.TokenOperationCode); err != nil {
+        return err
+    }
+    return ErrInvalidOperationCode
+}
+
+// operationCodeKey ties a code to its user, as six digits alone are not unique across users.
+func operationCodeKey(userID int, code string) string {
+    return strconv.Itoa(userID) + ":" + code
+}
+
+func (s *authService) checkTOTP(user *models.User, code string) error {
+    step, ok := utils.ValidateTOTP(user.TOTPSecret, strings.TrimSpace(code), time.Now())
+    if !ok {
+        return ErrInvalidMFACode
+    }
+    fresh, err := s.userRepo.UseTOTPStep(user.ID, step)
+    if err != nil {
+        return err
+    }
+    if !fresh {
+        return ErrInvalidMFACode
+    }
+    return nil
+}
+
+func (s *authService) newRecoveryCodes(userID int) ([]string, error) {
+    codes := make([]string, recoveryCodeCount)
+    hashes := make([]string, recoveryCodeCount)
+    for i := range codes {
+        b := make([]byte, 8)
+        if _, err := rand.Read(b); err != nil {
+            return nil, err
+        }
+        // Shown to the user as xxxxx-xxxxx; hashing ignores case and the dash
+        raw := strings.ToLower(base32.StdEncoding.EncodeToString(b)[:10])
+        codes[i] = fmt.Sprintf("%s-%s", raw[:5], raw[5:])
+        hashes[i] = hashRecoveryCode(codes[i])
+    }
+    if err := s.recoveryRepo.Replace(userID, hashes); err != nil {
+        return nil, err
+    }
+    return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+    normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+    return hashToken(normalized)
+}
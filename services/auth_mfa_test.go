@@ -0,0 +1,87 @@
+package services
+
+import (
+    "errors"
+    "testing"
+)
+
+func newEmailCodeAuth() (*authService, *recordingNotifier) {
+    notifier := &recordingNotifier{}
+    s := &authService{
+        userRepo:            verifiedUsers(1),
+        userTokenRepo:       &fakeUserTokenRepo{},
+        notificationService: notifier,
+    }
+    return s, notifier
+}
+
+// sentCode asks for a code and returns the one that was mailed.
+func sentCode(t *testing.T, s *authService, notifier *recordingNotifier) string {
+    if err := s.VerifySecondFactor(1, ""); !errors.Is(err, ErrOperationCodeSent) {
+        t.Fatalf("without a code: got %v, want ErrOperationCodeSent", err)
+    }
+    last := len(notifier.templates) - 1
+    if last < 0 || notifier.templates[last] != TemplateOperationCode {
+        t.Fatalf("sent %v, want %s", notifier.templates, TemplateOperationCode)
+    }
+    return notifier.data[last]["Code"].(string)
+}
+
+func TestSecondFactorByEmailWithout2FA(t *testing.T) {
+    s, notifier := newEmailCodeAuth()
+
+    code := sentCode(t, s, notifier)
+    if len(code) != 6 {
+        t.Fatalf("code %q, want six digits", code)
+    }
+    if err := s.VerifySecondFactor(1, code); err != nil {
+        t.Fatalf("right code: %v", err)
+    }
+    if err := s.VerifySecondFactor(1, code); !errors.Is(err, ErrInvalidOperationCode) {
+        t.Errorf("reused code: got %v, want ErrInvalidOperationCode", err)
+    }
+
+    // A wrong guess burns the code
+    code = sentCode(t, s, notifier)
+    wrong := "000000"
+    if code == wrong {
+        wrong = "111111"
+    }
+    if err := s.VerifySecondFactor(1, wrong); !errors.Is(err, ErrInvalidOperationCode) {
+        t.Errorf("wrong code: got %v, want ErrInvalidOperationCode", err)
+    }
+    if err := s.VerifySecondFactor(1, code); !errors.Is(err, ErrInvalidOperationCode) {
+        t.Errorf("code after a wrong guess: got %v, want ErrInvalidOperationCode", err)
+    }
+
+    // A new code replaces the previous one
+    first := sentCode(t, s, notifier)
+    second := sentCode(t, s, notifier)
+    if first != second {
+        if err := s.VerifySecondFactor(1, first); !errors.Is(err, ErrInvalidOperationCode) {
+            t.Errorf("replaced code: got %v, want ErrInvalidOperationCode", err)
+        }
+    }
+}
+
+func TestSecondFactorByEmailNeedsConfirmedEmail(t *testing.T) {
+    s, notifier := newEmailCodeAuth()
+    s.userRepo.(*fakeUserRepo).users[1].EmailVerifiedAt = nil
+
+    if err := s.VerifySecondFactor(1, ""); !errors.Is(err, ErrEmailNotVerified) {
+        t.Fatalf("got %v, want ErrEmailNotVerified", err)
+    }
+    if len(notifier.templates) != 0 {
+        t.Errorf("sent %v to an unconfirmed address", notifier.templates)
+    }
+}
+
+func TestLoginAndRecoveryCodesNeedTOTP(t *testing.T) {
+    s, notifier := newEmailCodeAuth()
+    if err := s.verifyTOTP(1, ""); !errors.Is(err, ErrMFARequired) {
+        t.Fatalf("got %v, want ErrMFARequired", err)
+    }
+    if len(notifier.templates) != 0 {
+        t.Errorf("sent %v, want no email code", notifier.templates)
+    }
+}
@@ -1,7 +1,14 @@
 package services
 
 import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
     "errors"
+    "log"
+    "strconv"
+    "strings"
     "time"
 
     "golang.org/x/crypto/bcrypt"
@@ -9,24 +16,99 @@ import (
 
     "banking_service_project/models"
     "banking_service_project/repositories"
+    "banking_service_project/utils"
 )
 
+const (
+    accessTokenTTL  = 15 * time.Minute
+    refreshTokenTTL = 30 * 24 * time.Hour
+    tokenClockSkew  = 30 * time.Second
+)
+
+var (
+    ErrInvalidCredentials  = errors.New("invalid credentials")
+    ErrInvalidToken        = errors.New("invalid token")
+    ErrInvalidRefreshToken = errors.New("invalid refresh token")
+    ErrRefreshTokenReused  = errors.New("refresh token reuse detected, all sessions of this login were revoked")
+    ErrUserClosed          = errors.New("user profile is closed")
+)
+
+// TokenPair is returned on login and refresh.
+type TokenPair struct {
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+    TokenType    string `json:"token_type"`
+    ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+}
+
 type AuthService interface {
-    Register(username, email, password string) (*models.User, error)
-    Login(email, password string) (string, error)
-    ParseToken(tokenStr string) (string, error)
+    Register(username, email, password, fullName, phone string) (*models.User, error)
+    Login(email, password, ip, userAgent string) (*TokenPair, error)
+    Refresh(refreshToken string) (*TokenPair, error)
+    Logout(userID int, jti string, expiresAt time.Time, refreshToken string) error
+    LogoutAll(userID int, jti string, expiresAt time.Time) error
+    IsRevoked(jti string) (bool, error)
+    ParseToken(tokenStr string) (*models.Claims, error)
+    JWKS() utils.JWKSet
+    CompleteMFALogin(mfaToken, code, recoveryCode, ip, userAgent string) (*TokenPair, error)
+    EnrollTOTP(userID int) (*TOTPEnrollment, error)
+    ConfirmTOTP(userID int, code string) ([]string, error)
+    RegenerateRecoveryCodes(userID int, code string) ([]string, error)
+    VerifySecondFactor(userID int, code string) error
+    SendVerificationEmail(userID int) error
+    VerifyEmail(token string) error
+    ForgotPassword(email string) error
+    ResetPassword(token, newPassword string) error
 }
 
 type authService struct {
-    userRepo  repositories.UserRepository
-    jwtSecret string
+    userRepo            repositories.UserRepository
+    loginEventRepo      repositories.LoginEventRepository
+    tokenRepo           repositories.TokenRepository
+    recoveryRepo        repositories.RecoveryCodeRepository
+    userTokenRepo       repositories.UserTokenRepository
+    notificationService NotificationService
+    keys                *utils.KeyRing
+    appBaseURL          string // links in emails point here
+    throttle            *loginThrottle
+    passwordPolicy      *PasswordPolicy
+
+    dummyPasswordHash []byte // compared against for unknown emails
 }
 
-func NewAuthService(userRepo repositories.UserRepository, jwtSecret string) AuthService {
-    return &authService{userRepo: userRepo, jwtSecret: jwtSecret}
+func NewAuthService(userRepo repositories.UserRepository, loginEventRepo repositories.LoginEventRepository, tokenRepo repositories.TokenRepository, recoveryRepo repositories.RecoveryCodeRepository, userTokenRepo repositories.UserTokenRepository, loginThrottleRepo repositories.LoginThrottleRepository, notificationService NotificationService, keys *utils.KeyRing, passwordPolicy *PasswordPolicy, appBaseURL string) AuthService {
+    dummyPasswordHash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+    if err != nil {
+        panic(err)
+    }
+    return &authService{
+        userRepo:            userRepo,
+        loginEventRepo:      loginEventRepo,
+        tokenRepo:           tokenRepo,
+        recoveryRepo:        recoveryRepo,
+        userTokenRepo:       userTokenRepo,
+        notificationService: notificationService,
+        keys:                keys,
+        appBaseURL:          strings.TrimSuffix(appBaseURL, "/"),
+        throttle:            &loginThrottle{repo: loginThrottleRepo, notificationService: notificationService},
+        passwordPolicy:      passwordPolicy,
+
+        dummyPasswordHash: dummyPasswordHash,
+    }
 }
 
-func (s *authService) Register(username, email, password string) (*models.User, error) {
+func (s *authService) Register(username, email, password, fullName, phone string) (*models.User, error) {
+    if phone != "" {
+        normalized, err := utils.NormalizePhone(phone)
+        if err != nil {
+            return nil, err
+        }
+        phone = normalized
+    }
+    if err := s.passwordPolicy.Validate(password, username, email); err != nil {
+        return nil, err
+    }
+
     // Check uniqueness
     if _, err := s.userRepo.GetByEmail(email); err == nil {
         return nil, errors.New("email already in use")
@@ -34,6 +116,11 @@ func (s *authService) Register(username, email, password string) (*models.User,
     if _, err := s.userRepo.GetByUsername(username); err == nil {
         return nil, errors.New("username already in use")
     }
+    if phone != "" {
+        if _, err := s.userRepo.GetByPhone(phone); err == nil {
+            return nil, errors.New("phone already in use")
+        }
+    }
 
     hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
     if err != nil {
@@ -43,45 +130,273 @@ func (s *authService) Register(username, email, password string) (*models.User,
     user := &models.User{
         Username: username,
         Email:    email,
+        Phone:    phone,
+        FullName: strings.TrimSpace(fullName),
         Password: string(hashedPass),
     }
 
     if err := s.userRepo.Create(user); err != nil {
         return nil, err
     }
+    // The user can ask for another email later, so a mail failure does not fail registration
+    if err := s.SendVerificationEmail(user.ID); err != nil {
+        log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+    }
     return user, nil
 }
 
-func (s *authService) Login(email, password string) (string, error) {
+func (s *authService) Login(email, password, ip, userAgent string) (*TokenPair, error) {
+    now := time.Now()
+    if err := s.throttle.check(email, ip, now); err != nil {
+        return nil, err
+    }
     user, err := s.userRepo.GetByEmail(email)
+    if err == nil && user.ClosedAt != nil {
+        err = ErrUserClosed
+    }
     if err != nil {
-        return "", errors.New("invalid credentials")
+        // Spend as long as for an existing user so timing does not reveal registered emails
+        bcrypt.CompareHashAndPassword(s.dummyPasswordHash, []byte(password))
+        s.throttle.fail(email, ip, nil, now)
+        return nil, ErrInvalidCredentials
     }
 
     if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-        return "", errors.New("invalid credentials")
+        s.throttle.fail(email, ip, user, now)
+        return nil, ErrInvalidCredentials
+    }
+    // With 2FA the failure counter is cleared only once the code is right too
+    if user.TOTPEnabled {
+        return nil, s.mfaChallenge(user.ID)
+    }
+    s.throttle.succeed(email)
+    return s.startSession(user.ID, ip, userAgent)
+}
+
+// startSession records a successful login and issues the first token pair of a new session.
+func (s *authService) startSession(userID int, ip, userAgent string) (*TokenPair, error) {
+    s.recordLogin(userID, ip, userAgent)
+
+    familyID, err := randomToken(16)
+    if err != nil {
+        return nil, err
+    }
+    return s.issueTokens(userID, familyID)
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token works once; presenting one
+// that was already exchanged means it was stolen, so every token of its family is revoked.
+func (s *authService) Refresh(refreshToken string) (*TokenPair, error) {
+    stored, err := s.tokenRepo.GetRefreshTokenByHash(hashToken(refreshToken))
+    if err != nil {
+        return nil, ErrInvalidRefreshToken
+    }
+    if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+        return nil, ErrInvalidRefreshToken
+    }
+    if stored.UsedAt != nil {
+        return nil, s.revokeReused(stored)
+    }
+    // Closing a profile revokes its sessions; this also stops a refresh that raced with it
+    user, err := s.userRepo.GetByID(stored.UserID)
+    if err != nil {
+        return nil, err
+    }
+    if user.ClosedAt != nil {
+        if err := s.tokenRepo.RevokeFamily(stored.FamilyID); err != nil {
+            return nil, err
+        }
+        return nil, ErrUserClosed
+    }
+    ok, err := s.tokenRepo.MarkRefreshTokenUsed(stored.ID)
+    if err != nil {
+        return nil, err
+    }
+    if !ok {
+        // Lost a race with another refresh using the same token
+        return nil, s.revokeReused(stored)
+    }
+    return s.issueTokens(stored.UserID, stored.FamilyID)
+}
+
+// Logout revokes the current access token and, if given, the refresh token family of this session.
+func (s *authService) Logout(userID int, jti string, expiresAt time.Time, refreshToken string) error {
+    if refreshToken != "" {
+        stored, err := s.tokenRepo.GetRefreshTokenByHash(hashToken(refreshToken))
+        if err != nil || stored.UserID != userID {
+            return ErrInvalidRefreshToken
+        }
+        if err := s.tokenRepo.RevokeFamily(stored.FamilyID); err != nil {
+            return err
+        }
+    }
+    return s.tokenRepo.RevokeAccessToken(jti, expiresAt)
+}
+
+func (s *authService) LogoutAll(userID int, jti string, expiresAt time.Time) error {
+    if err := s.tokenRepo.RevokeUserTokens(userID); err != nil {
+        return err
     }
+    return s.tokenRepo.RevokeAccessToken(jti, expiresAt)
+}
+
+func (s *authService) IsRevoked(jti string) (bool, error) {
+    return s.tokenRepo.IsAccessTokenRevoked(jti)
+}
+
+func (s *authService) JWKS() utils.JWKSet {
+    return s.keys.JWKS()
+}
+
+func (s *authService) revokeReused(stored *models.RefreshToken) error {
+    log.Printf("Refresh token reuse for user %d, revoking token family %s", stored.UserID, stored.FamilyID)
+    if err := s.tokenRepo.RevokeFamily(stored.FamilyID); err != nil {
+        return err
+    }
+    return ErrRefreshTokenReused
+}
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-        Subject:   string(rune(user.ID)),
-        ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-        IssuedAt:  jwt.NewNumericDate(time.Now()),
+// issueTokens reads the roles from the user every time, so granted or withdrawn roles take effect
+// with the next refresh.
+func (s *authService) issueTokens(userID int, familyID string) (*TokenPair, error) {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    jti, err := randomToken(16)
+    if err != nil {
+        return nil, err
+    }
+    accessExpiresAt := now.Add(accessTokenTTL)
+    accessToken, err := s.sign(&models.Claims{
+        UserID:    userID,
+        Roles:     user.Roles,
+        SessionID: familyID,
+        RegisteredClaims: jwt.RegisteredClaims{
+            ID:        jti,
+            Issuer:    models.TokenIssuer,
+            Audience:  jwt.ClaimStrings{models.TokenAudience},
+            Subject:   strconv.Itoa(userID),
+            ExpiresAt: jwt.NewNumericDate(accessExpiresAt),
+            IssuedAt:  jwt.NewNumericDate(now),
+        },
     })
+    if err != nil {
+        return nil, err
+    }
 
-    tokenStr, err := token.SignedString([]byte(s.jwtSecret))
+    refreshToken, err := randomToken(32)
     if err != nil {
-        return "", err
+        return nil, err
+    }
+    stored := &models.RefreshToken{
+        UserID:          userID,
+        FamilyID:        familyID,
+        TokenHash:       hashToken(refreshToken),
+        AccessJTI:       jti,
+        AccessExpiresAt: accessExpiresAt,
+        ExpiresAt:       now.Add(refreshTokenTTL),
+    }
+    if err := s.tokenRepo.CreateRefreshToken(stored); err != nil {
+        return nil, err
     }
-    return tokenStr, nil
+    return &TokenPair{
+        AccessToken:  accessToken,
+        RefreshToken: refreshToken,
+        TokenType:    "Bearer",
+        ExpiresIn:    int(accessTokenTTL.Seconds()),
+    }, nil
 }
 
-func (s *authService) ParseToken(tokenStr string) (string, error) {
-    token, err := jwt.ParseWithClaims(tokenStr, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(s.jwtSecret), nil
+// ParseToken verifies an access token and returns its claims. Besides the signature it requires
+// a key from the key ring matching the kid header, our issuer and audience, an expiry and a subject that is the decimal form of the user ID.
+func (s *authService) ParseToken(tokenStr string) (*models.Claims, error) {
+    claims, err := s.parse(tokenStr, models.TokenAudience)
+    if err != nil {
+        return nil, err
+    }
+    if claims.SessionID == "" {
+        return nil, ErrInvalidToken
+    }
+    return claims, nil
+}
+
+func (s *authService) sign(claims *models.Claims) (string, error) {
+    key := s.keys.SigningKey()
+    token := jwt.NewWithClaims(key.Method, claims)
+    token.Header["kid"] = key.ID
+    return token.SignedString(key.Private)
+}
+
+func (s *authService) parse(tokenStr, audience string) (*models.Claims, error) {
+    parser := jwt.NewParser(
+        jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+        jwt.WithIssuer(models.TokenIssuer),
+        jwt.WithAudience(audience),
+        jwt.WithLeeway(tokenClockSkew),
+        jwt.WithExpirationRequired(),
+        jwt.WithIssuedAt(),
+    )
+    claims := &models.Claims{}
+    token, err := parser.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+        kid, _ := token.Header["kid"].(string)
+        key, ok := s.keys.VerificationKey(kid)
+        if !ok || key.Method.Alg() != token.Method.Alg() {
+            return nil, ErrInvalidToken
+        }
+        return key.Private.Public(), nil
     })
     if err != nil || !token.Valid {
-        return "", errors.New("invalid token")
+        return nil, ErrInvalidToken
     }
-    claims := token.Claims.(*jwt.RegisteredClaims)
-    return claims.Subject, nil
+    userID, err := strconv.Atoi(claims.Subject)
+    if err != nil || userID <= 0 || userID != claims.UserID || strconv.Itoa(userID) != claims.Subject {
+        return nil, ErrInvalidToken
+    }
+    if claims.ID == "" {
+        return nil, ErrInvalidToken
+    }
+    return claims, nil
+}
+
+// recordLogin stores the login with a device fingerprint so fraud screening can spot new devices.
+// A failure here must not prevent the user from logging in.
+func (s *authService) recordLogin(userID int, ip, userAgent string) {
+    sum := sha256.Sum256([]byte(userAgent))
+    deviceID := hex.EncodeToString(sum[:8])
+
+    hasAny, err := s.loginEventRepo.HasAny(userID)
+    if err != nil {
+        log.Printf("Failed to load login history for user %d: %v", userID, err)
+        return
+    }
+    known, err := s.loginEventRepo.HasDevice(userID, deviceID)
+    if err != nil {
+        log.Printf("Failed to load login history for user %d: %v", userID, err)
+        return
+    }
+    event := &models.LoginEvent{
+        UserID:    userID,
+        IP:        ip,
+        UserAgent: userAgent,
+        DeviceID:  deviceID,
+        NewDevice: hasAny && !known,
+    }
+    if err := s.loginEventRepo.Create(event); err != nil {
+        log.Printf("Failed to record login for user %d: %v", userID, err)
+    }
+}
+
+func randomToken(size int) (string, error) {
+    b := make([]byte, size)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,27 @@
+package services
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "banking_service_project/models"
+)
+
+func TestRefreshRejectsClosedUser(t *testing.T) {
+    closedAt := time.Now().Add(-time.Minute)
+    tokens := &fakeTokenRepo{refreshTokens: []*models.RefreshToken{
+        {ID: 1, UserID: 7, FamilyID: "family", TokenHash: hashToken("refresh"), ExpiresAt: time.Now().Add(time.Hour)},
+    }}
+    s := &authService{
+        userRepo:  &fakeUserRepo{users: map[int]*models.User{7: {ID: 7, ClosedAt: &closedAt}}},
+        tokenRepo: tokens,
+    }
+
+    if _, err := s.Refresh("refresh"); !errors.Is(err, ErrUserClosed) {
+        t.Fatalf("got %v, want ErrUserClosed", err)
+    }
+    if len(tokens.revokedFamilies) != 1 || tokens.revokedFamilies[0] != "family" {
+        t.Errorf("revoked families %v, want [family]", tokens.revokedFamilies)
+    }
+}
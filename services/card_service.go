@@ -12,17 +12,27 @@ import (
 type CardService interface {
     CreateCard(accountID int) (*models.Card, error)
     GetCards(accountID int) ([]models.Card, error)
+    RevealCard(userID, cardID int) (*CardDetails, error)
+}
+
+// CardDetails are the decrypted card requisites, returned only after a second-factor check.
+type CardDetails struct {
+    ID        int       `json:"id"`
+    Number    string    `json:"number"`
+    CVV       string    `json:"cvv"`
+    ExpiresAt time.Time `json:"expires_at"`
 }
 
 type cardService struct {
     cardRepo     repositories.CardRepository
     accountRepo  repositories.AccountRepository
+    store        repositories.Store
     pgpPublicKey string
     pgpPrivateKey string
 }
 
-func NewCardService(cardRepo repositories.CardRepository, accountRepo repositories.AccountRepository, pgpPublicKey, pgpPrivateKey string) CardService {
-    return &cardService{cardRepo: cardRepo, accountRepo: accountRepo, pgpPublicKey: pgpPublicKey, pgpPrivateKey: pgpPrivateKey}
+func NewCardService(cardRepo repositories.CardRepository, accountRepo repositories.AccountRepository, store repositories.Store, pgpPublicKey, pgpPrivateKey string) CardService {
+    return &cardService{cardRepo: cardRepo, accountRepo: accountRepo, store: store, pgpPublicKey: pgpPublicKey, pgpPrivateKey: pgpPrivateKey}
 }
 
 func (s *cardService) CreateCard(accountID int) (*models.Card, error) {
@@ -30,6 +40,10 @@ func (s *cardService) CreateCard(accountID int) (*models.Card, error) {
     if err != nil {
         return nil, errors.New("account not found")
     }
+    // Cards pay from the account, so they are only issued and shown for accounts that can be debited
+    if err := checkDebit(acc); err != nil {
+        return nil, err
+    }
 
     cardNumber := utils.GenerateCardNumber()
     encryptedNumber, err := utils.EncryptPGP(cardNumber, s.pgpPublicKey)
@@ -50,7 +64,19 @@ func (s *cardService) CreateCard(accountID int) (*models.Card, error) {
         ExpiresAt:       time.Now().AddDate(3, 0, 0), // 3 years validity
     }
 
-    if err := s.cardRepo.Create(card); err != nil {
+    err = s.store.InTx(func(tx *repositories.Tx) error {
+        if err := tx.Cards.Create(card); err != nil {
+            return err
+        }
+        return publish(tx.Outbox, EventCardIssued, CardIssued{
+            CardID:    card.ID,
+            AccountID: acc.ID,
+            UserID:    acc.UserID,
+            LastFour:  cardNumber[len(cardNumber)-4:],
+            ExpiresAt: card.ExpiresAt,
+        })
+    })
+    if err != nil {
         return nil, err
     }
     return card, nil
@@ -59,3 +85,26 @@ func (s *cardService) CreateCard(accountID int) (*models.Card, error) {
 func (s *cardService) GetCards(accountID int) ([]models.Card, error) {
     return s.cardRepo.GetByAccountID(accountID)
 }
+
+func (s *cardService) RevealCard(userID, cardID int) (*CardDetails, error) {
+    card, err := s.cardRepo.GetByID(cardID)
+    if err != nil {
+        return nil, err
+    }
+    acc, err := s.accountRepo.GetByID(card.AccountID)
+    if err != nil || acc.UserID != userID {
+        return nil, errors.New("card not found")
+    }
+    if err := checkDebit(acc); err != nil {
+        return nil, err
+    }
+    number, err := utils.DecryptPGP(card.EncryptedNumber, s.pgpPrivateKey)
+    if err != nil {
+        return nil, err
+    }
+    cvv, err := utils.DecryptPGP(card.EncryptedCVV, s.pgpPrivateKey)
+    if err != nil {
+        return nil, err
+    }
+    return &CardDetails{ID: card.ID, Number: number, CVV: cvv, ExpiresAt: card.ExpiresAt}, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+const (
+    ClearingPending  = "pending"
+    ClearingSettled  = "settled"
+    ClearingReturned = "returned"
+)
+
+// ClearingPayment is an outgoing interbank payment as handed to the clearing system.
+type ClearingPayment struct {
+    ID           int       `json:"id"` // our external transfer ID
+    Amount       float64   `json:"amount"`
+    Currency     string    `json:"currency"`
+    PayerName    string    `json:"payer_name"`
+    PayerAccount string    `json:"payer_account"`
+    PayerBIC     string    `json:"payer_bic"`
+    PayeeName    string    `json:"payee_name"`
+    PayeeAccount string    `json:"payee_account"`
+    PayeeBIC     string    `json:"payee_bic"`
+    Purpose      string    `json:"purpose"`
+    CreatedAt    time.Time `json:"created_at"`
+}
+
+// ClearingResult is what the clearing system reports about a submitted payment.
+type ClearingResult struct {
+    Status string `json:"status"` // ClearingPending, ClearingSettled or ClearingReturned
+    Reason string `json:"reason,omitempty"`
+}
+
+// ClearingGateway connects outgoing interbank transfers to a clearing system. Submit may be called
+// again for a payment after a failure, so it must not create a second payment for the same ID.
+type ClearingGateway interface {
+    Submit(p ClearingPayment) (ref string, err error)
+    Status(ref string) (*ClearingResult, error)
+}
+
+// fileClearingGateway stands in for a real clearing system in development and tests. Payments are
+// written to <dir>/outgoing/<ref>.json; the outcome is read from <dir>/results/<ref>.json, put there
+// by whoever plays the clearing side. With autoSettle, payments without a result file settle at once.
+type fileClearingGateway struct {
+    dir        string
+    autoSettle bool
+}
+
+func NewFileClearingGateway(dir string, autoSettle bool) (ClearingGateway, error) {
+    for _, sub := range []string{"outgoing", "results"} {
+        if err := os.MkdirAll(filepath.Join(dir, sub), 0o750); err != nil {
+            return nil, err
+        }
+    }
+    return &fileClearingGateway{dir: dir, autoSettle: autoSettle}, nil
+}
+
+func (g *fileClearingGateway) Submit(p ClearingPayment) (string, error) {
+    ref := fmt.Sprintf("ext-%d", p.ID)
+    data, err := json.MarshalIndent(p, "", "  ")
+    if err != nil {
+        return "", err
+    }
+    // Written under a temporary name first so the clearing side never reads half a file
+    path := filepath.Join(g.dir, "outgoing", ref+".json")
+    if err := os.WriteFile(path+".tmp", data, 0o640); err != nil {
+        return "", err
+    }
+    if err := os.Rename(path+".tmp", path); err != nil {
+        return "", err
+    }
+    return ref, nil
+}
+
+func (g *fileClearingGateway) Status(ref string) (*ClearingResult, error) {
+    data, err := os.ReadFile(filepath.Join(g.dir, "results", ref+".json"))
+    if errors.Is(err, os.ErrNotExist) {
+        if g.autoSettle {
+            return &ClearingResult{Status: ClearingSettled}, nil
+        }
+        return &ClearingResult{Status: ClearingPending}, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var result ClearingResult
+    if err := json.Unmarshal(data, &result); err != nil {
+        return nil, fmt.Errorf("result for %s: %w", ref, err)
+    }
+    switch result.Status {
+    case ClearingPending, ClearingSettled, ClearingReturned:
+        return &result, nil
+    }
+    return nil, fmt.Errorf("result for %s has unknown status %q", ref, result.Status)
+}
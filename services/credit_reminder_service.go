@@ -0,0 +1,168 @@
+package services
+
+import (
+    "errors"
+    "log"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+// Days past the due date at which an unpaid installment gets each dunning notice.
+var creditDunningStages = []struct {
+    days int
+    kind string
+}{
+    {30, models.CreditOverdue30},
+    {7, models.CreditOverdue7},
+    {1, models.CreditOverdue1},
+}
+
+// CreditReminderService writes to borrowers about their installments: a reminder some days before
+// the due date, a notice on the due date if the account cannot cover the payment, and escalating
+// notices once it is overdue. Every message sent is recorded against the credit, and each kind is
+// sent at most once per installment; paid installments get nothing more.
+type CreditReminderService interface {
+    SendReminders(now time.Time)
+    StartReminders(interval time.Duration)
+    GetCommunications(userID, creditID int) ([]models.CreditCommunication, error)
+}
+
+type creditReminderService struct {
+    scheduleRepo        repositories.PaymentScheduleRepository
+    creditRepo          repositories.CreditRepository
+    accountRepo         repositories.AccountRepository
+    communicationRepo   repositories.CreditCommunicationRepository
+    notificationService NotificationService
+    reminderDays        int
+}
+
+func NewCreditReminderService(scheduleRepo repositories.PaymentScheduleRepository, creditRepo repositories.CreditRepository, accountRepo repositories.AccountRepository, communicationRepo repositories.CreditCommunicationRepository, notificationService NotificationService, reminderDays int) CreditReminderService {
+    return &creditReminderService{
+        scheduleRepo:        scheduleRepo,
+        creditRepo:          creditRepo,
+        accountRepo:         accountRepo,
+        communicationRepo:   communicationRepo,
+        notificationService: notificationService,
+        reminderDays:        reminderDays,
+    }
+}
+
+// SendReminders sends whatever is due for every unpaid installment. When the job has not run for a
+// while, only the latest dunning stage reached is sent.
+func (s *creditReminderService) SendReminders(now time.Time) {
+    today := truncateDay(now)
+    installments, err := s.scheduleRepo.GetUnpaidDueBefore(today.AddDate(0, 0, s.reminderDays+1))
+    if err != nil {
+        log.Printf("Failed to load unpaid installments: %v", err)
+        return
+    }
+    credits := make(map[int]*models.Credit)
+    accounts := make(map[int]*models.Account)
+    for i := range installments {
+        installment := &installments[i]
+        credit, ok := credits[installment.CreditID]
+        if !ok {
+            if credit, err = s.creditRepo.GetByID(installment.CreditID); err != nil {
+                log.Printf("Failed to load credit %d: %v", installment.CreditID, err)
+                continue
+            }
+            credits[credit.ID] = credit
+        }
+        acc, ok := accounts[credit.AccountID]
+        if !ok {
+            if acc, err = s.accountRepo.GetByID(credit.AccountID); err != nil {
+                log.Printf("Failed to load account of credit %d: %v", credit.ID, err)
+                continue
+            }
+            accounts[acc.ID] = acc
+        }
+        s.remind(installment, credit, acc, today, now)
+    }
+}
+
+func (s *creditReminderService) StartReminders(interval time.Duration) {
+    go func() {
+        s.SendReminders(time.Now())
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for now := range ticker.C {
+            s.SendReminders(now)
+        }
+    }()
+}
+
+// GetCommunications lists what was sent about the credit; it must be on one of the user's accounts.
+func (s *creditReminderService) GetCommunications(userID, creditID int) ([]models.CreditCommunication, error) {
+    credit, err := s.creditRepo.GetByID(creditID)
+    if err != nil {
+        return nil, errors.New("credit not found")
+    }
+    acc, err := s.accountRepo.GetByID(credit.AccountID)
+    if err != nil || acc.UserID != userID {
+        return nil, errors.New("credit not found")
+    }
+    return s.communicationRepo.GetByCredit(creditID)
+}
+
+func (s *creditReminderService) remind(installment *models.PaymentSchedule, credit *models.Credit, acc *models.Account, today, now time.Time) {
+    amount := roundMoney(installment.Amount)
+    daysLeft := int(truncateDay(installment.DueDate).Sub(today).Hours() / 24)
+    data := map[string]interface{}{
+        "CreditID": credit.ID,
+        "Account":  maskAccountNumber(acc.Number),
+        "Amount":   amount,
+        "Currency": credit.Currency,
+        "Balance":  acc.Balance,
+        "DueDate":  installment.DueDate,
+    }
+
+    var kind, template string
+    switch {
+    case daysLeft > 0:
+        kind, template = models.CreditReminder, TemplateCreditPaymentReminder
+    case daysLeft == 0:
+        if acc.Balance >= amount {
+            return
+        }
+        kind, template = models.CreditDueInsufficient, TemplateCreditPaymentDueInsufficient
+    default:
+        for _, stage := range creditDunningStages {
+            if -daysLeft >= stage.days {
+                kind, template = stage.kind, TemplateCreditPaymentOverdue
+                data["Stage"] = stage.days
+                break
+            }
+        }
+        data["DaysOverdue"] = -daysLeft
+    }
+
+    // Recording first keeps two runs from sending the same message; the record is dropped again if
+    // the message cannot be queued, so the next run retries.
+    c := &models.CreditCommunication{
+        CreditID:      credit.ID,
+        InstallmentID: installment.ID,
+        UserID:        acc.UserID,
+        Kind:          kind,
+        Template:      template,
+        Amount:        amount,
+        Currency:      credit.Currency,
+        DueDate:       installment.DueDate,
+        SentAt:        now,
+    }
+    ok, err := s.communicationRepo.Record(c)
+    if err != nil {
+        log.Printf("Failed to record %s for installment %d: %v", kind, installment.ID, err)
+        return
+    }
+    if !ok {
+        return
+    }
+    if err := s.notificationService.Notify(acc.UserID, template, data); err != nil {
+        log.Printf("Failed to send %s for installment %d: %v", kind, installment.ID, err)
+        if err := s.communicationRepo.Remove(c.ID); err != nil {
+            log.Printf("Failed to remove record of unsent %s for installment %d: %v", kind, installment.ID, err)
+        }
+    }
+}
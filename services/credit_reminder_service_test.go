@@ -0,0 +1,105 @@
+package services
+
+import (
+    "reflect"
+    "testing"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type creditReminderFixture struct {
+    service        CreditReminderService
+    schedule       *fakeScheduleRepo
+    accounts       *fakeAccountRepo
+    communications *fakeCommunicationRepo
+    notifier       *recordingNotifier
+}
+
+// newCreditReminderFixture sets up credit 1 on account 1 with a single unpaid installment of 500 RUB,
+// reminding 3 days ahead.
+func newCreditReminderFixture(due time.Time, balance float64) *creditReminderFixture {
+    f := &creditReminderFixture{
+        schedule: &fakeScheduleRepo{installments: []models.PaymentSchedule{{ID: 1, CreditID: 1, DueDate: due, Amount: 500}}},
+        accounts: &fakeAccountRepo{accounts: map[int]*models.Account{
+            1: {ID: 1, UserID: 10, Number: "40817810100000000001", Balance: balance, Currency: "RUB", Status: models.AccountActive},
+        }},
+        communications: &fakeCommunicationRepo{},
+        notifier:       &recordingNotifier{},
+    }
+    credits := &fakeCreditRepo{credits: map[int]*models.Credit{1: {ID: 1, AccountID: 1, Currency: "RUB"}}}
+    f.service = NewCreditReminderService(f.schedule, credits, f.accounts, f.communications, f.notifier, 3)
+    return f
+}
+
+func (f *creditReminderFixture) sentKinds() []string {
+    var kinds []string
+    for _, c := range f.communications.sent {
+        kinds = append(kinds, c.Kind)
+    }
+    return kinds
+}
+
+func TestCreditReminderStages(t *testing.T) {
+    now := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+    today := truncateDay(now)
+
+    tests := []struct {
+        name     string
+        dueIn    int // days from today, negative when overdue
+        balance  float64
+        wantKind string
+    }{
+        {"too early", 4, 0, ""},
+        {"reminder window opens", 3, 0, models.CreditReminder},
+        {"day before", 1, 1000, models.CreditReminder},
+        {"due and covered", 0, 500, ""},
+        {"due and short", 0, 499.99, models.CreditDueInsufficient},
+        {"one day overdue", -1, 0, models.CreditOverdue1},
+        {"six days overdue", -6, 0, models.CreditOverdue1},
+        {"a week overdue", -7, 0, models.CreditOverdue7},
+        {"29 days overdue", -29, 0, models.CreditOverdue7},
+        {"a month overdue", -30, 0, models.CreditOverdue30},
+        {"long overdue", -90, 1000, models.CreditOverdue30},
+    }
+    for _, tt := range tests {
+        f := newCreditReminderFixture(today.AddDate(0, 0, tt.dueIn), tt.balance)
+        f.service.SendReminders(now)
+
+        var want []string
+        if tt.wantKind != "" {
+            want = []string{tt.wantKind}
+        }
+        if got := f.sentKinds(); !reflect.DeepEqual(got, want) {
+            t.Errorf("%s: sent %v, want %v", tt.name, got, want)
+        }
+        if len(f.notifier.templates) != len(want) {
+            t.Errorf("%s: %d notifications for %d records", tt.name, len(f.notifier.templates), len(want))
+        }
+    }
+}
+
+func TestCreditReminderSentOncePerStage(t *testing.T) {
+    now := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+    f := newCreditReminderFixture(truncateDay(now).AddDate(0, 0, -2), 0)
+
+    f.service.SendReminders(now)
+    f.service.SendReminders(now.Add(time.Hour))
+    // The job was down for four weeks: only the stage reached is sent, not the 7-day one it missed
+    f.service.SendReminders(now.AddDate(0, 0, 28))
+    f.service.SendReminders(now.AddDate(0, 0, 29))
+
+    want := []string{models.CreditOverdue1, models.CreditOverdue30}
+    if got := f.sentKinds(); !reflect.DeepEqual(got, want) {
+        t.Errorf("sent %v, want %v", got, want)
+    }
+    if days := f.notifier.data[1]["DaysOverdue"]; days != 30 {
+        t.Errorf("DaysOverdue = %v, want 30", days)
+    }
+
+    f.schedule.installments[0].Paid = true
+    f.service.SendReminders(now.AddDate(0, 0, 60))
+    if len(f.communications.sent) != 2 {
+        t.Errorf("a paid installment got another notice")
+    }
+}
@@ -2,6 +2,7 @@ package services
 
 import (
     "errors"
+    "log"
     "math"
     "time"
 
@@ -9,19 +10,25 @@ import (
     "banking_service_project/repositories"
 )
 
+var ErrCreditRepaid = errors.New("credit is fully repaid")
+
 type CreditService interface {
     ApplyCredit(accountID int, principal, annualRate float64, termMonths int) (*models.Credit, []models.PaymentSchedule, error)
     GetSchedule(creditID int) ([]models.PaymentSchedule, error)
+    PayInstallment(userID, creditID int) (*models.PaymentSchedule, error)
+    CheckOverdue(now time.Time)
+    StartOverdueCheck(interval time.Duration)
 }
 
 type creditService struct {
-    creditRepo    repositories.CreditRepository
-    scheduleRepo  repositories.PaymentScheduleRepository
-    accountRepo   repositories.AccountRepository
+    creditRepo   repositories.CreditRepository
+    scheduleRepo repositories.PaymentScheduleRepository
+    accountRepo  repositories.AccountRepository
+    store        repositories.Store
 }
 
-func NewCreditService(creditRepo repositories.CreditRepository, scheduleRepo repositories.PaymentScheduleRepository, accountRepo repositories.AccountRepository) CreditService {
-    return &creditService{creditRepo: creditRepo, scheduleRepo: scheduleRepo, accountRepo: accountRepo}
+func NewCreditService(creditRepo repositories.CreditRepository, scheduleRepo repositories.PaymentScheduleRepository, accountRepo repositories.AccountRepository, store repositories.Store) CreditService {
+    return &creditService{creditRepo: creditRepo, scheduleRepo: scheduleRepo, accountRepo: accountRepo, store: store}
 }
 
 func (s *creditService) ApplyCredit(accountID int, principal, annualRate float64, termMonths int) (*models.Credit, []models.PaymentSchedule, error) {
@@ -29,6 +36,9 @@ func (s *creditService) ApplyCredit(accountID int, principal, annualRate float64
     if err != nil {
         return nil, nil, errors.New("account not found")
     }
+    if err := checkDebit(acc); err != nil {
+        return nil, nil, err
+    }
 
     monthlyRate := annualRate / 12 / 100
     annuity := (principal * monthlyRate) / (1 - math.Pow(1+monthlyRate, float64(-termMonths)))
@@ -36,27 +46,42 @@ func (s *creditService) ApplyCredit(accountID int, principal, annualRate float64
     credit := &models.Credit{
         AccountID:    acc.ID,
         Principal:    principal,
+        Currency:     acc.Currency,
         InterestRate: annualRate,
         TermMonths:   termMonths,
         CreatedAt:    time.Now(),
     }
-    if err := s.creditRepo.Create(credit); err != nil {
-        return nil, nil, err
-    }
-
     var schedules []models.PaymentSchedule
-    for i := 1; i <= termMonths; i++ {
-        dueDate := time.Now().AddDate(0, i, 0)
-        schedule := models.PaymentSchedule{
-            CreditID: credit.ID,
-            DueDate:  dueDate,
-            Amount:   annuity,
-            Paid:     false,
+    err = s.store.InTx(func(tx *repositories.Tx) error {
+        if err := tx.Credits.Create(credit); err != nil {
+            return err
         }
-        if err := s.scheduleRepo.Create(&schedule); err != nil {
-            return nil, nil, err
+        for i := 1; i <= termMonths; i++ {
+            dueDate := time.Now().AddDate(0, i, 0)
+            schedule := models.PaymentSchedule{
+                CreditID: credit.ID,
+                DueDate:  dueDate,
+                Amount:   annuity,
+                Paid:     false,
+            }
+            if err := tx.Schedules.Create(&schedule); err != nil {
+                return err
+            }
+            schedules = append(schedules, schedule)
         }
-        schedules = append(schedules, schedule)
+        return publish(tx.Outbox, EventCreditApproved, CreditApproved{
+            CreditID:       credit.ID,
+            AccountID:      acc.ID,
+            UserID:         acc.UserID,
+            Principal:      principal,
+            Currency:       acc.Currency,
+            InterestRate:   annualRate,
+            TermMonths:     termMonths,
+            MonthlyPayment: roundMoney(annuity),
+        })
+    })
+    if err != nil {
+        return nil, nil, err
     }
     return credit, schedules, nil
 }
@@ -64,3 +89,125 @@ func (s *creditService) ApplyCredit(accountID int, principal, annualRate float64
 func (s *creditService) GetSchedule(creditID int) ([]models.PaymentSchedule, error) {
     return s.scheduleRepo.GetByCreditID(creditID)
 }
+
+// PayInstallment pays the earliest unpaid installment of the credit from its account.
+func (s *creditService) PayInstallment(userID, creditID int) (*models.PaymentSchedule, error) {
+    credit, err := s.creditRepo.GetByID(creditID)
+    if err != nil {
+        return nil, errors.New("credit not found")
+    }
+    acc, err := s.accountRepo.GetByID(credit.AccountID)
+    if err != nil || acc.UserID != userID {
+        return nil, errors.New("credit not found")
+    }
+    if err := checkDebit(acc); err != nil {
+        return nil, err
+    }
+    installment, err := s.scheduleRepo.GetNextUnpaid(creditID)
+    if err != nil {
+        return nil, err
+    }
+    if installment == nil {
+        return nil, ErrCreditRepaid
+    }
+    amount := roundMoney(installment.Amount)
+    if acc.Balance < amount {
+        return nil, ErrInsufficientFunds
+    }
+
+    err = s.store.InTx(func(tx *repositories.Tx) error {
+        locked, err := tx.Accounts.GetForUpdate(0, acc.ID)
+        if err != nil {
+            return err
+        }
+        if err := checkDebit(locked[acc.ID]); err != nil {
+            return err
+        }
+        if locked[acc.ID].Balance < amount {
+            return ErrInsufficientFunds
+        }
+        ok, err := tx.Schedules.MarkPaid(installment.ID)
+        if err != nil {
+            return err
+        }
+        if !ok {
+            return errors.New("installment has already been paid")
+        }
+        if _, err := tx.Accounts.AddToBalance(acc.ID, -amount); err != nil {
+            return err
+        }
+        if err := tx.Transactions.Create(&models.Transaction{
+            FromAccountID: acc.ID,
+            Amount:        amount,
+            Currency:      acc.Currency,
+            ToAmount:      amount,
+            ToCurrency:    acc.Currency,
+            ExchangeRate:  1,
+            Type:          models.TxCreditPayment,
+        }); err != nil {
+            return err
+        }
+        return publish(tx.Outbox, EventInstallmentPaid, installmentEvent(installment, credit, acc, amount))
+    })
+    if err != nil {
+        return nil, err
+    }
+    installment.Paid = true
+    return installment, nil
+}
+
+// CheckOverdue publishes EventPaymentOverdue once for every installment that was due before today
+// and is still unpaid.
+func (s *creditService) CheckOverdue(now time.Time) {
+    overdue, err := s.scheduleRepo.GetNewlyOverdue(truncateDay(now))
+    if err != nil {
+        log.Printf("Failed to load overdue installments: %v", err)
+        return
+    }
+    for i := range overdue {
+        installment := &overdue[i]
+        credit, err := s.creditRepo.GetByID(installment.CreditID)
+        if err != nil {
+            log.Printf("Failed to load credit %d: %v", installment.CreditID, err)
+            continue
+        }
+        acc, err := s.accountRepo.GetByID(credit.AccountID)
+        if err != nil {
+            log.Printf("Failed to load account of credit %d: %v", credit.ID, err)
+            continue
+        }
+        err = s.store.InTx(func(tx *repositories.Tx) error {
+            ok, err := tx.Schedules.MarkOverdue(installment.ID, now)
+            if err != nil || !ok {
+                return err
+            }
+            return publish(tx.Outbox, EventPaymentOverdue, installmentEvent(installment, credit, acc, roundMoney(installment.Amount)))
+        })
+        if err != nil {
+            log.Printf("Failed to mark installment %d as overdue: %v", installment.ID, err)
+        }
+    }
+}
+
+func (s *creditService) StartOverdueCheck(interval time.Duration) {
+    go func() {
+        s.CheckOverdue(time.Now())
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for now := range ticker.C {
+            s.CheckOverdue(now)
+        }
+    }()
+}
+
+func installmentEvent(installment *models.PaymentSchedule, credit *models.Credit, acc *models.Account, amount float64) InstallmentEvent {
+    return InstallmentEvent{
+        CreditID:      credit.ID,
+        InstallmentID: installment.ID,
+        AccountID:     acc.ID,
+        UserID:        acc.UserID,
+        Amount:        amount,
+        Currency:      credit.Currency,
+        DueDate:       installment.DueDate,
+    }
+}
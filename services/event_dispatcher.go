@@ -0,0 +1,146 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "sync"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+const (
+    eventBatchSize   = 100
+    maxEventAttempts = 12
+    maxEventBackoff  = time.Hour
+)
+
+// EventHandler handles one event. Delivery is at least once, so handlers must cope with seeing
+// the same event again.
+type EventHandler func(event models.OutboxEvent) error
+
+// EventDispatcher delivers outbox events to the subscribers of their type. Each subscriber is
+// retried on its own: one that failed gets the event again with a growing delay, without the
+// others seeing it twice. After maxEventAttempts the event is marked failed.
+type EventDispatcher interface {
+    Subscribe(eventType, subscriber string, handler EventHandler)
+    Dispatch(now time.Time)
+    StartWorker(interval time.Duration)
+}
+
+type subscription struct {
+    name    string
+    handler EventHandler
+}
+
+type eventDispatcher struct {
+    outboxRepo repositories.OutboxRepository
+
+    mu          sync.RWMutex
+    subscribers map[string][]subscription
+}
+
+func NewEventDispatcher(outboxRepo repositories.OutboxRepository) EventDispatcher {
+    return &eventDispatcher{outboxRepo: outboxRepo, subscribers: make(map[string][]subscription)}
+}
+
+// Subscribe registers handler for events of eventType under a name that must stay the same across
+// restarts: it is what the delivery log records.
+func (d *eventDispatcher) Subscribe(eventType, subscriber string, handler EventHandler) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    d.subscribers[eventType] = append(d.subscribers[eventType], subscription{name: subscriber, handler: handler})
+}
+
+func (d *eventDispatcher) Dispatch(now time.Time) {
+    for {
+        events, err := d.outboxRepo.GetDue(now, eventBatchSize)
+        if err != nil {
+            log.Printf("Failed to load outbox events: %v", err)
+            return
+        }
+        for i := range events {
+            d.deliver(&events[i], now)
+        }
+        if len(events) < eventBatchSize {
+            return
+        }
+    }
+}
+
+func (d *eventDispatcher) StartWorker(interval time.Duration) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for now := range ticker.C {
+            d.Dispatch(now)
+        }
+    }()
+}
+
+func (d *eventDispatcher) deliver(event *models.OutboxEvent, now time.Time) {
+    d.mu.RLock()
+    subs := d.subscribers[event.Type]
+    d.mu.RUnlock()
+
+    var failures []string
+    if len(subs) > 0 {
+        delivered, err := d.outboxRepo.GetDeliveredSubscribers(event.ID)
+        if err != nil {
+            log.Printf("Failed to load deliveries of event %d: %v", event.ID, err)
+            return
+        }
+        for _, sub := range subs {
+            if delivered[sub.name] {
+                continue
+            }
+            if err := callHandler(sub.handler, *event); err != nil {
+                failures = append(failures, sub.name+": "+err.Error())
+                continue
+            }
+            if err := d.outboxRepo.MarkDelivered(event.ID, sub.name); err != nil {
+                failures = append(failures, sub.name+": "+err.Error())
+            }
+        }
+    }
+    if len(failures) == 0 {
+        if err := d.outboxRepo.MarkDispatched(event.ID); err != nil {
+            log.Printf("Failed to mark event %d as dispatched: %v", event.ID, err)
+        }
+        return
+    }
+
+    attempts := event.Attempts + 1
+    failed := attempts >= maxEventAttempts
+    lastError := strings.Join(failures, "; ")
+    if failed {
+        log.Printf("Giving up on event %d (%s) after %d attempts: %s", event.ID, event.Type, attempts, lastError)
+    }
+    if err := d.outboxRepo.RecordFailure(event.ID, attempts, lastError, now.Add(eventBackoff(attempts)), failed); err != nil {
+        log.Printf("Failed to record delivery failure of event %d: %v", event.ID, err)
+    }
+}
+
+// callHandler runs a subscriber, turning a panic into an error so it cannot stop the worker.
+func callHandler(handler EventHandler, event models.OutboxEvent) (err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("panic: %v", r)
+        }
+    }()
+    return handler(event)
+}
+
+// eventBackoff is 30s after the first failure, doubling up to maxEventBackoff.
+func eventBackoff(attempts int) time.Duration {
+    backoff := 30 * time.Second
+    for i := 1; i < attempts && backoff < maxEventBackoff; i++ {
+        backoff *= 2
+    }
+    if backoff > maxEventBackoff {
+        backoff = maxEventBackoff
+    }
+    return backoff
+}
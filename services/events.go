@@ -0,0 +1,105 @@
+package services
+
+import (
+    "encoding/json"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+// Domain events. They are written to the outbox in the transaction that makes the change and
+// handed to subscribers by the EventDispatcher; the payload types below are their JSON bodies.
+const (
+    EventTransferCompleted        = "transfer.completed"
+    EventCreditApproved           = "credit.approved"
+    EventInstallmentPaid          = "credit.installment_paid"
+    EventPaymentOverdue           = "credit.payment_overdue"
+    EventCardIssued               = "card.issued"
+    EventExternalTransferSettled  = "external_transfer.settled"
+    EventExternalTransferReturned = "external_transfer.returned"
+    EventInterestPosted           = "interest.posted"
+)
+
+// TransferCompleted covers every move between two of our accounts: transfers, approved held
+// transfers and balances swept out of a closed account (Type tells them apart). It goes to the
+// webhooks of both users, so it must not carry anything private to one side, such as a balance.
+type TransferCompleted struct {
+    TransactionID int       `json:"transaction_id"`
+    Type          string    `json:"type"`
+    FromAccountID int       `json:"from_account_id"`
+    FromUserID    int       `json:"from_user_id"`
+    ToAccountID   int       `json:"to_account_id"`
+    ToUserID      int       `json:"to_user_id"`
+    Amount        float64   `json:"amount"`
+    Currency      string    `json:"currency"`
+    ToAmount      float64   `json:"to_amount"`
+    ToCurrency    string    `json:"to_currency"`
+    At            time.Time `json:"at"`
+}
+
+type CreditApproved struct {
+    CreditID       int     `json:"credit_id"`
+    AccountID      int     `json:"account_id"`
+    UserID         int     `json:"user_id"`
+    Principal      float64 `json:"principal"`
+    Currency       string  `json:"currency"`
+    InterestRate   float64 `json:"interest_rate"`
+    TermMonths     int     `json:"term_months"`
+    MonthlyPayment float64 `json:"monthly_payment"`
+}
+
+// InstallmentEvent is the payload of EventInstallmentPaid and EventPaymentOverdue.
+type InstallmentEvent struct {
+    CreditID      int       `json:"credit_id"`
+    InstallmentID int       `json:"installment_id"`
+    AccountID     int       `json:"account_id"`
+    UserID        int       `json:"user_id"`
+    Amount        float64   `json:"amount"`
+    Currency      string    `json:"currency"`
+    DueDate       time.Time `json:"due_date"`
+}
+
+type CardIssued struct {
+    CardID    int       `json:"card_id"`
+    AccountID int       `json:"account_id"`
+    UserID    int       `json:"user_id"`
+    LastFour  string    `json:"last_four"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ExternalTransferFinished is the payload of EventExternalTransferSettled and EventExternalTransferReturned.
+type ExternalTransferFinished struct {
+    ExternalTransferID int     `json:"external_transfer_id"`
+    UserID             int     `json:"user_id"`
+    FromAccountID      int     `json:"from_account_id"`
+    Amount             float64 `json:"amount"`
+    Currency           string  `json:"currency"`
+    BIC                string  `json:"bic"`
+    AccountNumber      string  `json:"account_number"`
+    RecipientName      string  `json:"recipient_name"`
+    Status             string  `json:"status"`
+    ReturnReason       string  `json:"return_reason,omitempty"`
+}
+
+// InterestPosted is interest paid out to a savings or deposit account, or taken back from a deposit
+// closed early (Type interest_reversal).
+type InterestPosted struct {
+    TransactionID int       `json:"transaction_id"`
+    Type          string    `json:"type"`
+    AccountID     int       `json:"account_id"`
+    UserID        int       `json:"user_id"`
+    Amount        float64   `json:"amount"`
+    Currency      string    `json:"currency"`
+    Balance       float64   `json:"balance"` // right after the posting
+    At            time.Time `json:"at"`
+}
+
+// publish stores an event in the outbox; pass the outbox of the transaction making the change.
+func publish(outbox repositories.OutboxRepository, eventType string, payload interface{}) error {
+    data, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+    return outbox.Add(&models.OutboxEvent{Type: eventType, Payload: data})
+}
@@ -4,15 +4,19 @@ import (
     "crypto/hmac"
     "crypto/sha256"
     "encoding/hex"
-    "errors"
+    "strconv"
+    "time"
 
-    "gorm.io/gorm"
     "gopkg.in/gomail.v2"
+
+    "banking_service_project/utils"
 )
 
 type ExternalService interface {
     GetKeyRateCBR() (float64, error)
+    GetDailyRatesCBR(date time.Time) (time.Time, []utils.CurrencyRate, error)
     SendEmail(to, subject, body string) error
+    SendHTMLEmail(to, subject, textBody, htmlBody string) error
     ComputeHMAC(data string, secret string) string
 }
 
@@ -28,16 +32,29 @@ func NewExternalService(smtpHost, smtpPort, smtpUser, smtpPass, pgpPublicKey, pg
 }
 
 func (s *externalService) GetKeyRateCBR() (float64, error) {
-    // TODO: implement SOAP client to CBR
-    return 0, nil
+    // KeyRate reports one row per business day, so a month-long window is never empty
+    now := time.Now()
+    return utils.GetKeyRate(now.AddDate(0, -1, 0), now)
+}
+
+func (s *externalService) GetDailyRatesCBR(date time.Time) (time.Time, []utils.CurrencyRate, error) {
+    return utils.GetCursOnDate(date)
 }
 
 func (s *externalService) SendEmail(to, subject, body string) error {
+    return s.SendHTMLEmail(to, subject, body, "")
+}
+
+// SendHTMLEmail sends a multipart message with a plain-text and, if htmlBody is not empty, an HTML part.
+func (s *externalService) SendHTMLEmail(to, subject, textBody, htmlBody string) error {
     m := gomail.NewMessage()
     m.SetHeader("From", s.smtpUser)
     m.SetHeader("To", to)
     m.SetHeader("Subject", subject)
-    m.SetBody("text/plain", body)
+    m.SetBody("text/plain", textBody)
+    if htmlBody != "" {
+        m.AddAlternative("text/html", htmlBody)
+    }
 
     port, err := strconv.Atoi(s.smtpPort)
     if err != nil {
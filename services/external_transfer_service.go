@@ -0,0 +1,397 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "banking_service_project/fraud"
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+    "banking_service_project/utils"
+)
+
+const (
+    maxClearingAttempts  = 5
+    maxPurposeLength     = 210
+    clearingClaimTimeout = 10 * time.Minute // a claimed transfer is submitted again after this
+)
+
+var (
+    ErrExternalTransfersDisabled = errors.New("transfers to other banks are not available")
+    ErrInvalidBIC                = errors.New("invalid BIC")
+    ErrInvalidAccountNumber      = errors.New("account number does not match the BIC")
+    ErrOwnBankAccount            = errors.New("the account is at this bank, use a regular transfer")
+    ErrExternalCurrency          = errors.New("transfers to other banks can only be made from ruble accounts")
+)
+
+type ExternalTransferRequest struct {
+    FromAccountID int     `json:"from_account_id"`
+    BIC           string  `json:"bic"`
+    AccountNumber string  `json:"account_number"`
+    RecipientName string  `json:"recipient_name"`
+    Purpose       string  `json:"purpose"`
+    Amount        float64 `json:"amount"`
+}
+
+// ExternalTransferService sends money to accounts at other banks. The amount leaves the account
+// when the transfer is created; a worker then submits it through the ClearingGateway and follows it
+// until it settles or comes back, in which case the money is returned to the account. Transfers are
+// screened like transfers to other users; a held one waits in the held status until staff decide.
+type ExternalTransferService interface {
+    Create(userID int, req ExternalTransferRequest) (*models.ExternalTransfer, error)
+    List(userID int) ([]models.ExternalTransfer, error)
+    Get(userID, id int) (*models.ExternalTransfer, error)
+    Process(now time.Time)
+    StartWorker(interval time.Duration)
+}
+
+type externalTransferService struct {
+    externalRepo repositories.ExternalTransferRepository
+    accountRepo  repositories.AccountRepository
+    userRepo     repositories.UserRepository
+    limitService LimitService
+    fraudEngine  fraud.Engine
+    store        repositories.Store
+    gateway      ClearingGateway // nil when no clearing is configured
+    bankBIC      string
+}
+
+func NewExternalTransferService(externalRepo repositories.ExternalTransferRepository, accountRepo repositories.AccountRepository, userRepo repositories.UserRepository, limitService LimitService, fraudEngine fraud.Engine, store repositories.Store, gateway ClearingGateway, bankBIC string) ExternalTransferService {
+    return &externalTransferService{
+        externalRepo: externalRepo,
+        accountRepo:  accountRepo,
+        userRepo:     userRepo,
+        limitService: limitService,
+        fraudEngine:  fraudEngine,
+        store:        store,
+        gateway:      gateway,
+        bankBIC:      bankBIC,
+    }
+}
+
+func (s *externalTransferService) Create(userID int, req ExternalTransferRequest) (*models.ExternalTransfer, error) {
+    if s.gateway == nil {
+        return nil, ErrExternalTransfersDisabled
+    }
+    bic := strings.TrimSpace(req.BIC)
+    number := strings.TrimSpace(req.AccountNumber)
+    name := strings.TrimSpace(req.RecipientName)
+    purpose := strings.TrimSpace(req.Purpose)
+    if !utils.ValidBIC(bic) {
+        return nil, ErrInvalidBIC
+    }
+    if !utils.ValidAccountNumber(number, bic) {
+        return nil, ErrInvalidAccountNumber
+    }
+    if bic == s.bankBIC {
+        return nil, ErrOwnBankAccount
+    }
+    if name == "" {
+        return nil, errors.New("recipient name is required")
+    }
+    if len([]rune(purpose)) > maxPurposeLength {
+        return nil, fmt.Errorf("purpose must be at most %d characters", maxPurposeLength)
+    }
+    if req.Amount <= 0 {
+        return nil, errors.New("amount must be positive")
+    }
+    amount := roundMoney(req.Amount)
+
+    fromAcc, err := s.accountRepo.GetByID(req.FromAccountID)
+    if err != nil || fromAcc.UserID != userID {
+        return nil, errors.New("from account not found")
+    }
+    if fromAcc.Currency != models.DefaultCurrency {
+        return nil, ErrExternalCurrency
+    }
+    if err := checkDebit(fromAcc); err != nil {
+        return nil, err
+    }
+    if fromAcc.Balance < amount {
+        return nil, ErrInsufficientFunds
+    }
+    if err := s.limitService.Check(fromAcc, nil, amount); err != nil {
+        return nil, err
+    }
+    sender, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    if sender.EmailVerifiedAt == nil {
+        return nil, ErrEmailNotVerified
+    }
+    // Only ruble accounts can send to other banks, so the amount is already in rubles
+    screening, err := s.fraudEngine.Evaluate(fraud.Transfer{
+        UserID:          userID,
+        FromAccountID:   fromAcc.ID,
+        ToBIC:           bic,
+        ToAccountNumber: number,
+        AmountRub:       amount,
+        At:              time.Now(),
+    })
+    if err != nil {
+        return nil, err
+    }
+    if screening.Decision == fraud.Block {
+        return nil, ErrTransferBlocked
+    }
+
+    transfer := &models.ExternalTransfer{
+        UserID:        userID,
+        FromAccountID: fromAcc.ID,
+        Amount:        amount,
+        Currency:      fromAcc.Currency,
+        BIC:           bic,
+        AccountNumber: number,
+        RecipientName: name,
+        Purpose:       purpose,
+        Status:        models.ExternalPending,
+    }
+    var held *models.HeldTransfer
+    if screening.Decision == fraud.Hold {
+        transfer.Status = models.ExternalHeld
+        held = &models.HeldTransfer{
+            UserID:        userID,
+            FromAccountID: fromAcc.ID,
+            Amount:        amount,
+            Reasons:       screening.Reasons,
+            Status:        models.HeldPending,
+        }
+    }
+    err = s.store.InTx(func(tx *repositories.Tx) error {
+        locked, err := tx.Accounts.GetForUpdate(userID, fromAcc.ID)
+        if err != nil {
+            return err
+        }
+        if err := checkDebit(locked[fromAcc.ID]); err != nil {
+            return err
+        }
+        if locked[fromAcc.ID].Balance < amount {
+            return ErrInsufficientFunds
+        }
+        if err := s.limitService.CheckInTx(tx, locked[fromAcc.ID], nil, amount); err != nil {
+            return err
+        }
+        if _, err := tx.Accounts.AddToBalance(fromAcc.ID, -amount); err != nil {
+            return err
+        }
+        debit := &models.Transaction{
+            FromAccountID: fromAcc.ID,
+            Amount:        amount,
+            Currency:      fromAcc.Currency,
+            ToAmount:      amount,
+            ToCurrency:    fromAcc.Currency,
+            ExchangeRate:  1,
+            Type:          models.TxExternalTransfer,
+        }
+        if err := tx.Transactions.Create(debit); err != nil {
+            return err
+        }
+        transfer.TransactionID = debit.ID
+        if err := tx.ExternalTransfers.Create(transfer); err != nil || held == nil {
+            return err
+        }
+        held.ExternalTransferID = &transfer.ID
+        return tx.HeldTransfers.Create(held)
+    })
+    if err != nil {
+        return nil, err
+    }
+    if held != nil {
+        return nil, &TransferHeldError{HeldTransferID: held.ID}
+    }
+    return transfer, nil
+}
+
+func (s *externalTransferService) List(userID int) ([]models.ExternalTransfer, error) {
+    return s.externalRepo.GetByUserID(userID)
+}
+
+func (s *externalTransferService) Get(userID, id int) (*models.ExternalTransfer, error) {
+    t, err := s.externalRepo.GetByID(id)
+    if err != nil || t.UserID != userID {
+        return nil, errors.New("external transfer not found")
+    }
+    return t, nil
+}
+
+// Process submits the transfers that are due and collects the outcome of submitted ones.
+func (s *externalTransferService) Process(now time.Time) {
+    if s.gateway == nil {
+        return
+    }
+    due, err := s.externalRepo.GetDue(now, now.Add(-clearingClaimTimeout))
+    if err != nil {
+        log.Printf("Failed to load external transfers to submit: %v", err)
+    }
+    for i := range due {
+        s.submit(&due[i], now)
+    }
+
+    submitted, err := s.externalRepo.GetSubmitted()
+    if err != nil {
+        log.Printf("Failed to load submitted external transfers: %v", err)
+        return
+    }
+    for i := range submitted {
+        s.poll(&submitted[i])
+    }
+}
+
+func (s *externalTransferService) StartWorker(interval time.Duration) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for now := range ticker.C {
+            s.Process(now)
+        }
+    }()
+}
+
+// submit hands a pending transfer to the gateway. The transfer is claimed first, so a gateway ref that
+// cannot be saved does not lead to a second submission on the next run; only a transfer left claimed
+// for clearingClaimTimeout is submitted again, which the gateway must tolerate. Failed attempts are
+// retried with a growing delay; after maxClearingAttempts the transfer is returned.
+func (s *externalTransferService) submit(t *models.ExternalTransfer, now time.Time) {
+    ok, err := s.externalRepo.Claim(t)
+    if err != nil {
+        log.Printf("Failed to claim external transfer %d: %v", t.ID, err)
+        return
+    }
+    if !ok {
+        return
+    }
+    payment, err := s.payment(t)
+    if err == nil {
+        var ref string
+        if ref, err = s.gateway.Submit(*payment); err == nil {
+            if _, err := s.externalRepo.MarkSubmitted(t.ID, ref); err != nil {
+                log.Printf("Failed to mark external transfer %d as submitted: %v", t.ID, err)
+            }
+            return
+        }
+    }
+
+    attempts := t.Attempts + 1
+    if attempts >= maxClearingAttempts {
+        s.returnFunds(t, "could not be submitted to clearing: "+err.Error())
+        return
+    }
+    next := now.Add(time.Minute << uint(attempts))
+    if err := s.externalRepo.RecordFailedAttempt(t.ID, attempts, err.Error(), next); err != nil {
+        log.Printf("Failed to record attempt of external transfer %d: %v", t.ID, err)
+    }
+}
+
+func (s *externalTransferService) poll(t *models.ExternalTransfer) {
+    result, err := s.gateway.Status(t.GatewayRef)
+    if err != nil {
+        log.Printf("Failed to get clearing status of external transfer %d: %v", t.ID, err)
+        return
+    }
+    switch result.Status {
+    case ClearingSettled:
+        err := s.store.InTx(func(tx *repositories.Tx) error {
+            ok, err := tx.ExternalTransfers.Finish(t.ID, models.ExternalSettled, "")
+            if err != nil || !ok {
+                return err
+            }
+            return publish(tx.Outbox, EventExternalTransferSettled, externalTransferFinished(t, ""))
+        })
+        if err != nil {
+            log.Printf("Failed to settle external transfer %d: %v", t.ID, err)
+        }
+    case ClearingReturned:
+        reason := result.Reason
+        if reason == "" {
+            reason = "returned by clearing"
+        }
+        s.returnFunds(t, reason)
+    }
+}
+
+// returnFunds closes the transfer as returned and credits the amount back.
+func (s *externalTransferService) returnFunds(t *models.ExternalTransfer, reason string) {
+    err := s.store.InTx(func(tx *repositories.Tx) error {
+        _, err := refundExternal(tx, t, reason)
+        return err
+    })
+    if err != nil {
+        log.Printf("REFUND FAILURE: external transfer %d of %.2f %s to account %d: %v", t.ID, t.Amount, t.Currency, t.FromAccountID, err)
+    }
+}
+
+// refundExternal returns an open transfer in tx; false means it had been finished already. The refund
+// ignores the account status: the money never left the customer. Accounts cannot be closed while a
+// transfer from them is open.
+func refundExternal(tx *repositories.Tx, t *models.ExternalTransfer, reason string) (bool, error) {
+    ok, err := tx.ExternalTransfers.Finish(t.ID, models.ExternalReturned, reason)
+    if err != nil || !ok {
+        return false, err
+    }
+    if _, err := tx.Accounts.AddToBalance(t.FromAccountID, t.Amount); err != nil {
+        return false, err
+    }
+    refund := &models.Transaction{
+        ToAccountID:  t.FromAccountID,
+        Amount:       t.Amount,
+        Currency:     t.Currency,
+        ToAmount:     t.Amount,
+        ToCurrency:   t.Currency,
+        ExchangeRate: 1,
+        Type:         models.TxExternalReturn,
+    }
+    if err := tx.Transactions.Create(refund); err != nil {
+        return false, err
+    }
+    if err := tx.ExternalTransfers.SetReversal(t.ID, refund.ID); err != nil {
+        return false, err
+    }
+    return true, publish(tx.Outbox, EventExternalTransferReturned, externalTransferFinished(t, reason))
+}
+
+func externalTransferFinished(t *models.ExternalTransfer, reason string) ExternalTransferFinished {
+    status := models.ExternalSettled
+    if reason != "" {
+        status = models.ExternalReturned
+    }
+    return ExternalTransferFinished{
+        ExternalTransferID: t.ID,
+        UserID:             t.UserID,
+        FromAccountID:      t.FromAccountID,
+        Amount:             t.Amount,
+        Currency:           t.Currency,
+        BIC:                t.BIC,
+        AccountNumber:      t.AccountNumber,
+        RecipientName:      t.RecipientName,
+        Status:             status,
+        ReturnReason:       reason,
+    }
+}
+
+func (s *externalTransferService) payment(t *models.ExternalTransfer) (*ClearingPayment, error) {
+    acc, err := s.accountRepo.GetByID(t.FromAccountID)
+    if err != nil {
+        return nil, err
+    }
+    payer, err := s.userRepo.GetByID(t.UserID)
+    if err != nil {
+        return nil, err
+    }
+    return &ClearingPayment{
+        ID:           t.ID,
+        Amount:       t.Amount,
+        Currency:     t.Currency,
+        PayerName:    payer.FullName,
+        PayerAccount: acc.Number,
+        PayerBIC:     s.bankBIC,
+        PayeeName:    t.RecipientName,
+        PayeeAccount: t.AccountNumber,
+        PayeeBIC:     t.BIC,
+        Purpose:      t.Purpose,
+        CreatedAt:    t.CreatedAt,
+    }, nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+    "encoding/json"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "banking_service_project/fraud"
+    "banking_service_project/models"
+)
+
+const (
+    testBankBIC      = "044525999"
+    testPayeeBIC     = "044525225"
+    testPayeeAccount = "40702810438000034726"
+)
+
+type clearingFixture struct {
+    dir          string
+    service      *externalTransferService
+    transfers    *fakeExternalRepo
+    accounts     *fakeAccountRepo
+    transactions *fakeTransactionRepo
+    outbox       *fakeOutbox
+}
+
+// newClearingFixture sets up one pending transfer of 500 RUB, already debited from account 1.
+func newClearingFixture(t *testing.T, autoSettle bool) *clearingFixture {
+    dir := t.TempDir()
+    gateway, err := NewFileClearingGateway(dir, autoSettle)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f := &clearingFixture{
+        dir: dir,
+        transfers: &fakeExternalRepo{transfers: map[int]*models.ExternalTransfer{
+            7: {ID: 7, UserID: 10, FromAccountID: 1, Amount: 500, Currency: "RUB", BIC: testPayeeBIC,
+                AccountNumber: testPayeeAccount, RecipientName: "Иван Петров", Status: models.ExternalPending},
+        }},
+        accounts: &fakeAccountRepo{accounts: map[int]*models.Account{
+            1: {ID: 1, UserID: 10, Number: "40817810100000000001", Balance: 1000, Currency: "RUB", Status: models.AccountActive},
+        }},
+        transactions: &fakeTransactionRepo{},
+    }
+    users := verifiedUsers(10)
+    users.users[10].FullName = "Анна Смирнова"
+    store := newFakeStore(f.accounts, f.transactions)
+    store.tx.ExternalTransfers = f.transfers
+    f.outbox = store.outbox()
+    f.service = NewExternalTransferService(f.transfers, f.accounts, users, noLimits{}, fraud.NewEngine(), store, gateway, testBankBIC).(*externalTransferService)
+    return f
+}
+
+func (f *clearingFixture) writeResult(t *testing.T, result string) {
+    if err := os.WriteFile(filepath.Join(f.dir, "results", "ext-7.json"), []byte(result), 0o640); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestCreateExternalTransfer(t *testing.T) {
+    tests := []struct {
+        name    string
+        req     ExternalTransferRequest
+        wantErr error
+    }{
+        {name: "invalid BIC", req: ExternalTransferRequest{BIC: "12345", AccountNumber: testPayeeAccount}, wantErr: ErrInvalidBIC},
+        {name: "wrong control key", req: ExternalTransferRequest{BIC: testPayeeBIC, AccountNumber: "40702810538000034726"}, wantErr: ErrInvalidAccountNumber},
+        {name: "account at this bank", req: ExternalTransferRequest{BIC: testBankBIC, AccountNumber: "40817810100000000001"}, wantErr: ErrOwnBankAccount},
+        {name: "dollar account", req: ExternalTransferRequest{FromAccountID: 2, BIC: testPayeeBIC, AccountNumber: testPayeeAccount}, wantErr: ErrExternalCurrency},
+    }
+    for _, tt := range tests {
+        f := newClearingFixture(t, false)
+        f.accounts.accounts[2] = &models.Account{ID: 2, UserID: 10, Balance: 1000, Currency: "USD", Status: models.AccountActive}
+        tt.req.RecipientName = "Иван Петров"
+        tt.req.Amount = 100
+        if tt.req.FromAccountID == 0 {
+            tt.req.FromAccountID = 1
+        }
+        if _, err := f.service.Create(10, tt.req); !errors.Is(err, tt.wantErr) {
+            t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+        }
+        if f.accounts.accounts[1].Balance != 1000 || f.accounts.accounts[2].Balance != 1000 {
+            t.Errorf("%s: a rejected transfer must not move money", tt.name)
+        }
+    }
+
+    f := newClearingFixture(t, false)
+    transfer, err := f.service.Create(10, ExternalTransferRequest{FromAccountID: 1, BIC: " " + testPayeeBIC, AccountNumber: testPayeeAccount,
+        RecipientName: "Иван Петров", Amount: 300.004})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if transfer.Status != models.ExternalPending || transfer.Amount != 300 || transfer.BIC != testPayeeBIC {
+        t.Errorf("transfer = %+v", transfer)
+    }
+    if f.accounts.accounts[1].Balance != 700 {
+        t.Errorf("balance = %v, want 700", f.accounts.accounts[1].Balance)
+    }
+    if len(f.transactions.created) != 1 || f.transactions.created[0].Type != models.TxExternalTransfer || transfer.TransactionID != f.transactions.created[0].ID {
+        t.Errorf("transactions = %v, want one %s linked to the transfer", f.transactions.created, models.TxExternalTransfer)
+    }
+}
+
+func TestClearingSubmitAndReturn(t *testing.T) {
+    f := newClearingFixture(t, false)
+    now := time.Now()
+
+    f.service.Process(now)
+    transfer := f.transfers.transfers[7]
+    if transfer.Status != models.ExternalSubmitted || transfer.GatewayRef != "ext-7" {
+        t.Fatalf("after submit: status %s, ref %q", transfer.Status, transfer.GatewayRef)
+    }
+    data, err := os.ReadFile(filepath.Join(f.dir, "outgoing", "ext-7.json"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    var payment ClearingPayment
+    if err := json.Unmarshal(data, &payment); err != nil {
+        t.Fatal(err)
+    }
+    if payment.Amount != 500 || payment.PayerName != "Анна Смирнова" || payment.PayerAccount != "40817810100000000001" ||
+        payment.PayerBIC != testBankBIC || payment.PayeeAccount != testPayeeAccount || payment.PayeeBIC != testPayeeBIC {
+        t.Errorf("payment = %+v", payment)
+    }
+
+    // No result file yet: the payment stays in clearing
+    f.service.Process(now)
+    if transfer.Status != models.ExternalSubmitted {
+        t.Fatalf("without a result: status %s, want submitted", transfer.Status)
+    }
+
+    f.writeResult(t, `{"status": "returned", "reason": "Счёт получателя закрыт"}`)
+    f.service.Process(now)
+    f.service.Process(now)
+    if transfer.Status != models.ExternalReturned || transfer.ReturnReason != "Счёт получателя закрыт" {
+        t.Fatalf("after return: status %s, reason %q", transfer.Status, transfer.ReturnReason)
+    }
+    if f.accounts.accounts[1].Balance != 1500 {
+        t.Errorf("balance = %v, want the 500 refunded once", f.accounts.accounts[1].Balance)
+    }
+    if len(f.transactions.created) != 1 || f.transactions.created[0].Type != models.TxExternalReturn {
+        t.Fatalf("transactions = %v, want one %s", f.transactions.created, models.TxExternalReturn)
+    }
+    if transfer.ReversalTransactionID == nil || *transfer.ReversalTransactionID != f.transactions.created[0].ID {
+        t.Errorf("reversal transaction not linked")
+    }
+    if len(f.outbox.events) != 1 || f.outbox.events[0].Type != EventExternalTransferReturned {
+        t.Errorf("events = %v, want one %s", f.outbox.events, EventExternalTransferReturned)
+    }
+}
+
+func TestClearingAutoSettle(t *testing.T) {
+    f := newClearingFixture(t, true)
+
+    f.service.Process(time.Now())
+    transfer := f.transfers.transfers[7]
+    if transfer.Status != models.ExternalSettled {
+        t.Fatalf("status %s, want settled", transfer.Status)
+    }
+    if f.accounts.accounts[1].Balance != 1000 || len(f.transactions.created) != 0 {
+        t.Errorf("a settled transfer must not move money again")
+    }
+    if len(f.outbox.events) != 1 || f.outbox.events[0].Type != EventExternalTransferSettled {
+        t.Errorf("events = %v, want one %s", f.outbox.events, EventExternalTransferSettled)
+    }
+}
+
+func TestFileClearingGatewayRejectsUnknownStatus(t *testing.T) {
+    f := newClearingFixture(t, false)
+    f.writeResult(t, `{"status": "lost"}`)
+
+    if _, err := f.service.gateway.Status("ext-7"); err == nil {
+        t.Fatal("expected an error for an unknown clearing status")
+    }
+}
+
+func TestClearingClaims(t *testing.T) {
+    f := newClearingFixture(t, false)
+    now := time.Now()
+    transfer := f.transfers.transfers[7]
+
+    // Another worker claimed it a moment ago: leave it alone
+    transfer.Status = models.ExternalSubmitting
+    transfer.UpdatedAt = now.Add(-time.Minute)
+    f.service.Process(now)
+    if transfer.Status != models.ExternalSubmitting {
+        t.Fatalf("a fresh claim was taken over: status %s", transfer.Status)
+    }
+
+    // That worker died before recording the outcome: submit it again
+    f.service.Process(now.Add(clearingClaimTimeout))
+    if transfer.Status != models.ExternalSubmitted || transfer.GatewayRef != "ext-7" {
+        t.Fatalf("stale claim: status %s, ref %q", transfer.Status, transfer.GatewayRef)
+    }
+}
+
+func TestCreateExternalTransferScreening(t *testing.T) {
+    req := ExternalTransferRequest{FromAccountID: 1, BIC: testPayeeBIC, AccountNumber: testPayeeAccount, RecipientName: "Иван Петров", Amount: 300}
+
+    f := newClearingFixture(t, false)
+    f.service.fraudEngine = fraud.NewEngine(fixedRule(fraud.Block))
+    if _, err := f.service.Create(10, req); err != ErrTransferBlocked {
+        t.Fatalf("blocked: err = %v, want ErrTransferBlocked", err)
+    }
+    if f.accounts.accounts[1].Balance != 1000 {
+        t.Errorf("a blocked transfer moved money")
+    }
+
+    f = newClearingFixture(t, false)
+    held := &fakeHeldRepo{}
+    f.service.store.(*fakeStore).tx.HeldTransfers = held
+    f.service.fraudEngine = fraud.NewEngine(fixedRule(fraud.Hold))
+    _, err := f.service.Create(10, req)
+    var heldErr *TransferHeldError
+    if !errors.As(err, &heldErr) || len(held.held) != 1 || heldErr.HeldTransferID != held.held[0].ID {
+        t.Fatalf("held: err = %v, held = %v", err, held.held)
+    }
+    // The money is reserved while staff review it, and the worker does not submit it
+    transfer := f.transfers.transfers[*held.held[0].ExternalTransferID]
+    if transfer.Status != models.ExternalHeld || f.accounts.accounts[1].Balance != 700 {
+        t.Errorf("held transfer: status %s, balance %v", transfer.Status, f.accounts.accounts[1].Balance)
+    }
+    f.service.Process(time.Now())
+    if transfer.Status != models.ExternalHeld {
+        t.Errorf("a held transfer was submitted")
+    }
+}
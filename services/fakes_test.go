@@ -0,0 +1,630 @@
+package services
+
+import (
+    "errors"
+    "sort"
+    "time"
+
+    "banking_service_project/fraud"
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+// In-memory stand-ins for the repositories. Each embeds the interface it implements, so a test that
+// reaches a method nobody faked fails loudly on the nil embedded value.
+
+type fakeAccountRepo struct {
+    repositories.AccountRepository
+    accounts map[int]*models.Account
+}
+
+func (r *fakeAccountRepo) GetByID(accountID int) (*models.Account, error) {
+    acc, ok := r.accounts[accountID]
+    if !ok {
+        return nil, errors.New("account not found")
+    }
+    copied := *acc
+    return &copied, nil
+}
+
+func (r *fakeAccountRepo) UpdateBalance(accountID int, newBalance float64) error {
+    r.accounts[accountID].Balance = newBalance
+    return nil
+}
+
+func (r *fakeAccountRepo) GetForUpdate(ownerID int, accountIDs ...int) (map[int]*models.Account, error) {
+    locked := make(map[int]*models.Account)
+    for id, acc := range r.accounts {
+        if ownerID != 0 && acc.UserID == ownerID {
+            copied := *acc
+            locked[id] = &copied
+        }
+    }
+    for _, id := range accountIDs {
+        acc, err := r.GetByID(id)
+        if err != nil {
+            return nil, err
+        }
+        locked[id] = acc
+    }
+    return locked, nil
+}
+
+func (r *fakeAccountRepo) SetStatus(accountID int, status, reason string, changedBy int) error {
+    r.accounts[accountID].Status = status
+    return nil
+}
+
+func (r *fakeAccountRepo) AddToBalance(accountID int, delta float64) (float64, error) {
+    acc, ok := r.accounts[accountID]
+    if !ok {
+        return 0, errors.New("account not found")
+    }
+    acc.Balance = roundMoney(acc.Balance + delta)
+    return acc.Balance, nil
+}
+
+type fakeTransactionRepo struct {
+    repositories.TransactionRepository
+    created  []*models.Transaction
+    outgoing []fakeOutgoing // history the limit sums are taken from
+}
+
+type fakeOutgoing struct {
+    userID, accountID, toAccountID int
+    currency                       string
+    amount                         float64
+    at                             time.Time
+}
+
+func (r *fakeTransactionRepo) SumOutgoingByUser(userID int, since time.Time) (map[string]float64, error) {
+    sums := make(map[string]float64)
+    for _, o := range r.outgoing {
+        if o.userID == userID && !o.at.Before(since) {
+            sums[o.currency] += o.amount
+        }
+    }
+    return sums, nil
+}
+
+func (r *fakeTransactionRepo) SumOutgoingByAccount(accountID int, since time.Time) (float64, error) {
+    sum := 0.0
+    for _, o := range r.outgoing {
+        if o.accountID == accountID && !o.at.Before(since) {
+            sum += o.amount
+        }
+    }
+    return sum, nil
+}
+
+func (r *fakeTransactionRepo) SumOutgoingToAccount(userID, toAccountID int, since time.Time) (map[string]float64, error) {
+    sums := make(map[string]float64)
+    for _, o := range r.outgoing {
+        if o.userID == userID && o.toAccountID == toAccountID && !o.at.Before(since) {
+            sums[o.currency] += o.amount
+        }
+    }
+    return sums, nil
+}
+
+func (r *fakeTransactionRepo) Create(tx *models.Transaction) error {
+    tx.ID = len(r.created) + 1
+    tx.CreatedAt = time.Now()
+    r.created = append(r.created, tx)
+    return nil
+}
+
+// fakeFXRateRepo holds published rates in date order.
+type fakeFXRateRepo struct {
+    repositories.FXRateRepository
+    rates     []models.FXRate
+    fetchedAt time.Time
+}
+
+func (r *fakeFXRateRepo) LastFetchedAt() (time.Time, error) {
+    return r.fetchedAt, nil
+}
+
+func (r *fakeFXRateRepo) GetRate(currency string, date time.Time) (*models.FXRate, error) {
+    var found *models.FXRate
+    for i, fr := range r.rates {
+        if fr.Currency == currency && !fr.Date.After(date) {
+            found = &r.rates[i]
+        }
+    }
+    if found == nil {
+        return nil, errors.New("exchange rate not found")
+    }
+    return found, nil
+}
+
+func (r *fakeFXRateRepo) GetSeries(currency string, from, to time.Time) ([]models.FXRate, error) {
+    var series []models.FXRate
+    for _, fr := range r.rates {
+        if fr.Currency != currency || fr.Date.After(to) {
+            continue
+        }
+        if fr.Date.Before(from) {
+            series = series[:0]
+        }
+        series = append(series, fr)
+    }
+    return series, nil
+}
+
+type fakeUserRepo struct {
+    repositories.UserRepository
+    users map[int]*models.User
+}
+
+// verifiedUsers returns users with confirmed emails, who are allowed to send transfers.
+func verifiedUsers(ids ...int) *fakeUserRepo {
+    verified := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+    users := make(map[int]*models.User)
+    for _, id := range ids {
+        users[id] = &models.User{ID: id, EmailVerifiedAt: &verified}
+    }
+    return &fakeUserRepo{users: users}
+}
+
+func (r *fakeUserRepo) GetByID(userID int) (*models.User, error) {
+    user, ok := r.users[userID]
+    if !ok {
+        return nil, errors.New("user not found")
+    }
+    return user, nil
+}
+
+func (r *fakeUserRepo) Close(userID int) error {
+    now := time.Now()
+    r.users[userID].ClosedAt = &now
+    return nil
+}
+
+func (r *fakeUserRepo) SetRoles(userID int, roles []string) error {
+    r.users[userID].Roles = roles
+    return nil
+}
+
+func (r *fakeUserRepo) find(match func(u *models.User) bool) (*models.User, error) {
+    for _, u := range r.users {
+        if match(u) {
+            return u, nil
+        }
+    }
+    return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepo) GetByEmail(email string) (*models.User, error) {
+    return r.find(func(u *models.User) bool { return u.Email == email })
+}
+
+func (r *fakeUserRepo) GetByUsername(username string) (*models.User, error) {
+    return r.find(func(u *models.User) bool { return u.Username == username })
+}
+
+func (r *fakeUserRepo) GetByPhone(phone string) (*models.User, error) {
+    return r.find(func(u *models.User) bool { return u.Phone == phone })
+}
+
+// fakeLimitRepo has no tier rows, so the default limits apply.
+type fakeLimitRepo struct{}
+
+func (fakeLimitRepo) GetByTier(tier string) (*models.TransferLimits, error) {
+    return nil, nil
+}
+
+// noLimits lets every transfer through.
+type noLimits struct {
+    LimitService
+}
+
+func (noLimits) Check(fromAcc, toAcc *models.Account, amount float64) error {
+    return nil
+}
+
+func (noLimits) CheckInTx(tx *repositories.Tx, fromAcc, toAcc *models.Account, amount float64) error {
+    return nil
+}
+
+// fakeExternalRepo keeps the status transitions of the real repository.
+type fakeExternalRepo struct {
+    repositories.ExternalTransferRepository
+    transfers map[int]*models.ExternalTransfer
+}
+
+func (r *fakeExternalRepo) Create(t *models.ExternalTransfer) error {
+    if r.transfers == nil {
+        r.transfers = make(map[int]*models.ExternalTransfer)
+    }
+    t.ID = len(r.transfers) + 1
+    stored := *t
+    r.transfers[t.ID] = &stored
+    return nil
+}
+
+func (r *fakeExternalRepo) CountOpenByAccount(accountID int) (int, error) {
+    count := 0
+    for _, t := range r.transfers {
+        switch t.Status {
+        case models.ExternalHeld, models.ExternalPending, models.ExternalSubmitting, models.ExternalSubmitted:
+            if t.FromAccountID == accountID {
+                count++
+            }
+        }
+    }
+    return count, nil
+}
+
+func (r *fakeExternalRepo) GetDue(now, staleBefore time.Time) ([]models.ExternalTransfer, error) {
+    var due []models.ExternalTransfer
+    for _, t := range r.transfers {
+        if t.Status == models.ExternalPending && !t.NextAttemptAt.After(now) ||
+            t.Status == models.ExternalSubmitting && t.UpdatedAt.Before(staleBefore) {
+            due = append(due, *t)
+        }
+    }
+    return due, nil
+}
+
+func (r *fakeExternalRepo) GetSubmitted() ([]models.ExternalTransfer, error) {
+    var submitted []models.ExternalTransfer
+    for _, t := range r.transfers {
+        if t.Status == models.ExternalSubmitted {
+            submitted = append(submitted, *t)
+        }
+    }
+    return submitted, nil
+}
+
+func (r *fakeExternalRepo) Claim(t *models.ExternalTransfer) (bool, error) {
+    stored := r.transfers[t.ID]
+    if stored.Status != t.Status || !stored.UpdatedAt.Equal(t.UpdatedAt) {
+        return false, nil
+    }
+    stored.Status = models.ExternalSubmitting
+    stored.UpdatedAt = time.Now()
+    t.Status, t.UpdatedAt = stored.Status, stored.UpdatedAt
+    return true, nil
+}
+
+func (r *fakeExternalRepo) MarkSubmitted(id int, gatewayRef string) (bool, error) {
+    t := r.transfers[id]
+    if t.Status != models.ExternalSubmitting {
+        return false, nil
+    }
+    t.Status = models.ExternalSubmitted
+    t.GatewayRef = gatewayRef
+    t.Attempts++
+    return true, nil
+}
+
+func (r *fakeExternalRepo) RecordFailedAttempt(id, attempts int, lastError string, nextAttemptAt time.Time) error {
+    t := r.transfers[id]
+    if t.Status != models.ExternalSubmitting {
+        return nil
+    }
+    t.Status = models.ExternalPending
+    t.Attempts = attempts
+    t.LastError = lastError
+    t.NextAttemptAt = nextAttemptAt
+    return nil
+}
+
+func (r *fakeExternalRepo) Finish(id int, status, returnReason string) (bool, error) {
+    t := r.transfers[id]
+    if t.Status == models.ExternalSettled || t.Status == models.ExternalReturned {
+        return false, nil
+    }
+    t.Status = status
+    t.ReturnReason = returnReason
+    return true, nil
+}
+
+func (r *fakeExternalRepo) SetReversal(id, transactionID int) error {
+    r.transfers[id].ReversalTransactionID = &transactionID
+    return nil
+}
+
+// fakeStore runs fn directly against the fakes in tx; nothing is rolled back on error.
+type fakeStore struct {
+    tx *repositories.Tx
+}
+
+func newFakeStore(accounts *fakeAccountRepo, transactions *fakeTransactionRepo) *fakeStore {
+    return &fakeStore{tx: &repositories.Tx{Accounts: accounts, Transactions: transactions, Outbox: &fakeOutbox{}}}
+}
+
+func (s *fakeStore) InTx(fn func(tx *repositories.Tx) error) error {
+    return fn(s.tx)
+}
+
+func (s *fakeStore) outbox() *fakeOutbox {
+    return s.tx.Outbox.(*fakeOutbox)
+}
+
+type fakeTokenRepo struct {
+    repositories.TokenRepository
+    revokedUsers    []int
+    refreshTokens   []*models.RefreshToken
+    revokedFamilies []string
+}
+
+func (r *fakeTokenRepo) GetRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+    for _, t := range r.refreshTokens {
+        if t.TokenHash == hash {
+            copied := *t
+            return &copied, nil
+        }
+    }
+    return nil, errors.New("refresh token not found")
+}
+
+func (r *fakeTokenRepo) RevokeFamily(familyID string) error {
+    r.revokedFamilies = append(r.revokedFamilies, familyID)
+    return nil
+}
+
+func (r *fakeTokenRepo) RevokeUserTokens(userID int) error {
+    r.revokedUsers = append(r.revokedUsers, userID)
+    return nil
+}
+
+type fakeUserTokenRepo struct {
+    repositories.UserTokenRepository
+    tokens []*models.UserToken
+}
+
+func (r *fakeUserTokenRepo) Create(t *models.UserToken) error {
+    for _, existing := range r.tokens {
+        if existing.TokenHash == t.TokenHash {
+            return errors.New("duplicate token hash")
+        }
+    }
+    t.ID = len(r.tokens) + 1
+    t.CreatedAt = time.Now()
+    r.tokens = append(r.tokens, t)
+    return nil
+}
+
+func (r *fakeUserTokenRepo) GetByHash(purpose, hash string) (*models.UserToken, error) {
+    for _, t := range r.tokens {
+        if t.Purpose == purpose && t.TokenHash == hash {
+            copied := *t
+            return &copied, nil
+        }
+    }
+    return nil, errors.New("token not found")
+}
+
+func (r *fakeUserTokenRepo) MarkUsed(id int) (bool, error) {
+    for _, t := range r.tokens {
+        if t.ID == id && t.UsedAt == nil {
+            now := time.Now()
+            t.UsedAt = &now
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+func (r *fakeUserTokenRepo) InvalidateForUser(userID int, purpose string) error {
+    now := time.Now()
+    for _, t := range r.tokens {
+        if t.UserID == userID && t.Purpose == purpose && t.UsedAt == nil {
+            t.UsedAt = &now
+        }
+    }
+    return nil
+}
+
+func (r *fakeUserTokenRepo) DeleteForUser(userID int, purpose string) error {
+    kept := r.tokens[:0]
+    for _, t := range r.tokens {
+        if t.UserID != userID || t.Purpose != purpose {
+            kept = append(kept, t)
+        }
+    }
+    r.tokens = kept
+    return nil
+}
+
+type fakeAuditRepo struct {
+    repositories.AuditRepository
+    entries []models.AuditEntry
+}
+
+func (r *fakeAuditRepo) Create(entry *models.AuditEntry) error {
+    r.entries = append(r.entries, *entry)
+    return nil
+}
+
+type fakeOutbox struct {
+    repositories.OutboxRepository
+    events []models.OutboxEvent
+}
+
+func (o *fakeOutbox) Add(event *models.OutboxEvent) error {
+    event.ID = len(o.events) + 1
+    o.events = append(o.events, *event)
+    return nil
+}
+
+type fakeNotificationRepo struct {
+    repositories.NotificationRepository
+    queued      []*models.Notification
+    recorded    []*models.Notification
+    preferences []models.NotificationPreference
+}
+
+func (r *fakeNotificationRepo) Record(n *models.Notification) error {
+    n.ID = 1000 + len(r.recorded)
+    n.CreatedAt = time.Now()
+    r.recorded = append(r.recorded, n)
+    return nil
+}
+
+func (r *fakeNotificationRepo) Enqueue(n *models.Notification) error {
+    n.ID = len(r.queued) + 1
+    n.Status = models.NotificationPending
+    n.CreatedAt = time.Now()
+    n.NextAttemptAt = n.CreatedAt
+    r.queued = append(r.queued, n)
+    return nil
+}
+
+func (r *fakeNotificationRepo) GetDue(now time.Time, limit int) ([]models.Notification, error) {
+    var due []models.Notification
+    for _, n := range r.queued {
+        if n.Status == models.NotificationPending && !n.NextAttemptAt.After(now) && len(due) < limit {
+            due = append(due, *n)
+        }
+    }
+    return due, nil
+}
+
+func (r *fakeNotificationRepo) MarkSent(id, attempts int, at time.Time) error {
+    n := r.queued[id-1]
+    n.Status = models.NotificationSent
+    n.Attempts = attempts
+    n.SentAt = &at
+    return nil
+}
+
+func (r *fakeNotificationRepo) RecordFailure(id, attempts int, lastError string, next time.Time, failed bool) error {
+    n := r.queued[id-1]
+    n.Attempts = attempts
+    n.LastError = lastError
+    n.NextAttemptAt = next
+    if failed {
+        n.Status = models.NotificationFailed
+    }
+    return nil
+}
+
+func (r *fakeNotificationRepo) GetPreferences(userID int) ([]models.NotificationPreference, error) {
+    var prefs []models.NotificationPreference
+    for _, p := range r.preferences {
+        if p.UserID == userID {
+            prefs = append(prefs, p)
+        }
+    }
+    return prefs, nil
+}
+
+func (r *fakeNotificationRepo) SetPreference(p *models.NotificationPreference) error {
+    r.preferences = append(r.preferences, *p)
+    return nil
+}
+
+type fakeDigestRepo struct {
+    repositories.TransferDigestRepository
+    items []*models.TransferDigestItem
+}
+
+func (r *fakeDigestRepo) Add(item *models.TransferDigestItem) error {
+    item.ID = len(r.items) + 1
+    r.items = append(r.items, item)
+    return nil
+}
+
+func (r *fakeDigestRepo) GetUnsentBefore(before time.Time) ([]models.TransferDigestItem, error) {
+    var unsent []models.TransferDigestItem
+    for _, item := range r.items {
+        if item.SentAt == nil && item.At.Before(before) {
+            unsent = append(unsent, *item)
+        }
+    }
+    sort.SliceStable(unsent, func(i, j int) bool { return unsent[i].UserID < unsent[j].UserID })
+    return unsent, nil
+}
+
+func (r *fakeDigestRepo) MarkSent(ids []int, at time.Time) error {
+    for _, id := range ids {
+        r.items[id-1].SentAt = &at
+    }
+    return nil
+}
+
+type fakeScheduleRepo struct {
+    repositories.PaymentScheduleRepository
+    installments []models.PaymentSchedule
+}
+
+func (r *fakeScheduleRepo) GetUnpaidDueBefore(before time.Time) ([]models.PaymentSchedule, error) {
+    var unpaid []models.PaymentSchedule
+    for _, p := range r.installments {
+        if !p.Paid && p.DueDate.Before(before) {
+            unpaid = append(unpaid, p)
+        }
+    }
+    return unpaid, nil
+}
+
+type fakeCreditRepo struct {
+    repositories.CreditRepository
+    credits    map[int]*models.Credit
+    openByUser map[int]int
+}
+
+func (r *fakeCreditRepo) CountOpenByUser(userID int) (int, error) {
+    return r.openByUser[userID], nil
+}
+
+func (r *fakeCreditRepo) GetByID(id int) (*models.Credit, error) {
+    credit, ok := r.credits[id]
+    if !ok {
+        return nil, errors.New("credit not found")
+    }
+    return credit, nil
+}
+
+// fakeCommunicationRepo records each kind once per installment, like the unique index does.
+type fakeCommunicationRepo struct {
+    repositories.CreditCommunicationRepository
+    sent []models.CreditCommunication
+}
+
+func (r *fakeCommunicationRepo) Record(c *models.CreditCommunication) (bool, error) {
+    for _, s := range r.sent {
+        if s.InstallmentID == c.InstallmentID && s.Kind == c.Kind {
+            return false, nil
+        }
+    }
+    c.ID = len(r.sent) + 1
+    r.sent = append(r.sent, *c)
+    return true, nil
+}
+
+// recordingNotifier keeps the templates it was asked to send instead of sending them.
+type recordingNotifier struct {
+    NotificationService
+    templates []string
+    data      []map[string]interface{}
+}
+
+func (n *recordingNotifier) Notify(userID int, template string, data map[string]interface{}) error {
+    n.templates = append(n.templates, template)
+    n.data = append(n.data, data)
+    return nil
+}
+
+type fakeHeldRepo struct {
+    repositories.HeldTransferRepository
+    held []*models.HeldTransfer
+}
+
+func (r *fakeHeldRepo) Create(ht *models.HeldTransfer) error {
+    ht.ID = len(r.held) + 1
+    r.held = append(r.held, ht)
+    return nil
+}
+
+// fixedRule gives the same decision for every transfer.
+type fixedRule fraud.Decision
+
+func (r fixedRule) Name() string { return "fixed" }
+
+func (r fixedRule) Evaluate(t fraud.Transfer) (fraud.Decision, string, error) {
+    return fraud.Decision(r), "fixed", nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+    "time"
+
+    "banking_service_project/fraud"
+    "banking_service_project/repositories"
+)
+
+type fraudHistory struct {
+    transactionRepo repositories.TransactionRepository
+    userRepo        repositories.UserRepository
+    loginEventRepo  repositories.LoginEventRepository
+    externalRepo    repositories.ExternalTransferRepository
+    rateSource      RateSource
+}
+
+// NewFraudHistory exposes stored transactions and login events to the fraud rules.
+func NewFraudHistory(transactionRepo repositories.TransactionRepository, userRepo repositories.UserRepository, loginEventRepo repositories.LoginEventRepository, externalRepo repositories.ExternalTransferRepository, rateSource RateSource) fraud.History {
+    return &fraudHistory{transactionRepo: transactionRepo, userRepo: userRepo, loginEventRepo: loginEventRepo, externalRepo: externalRepo, rateSource: rateSource}
+}
+
+func (h *fraudHistory) HasTransferredTo(userID, toAccountID int) (bool, error) {
+    return h.transactionRepo.HasTransferredTo(userID, toAccountID)
+}
+
+func (h *fraudHistory) HasTransferredToExternal(userID int, bic, accountNumber string) (bool, error) {
+    return h.externalRepo.HasTransferredTo(userID, bic, accountNumber)
+}
+
+func (h *fraudHistory) CountOutgoingSince(userID int, since time.Time) (int, error) {
+    return h.transactionRepo.CountOutgoingByUser(userID, since)
+}
+
+func (h *fraudHistory) AverageOutgoingSince(userID int, since time.Time) (float64, int, error) {
+    count, err := h.transactionRepo.CountOutgoingByUser(userID, since)
+    if err != nil || count == 0 {
+        return 0, 0, err
+    }
+    sums, err := h.transactionRepo.SumOutgoingByUser(userID, since)
+    if err != nil {
+        return 0, 0, err
+    }
+    total := 0.0
+    for currency, sum := range sums {
+        rate, err := h.rateSource.RubRate(currency, time.Now())
+        if err != nil {
+            return 0, 0, err
+        }
+        total += sum * rate
+    }
+    return total / float64(count), count, nil
+}
+
+func (h *fraudHistory) LastPasswordChange(userID int) (*time.Time, error) {
+    user, err := h.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    return user.PasswordChangedAt, nil
+}
+
+func (h *fraudHistory) LastNewDeviceLogin(userID int) (*time.Time, error) {
+    return h.loginEventRepo.LastNewDevice(userID)
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+    "errors"
+    "log"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+var ErrDepositLocked = errors.New("money cannot be taken out of a term deposit before it matures; close the deposit instead")
+
+// InterestService accrues interest on savings and deposit accounts. Interest is accrued daily on
+// the end-of-day balance and paid out (capitalized) on the last day of each month and on the last
+// day of a deposit's term. Interest is owed whatever the account status, so frozen accounts accrue
+// and get paid as usual. Each account is accrued in one database transaction with its row locked,
+// so a period is paid out together with the move of interest_accrued_to past it, exactly once.
+type InterestService interface {
+    OpeningRate(product *models.AccountProduct) float64
+    AccrueAll(now time.Time)
+    Settle(tx *repositories.Tx, acc *models.Account) error
+    StartAccrual(interval time.Duration)
+}
+
+type interestService struct {
+    accountRepo     repositories.AccountRepository
+    productRepo     repositories.AccountProductRepository
+    externalService ExternalService
+    store           repositories.Store
+}
+
+func NewInterestService(accountRepo repositories.AccountRepository, productRepo repositories.AccountProductRepository, externalService ExternalService, store repositories.Store) InterestService {
+    return &interestService{accountRepo: accountRepo, productRepo: productRepo, externalService: externalService, store: store}
+}
+
+// OpeningRate is the rate a new account of the product starts with. For products tied to the key
+// rate the product's own rate is the fallback when the CBR cannot be reached.
+func (s *interestService) OpeningRate(product *models.AccountProduct) float64 {
+    if product.KeyRateSpread == nil {
+        return product.InterestRate
+    }
+    keyRate, err := s.externalService.GetKeyRateCBR()
+    if err != nil {
+        log.Printf("Failed to get the key rate, opening %s at %.2f%%: %v", product.Code, product.InterestRate, err)
+        return product.InterestRate
+    }
+    return keyRate + *product.KeyRateSpread
+}
+
+// AccrueAll accrues interest on every open savings and deposit account up to the end of yesterday.
+// Days already accrued are skipped, so running it more than once a day is harmless.
+func (s *interestService) AccrueAll(now time.Time) {
+    accounts, err := s.accountRepo.GetInterestBearing()
+    if err != nil {
+        log.Printf("Failed to load interest-bearing accounts: %v", err)
+        return
+    }
+    through := truncateDay(now).AddDate(0, 0, -1)
+    products := make(map[int]*models.AccountProduct)
+    keyRate, keyRateErr := 0.0, error(nil)
+    keyRateFetched := false
+
+    for i := range accounts {
+        acc := &accounts[i]
+        rate := acc.InterestRate
+        // Savings rates tied to the key rate follow it; deposits keep the rate they were opened at
+        if acc.Type == models.AccountTypeSavings && acc.ProductID != nil {
+            product, ok := products[*acc.ProductID]
+            if !ok {
+                product, err = s.productRepo.GetByID(*acc.ProductID)
+                if err != nil {
+                    log.Printf("Failed to load product of account %d: %v", acc.ID, err)
+                    continue
+                }
+                products[*acc.ProductID] = product
+            }
+            if product.KeyRateSpread != nil {
+                if !keyRateFetched {
+                    keyRate, keyRateErr = s.externalService.GetKeyRateCBR()
+                    keyRateFetched = true
+                    if keyRateErr != nil {
+                        log.Printf("Failed to get the key rate, keeping the last rates: %v", keyRateErr)
+                    }
+                }
+                if keyRateErr == nil {
+                    rate = keyRate + *product.KeyRateSpread
+                }
+            }
+        }
+        err := s.store.InTx(func(tx *repositories.Tx) error {
+            locked, err := tx.Accounts.GetForUpdate(0, acc.ID)
+            if err != nil {
+                return err
+            }
+            if locked[acc.ID].Status == models.AccountClosed {
+                return nil
+            }
+            return s.accrue(tx, locked[acc.ID], through, rate)
+        })
+        if err != nil {
+            log.Printf("Failed to accrue interest on account %d: %v", acc.ID, err)
+        }
+    }
+}
+
+func (s *interestService) StartAccrual(interval time.Duration) {
+    go func() {
+        s.AccrueAll(time.Now())
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for now := range ticker.C {
+            s.AccrueAll(now)
+        }
+    }()
+}
+
+// Settle pays out what has been accrued on an account that is being closed. A deposit closed before
+// maturity earns the product's early withdrawal rate instead: interest already paid out is scaled
+// down to that rate and the difference is taken back. It runs in the closing transaction tx, in
+// which acc has been locked with GetForUpdate, and leaves acc.Balance up to date.
+func (s *interestService) Settle(tx *repositories.Tx, acc *models.Account) error {
+    if acc.Type == models.AccountTypeCurrent {
+        return nil
+    }
+    now := time.Now()
+    if err := s.accrue(tx, acc, truncateDay(now).AddDate(0, 0, -1), acc.InterestRate); err != nil {
+        return err
+    }
+    accruedTo := truncateDay(now)
+
+    if acc.Type != models.AccountTypeDeposit || acc.MaturesAt == nil || !now.Before(*acc.MaturesAt) {
+        if amount := roundMoney(acc.AccruedInterest); amount > 0 {
+            if err := s.post(tx, acc, amount, models.TxInterest); err != nil {
+                return err
+            }
+        }
+        return tx.Accounts.UpdateInterest(acc.ID, 0, accruedTo, acc.InterestRate)
+    }
+
+    if acc.ProductID == nil {
+        return errors.New("deposit has no product")
+    }
+    product, err := s.productRepo.GetByID(*acc.ProductID)
+    if err != nil {
+        return err
+    }
+    paid, err := tx.Transactions.SumInterestPaid(acc.ID)
+    if err != nil {
+        return err
+    }
+    // Balances on a deposit only grow, so scaling the total by the rate ratio gives what the
+    // reduced rate would have earned
+    earned := 0.0
+    if acc.InterestRate > 0 {
+        earned = (paid + acc.AccruedInterest) * product.EarlyWithdrawalRate / acc.InterestRate
+    }
+    diff := roundMoney(earned - paid)
+    if diff > 0 {
+        err = s.post(tx, acc, diff, models.TxInterest)
+    } else if diff < 0 {
+        err = s.post(tx, acc, -diff, models.TxInterestReversal)
+    }
+    if err != nil {
+        return err
+    }
+    return tx.Accounts.UpdateInterest(acc.ID, 0, accruedTo, product.EarlyWithdrawalRate)
+}
+
+// accrue adds a day's interest for every day after the last accrued one up to through, paying it
+// out at month end and on a deposit's last day. acc must have been locked in tx with GetForUpdate.
+func (s *interestService) accrue(tx *repositories.Tx, acc *models.Account, through time.Time, rate float64) error {
+    from := truncateDay(acc.CreatedAt)
+    if acc.InterestAccruedTo != nil {
+        from = truncateDay(*acc.InterestAccruedTo).AddDate(0, 0, 1)
+    }
+    var lastDay time.Time
+    if acc.MaturesAt != nil {
+        lastDay = truncateDay(*acc.MaturesAt).AddDate(0, 0, -1)
+        if through.After(lastDay) {
+            through = lastDay
+        }
+    }
+    if from.After(through) {
+        return nil
+    }
+
+    acc.InterestRate = rate
+    // Interest paid out while catching up is credited today, after the close of the days it belongs to
+    paidOut := 0.0
+    for day := from; !day.After(through); day = day.AddDate(0, 0, 1) {
+        balance, err := tx.Accounts.EndOfDayBalance(acc.ID, day)
+        if err != nil {
+            return err
+        }
+        if balance += paidOut; balance > 0 {
+            acc.AccruedInterest += balance * rate / 100 / float64(daysInYear(day.Year()))
+        }
+        accruedTo := day
+        acc.InterestAccruedTo = &accruedTo
+        if day.AddDate(0, 0, 1).Day() != 1 && !day.Equal(lastDay) {
+            continue
+        }
+        // Whole kopecks are paid out; the fraction carries over to the next period
+        if amount := roundMoney(acc.AccruedInterest); amount > 0 {
+            if err := s.post(tx, acc, amount, models.TxInterest); err != nil {
+                return err
+            }
+            acc.AccruedInterest -= amount
+            paidOut += amount
+        }
+    }
+    return tx.Accounts.UpdateInterest(acc.ID, acc.AccruedInterest, *acc.InterestAccruedTo, rate)
+}
+
+// post moves interest between the bank and the account, records it as a transaction and publishes
+// EventInterestPosted.
+func (s *interestService) post(tx *repositories.Tx, acc *models.Account, amount float64, txType string) error {
+    t := &models.Transaction{
+        Amount:       amount,
+        Currency:     acc.Currency,
+        ToAmount:     amount,
+        ToCurrency:   acc.Currency,
+        ExchangeRate: 1,
+        Type:         txType,
+    }
+    delta := amount
+    if txType == models.TxInterest {
+        t.ToAccountID = acc.ID
+    } else {
+        t.FromAccountID = acc.ID
+        delta = -amount
+    }
+    newBalance, err := tx.Accounts.AddToBalance(acc.ID, delta)
+    if err != nil {
+        return err
+    }
+    acc.Balance = newBalance
+    if err := tx.Transactions.Create(t); err != nil {
+        return err
+    }
+    return publish(tx.Outbox, EventInterestPosted, InterestPosted{
+        TransactionID: t.ID,
+        Type:          txType,
+        AccountID:     acc.ID,
+        UserID:        acc.UserID,
+        Amount:        amount,
+        Currency:      acc.Currency,
+        Balance:       roundMoney(newBalance),
+        At:            t.CreatedAt,
+    })
+}
+
+func daysInYear(year int) int {
+    if time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay() == 366 {
+        return 366
+    }
+    return 365
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+    "fmt"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+const (
+    LimitMinAmount           = "min_amount"
+    LimitMaxAmount           = "max_amount"
+    LimitDailyUser           = "daily_user"
+    LimitMonthlyUser         = "monthly_user"
+    LimitDailyAccount        = "daily_account"
+    LimitMonthlyAccount      = "monthly_account"
+    LimitDailyCounterparty   = "daily_counterparty"
+    LimitMonthlyCounterparty = "monthly_counterparty"
+)
+
+// defaultTierLimits apply when a tier has no row in transfer_limits.
+var defaultTierLimits = map[string]models.TransferLimits{
+    models.TierStandard: {
+        Tier:                models.TierStandard,
+        MinAmount:           1,
+        MaxAmount:           300000,
+        DailyUser:           500000,
+        MonthlyUser:         3000000,
+        DailyAccount:        500000,
+        MonthlyAccount:      3000000,
+        DailyCounterparty:   300000,
+        MonthlyCounterparty: 1000000,
+    },
+    models.TierPremium: {
+        Tier:                models.TierPremium,
+        MinAmount:           1,
+        MaxAmount:           3000000,
+        DailyUser:           5000000,
+        MonthlyUser:         30000000,
+        DailyAccount:        5000000,
+        MonthlyAccount:      30000000,
+        DailyCounterparty:   3000000,
+        MonthlyCounterparty: 10000000,
+    },
+}
+
+// LimitError is returned when a transfer would break a limit. Amounts are in rubles.
+type LimitError struct {
+    Type      string  `json:"limit_type"`
+    Limit     float64 `json:"limit"`
+    Remaining float64 `json:"remaining"`
+    Currency  string  `json:"currency"`
+}
+
+func (e *LimitError) Error() string {
+    switch e.Type {
+    case LimitMinAmount:
+        return fmt.Sprintf("transfer amount is below the minimum of %.2f %s", e.Limit, e.Currency)
+    case LimitMaxAmount:
+        return fmt.Sprintf("transfer amount exceeds the maximum of %.2f %s", e.Limit, e.Currency)
+    }
+    return fmt.Sprintf("%s limit of %.2f %s exceeded, %.2f %s remaining", e.Type, e.Limit, e.Currency, e.Remaining, e.Currency)
+}
+
+type LimitUsageItem struct {
+    Limit     float64 `json:"limit"`
+    Used      float64 `json:"used"`
+    Remaining float64 `json:"remaining"`
+}
+
+type AccountLimitUsage struct {
+    AccountID int            `json:"account_id"`
+    Daily     LimitUsageItem `json:"daily"`
+    Monthly   LimitUsageItem `json:"monthly"`
+}
+
+type LimitUsage struct {
+    Tier     string                `json:"tier"`
+    Currency string                `json:"currency"`
+    Limits   models.TransferLimits `json:"limits"`
+    Daily    LimitUsageItem        `json:"daily"`
+    Monthly  LimitUsageItem        `json:"monthly"`
+    Accounts []AccountLimitUsage   `json:"accounts"`
+}
+
+type LimitService interface {
+    Check(fromAcc, toAcc *models.Account, amount float64) error
+    CheckInTx(tx *repositories.Tx, fromAcc, toAcc *models.Account, amount float64) error
+    GetUsage(userID int) (*LimitUsage, error)
+}
+
+type limitService struct {
+    limitRepo       repositories.TransferLimitRepository
+    userRepo        repositories.UserRepository
+    accountRepo     repositories.AccountRepository
+    transactionRepo repositories.TransactionRepository
+    rateSource      RateSource
+}
+
+func NewLimitService(limitRepo repositories.TransferLimitRepository, userRepo repositories.UserRepository, accountRepo repositories.AccountRepository, transactionRepo repositories.TransactionRepository, rateSource RateSource) LimitService {
+    return &limitService{limitRepo: limitRepo, userRepo: userRepo, accountRepo: accountRepo, transactionRepo: transactionRepo, rateSource: rateSource}
+}
+
+// Check validates an outgoing transfer of amount (in fromAcc's currency) against the owner's tier limits.
+// toAcc is nil for transfers to other banks, which have no per-counterparty limit. It is an early
+// answer for the caller; the transfer itself must pass CheckInTx.
+func (s *limitService) Check(fromAcc, toAcc *models.Account, amount float64) error {
+    return s.check(s.transactionRepo, fromAcc, toAcc, amount)
+}
+
+// CheckInTx is Check inside the transaction that moves the money. The caller must have locked all
+// of the sender's accounts in tx, so concurrent transfers of the same user see each other's usage.
+func (s *limitService) CheckInTx(tx *repositories.Tx, fromAcc, toAcc *models.Account, amount float64) error {
+    return s.check(tx.Transactions, fromAcc, toAcc, amount)
+}
+
+func (s *limitService) check(transactions repositories.TransactionRepository, fromAcc, toAcc *models.Account, amount float64) error {
+    limits, err := s.limitsForUser(fromAcc.UserID)
+    if err != nil {
+        return err
+    }
+    now := time.Now()
+    amountRub, err := s.toRub(map[string]float64{fromAcc.Currency: amount}, now)
+    if err != nil {
+        return err
+    }
+
+    if amountRub < limits.MinAmount {
+        return &LimitError{Type: LimitMinAmount, Limit: limits.MinAmount, Currency: models.DefaultCurrency}
+    }
+    if limits.MaxAmount > 0 && amountRub > limits.MaxAmount {
+        return &LimitError{Type: LimitMaxAmount, Limit: limits.MaxAmount, Remaining: limits.MaxAmount, Currency: models.DefaultCurrency}
+    }
+
+    // Moving money between one's own accounts is not subject to outbound caps
+    if toAcc != nil && fromAcc.UserID == toAcc.UserID {
+        return nil
+    }
+
+    dayStart, monthStart := periodStarts(now)
+
+    byUser, err := transactions.SumOutgoingByUser(fromAcc.UserID, dayStart)
+    if err != nil {
+        return err
+    }
+    if err := s.checkCap(LimitDailyUser, limits.DailyUser, byUser, amountRub, now); err != nil {
+        return err
+    }
+    byUser, err = transactions.SumOutgoingByUser(fromAcc.UserID, monthStart)
+    if err != nil {
+        return err
+    }
+    if err := s.checkCap(LimitMonthlyUser, limits.MonthlyUser, byUser, amountRub, now); err != nil {
+        return err
+    }
+
+    byAccount, err := transactions.SumOutgoingByAccount(fromAcc.ID, dayStart)
+    if err != nil {
+        return err
+    }
+    if err := s.checkCap(LimitDailyAccount, limits.DailyAccount, map[string]float64{fromAcc.Currency: byAccount}, amountRub, now); err != nil {
+        return err
+    }
+    byAccount, err = transactions.SumOutgoingByAccount(fromAcc.ID, monthStart)
+    if err != nil {
+        return err
+    }
+    if err := s.checkCap(LimitMonthlyAccount, limits.MonthlyAccount, map[string]float64{fromAcc.Currency: byAccount}, amountRub, now); err != nil {
+        return err
+    }
+    if toAcc == nil {
+        return nil
+    }
+
+    toCounterparty, err := transactions.SumOutgoingToAccount(fromAcc.UserID, toAcc.ID, dayStart)
+    if err != nil {
+        return err
+    }
+    if err := s.checkCap(LimitDailyCounterparty, limits.DailyCounterparty, toCounterparty, amountRub, now); err != nil {
+        return err
+    }
+    toCounterparty, err = transactions.SumOutgoingToAccount(fromAcc.UserID, toAcc.ID, monthStart)
+    if err != nil {
+        return err
+    }
+    return s.checkCap(LimitMonthlyCounterparty, limits.MonthlyCounterparty, toCounterparty, amountRub, now)
+}
+
+func (s *limitService) GetUsage(userID int) (*LimitUsage, error) {
+    limits, err := s.limitsForUser(userID)
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    dayStart, monthStart := periodStarts(now)
+
+    usage := &LimitUsage{Tier: limits.Tier, Currency: models.DefaultCurrency, Limits: *limits}
+    byUser, err := s.transactionRepo.SumOutgoingByUser(userID, dayStart)
+    if err != nil {
+        return nil, err
+    }
+    if usage.Daily, err = s.usageItem(limits.DailyUser, byUser, now); err != nil {
+        return nil, err
+    }
+    byUser, err = s.transactionRepo.SumOutgoingByUser(userID, monthStart)
+    if err != nil {
+        return nil, err
+    }
+    if usage.Monthly, err = s.usageItem(limits.MonthlyUser, byUser, now); err != nil {
+        return nil, err
+    }
+
+    accounts, err := s.accountRepo.GetByUserID(userID)
+    if err != nil {
+        return nil, err
+    }
+    for _, acc := range accounts {
+        item := AccountLimitUsage{AccountID: acc.ID}
+        daily, err := s.transactionRepo.SumOutgoingByAccount(acc.ID, dayStart)
+        if err != nil {
+            return nil, err
+        }
+        if item.Daily, err = s.usageItem(limits.DailyAccount, map[string]float64{acc.Currency: daily}, now); err != nil {
+            return nil, err
+        }
+        monthly, err := s.transactionRepo.SumOutgoingByAccount(acc.ID, monthStart)
+        if err != nil {
+            return nil, err
+        }
+        if item.Monthly, err = s.usageItem(limits.MonthlyAccount, map[string]float64{acc.Currency: monthly}, now); err != nil {
+            return nil, err
+        }
+        usage.Accounts = append(usage.Accounts, item)
+    }
+    return usage, nil
+}
+
+func (s *limitService) limitsForUser(userID int) (*models.TransferLimits, error) {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    tier := user.Tier
+    if tier == "" {
+        tier = models.TierStandard
+    }
+    configured, err := s.limitRepo.GetByTier(tier)
+    if err != nil {
+        return nil, err
+    }
+    if configured != nil {
+        return configured, nil
+    }
+    limits, ok := defaultTierLimits[tier]
+    if !ok {
+        limits = defaultTierLimits[models.TierStandard]
+    }
+    return &limits, nil
+}
+
+func (s *limitService) checkCap(limitType string, limit float64, used map[string]float64, amountRub float64, now time.Time) error {
+    if limit <= 0 {
+        return nil
+    }
+    item, err := s.usageItem(limit, used, now)
+    if err != nil {
+        return err
+    }
+    if amountRub > item.Remaining {
+        return &LimitError{Type: limitType, Limit: limit, Remaining: item.Remaining, Currency: models.DefaultCurrency}
+    }
+    return nil
+}
+
+func (s *limitService) usageItem(limit float64, used map[string]float64, now time.Time) (LimitUsageItem, error) {
+    usedRub, err := s.toRub(used, now)
+    if err != nil {
+        return LimitUsageItem{}, err
+    }
+    remaining := 0.0
+    if limit > usedRub {
+        remaining = roundMoney(limit - usedRub)
+    }
+    return LimitUsageItem{Limit: limit, Used: usedRub, Remaining: remaining}, nil
+}
+
+func (s *limitService) toRub(amounts map[string]float64, now time.Time) (float64, error) {
+    total := 0.0
+    for currency, amount := range amounts {
+        rate, err := s.rateSource.RubRate(currency, now)
+        if err != nil {
+            return 0, err
+        }
+        total += amount * rate
+    }
+    return roundMoney(total), nil
+}
+
+func periodStarts(now time.Time) (time.Time, time.Time) {
+    dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+    monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+    return dayStart, monthStart
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+    "testing"
+    "time"
+
+    "banking_service_project/models"
+)
+
+func TestPeriodStarts(t *testing.T) {
+    loc := time.FixedZone("MSK", 3*3600)
+    tests := []struct {
+        now            time.Time
+        wantDay, wantM string
+    }{
+        {time.Date(2026, 3, 15, 14, 20, 0, 0, loc), "2026-03-15 00:00 +0300", "2026-03-01 00:00 +0300"},
+        {time.Date(2026, 3, 1, 0, 0, 0, 0, loc), "2026-03-01 00:00 +0300", "2026-03-01 00:00 +0300"},
+        {time.Date(2026, 12, 31, 23, 59, 59, 0, loc), "2026-12-31 00:00 +0300", "2026-12-01 00:00 +0300"},
+    }
+    for _, tt := range tests {
+        dayStart, monthStart := periodStarts(tt.now)
+        if got := dayStart.Format("2006-01-02 15:04 -0700"); got != tt.wantDay {
+            t.Errorf("day start of %v = %s, want %s", tt.now, got, tt.wantDay)
+        }
+        if got := monthStart.Format("2006-01-02 15:04 -0700"); got != tt.wantM {
+            t.Errorf("month start of %v = %s, want %s", tt.now, got, tt.wantM)
+        }
+    }
+}
+
+func TestLimitCheck(t *testing.T) {
+    dayStart, monthStart := periodStarts(time.Now())
+    // User 1 owns accounts 1 and 3 (RUB) and 4 (USD); account 2 belongs to user 2.
+    accounts := map[int]*models.Account{
+        1: {ID: 1, UserID: 1, Currency: "RUB"},
+        2: {ID: 2, UserID: 2, Currency: "RUB"},
+        3: {ID: 3, UserID: 1, Currency: "RUB"},
+        4: {ID: 4, UserID: 1, Currency: "USD"},
+    }
+    tests := []struct {
+        name          string
+        history       []fakeOutgoing
+        from, to      int
+        amount        float64
+        wantType      string
+        wantRemaining float64
+        monthOnly     bool // needs history from before today in this month
+    }{
+        {name: "within limits", from: 1, to: 2, amount: 1000},
+        {name: "below minimum", from: 1, to: 2, amount: 0.5, wantType: LimitMinAmount},
+        {name: "above maximum", from: 1, to: 2, amount: 300001, wantType: LimitMaxAmount, wantRemaining: 300000},
+        {name: "above maximum in dollars", from: 4, to: 2, amount: 4000, wantType: LimitMaxAmount, wantRemaining: 300000},
+        {
+            name:    "daily user cap",
+            history: []fakeOutgoing{{userID: 1, accountID: 3, toAccountID: 9, currency: "RUB", amount: 400000, at: dayStart}},
+            from:    1, to: 2, amount: 150000, wantType: LimitDailyUser, wantRemaining: 100000,
+        },
+        {
+            name:    "daily user cap counts every currency",
+            history: []fakeOutgoing{{userID: 1, accountID: 4, toAccountID: 9, currency: "USD", amount: 5000, at: dayStart}},
+            from:    1, to: 2, amount: 100000, wantType: LimitDailyUser, wantRemaining: 50000,
+        },
+        {
+            name:    "yesterday does not count for the day",
+            history: []fakeOutgoing{{userID: 1, accountID: 1, toAccountID: 2, currency: "RUB", amount: 400000, at: dayStart.Add(-time.Minute)}},
+            from:    1, to: 2, amount: 150000,
+        },
+        {
+            name: "monthly user cap",
+            history: []fakeOutgoing{
+                {userID: 1, accountID: 3, toAccountID: 9, currency: "RUB", amount: 2950000, at: monthStart},
+            },
+            from: 1, to: 2, amount: 100000, wantType: LimitMonthlyUser, wantRemaining: 50000, monthOnly: true,
+        },
+        {
+            name:    "daily counterparty cap",
+            history: []fakeOutgoing{{userID: 1, accountID: 3, toAccountID: 2, currency: "RUB", amount: 250000, at: dayStart}},
+            from:    1, to: 2, amount: 100000, wantType: LimitDailyCounterparty, wantRemaining: 50000,
+        },
+        {
+            name:    "monthly counterparty cap",
+            history: []fakeOutgoing{{userID: 1, accountID: 3, toAccountID: 2, currency: "RUB", amount: 950000, at: monthStart}},
+            from:    1, to: 2, amount: 100000, wantType: LimitMonthlyCounterparty, wantRemaining: 50000, monthOnly: true,
+        },
+        {
+            name:    "own accounts are not capped",
+            history: []fakeOutgoing{{userID: 1, accountID: 1, toAccountID: 9, currency: "RUB", amount: 500000, at: dayStart}},
+            from:    1, to: 3, amount: 200000,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if tt.monthOnly && dayStart.Equal(monthStart) {
+                t.Skip("no earlier day in this month")
+            }
+            users := &fakeUserRepo{users: map[int]*models.User{1: {ID: 1}, 2: {ID: 2}}}
+            s := NewLimitService(fakeLimitRepo{}, users, &fakeAccountRepo{accounts: accounts},
+                &fakeTransactionRepo{outgoing: tt.history}, NewStaticRateSource(map[string]float64{"USD": 90}))
+
+            err := s.Check(accounts[tt.from], accounts[tt.to], tt.amount)
+            if tt.wantType == "" {
+                if err != nil {
+                    t.Fatalf("unexpected error: %v", err)
+                }
+                return
+            }
+            limitErr, ok := err.(*LimitError)
+            if !ok {
+                t.Fatalf("err = %v, want a %s LimitError", err, tt.wantType)
+            }
+            if limitErr.Type != tt.wantType || limitErr.Remaining != tt.wantRemaining {
+                t.Errorf("got %s with %.2f remaining, want %s with %.2f", limitErr.Type, limitErr.Remaining, tt.wantType, tt.wantRemaining)
+            }
+        })
+    }
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+const (
+    loginFreeAttempts       = 3  // failures before backoff starts
+    loginEmailLockAfter     = 10 // failures for one email before the account is locked
+    loginIPLockAfter        = 50 // failures from one IP before it is locked
+    loginLockDuration       = 30 * time.Minute
+    loginMaxBackoff         = 15 * time.Minute
+    loginFailureWindow      = 24 * time.Hour // counters start over after a day without failures
+    mfaChallengeMaxFailures = 5  // wrong codes before a login challenge token stops working
+)
+
+// LoginThrottledError is returned while an email or IP is in backoff or locked.
+type LoginThrottledError struct {
+    RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+    return fmt.Sprintf("too many failed login attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// loginThrottle keeps failed login counters per email and per IP in the database, so they hold
+// across restarts and instances.
+type loginThrottle struct {
+    repo                repositories.LoginThrottleRepository
+    notificationService NotificationService
+}
+
+// check returns a LoginThrottledError if either key has to wait before the next attempt.
+func (t *loginThrottle) check(email, ip string, now time.Time) error {
+    var wait time.Duration
+    for _, key := range []string{emailKey(email), ipKey(ip)} {
+        state, err := t.repo.Get(key)
+        if err != nil {
+            return err
+        }
+        if state == nil {
+            continue
+        }
+        if d := retryAfter(state, now); d > wait {
+            wait = d
+        }
+    }
+    if wait > 0 {
+        return &LoginThrottledError{RetryAfter: wait}
+    }
+    return nil
+}
+
+// fail records a failed attempt. user is nil for unknown emails; they are counted the same way so
+// responses do not reveal which emails are registered.
+func (t *loginThrottle) fail(email, ip string, user *models.User, now time.Time) {
+    state, err := t.repo.RecordFailure(emailKey(email), now, now.Add(-loginFailureWindow))
+    if err != nil {
+        log.Printf("Failed to record failed login: %v", err)
+    } else if state.Failures >= loginEmailLockAfter {
+        until := now.Add(loginLockDuration)
+        if err := t.repo.Lock(state.Key, until); err != nil {
+            log.Printf("Failed to lock login for %s: %v", state.Key, err)
+        } else if user != nil {
+            t.notifyLocked(user, state.Failures, until)
+        }
+    }
+
+    state, err = t.repo.RecordFailure(ipKey(ip), now, now.Add(-loginFailureWindow))
+    if err != nil {
+        log.Printf("Failed to record failed login: %v", err)
+    } else if state.Failures >= loginIPLockAfter {
+        if err := t.repo.Lock(state.Key, now.Add(loginLockDuration)); err != nil {
+            log.Printf("Failed to lock login for %s: %v", state.Key, err)
+        }
+    }
+}
+
+// failChallenge counts a wrong second-factor code against one login challenge and reports whether
+// the challenge has to be dropped. When the count cannot be stored the challenge is dropped too.
+func (t *loginThrottle) failChallenge(jti string, now time.Time) bool {
+    state, err := t.repo.RecordFailure("mfa:"+jti, now, now.Add(-loginFailureWindow))
+    if err != nil {
+        log.Printf("Failed to record wrong second-factor code: %v", err)
+        return true
+    }
+    return state.Failures >= mfaChallengeMaxFailures
+}
+
+// succeed clears the email counter. The IP counter is left to expire, otherwise an attacker could
+// reset it by logging into an account of their own.
+func (t *loginThrottle) succeed(email string) {
+    if err := t.repo.Reset(emailKey(email)); err != nil {
+        log.Printf("Failed to reset failed login counter: %v", err)
+    }
+}
+
+func (t *loginThrottle) notifyLocked(user *models.User, failures int, until time.Time) {
+    data := map[string]interface{}{"Failures": failures, "Until": until}
+    if err := t.notificationService.Notify(user.ID, TemplateLoginLocked, data); err != nil {
+        log.Printf("Failed to send lockout notification to user %d: %v", user.ID, err)
+    }
+}
+
+// retryAfter is the remaining lock time, or the exponential backoff after the free attempts:
+// 1s, 2s, 4s, ... up to loginMaxBackoff since the last failure.
+func retryAfter(state *models.LoginThrottle, now time.Time) time.Duration {
+    if state.LockedUntil != nil && state.LockedUntil.After(now) {
+        return state.LockedUntil.Sub(now)
+    }
+    if now.Sub(state.LastFailureAt) > loginFailureWindow || state.Failures < loginFreeAttempts {
+        return 0
+    }
+    backoff := loginMaxBackoff
+    if shift := state.Failures - loginFreeAttempts; shift < 10 {
+        backoff = time.Duration(1<<shift) * time.Second
+        if backoff > loginMaxBackoff {
+            backoff = loginMaxBackoff
+        }
+    }
+    if wait := state.LastFailureAt.Add(backoff).Sub(now); wait > 0 {
+        return wait
+    }
+    return 0
+}
+
+func emailKey(email string) string {
+    return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+    return "ip:" + ip
+}
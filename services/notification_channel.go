@@ -0,0 +1,96 @@
+package services
+
+import (
+    "encoding/json"
+    "os"
+    "sync"
+    "time"
+
+    "banking_service_project/models"
+)
+
+// NotificationMessage is a rendered notification. HTML may be empty. OneTimeSecret marks a message
+// whose body must not be written anywhere but to the recipient.
+type NotificationMessage struct {
+    Subject     string `json:"subject"`
+    Text        string `json:"text"`
+    HTML        string `json:"html,omitempty"`
+    OneTimeSecret bool `json:"-"`
+}
+
+// NotificationChannel delivers notifications by one means, such as email.
+type NotificationChannel interface {
+    Name() string
+    // Address returns where the user is reached on this channel, or "" if they cannot be.
+    Address(user *models.User) string
+    Send(to string, msg NotificationMessage) error
+}
+
+type emailChannel struct {
+    externalService ExternalService
+}
+
+func NewEmailChannel(externalService ExternalService) NotificationChannel {
+    return &emailChannel{externalService: externalService}
+}
+
+func (c *emailChannel) Name() string {
+    return "email"
+}
+
+func (c *emailChannel) Address(user *models.User) string {
+    return user.Email
+}
+
+func (c *emailChannel) Send(to string, msg NotificationMessage) error {
+    return c.externalService.SendHTMLEmail(to, msg.Subject, msg.Text, msg.HTML)
+}
+
+// fileChannel appends every message as a JSON line to a file instead of delivering it. It stands in
+// for a real channel in development and tests, under that channel's name. Bodies with a one-time
+// link or code are left out, so the log cannot be used to take over an account.
+type fileChannel struct {
+    name    string
+    address func(user *models.User) string
+    path    string
+    mu      sync.Mutex
+}
+
+func NewFileChannel(channel NotificationChannel, path string) NotificationChannel {
+    return &fileChannel{name: channel.Name(), address: channel.Address, path: path}
+}
+
+func (c *fileChannel) Name() string {
+    return c.name
+}
+
+func (c *fileChannel) Address(user *models.User) string {
+    return c.address(user)
+}
+
+func (c *fileChannel) Send(to string, msg NotificationMessage) error {
+    if msg.OneTimeSecret {
+        msg.Text = "[withheld: contains a one-time link or code]"
+        msg.HTML = ""
+    }
+    line, err := json.Marshal(struct {
+        Channel string    `json:"channel"`
+        To      string    `json:"to"`
+        At      time.Time `json:"at"`
+        NotificationMessage
+    }{c.name, to, time.Now(), msg})
+    if err != nil {
+        return err
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+    if err != nil {
+        return err
+    }
+    if _, err := f.Write(append(line, '\n')); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
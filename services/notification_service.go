@@ -0,0 +1,272 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "sort"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+const (
+    maxNotificationAttempts = 6
+    notificationBatchSize   = 50
+)
+
+var ErrMandatoryNotification = errors.New("security notifications cannot be turned off")
+
+// NotificationService renders templated notifications in the user's language and queues them for
+// every channel the user has not turned the category off for. A worker sends the queue, so callers
+// never wait for SMTP; failed sends are retried with a growing delay. Messages with a one-time link
+// or code are the exception: they are sent right away and only the fact of sending is stored.
+type NotificationService interface {
+    Notify(userID int, template string, data map[string]interface{}) error
+    GetPreferences(userID int) ([]models.NotificationPreference, error)
+    SetPreference(userID int, category, channel string, enabled bool) error
+    Send(now time.Time)
+    StartWorker(interval time.Duration)
+}
+
+type notificationService struct {
+    notificationRepo repositories.NotificationRepository
+    userRepo         repositories.UserRepository
+    channels         map[string]NotificationChannel
+    templates        *notificationTemplateSet
+    wake             chan struct{}
+}
+
+func NewNotificationService(notificationRepo repositories.NotificationRepository, userRepo repositories.UserRepository, channels ...NotificationChannel) (NotificationService, error) {
+    templates, err := loadNotificationTemplates()
+    if err != nil {
+        return nil, err
+    }
+    s := &notificationService{
+        notificationRepo: notificationRepo,
+        userRepo:         userRepo,
+        channels:         make(map[string]NotificationChannel),
+        templates:        templates,
+        wake:             make(chan struct{}, 1),
+    }
+    for _, c := range channels {
+        s.channels[c.Name()] = c
+    }
+    return s, nil
+}
+
+// Notify queues the notification; data is the template's input, with .Name set to the username
+// unless given. One-time link and code templates are sent before it returns, and the error says
+// whether they were, so the user can ask for a new one.
+func (s *notificationService) Notify(userID int, template string, data map[string]interface{}) error {
+    category, ok := notificationCategories[template]
+    if !ok {
+        return fmt.Errorf("unknown notification template %s", template)
+    }
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return err
+    }
+    disabled, err := s.disabledChannels(userID, category)
+    if err != nil {
+        return err
+    }
+    if data == nil {
+        data = make(map[string]interface{})
+    }
+    if _, ok := data["Name"]; !ok {
+        data["Name"] = user.Username
+    }
+    msg, err := s.templates.render(template, user.PreferredLanguage, data)
+    if err != nil {
+        return err
+    }
+    if oneTimeSecretTemplates[template] {
+        msg.OneTimeSecret = true
+        return s.sendNow(user, template, msg)
+    }
+
+    queued := false
+    for _, name := range s.channelNames() {
+        channel := s.channels[name]
+        to := channel.Address(user)
+        if to == "" || disabled[name] {
+            continue
+        }
+        n := &models.Notification{
+            UserID:    userID,
+            Template:  template,
+            Channel:   name,
+            Recipient: to,
+            Subject:   msg.Subject,
+            TextBody:  msg.Text,
+            HTMLBody:  msg.HTML,
+        }
+        if err := s.notificationRepo.Enqueue(n); err != nil {
+            return err
+        }
+        queued = true
+    }
+    if queued {
+        select {
+        case s.wake <- struct{}{}:
+        default:
+        }
+    }
+    return nil
+}
+
+// sendNow delivers a message on every channel the user has without queueing it, so the secret in it
+// is never stored. It fails only if no channel took the message.
+func (s *notificationService) sendNow(user *models.User, template string, msg *NotificationMessage) error {
+    var sendErr error
+    sent := false
+    for _, name := range s.channelNames() {
+        channel := s.channels[name]
+        to := channel.Address(user)
+        if to == "" {
+            continue
+        }
+        n := &models.Notification{
+            UserID:    user.ID,
+            Template:  template,
+            Channel:   name,
+            Recipient: to,
+            Subject:   msg.Subject,
+            Status:    models.NotificationSent,
+            Attempts:  1,
+        }
+        if err := channel.Send(to, *msg); err != nil {
+            n.Status = models.NotificationFailed
+            n.LastError = err.Error()
+            sendErr = err
+        } else {
+            sent = true
+        }
+        if err := s.notificationRepo.Record(n); err != nil {
+            log.Printf("Failed to record %s notification to user %d: %v", template, user.ID, err)
+        }
+    }
+    if !sent && sendErr != nil {
+        return sendErr
+    }
+    return nil
+}
+
+// GetPreferences lists every category and channel with whether it is on.
+func (s *notificationService) GetPreferences(userID int) ([]models.NotificationPreference, error) {
+    stored, err := s.notificationRepo.GetPreferences(userID)
+    if err != nil {
+        return nil, err
+    }
+    off := make(map[string]bool)
+    for _, p := range stored {
+        if !p.Enabled {
+            off[p.Category+"/"+p.Channel] = true
+        }
+    }
+    var prefs []models.NotificationPreference
+    for _, category := range []string{models.NotificationSecurity, models.NotificationTransfers, models.NotificationCredits} {
+        for _, channel := range s.channelNames() {
+            prefs = append(prefs, models.NotificationPreference{
+                UserID:   userID,
+                Category: category,
+                Channel:  channel,
+                Enabled:  category == models.NotificationSecurity || !off[category+"/"+channel],
+            })
+        }
+    }
+    return prefs, nil
+}
+
+func (s *notificationService) SetPreference(userID int, category, channel string, enabled bool) error {
+    switch category {
+    case models.NotificationSecurity:
+        if !enabled {
+            return ErrMandatoryNotification
+        }
+        return nil
+    case models.NotificationTransfers, models.NotificationCredits:
+    default:
+        return fmt.Errorf("unknown notification category %q", category)
+    }
+    if _, ok := s.channels[channel]; !ok {
+        return fmt.Errorf("unknown notification channel %q", channel)
+    }
+    return s.notificationRepo.SetPreference(&models.NotificationPreference{UserID: userID, Category: category, Channel: channel, Enabled: enabled})
+}
+
+// Send makes one attempt for every queued notification that is due.
+func (s *notificationService) Send(now time.Time) {
+    queued, err := s.notificationRepo.GetDue(now, notificationBatchSize)
+    if err != nil {
+        log.Printf("Failed to load queued notifications: %v", err)
+        return
+    }
+    for i := range queued {
+        n := &queued[i]
+        attempts := n.Attempts + 1
+        channel, ok := s.channels[n.Channel]
+        if !ok {
+            err = fmt.Errorf("channel %s is not configured", n.Channel)
+        } else {
+            err = channel.Send(n.Recipient, NotificationMessage{Subject: n.Subject, Text: n.TextBody, HTML: n.HTMLBody})
+        }
+        if err == nil {
+            if err := s.notificationRepo.MarkSent(n.ID, attempts, time.Now()); err != nil {
+                log.Printf("Failed to mark notification %d as sent: %v", n.ID, err)
+            }
+            continue
+        }
+        failed := attempts >= maxNotificationAttempts
+        if failed {
+            log.Printf("Giving up on %s notification %d to user %d: %v", n.Template, n.ID, n.UserID, err)
+        }
+        if err := s.notificationRepo.RecordFailure(n.ID, attempts, err.Error(), now.Add(time.Minute<<uint(attempts-1)), failed); err != nil {
+            log.Printf("Failed to record failure of notification %d: %v", n.ID, err)
+        }
+    }
+}
+
+// StartWorker sends the queue every interval and right after something is queued.
+func (s *notificationService) StartWorker(interval time.Duration) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case now := <-ticker.C:
+                s.Send(now)
+            case <-s.wake:
+                s.Send(time.Now())
+            }
+        }
+    }()
+}
+
+func (s *notificationService) disabledChannels(userID int, category string) (map[string]bool, error) {
+    disabled := make(map[string]bool)
+    if category == models.NotificationSecurity {
+        return disabled, nil
+    }
+    prefs, err := s.notificationRepo.GetPreferences(userID)
+    if err != nil {
+        return nil, err
+    }
+    for _, p := range prefs {
+        if p.Category == category && !p.Enabled {
+            disabled[p.Channel] = true
+        }
+    }
+    return disabled, nil
+}
+
+func (s *notificationService) channelNames() []string {
+    names := make([]string, 0, len(s.channels))
+    for name := range s.channels {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "banking_service_project/models"
+)
+
+type failingChannel struct{}
+
+func (failingChannel) Name() string                     { return "email" }
+func (failingChannel) Address(user *models.User) string { return user.Email }
+func (failingChannel) Send(to string, msg NotificationMessage) error {
+    return errors.New("smtp: connection refused")
+}
+
+type loggedNotification struct {
+    Channel string `json:"channel"`
+    To      string `json:"to"`
+    NotificationMessage
+}
+
+func readNotificationLog(t *testing.T, path string) []loggedNotification {
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    var logged []loggedNotification
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        var n loggedNotification
+        if err := json.Unmarshal(scanner.Bytes(), &n); err != nil {
+            t.Fatal(err)
+        }
+        logged = append(logged, n)
+    }
+    return logged
+}
+
+var notificationTestUsers = map[int]*models.User{
+    1: {ID: 1, Username: "anna", Email: "anna@example.com", PreferredLanguage: "ru"},
+    2: {ID: 2, Username: "john", Email: "john@example.com", PreferredLanguage: "en"},
+}
+
+func newFileNotificationService(t *testing.T, repo *fakeNotificationRepo) (NotificationService, string) {
+    path := filepath.Join(t.TempDir(), "notifications.log")
+    s, err := NewNotificationService(repo, &fakeUserRepo{users: notificationTestUsers}, NewFileChannel(NewEmailChannel(nil), path))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return s, path
+}
+
+func pausedTransferData() map[string]interface{} {
+    return map[string]interface{}{
+        "TransferID": 12, "Amount": 1234567.5, "Currency": "RUB", "FromAccount": "*0001", "ToAccount": "*5982",
+        "Failures": 3, "Error": "insufficient funds",
+    }
+}
+
+func TestNotifyRendersInUserLanguage(t *testing.T) {
+    repo := &fakeNotificationRepo{}
+    s, path := newFileNotificationService(t, repo)
+    until := time.Date(2026, 3, 5, 14, 30, 0, 0, time.UTC)
+
+    if err := s.Notify(1, TemplateScheduledTransferPaused, pausedTransferData()); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Notify(2, TemplateScheduledTransferPaused, pausedTransferData()); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Notify(1, TemplateLoginLocked, map[string]interface{}{"Failures": 5, "Until": until}); err != nil {
+        t.Fatal(err)
+    }
+    s.Send(time.Now())
+
+    logged := readNotificationLog(t, path)
+    if len(logged) != 3 {
+        t.Fatalf("logged %d notifications, want 3", len(logged))
+    }
+    ru, en, locked := logged[0], logged[1], logged[2]
+    if ru.Channel != "email" || ru.To != "anna@example.com" || ru.Subject != "Регулярный перевод приостановлен" {
+        t.Errorf("ru notification = %+v", ru)
+    }
+    if !strings.Contains(ru.Text, "Здравствуйте, anna!") || !strings.Contains(ru.Text, "1\u00a0234\u00a0567,50 RUB") {
+        t.Errorf("ru text = %q", ru.Text)
+    }
+    if en.To != "john@example.com" || en.Subject != "Scheduled transfer paused" ||
+        !strings.Contains(en.Text, "Hello, john!") || !strings.Contains(en.Text, "1,234,567.50 RUB") {
+        t.Errorf("en notification = %+v", en)
+    }
+    if !strings.Contains(locked.Text, "05.03.2026 14:30 UTC") {
+        t.Errorf("lockout text = %q", locked.Text)
+    }
+    for _, n := range repo.queued {
+        if n.Status != models.NotificationSent || n.Attempts != 1 {
+            t.Errorf("notification %d: status %s after %d attempts, want sent after 1", n.ID, n.Status, n.Attempts)
+        }
+    }
+}
+
+func TestNotifyRespectsPreferences(t *testing.T) {
+    repo := &fakeNotificationRepo{}
+    s, path := newFileNotificationService(t, repo)
+
+    if err := s.SetPreference(1, models.NotificationTransfers, "email", false); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.SetPreference(1, models.NotificationSecurity, "email", false); err != ErrMandatoryNotification {
+        t.Fatalf("turning security off: err = %v, want ErrMandatoryNotification", err)
+    }
+    if err := s.SetPreference(1, models.NotificationCredits, "sms", false); err == nil {
+        t.Fatal("expected an error for an unknown channel")
+    }
+
+    if err := s.Notify(1, TemplateScheduledTransferPaused, pausedTransferData()); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Notify(1, TemplatePasswordChanged, nil); err != nil {
+        t.Fatal(err)
+    }
+    s.Send(time.Now())
+
+    logged := readNotificationLog(t, path)
+    if len(logged) != 1 || logged[0].Subject != "Пароль изменён" {
+        t.Fatalf("logged = %+v, want only the password change", logged)
+    }
+
+    prefs, err := s.GetPreferences(1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    enabled := make(map[string]bool)
+    for _, p := range prefs {
+        enabled[p.Category+"/"+p.Channel] = p.Enabled
+    }
+    if !enabled["security/email"] || enabled["transfers/email"] || !enabled["credits/email"] {
+        t.Errorf("preferences = %v", enabled)
+    }
+}
+
+func TestSendRetriesFailedNotifications(t *testing.T) {
+    repo := &fakeNotificationRepo{}
+    s, err := NewNotificationService(repo, &fakeUserRepo{users: notificationTestUsers}, failingChannel{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Notify(2, TemplatePasswordChanged, nil); err != nil {
+        t.Fatal(err)
+    }
+
+    now := time.Now()
+    s.Send(now)
+    n := repo.queued[0]
+    if n.Status != models.NotificationPending || n.Attempts != 1 || !n.NextAttemptAt.Equal(now.Add(time.Minute)) {
+        t.Fatalf("after one failure: status %s, attempts %d, next %v", n.Status, n.Attempts, n.NextAttemptAt)
+    }
+    for i := 1; i < maxNotificationAttempts; i++ {
+        s.Send(n.NextAttemptAt)
+    }
+    if n.Status != models.NotificationFailed || n.Attempts != maxNotificationAttempts {
+        t.Errorf("status %s after %d attempts, want failed after %d", n.Status, n.Attempts, maxNotificationAttempts)
+    }
+}
+
+func TestOneTimeSecretsAreNotStored(t *testing.T) {
+    link := "https://bank.example.com/reset-password?token=secret-token"
+    repo := &fakeNotificationRepo{}
+    s, path := newFileNotificationService(t, repo)
+
+    if err := s.Notify(1, TemplatePasswordReset, map[string]interface{}{"Link": link}); err != nil {
+        t.Fatal(err)
+    }
+    if len(repo.queued) != 0 {
+        t.Fatalf("queued %d notifications, want none", len(repo.queued))
+    }
+    if len(repo.recorded) != 1 {
+        t.Fatalf("recorded %d notifications, want 1", len(repo.recorded))
+    }
+    n := repo.recorded[0]
+    if n.Status != models.NotificationSent || n.TextBody != "" || n.HTMLBody != "" {
+        t.Errorf("recorded %+v, want sent without a body", n)
+    }
+    logged := readNotificationLog(t, path)
+    if len(logged) != 1 {
+        t.Fatalf("logged %d notifications, want 1", len(logged))
+    }
+    if strings.Contains(logged[0].Text+logged[0].HTML, "secret-token") {
+        t.Errorf("log contains the link: %q", logged[0].Text)
+    }
+
+    failing, err := NewNotificationService(repo, &fakeUserRepo{users: notificationTestUsers}, failingChannel{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := failing.Notify(1, TemplateEmailVerification, map[string]interface{}{"Link": link}); err == nil {
+        t.Fatal("expected the send error")
+    }
+    if n := repo.recorded[1]; n.Status != models.NotificationFailed || n.LastError == "" {
+        t.Errorf("recorded %+v, want failed with the error", n)
+    }
+}
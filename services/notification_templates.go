@@ -0,0 +1,196 @@
+package services
+
+import (
+    "bytes"
+    "embed"
+    "fmt"
+    htmltemplate "html/template"
+    "io/fs"
+    "path"
+    "strings"
+    texttemplate "text/template"
+    "time"
+
+    "banking_service_project/models"
+)
+
+// Templates live in templates/notifications/<language>/<name>.txt, a text/template defining
+// "subject" and "text", with an optional html/template in <name>.html next to it.
+//
+//go:embed templates/notifications
+var notificationTemplateFS embed.FS
+
+// Notification templates and the category each belongs to.
+const (
+    TemplateEmailVerification       = "email_verification"
+    TemplatePasswordReset           = "password_reset"
+    TemplateOperationCode           = "operation_code"
+    TemplatePasswordChanged         = "password_changed"
+    TemplateLoginLocked             = "login_locked"
+    TemplateScheduledTransferPaused = "scheduled_transfer_paused"
+    TemplateTransferSent            = "transfer_sent"
+    TemplateTransferReceived        = "transfer_received"
+    TemplateTransferDigest          = "transfer_digest"
+    TemplateCreditPaymentReminder   = "credit_payment_reminder"
+    TemplateCreditPaymentDueInsufficient = "credit_payment_due_insufficient"
+    TemplateCreditPaymentOverdue    = "credit_payment_overdue"
+)
+
+var notificationCategories = map[string]string{
+    TemplateEmailVerification:       models.NotificationSecurity,
+    TemplatePasswordReset:           models.NotificationSecurity,
+    TemplateOperationCode:           models.NotificationSecurity,
+    TemplatePasswordChanged:         models.NotificationSecurity,
+    TemplateLoginLocked:             models.NotificationSecurity,
+    TemplateScheduledTransferPaused: models.NotificationTransfers,
+    TemplateTransferSent:            models.NotificationTransfers,
+    TemplateTransferReceived:        models.NotificationTransfers,
+    TemplateTransferDigest:          models.NotificationTransfers,
+    TemplateCreditPaymentReminder:   models.NotificationCredits,
+    TemplateCreditPaymentDueInsufficient: models.NotificationCredits,
+    TemplateCreditPaymentOverdue:    models.NotificationCredits,
+}
+
+// oneTimeSecretTemplates carry a single-use link or code, so they are sent at once and never stored.
+var oneTimeSecretTemplates = map[string]bool{
+    TemplateEmailVerification: true,
+    TemplatePasswordReset:     true,
+    TemplateOperationCode:     true,
+}
+
+type notificationTemplateSet struct {
+    text map[string]*texttemplate.Template // by "<language>/<name>"
+    html map[string]*htmltemplate.Template
+}
+
+// loadNotificationTemplates parses every template and checks that each known template exists in the
+// default language.
+func loadNotificationTemplates() (*notificationTemplateSet, error) {
+    set := &notificationTemplateSet{text: make(map[string]*texttemplate.Template), html: make(map[string]*htmltemplate.Template)}
+    err := fs.WalkDir(notificationTemplateFS, "templates/notifications", func(p string, d fs.DirEntry, err error) error {
+        if err != nil || d.IsDir() {
+            return err
+        }
+        data, err := notificationTemplateFS.ReadFile(p)
+        if err != nil {
+            return err
+        }
+        key := path.Base(path.Dir(p)) + "/" + strings.TrimSuffix(path.Base(p), path.Ext(p))
+        switch path.Ext(p) {
+        case ".txt":
+            t, err := texttemplate.New(key).Funcs(notificationFuncs(models.DefaultLanguage)).Option("missingkey=error").Parse(string(data))
+            if err != nil {
+                return err
+            }
+            if t.Lookup("subject") == nil || t.Lookup("text") == nil {
+                return fmt.Errorf("%s must define subject and text", p)
+            }
+            set.text[key] = t
+        case ".html":
+            t, err := htmltemplate.New(key).Funcs(htmltemplate.FuncMap(notificationFuncs(models.DefaultLanguage))).Option("missingkey=error").Parse(string(data))
+            if err != nil {
+                return err
+            }
+            set.html[key] = t
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    for name := range notificationCategories {
+        if set.text[models.DefaultLanguage+"/"+name] == nil {
+            return nil, fmt.Errorf("notification template %s is missing in %s", name, models.DefaultLanguage)
+        }
+    }
+    return set, nil
+}
+
+// render falls back to the default language when the template is not translated.
+func (set *notificationTemplateSet) render(name, lang string, data map[string]interface{}) (*NotificationMessage, error) {
+    key := lang + "/" + name
+    textT := set.text[key]
+    if textT == nil {
+        lang = models.DefaultLanguage
+        key = lang + "/" + name
+        if textT = set.text[key]; textT == nil {
+            return nil, fmt.Errorf("unknown notification template %s", name)
+        }
+    }
+    funcs := notificationFuncs(lang)
+
+    var msg NotificationMessage
+    var buf bytes.Buffer
+    t, err := textT.Clone()
+    if err != nil {
+        return nil, err
+    }
+    t.Funcs(funcs)
+    if err := t.ExecuteTemplate(&buf, "subject", data); err != nil {
+        return nil, err
+    }
+    msg.Subject = strings.TrimSpace(buf.String())
+    buf.Reset()
+    if err := t.ExecuteTemplate(&buf, "text", data); err != nil {
+        return nil, err
+    }
+    msg.Text = strings.TrimSpace(buf.String()) + "\n"
+
+    if htmlT := set.html[key]; htmlT != nil {
+        h, err := htmlT.Clone()
+        if err != nil {
+            return nil, err
+        }
+        h.Funcs(htmltemplate.FuncMap(funcs))
+        buf.Reset()
+        if err := h.Execute(&buf, data); err != nil {
+            return nil, err
+        }
+        msg.HTML = buf.String()
+    }
+    return &msg, nil
+}
+
+// notificationFuncs formats values the way readers of the given language expect.
+func notificationFuncs(lang string) texttemplate.FuncMap {
+    return texttemplate.FuncMap{
+        "money": func(amount float64, currency string) string {
+            return formatMoney(amount, currency, lang)
+        },
+        "date": func(t time.Time) string {
+            if lang == "en" {
+                return t.Format("Jan 2, 2006")
+            }
+            return t.Format("02.01.2006")
+        },
+        "datetime": func(t time.Time) string {
+            if lang == "en" {
+                return t.Format("Jan 2, 2006 15:04 MST")
+            }
+            return t.Format("02.01.2006 15:04 MST")
+        },
+    }
+}
+
+// formatMoney writes 1234567.5 as "1 234 567,50 RUB" in Russian and "1,234,567.50 RUB" in English.
+func formatMoney(amount float64, currency, lang string) string {
+    sign := ""
+    if amount < 0 {
+        sign = "-"
+        amount = -amount
+    }
+    s := fmt.Sprintf("%.2f", amount)
+    whole, frac := s[:len(s)-3], s[len(s)-2:]
+    thousands, decimal := " ", ","
+    if lang == "en" {
+        thousands, decimal = ",", "."
+    }
+    var b strings.Builder
+    for i, c := range whole {
+        if i > 0 && (len(whole)-i)%3 == 0 {
+            b.WriteString(thousands)
+        }
+        b.WriteRune(c)
+    }
+    return sign + b.String() + decimal + frac + " " + currency
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+    "fmt"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "banking_service_project/utils"
+)
+
+const (
+    PasswordRuleMinLength   = "min_length"
+    PasswordRuleMaxLength   = "max_length"
+    PasswordRuleCharClasses = "char_classes"
+    PasswordRuleUsername    = "contains_username"
+    PasswordRuleEmail       = "contains_email"
+    PasswordRuleBreached    = "breached"
+
+    // Shorter usernames and email names would match too many unrelated passwords
+    personalInfoMinLength = 3
+
+    // bcrypt ignores everything after 72 bytes
+    passwordMaxBytes = 72
+)
+
+type PasswordViolation struct {
+    Rule    string `json:"rule"`
+    Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule the password breaks, not just the first one.
+type PasswordPolicyError struct {
+    Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+    messages := make([]string, len(e.Violations))
+    for i, v := range e.Violations {
+        messages[i] = v.Message
+    }
+    return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// PasswordPolicy is applied on registration and whenever a password is changed.
+type PasswordPolicy struct {
+    MinLength      int // in characters
+    MinCharClasses int // of lowercase, uppercase, digits and other characters
+    Breached       *utils.BreachedPasswords
+}
+
+// Validate returns a *PasswordPolicyError, or nil if the password is acceptable.
+func (p *PasswordPolicy) Validate(password, username, email string) error {
+    var violations []PasswordViolation
+    if utf8.RuneCountInString(password) < p.MinLength {
+        violations = append(violations, PasswordViolation{PasswordRuleMinLength, fmt.Sprintf("must be at least %d characters long", p.MinLength)})
+    }
+    if len(password) > passwordMaxBytes {
+        violations = append(violations, PasswordViolation{PasswordRuleMaxLength, fmt.Sprintf("must not be longer than %d bytes", passwordMaxBytes)})
+    }
+    if classes := charClasses(password); classes < p.MinCharClasses {
+        violations = append(violations, PasswordViolation{PasswordRuleCharClasses, fmt.Sprintf("must contain at least %d of: lowercase letters, uppercase letters, digits, other characters", p.MinCharClasses)})
+    }
+
+    lower := strings.ToLower(password)
+    if len(username) >= personalInfoMinLength && strings.Contains(lower, strings.ToLower(username)) {
+        violations = append(violations, PasswordViolation{PasswordRuleUsername, "must not contain the username"})
+    }
+    if local, _, _ := strings.Cut(strings.ToLower(email), "@"); len(local) >= personalInfoMinLength && strings.Contains(lower, local) {
+        violations = append(violations, PasswordViolation{PasswordRuleEmail, "must not contain the email address"})
+    }
+    if p.Breached.Contains(password) {
+        violations = append(violations, PasswordViolation{PasswordRuleBreached, "appears in a list of leaked passwords"})
+    }
+
+    if len(violations) > 0 {
+        return &PasswordPolicyError{Violations: violations}
+    }
+    return nil
+}
+
+func charClasses(password string) int {
+    var lower, upper, digit, other bool
+    for _, r := range password {
+        switch {
+        case unicode.IsLower(r):
+            lower = true
+        case unicode.IsUpper(r):
+            upper = true
+        case unicode.IsDigit(r):
+            digit = true
+        default:
+            other = true
+        }
+    }
+    count := 0
+    for _, present := range []bool{lower, upper, digit, other} {
+        if present {
+            count++
+        }
+    }
+    return count
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+    "crypto/sha1"
+    "encoding/hex"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "banking_service_project/utils"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+    sum := sha1.Sum([]byte("Spring2024!"))
+    path := filepath.Join(t.TempDir(), "breached.txt")
+    content := "# leaked\n\n" + hex.EncodeToString(sum[:]) + ":1234\n"
+    if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    breached, err := utils.LoadBreachedPasswords(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    policy := &PasswordPolicy{MinLength: 10, MinCharClasses: 3, Breached: breached}
+
+    tests := []struct {
+        name     string
+        password string
+        want     []string
+    }{
+        {"acceptable", "Correct-Horse-7", nil},
+        {"non-latin letters count", "Пароль-Надёжный7", nil},
+        {"too short", "Ab1!xyz", []string{PasswordRuleMinLength}},
+        {"short in bytes, long in characters", "Ёжик-в-тумане1", nil},
+        {"too long for bcrypt", "Aa1!" + strings.Repeat("x", 70), []string{PasswordRuleMaxLength}},
+        {"one character class", "correcthorsebattery", []string{PasswordRuleCharClasses}},
+        {"contains the username", "Ivan.Petrov-2024", []string{PasswordRuleUsername}},
+        {"contains the email name", "My-ivanp-Secret1", []string{PasswordRuleEmail}},
+        {"breached", "Spring2024!", []string{PasswordRuleBreached}},
+        {"every rule is reported", "ivanp.ivan.petrov", []string{PasswordRuleCharClasses, PasswordRuleUsername, PasswordRuleEmail}},
+    }
+    for _, tt := range tests {
+        err := policy.Validate(tt.password, "ivan.petrov", "IvanP@example.com")
+        var got []string
+        if err != nil {
+            policyErr, ok := err.(*PasswordPolicyError)
+            if !ok {
+                t.Errorf("%s: unexpected error type %T", tt.name, err)
+                continue
+            }
+            for _, v := range policyErr.Violations {
+                got = append(got, v.Rule)
+            }
+        }
+        if !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s: rules %v, want %v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestPasswordPolicyShortPersonalInfo(t *testing.T) {
+    policy := &PasswordPolicy{MinLength: 8, MinCharClasses: 2}
+    if err := policy.Validate("Jo-password", "jo", "jo@example.com"); err != nil {
+        t.Errorf("a two-letter username must not be matched: %v", err)
+    }
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+const (
+    maxIngestAttempts  = 5
+    ingestRetryBackoff = time.Minute
+    maxHistoryDays     = 366
+    // A publication older than maxRateAge is still used while the CBR keeps returning it, i.e.
+    // rates were loaded less than maxFetchAge ago: the New Year and May holidays run longer than
+    // any fixed window, but a rate left over from a broken ingestion must not be used for long.
+    maxRateAge         = 4 * 24 * time.Hour
+    maxFetchAge        = 24 * time.Hour
+)
+
+// RatePoint is the rate in force on a calendar day; PublishedOn is earlier than Date when the
+// day had no publication of its own (weekends, holidays).
+type RatePoint struct {
+    Date        time.Time `json:"date"`
+    Nominal     int       `json:"nominal"`
+    Rate        float64   `json:"rate"`
+    PublishedOn time.Time `json:"published_on"`
+}
+
+type RateService interface {
+    RateSource
+    IngestRates(date time.Time) error
+    GetRates(date time.Time) ([]models.FXRate, error)
+    GetHistory(currency string, from, to time.Time) ([]RatePoint, error)
+    StartIngestion(interval time.Duration)
+}
+
+type rateService struct {
+    fxRateRepo      repositories.FXRateRepository
+    externalService ExternalService
+}
+
+func NewRateService(fxRateRepo repositories.FXRateRepository, externalService ExternalService) RateService {
+    return &rateService{fxRateRepo: fxRateRepo, externalService: externalService}
+}
+
+func (s *rateService) IngestRates(date time.Time) error {
+    onDate, rates, err := s.externalService.GetDailyRatesCBR(date)
+    if err != nil {
+        return err
+    }
+    for _, r := range rates {
+        fr := &models.FXRate{
+            Date:     truncateDay(onDate),
+            Currency: r.Code,
+            Nominal:  r.Nominal,
+            Rate:     r.Rate,
+        }
+        if err := s.fxRateRepo.Upsert(fr); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (s *rateService) GetRates(date time.Time) ([]models.FXRate, error) {
+    return s.fxRateRepo.GetOnDate(truncateDay(date))
+}
+
+func (s *rateService) GetHistory(currency string, from, to time.Time) ([]RatePoint, error) {
+    currency, err := normalizeCurrency(currency)
+    if err != nil {
+        return nil, err
+    }
+    from, to = truncateDay(from), truncateDay(to)
+    if to.Before(from) {
+        return nil, errors.New("invalid date range")
+    }
+    if to.Sub(from) > maxHistoryDays*24*time.Hour {
+        return nil, fmt.Errorf("date range must not exceed %d days", maxHistoryDays)
+    }
+
+    published, err := s.fxRateRepo.GetSeries(currency, from, to)
+    if err != nil {
+        return nil, err
+    }
+
+    var points []RatePoint
+    var current *models.FXRate
+    next := 0
+    for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+        for next < len(published) && !truncateDay(published[next].Date).After(day) {
+            current = &published[next]
+            next++
+        }
+        if current == nil {
+            continue
+        }
+        points = append(points, RatePoint{
+            Date:        day,
+            Nominal:     current.Nominal,
+            Rate:        current.Rate,
+            PublishedOn: truncateDay(current.Date),
+        })
+    }
+    return points, nil
+}
+
+// RubRate serves transfers from the stored rates, falling back to the last publication. One older
+// than maxRateAge is only used if the ingestion has recently confirmed it is still in force.
+func (s *rateService) RubRate(currency string, date time.Time) (float64, error) {
+    if currency == models.DefaultCurrency {
+        return 1, nil
+    }
+    day := truncateDay(date)
+    fr, err := s.fxRateRepo.GetRate(currency, day)
+    if err != nil {
+        return 0, fmt.Errorf("exchange rate for %s not available", currency)
+    }
+    if day.Sub(truncateDay(fr.Date)) > maxRateAge {
+        fetched, err := s.fxRateRepo.LastFetchedAt()
+        if err != nil {
+            return 0, err
+        }
+        if date.Sub(fetched) > maxFetchAge {
+            log.Printf("Stored %s rate from %s is too old for %s, rates were last loaded at %s", currency, fr.Date.Format("2006-01-02"),
+                day.Format("2006-01-02"), fetched.Format(time.RFC3339))
+            return 0, fmt.Errorf("exchange rate for %s not available", currency)
+        }
+    }
+    if fr.Nominal <= 0 {
+        return 0, errors.New("invalid exchange rate")
+    }
+    return fr.Rate / float64(fr.Nominal), nil
+}
+
+// StartIngestion loads today's and tomorrow's rates (the CBR publishes the next day's rates in
+// the afternoon) immediately and then every interval, retrying failed fetches with backoff.
+func (s *rateService) StartIngestion(interval time.Duration) {
+    go func() {
+        for {
+            now := time.Now()
+            s.ingestWithRetry(now)
+            s.ingestWithRetry(now.AddDate(0, 0, 1))
+            time.Sleep(interval)
+        }
+    }()
+}
+
+func (s *rateService) ingestWithRetry(date time.Time) {
+    backoff := ingestRetryBackoff
+    for attempt := 1; attempt <= maxIngestAttempts; attempt++ {
+        err := s.IngestRates(date)
+        if err == nil {
+            return
+        }
+        log.Printf("CBR rates ingestion for %s failed (attempt %d/%d): %v", date.Format("2006-01-02"), attempt, maxIngestAttempts, err)
+        if attempt < maxIngestAttempts {
+            time.Sleep(backoff)
+            backoff *= 2
+        }
+    }
+}
+
+func truncateDay(t time.Time) time.Time {
+    return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
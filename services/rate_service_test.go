@@ -0,0 +1,131 @@
+package services
+
+import (
+    "testing"
+    "time"
+
+    "banking_service_project/models"
+)
+
+func mustDay(s string) time.Time {
+    d, err := time.Parse("2006-01-02", s)
+    if err != nil {
+        panic(err)
+    }
+    return d
+}
+
+// Published on Friday and, after a holiday Monday, on Tuesday.
+var testRates = []models.FXRate{
+    {Date: mustDay("2026-03-03"), Currency: "USD", Nominal: 1, Rate: 88},
+    {Date: mustDay("2026-03-06"), Currency: "USD", Nominal: 1, Rate: 90},
+    {Date: mustDay("2026-03-06"), Currency: "JPY", Nominal: 100, Rate: 60},
+    {Date: mustDay("2026-03-10"), Currency: "USD", Nominal: 1, Rate: 91},
+}
+
+func TestRubRate(t *testing.T) {
+    s := NewRateService(&fakeFXRateRepo{rates: testRates}, nil)
+
+    tests := []struct {
+        currency string
+        date     string
+        want     float64
+        wantErr  bool
+    }{
+        {currency: "RUB", date: "2026-03-06", want: 1},
+        {currency: "USD", date: "2026-03-06", want: 90},
+        {currency: "USD", date: "2026-03-09", want: 90},
+        {currency: "USD", date: "2026-03-10", want: 91},
+        {currency: "JPY", date: "2026-03-07", want: 0.6},
+        {currency: "JPY", date: "2026-03-05", wantErr: true},
+        {currency: "EUR", date: "2026-03-06", wantErr: true},
+    }
+    for _, tt := range tests {
+        got, err := s.RubRate(tt.currency, mustDay(tt.date).Add(15*time.Hour))
+        if tt.wantErr {
+            if err == nil {
+                t.Errorf("%s on %s: expected an error", tt.currency, tt.date)
+            }
+            continue
+        }
+        if err != nil || got != tt.want {
+            t.Errorf("%s on %s = %v, %v; want %v", tt.currency, tt.date, got, err, tt.want)
+        }
+    }
+}
+
+func TestRubRateAfterLongHoliday(t *testing.T) {
+    // No publication from 2026-03-10 to 2026-03-17
+    at := mustDay("2026-03-17").Add(15 * time.Hour)
+
+    tests := []struct {
+        name    string
+        fetched time.Time
+        wantErr bool
+    }{
+        {name: "loaded this morning", fetched: mustDay("2026-03-17").Add(9 * time.Hour)},
+        {name: "loaded last night", fetched: mustDay("2026-03-16").Add(21 * time.Hour)},
+        {name: "ingestion broken for days", fetched: mustDay("2026-03-12").Add(9 * time.Hour), wantErr: true},
+        {name: "never loaded", wantErr: true},
+    }
+    for _, tt := range tests {
+        s := NewRateService(&fakeFXRateRepo{rates: testRates, fetchedAt: tt.fetched}, nil)
+        got, err := s.RubRate("USD", at)
+        if tt.wantErr {
+            if err == nil {
+                t.Errorf("%s: expected an error", tt.name)
+            }
+            continue
+        }
+        if err != nil || got != 91 {
+            t.Errorf("%s: got %v, %v; want 91", tt.name, got, err)
+        }
+    }
+}
+
+func TestGetHistoryFillsDaysWithoutPublication(t *testing.T) {
+    s := NewRateService(&fakeFXRateRepo{rates: testRates}, nil)
+
+    points, err := s.GetHistory("usd", mustDay("2026-03-07"), mustDay("2026-03-10"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []struct {
+        date, publishedOn string
+        rate              float64
+    }{
+        {"2026-03-07", "2026-03-06", 90},
+        {"2026-03-08", "2026-03-06", 90},
+        {"2026-03-09", "2026-03-06", 90},
+        {"2026-03-10", "2026-03-10", 91},
+    }
+    if len(points) != len(want) {
+        t.Fatalf("got %d points, want %d", len(points), len(want))
+    }
+    for i, w := range want {
+        p := points[i]
+        if !p.Date.Equal(mustDay(w.date)) || !p.PublishedOn.Equal(mustDay(w.publishedOn)) || p.Rate != w.rate {
+            t.Errorf("point %d = %s published %s at %v, want %s published %s at %v", i,
+                p.Date.Format("2006-01-02"), p.PublishedOn.Format("2006-01-02"), p.Rate, w.date, w.publishedOn, w.rate)
+        }
+    }
+}
+
+func TestGetHistoryValidatesRange(t *testing.T) {
+    s := NewRateService(&fakeFXRateRepo{rates: testRates}, nil)
+
+    tests := []struct {
+        name     string
+        currency string
+        from, to time.Time
+    }{
+        {"reversed range", "USD", mustDay("2026-03-10"), mustDay("2026-03-01")},
+        {"longer than a year", "USD", mustDay("2025-01-01"), mustDay("2026-03-01")},
+        {"bad currency", "US", mustDay("2026-03-01"), mustDay("2026-03-10")},
+    }
+    for _, tt := range tests {
+        if _, err := s.GetHistory(tt.currency, tt.from, tt.to); err == nil {
+            t.Errorf("%s: expected an error", tt.name)
+        }
+    }
+}
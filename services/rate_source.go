@@ -0,0 +1,74 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "strings"
+    "time"
+
+    "banking_service_project/models"
+)
+
+var ErrInvalidCurrency = errors.New("invalid currency code")
+
+// RateSource returns how many rubles one unit of a currency is worth on a date.
+type RateSource interface {
+    RubRate(currency string, date time.Time) (float64, error)
+}
+
+type staticRateSource struct {
+    rates map[string]float64
+}
+
+// NewStaticRateSource returns a RateSource serving fixed ruble rates, for tests and local runs.
+func NewStaticRateSource(rates map[string]float64) RateSource {
+    return &staticRateSource{rates: rates}
+}
+
+func (s *staticRateSource) RubRate(currency string, date time.Time) (float64, error) {
+    if currency == models.DefaultCurrency {
+        return 1, nil
+    }
+    rate, ok := s.rates[currency]
+    if !ok {
+        return 0, fmt.Errorf("exchange rate for %s not available", currency)
+    }
+    return rate, nil
+}
+
+// crossRate returns the mid-market rate for converting one unit of from into to.
+func crossRate(src RateSource, from, to string, date time.Time) (float64, error) {
+    fromRub, err := src.RubRate(from, date)
+    if err != nil {
+        return 0, err
+    }
+    toRub, err := src.RubRate(to, date)
+    if err != nil {
+        return 0, err
+    }
+    if toRub == 0 {
+        return 0, errors.New("invalid exchange rate")
+    }
+    return fromRub / toRub, nil
+}
+
+func normalizeCurrency(code string) (string, error) {
+    code = strings.ToUpper(strings.TrimSpace(code))
+    if code == "" {
+        return models.DefaultCurrency, nil
+    }
+    if len(code) != 3 {
+        return "", ErrInvalidCurrency
+    }
+    for _, c := range code {
+        if c < 'A' || c > 'Z' {
+            return "", ErrInvalidCurrency
+        }
+    }
+    return code, nil
+}
+
+func roundMoney(amount float64) float64 {
+    return math.Round(amount*100) / 100
+}
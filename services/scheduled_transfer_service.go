@@ -0,0 +1,282 @@
+package services
+
+import (
+    "errors"
+    "log"
+    "strconv"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+const (
+    maxScheduledFailures   = 3
+    scheduledRetryInterval = time.Hour
+)
+
+type ScheduledTransferService interface {
+    Create(userID int, st *models.ScheduledTransfer) error
+    List(userID int) ([]models.ScheduledTransfer, error)
+    GetRuns(userID, id int) ([]models.ScheduledTransferRun, error)
+    Cancel(userID, id int) error
+    Resume(userID, id int) error
+    RunDue(now time.Time)
+    StartWorker(interval time.Duration)
+}
+
+type scheduledTransferService struct {
+    scheduledRepo       repositories.ScheduledTransferRepository
+    accountRepo         repositories.AccountRepository
+    userRepo            repositories.UserRepository
+    transferService     TransferService
+    notificationService NotificationService
+}
+
+func NewScheduledTransferService(scheduledRepo repositories.ScheduledTransferRepository, accountRepo repositories.AccountRepository, userRepo repositories.UserRepository, transferService TransferService, notificationService NotificationService) ScheduledTransferService {
+    return &scheduledTransferService{
+        scheduledRepo:       scheduledRepo,
+        accountRepo:         accountRepo,
+        userRepo:            userRepo,
+        transferService:     transferService,
+        notificationService: notificationService,
+    }
+}
+
+// Create validates and stores a standing order; st.NextRunAt is the first execution time.
+func (s *scheduledTransferService) Create(userID int, st *models.ScheduledTransfer) error {
+    fromAcc, err := s.accountRepo.GetByID(st.FromAccountID)
+    if err != nil || fromAcc.UserID != userID {
+        return errors.New("from account not found")
+    }
+    if _, err := s.accountRepo.GetByID(st.ToAccountID); err != nil {
+        return errors.New("to account not found")
+    }
+    if st.FromAccountID == st.ToAccountID {
+        return errors.New("cannot transfer to the same account")
+    }
+    if st.Amount <= 0 {
+        return errors.New("amount must be positive")
+    }
+    if st.NextRunAt.IsZero() {
+        st.NextRunAt = time.Now()
+    }
+
+    switch st.Frequency {
+    case models.FrequencyOnce, models.FrequencyDaily, models.FrequencyWeekly:
+        st.DayOfMonth = 0
+    case models.FrequencyMonthly:
+        if st.DayOfMonth == 0 {
+            st.DayOfMonth = st.NextRunAt.Day()
+        }
+        if st.DayOfMonth < 1 || st.DayOfMonth > 31 {
+            return errors.New("day_of_month must be between 1 and 31")
+        }
+        start := st.NextRunAt
+        st.NextRunAt = monthlyRun(start.Year(), start.Month(), st.DayOfMonth, start)
+        if st.NextRunAt.Before(start) {
+            st.NextRunAt = monthlyRun(start.Year(), start.Month()+1, st.DayOfMonth, start)
+        }
+    default:
+        return errors.New("frequency must be one of once, daily, weekly, monthly")
+    }
+    if st.EndDate != nil && st.EndDate.Before(st.NextRunAt) {
+        return errors.New("end_date must not be before the first run")
+    }
+
+    st.UserID = userID
+    st.Status = models.ScheduleActive
+    st.FailureCount = 0
+    return s.scheduledRepo.Create(st)
+}
+
+func (s *scheduledTransferService) List(userID int) ([]models.ScheduledTransfer, error) {
+    return s.scheduledRepo.GetByUserID(userID)
+}
+
+func (s *scheduledTransferService) GetRuns(userID, id int) ([]models.ScheduledTransferRun, error) {
+    if _, err := s.getOwned(userID, id); err != nil {
+        return nil, err
+    }
+    return s.scheduledRepo.GetRuns(id)
+}
+
+func (s *scheduledTransferService) Cancel(userID, id int) error {
+    st, err := s.getOwned(userID, id)
+    if err != nil {
+        return err
+    }
+    if st.Status == models.ScheduleCompleted || st.Status == models.ScheduleCancelled {
+        return errors.New("scheduled transfer is already finished")
+    }
+    st.Status = models.ScheduleCancelled
+    return s.scheduledRepo.Update(st)
+}
+
+// Resume reactivates a schedule paused after failures; missed runs are skipped.
+func (s *scheduledTransferService) Resume(userID, id int) error {
+    st, err := s.getOwned(userID, id)
+    if err != nil {
+        return err
+    }
+    if st.Status != models.SchedulePaused {
+        return errors.New("scheduled transfer is not paused")
+    }
+    st.Status = models.ScheduleActive
+    st.FailureCount = 0
+    st.RetryAt = nil
+    if st.Frequency != models.FrequencyOnce {
+        st.NextRunAt = s.advance(st, time.Now())
+    }
+    return s.scheduledRepo.Update(st)
+}
+
+func (s *scheduledTransferService) RunDue(now time.Time) {
+    due, err := s.scheduledRepo.GetDue(now)
+    if err != nil {
+        log.Printf("Failed to load due scheduled transfers: %v", err)
+        return
+    }
+    for i := range due {
+        s.execute(&due[i], now)
+    }
+}
+
+func (s *scheduledTransferService) StartWorker(interval time.Duration) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for now := range ticker.C {
+            s.RunDue(now)
+        }
+    }()
+}
+
+var errScheduledRunHandled = errors.New("scheduled run has already been handled")
+
+// execute makes one run. A successful transfer and the schedule's move to its next run are
+// committed together, and a run that another worker has already handled is not repeated.
+func (s *scheduledTransferService) execute(st *models.ScheduledTransfer, now time.Time) {
+    dueAt := st.NextRunAt
+    if st.RetryAt != nil {
+        dueAt = *st.RetryAt
+    }
+    done := *st
+    s.completeRun(&done, now)
+    _, err := s.transferService.TransferWith(st.FromAccountID, st.ToAccountID, st.Amount, func(dbTx *repositories.Tx, tx *models.Transaction) error {
+        ok, err := dbTx.Scheduled.Advance(&done, dueAt)
+        if err != nil {
+            return err
+        }
+        if !ok {
+            return errScheduledRunHandled
+        }
+        return dbTx.Scheduled.CreateRun(&models.ScheduledTransferRun{ScheduledTransferID: st.ID, TransactionID: &tx.ID, Success: true})
+    })
+    if err == nil || errors.Is(err, errScheduledRunHandled) {
+        return
+    }
+
+    run := &models.ScheduledTransferRun{ScheduledTransferID: st.ID, Error: err.Error()}
+    var heldErr *TransferHeldError
+    if errors.As(err, &heldErr) {
+        // The run is now in the review queue; retrying would queue it again
+        *st = done
+    } else {
+        st.FailureCount++
+        retryAt := now.Add(scheduledRetryInterval)
+        st.RetryAt = &retryAt
+        if st.FailureCount >= maxScheduledFailures {
+            st.Status = models.SchedulePaused
+            st.RetryAt = nil
+        }
+    }
+    ok, updateErr := s.scheduledRepo.Advance(st, dueAt)
+    if updateErr != nil {
+        log.Printf("Failed to update scheduled transfer %d: %v", st.ID, updateErr)
+        return
+    }
+    if !ok {
+        return
+    }
+    if err := s.scheduledRepo.CreateRun(run); err != nil {
+        log.Printf("Failed to record run of scheduled transfer %d: %v", st.ID, err)
+    }
+    if st.Status == models.SchedulePaused {
+        s.notifyPaused(st, err)
+    }
+}
+
+// completeRun moves the schedule past a run that went through.
+func (s *scheduledTransferService) completeRun(st *models.ScheduledTransfer, now time.Time) {
+    st.FailureCount = 0
+    st.RetryAt = nil
+    if st.Frequency == models.FrequencyOnce {
+        st.Status = models.ScheduleCompleted
+        return
+    }
+    st.NextRunAt = s.advance(st, now)
+    if st.EndDate != nil && st.NextRunAt.After(*st.EndDate) {
+        st.Status = models.ScheduleCompleted
+    }
+}
+
+// advance moves NextRunAt forward by whole periods until it is after now, so a worker that was
+// down does not replay every missed run.
+func (s *scheduledTransferService) advance(st *models.ScheduledTransfer, now time.Time) time.Time {
+    next := st.NextRunAt
+    for !next.After(now) {
+        switch st.Frequency {
+        case models.FrequencyDaily:
+            next = next.AddDate(0, 0, 1)
+        case models.FrequencyWeekly:
+            next = next.AddDate(0, 0, 7)
+        case models.FrequencyMonthly:
+            // Step from the first of the month so the 31st does not overflow into the next one
+            firstOfNext := time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+            next = monthlyRun(firstOfNext.Year(), firstOfNext.Month(), st.DayOfMonth, next)
+        default:
+            return next
+        }
+    }
+    return next
+}
+
+func (s *scheduledTransferService) getOwned(userID, id int) (*models.ScheduledTransfer, error) {
+    st, err := s.scheduledRepo.GetByID(id)
+    if err != nil || st.UserID != userID {
+        return nil, errors.New("scheduled transfer not found")
+    }
+    return st, nil
+}
+
+func (s *scheduledTransferService) notifyPaused(st *models.ScheduledTransfer, cause error) {
+    data := map[string]interface{}{
+        "TransferID":  st.ID,
+        "Amount":      st.Amount,
+        "Currency":    "",
+        "FromAccount": strconv.Itoa(st.FromAccountID),
+        "ToAccount":   strconv.Itoa(st.ToAccountID),
+        "Failures":    st.FailureCount,
+        "Error":       cause.Error(),
+    }
+    if acc, err := s.accountRepo.GetByID(st.FromAccountID); err == nil {
+        data["Currency"] = acc.Currency
+        data["FromAccount"] = acc.Number
+    }
+    if acc, err := s.accountRepo.GetByID(st.ToAccountID); err == nil {
+        data["ToAccount"] = acc.Number
+    }
+    if err := s.notificationService.Notify(st.UserID, TemplateScheduledTransferPaused, data); err != nil {
+        log.Printf("Failed to send pause notification for scheduled transfer %d: %v", st.ID, err)
+    }
+}
+
+// monthlyRun returns day of the given month at the time of day of at, clamped to the month's last day.
+func monthlyRun(year int, month time.Month, day int, at time.Time) time.Time {
+    lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, at.Location()).Day()
+    if day > lastDay {
+        day = lastDay
+    }
+    return time.Date(year, month, day, at.Hour(), at.Minute(), at.Second(), 0, at.Location())
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+    "testing"
+    "time"
+
+    "banking_service_project/models"
+)
+
+func TestMonthlyRunClampsToMonthEnd(t *testing.T) {
+    at := time.Date(2026, 1, 1, 9, 30, 0, 0, time.UTC)
+    tests := []struct {
+        year  int
+        month time.Month
+        day   int
+        want  string
+    }{
+        {2026, time.January, 15, "2026-01-15 09:30"},
+        {2026, time.January, 31, "2026-01-31 09:30"},
+        {2026, time.February, 31, "2026-02-28 09:30"},
+        {2028, time.February, 30, "2028-02-29 09:30"},
+        {2026, time.April, 31, "2026-04-30 09:30"},
+        {2026, time.December, 31, "2026-12-31 09:30"},
+        {2026, time.Month(13), 31, "2027-01-31 09:30"},
+    }
+    for _, tt := range tests {
+        got := monthlyRun(tt.year, tt.month, tt.day, at).Format("2006-01-02 15:04")
+        if got != tt.want {
+            t.Errorf("monthlyRun(%d, %d, %d) = %s, want %s", tt.year, tt.month, tt.day, got, tt.want)
+        }
+    }
+}
+
+func TestAdvanceSkipsMissedRuns(t *testing.T) {
+    at := func(s string) time.Time {
+        tm, err := time.Parse("2006-01-02 15:04", s)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return tm
+    }
+    tests := []struct {
+        name       string
+        frequency  string
+        dayOfMonth int
+        next, now  string
+        want       string
+    }{
+        {"daily", models.FrequencyDaily, 0, "2026-03-01 10:00", "2026-03-01 10:00", "2026-03-02 10:00"},
+        {"daily after downtime", models.FrequencyDaily, 0, "2026-03-01 10:00", "2026-03-04 12:00", "2026-03-05 10:00"},
+        {"weekly", models.FrequencyWeekly, 0, "2026-03-02 08:00", "2026-03-10 08:00", "2026-03-16 08:00"},
+        {"monthly on the 31st into February", models.FrequencyMonthly, 31, "2026-01-31 09:00", "2026-01-31 09:00", "2026-02-28 09:00"},
+        {"monthly back to the 31st", models.FrequencyMonthly, 31, "2026-02-28 09:00", "2026-02-28 09:00", "2026-03-31 09:00"},
+        {"monthly after downtime", models.FrequencyMonthly, 15, "2026-01-15 09:00", "2026-04-20 09:00", "2026-05-15 09:00"},
+    }
+    s := &scheduledTransferService{}
+    for _, tt := range tests {
+        st := &models.ScheduledTransfer{Frequency: tt.frequency, DayOfMonth: tt.dayOfMonth, NextRunAt: at(tt.next)}
+        if got := s.advance(st, at(tt.now)).Format("2006-01-02 15:04"); got != tt.want {
+            t.Errorf("%s: next run %s, want %s", tt.name, got, tt.want)
+        }
+    }
+}
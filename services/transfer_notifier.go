@@ -0,0 +1,188 @@
+package services
+
+import (
+    "encoding/json"
+    "log"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+// TransferNotifier tells both sides of a transfer that money moved. Transfers worth less than the
+// threshold (in rubles) are collected and sent once a day as a digest instead. Moves between two
+// accounts of the same user are not reported.
+type TransferNotifier interface {
+    HandleEvent(event models.OutboxEvent) error
+    SendDigests(now time.Time)
+    StartDigests(interval time.Duration)
+}
+
+type transferNotifier struct {
+    notificationService NotificationService
+    digestRepo          repositories.TransferDigestRepository
+    accountRepo         repositories.AccountRepository
+    userRepo            repositories.UserRepository
+    rateSource          RateSource
+    thresholdRub        float64
+}
+
+func NewTransferNotifier(notificationService NotificationService, digestRepo repositories.TransferDigestRepository, accountRepo repositories.AccountRepository, userRepo repositories.UserRepository, rateSource RateSource, thresholdRub float64) TransferNotifier {
+    return &transferNotifier{
+        notificationService: notificationService,
+        digestRepo:          digestRepo,
+        accountRepo:         accountRepo,
+        userRepo:            userRepo,
+        rateSource:          rateSource,
+        thresholdRub:        thresholdRub,
+    }
+}
+
+// HandleEvent takes EventTransferCompleted events. The balance each side is told is read from its own
+// account when the event is handled, so it may already include later operations.
+func (n *transferNotifier) HandleEvent(event models.OutboxEvent) error {
+    var t TransferCompleted
+    if err := json.Unmarshal(event.Payload, &t); err != nil {
+        return err
+    }
+    if t.FromUserID == t.ToUserID {
+        return nil
+    }
+    fromAcc, err := n.accountRepo.GetByID(t.FromAccountID)
+    if err != nil {
+        return err
+    }
+    toAcc, err := n.accountRepo.GetByID(t.ToAccountID)
+    if err != nil {
+        return err
+    }
+    sender, err := n.userRepo.GetByID(t.FromUserID)
+    if err != nil {
+        return err
+    }
+    recipient, err := n.userRepo.GetByID(t.ToUserID)
+    if err != nil {
+        return err
+    }
+
+    immediate := n.aboveThreshold(t.Amount, t.Currency, t.At)
+    outgoing := models.TransferDigestItem{
+        UserID:        t.FromUserID,
+        TransactionID: t.TransactionID,
+        AccountNumber: fromAcc.Number,
+        Counterparty:  maskName(recipient) + ", " + maskAccountNumber(toAcc.Number),
+        Amount:        t.Amount,
+        Currency:      t.Currency,
+        Balance:       fromAcc.Balance,
+        At:            t.At,
+    }
+    incoming := models.TransferDigestItem{
+        UserID:        t.ToUserID,
+        TransactionID: t.TransactionID,
+        Incoming:      true,
+        AccountNumber: toAcc.Number,
+        Counterparty:  maskName(sender),
+        Amount:        t.ToAmount,
+        Currency:      t.ToCurrency,
+        Balance:       toAcc.Balance,
+        At:            t.At,
+    }
+    for _, item := range []models.TransferDigestItem{outgoing, incoming} {
+        if !immediate {
+            if err := n.digestRepo.Add(&item); err != nil {
+                return err
+            }
+            continue
+        }
+        template := TemplateTransferSent
+        if item.Incoming {
+            template = TemplateTransferReceived
+        }
+        if err := n.notificationService.Notify(item.UserID, template, transferNotificationData(item)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// SendDigests sends every user one digest of the small transfers made before today (UTC).
+func (n *transferNotifier) SendDigests(now time.Time) {
+    items, err := n.digestRepo.GetUnsentBefore(truncateDay(now))
+    if err != nil {
+        log.Printf("Failed to load transfer digest items: %v", err)
+        return
+    }
+    for start := 0; start < len(items); {
+        end := start
+        for end < len(items) && items[end].UserID == items[start].UserID {
+            end++
+        }
+        n.sendDigest(items[start:end], now)
+        start = end
+    }
+}
+
+func (n *transferNotifier) StartDigests(interval time.Duration) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for now := range ticker.C {
+            n.SendDigests(now)
+        }
+    }()
+}
+
+func (n *transferNotifier) sendDigest(items []models.TransferDigestItem, now time.Time) {
+    userID := items[0].UserID
+    transfers := make([]map[string]interface{}, len(items))
+    ids := make([]int, len(items))
+    for i, item := range items {
+        transfers[i] = transferNotificationData(item)
+        ids[i] = item.ID
+    }
+    data := map[string]interface{}{
+        "From":      items[0].At,
+        "To":        items[len(items)-1].At,
+        "Transfers": transfers,
+    }
+    if err := n.notificationService.Notify(userID, TemplateTransferDigest, data); err != nil {
+        log.Printf("Failed to send transfer digest to user %d: %v", userID, err)
+        return
+    }
+    if err := n.digestRepo.MarkSent(ids, now); err != nil {
+        log.Printf("Failed to mark transfer digest of user %d as sent: %v", userID, err)
+    }
+}
+
+// aboveThreshold errs on the side of an immediate notification when the rate is unknown.
+func (n *transferNotifier) aboveThreshold(amount float64, currency string, at time.Time) bool {
+    if n.thresholdRub <= 0 {
+        return true
+    }
+    rate, err := n.rateSource.RubRate(currency, at)
+    if err != nil {
+        log.Printf("No %s rate to compare a transfer with the notification threshold: %v", currency, err)
+        return true
+    }
+    return amount*rate >= n.thresholdRub
+}
+
+func transferNotificationData(item models.TransferDigestItem) map[string]interface{} {
+    return map[string]interface{}{
+        "Incoming":     item.Incoming,
+        "Account":      maskAccountNumber(item.AccountNumber),
+        "Counterparty": item.Counterparty,
+        "Amount":       item.Amount,
+        "Currency":     item.Currency,
+        "Balance":      item.Balance,
+        "At":           item.At,
+    }
+}
+
+// maskAccountNumber keeps the last four digits: "*4312".
+func maskAccountNumber(number string) string {
+    if len(number) < 4 {
+        return "*"
+    }
+    return "*" + number[len(number)-4:]
+}
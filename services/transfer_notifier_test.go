@@ -0,0 +1,275 @@
+package services
+
+import (
+    "bufio"
+    "encoding/json"
+    "io"
+    "mime"
+    "mime/multipart"
+    "mime/quotedprintable"
+    "net"
+    "net/mail"
+    "sort"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "banking_service_project/models"
+)
+
+// smtpStandIn is a local SMTP server that accepts every message and keeps it.
+type smtpStandIn struct {
+    listener net.Listener
+    mu       sync.Mutex
+    messages []string
+}
+
+func startSMTPStandIn(t *testing.T) *smtpStandIn {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := &smtpStandIn{listener: l}
+    t.Cleanup(func() { l.Close() })
+    go func() {
+        for {
+            conn, err := l.Accept()
+            if err != nil {
+                return
+            }
+            go s.serve(conn)
+        }
+    }()
+    return s
+}
+
+func (s *smtpStandIn) addr() (host, port string) {
+    host, port, _ = net.SplitHostPort(s.listener.Addr().String())
+    return host, port
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+    defer conn.Close()
+    r := bufio.NewReader(conn)
+    reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+    reply("220 localhost ESMTP")
+    for {
+        line, err := r.ReadString('\n')
+        if err != nil {
+            return
+        }
+        cmd := strings.ToUpper(strings.TrimSpace(line))
+        switch {
+        case strings.HasPrefix(cmd, "DATA"):
+            reply("354 go ahead")
+            var data strings.Builder
+            for {
+                l, err := r.ReadString('\n')
+                if err != nil {
+                    return
+                }
+                if l == ".\r\n" {
+                    break
+                }
+                data.WriteString(strings.TrimPrefix(l, "."))
+            }
+            s.mu.Lock()
+            s.messages = append(s.messages, data.String())
+            s.mu.Unlock()
+            reply("250 queued")
+        case strings.HasPrefix(cmd, "QUIT"):
+            reply("221 bye")
+            return
+        default:
+            reply("250 ok")
+        }
+    }
+}
+
+type receivedEmail struct {
+    To, Subject, Text string
+}
+
+// received decodes the messages taken so far, ordered by recipient.
+func (s *smtpStandIn) received(t *testing.T) []receivedEmail {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var decoder mime.WordDecoder
+    var emails []receivedEmail
+    for _, raw := range s.messages {
+        msg, err := mail.ReadMessage(strings.NewReader(raw))
+        if err != nil {
+            t.Fatal(err)
+        }
+        subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+        if err != nil {
+            t.Fatal(err)
+        }
+        email := receivedEmail{To: msg.Header.Get("To"), Subject: subject}
+        _, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if boundary := params["boundary"]; boundary != "" {
+            // The first part of multipart/alternative is the plain text
+            part, err := multipart.NewReader(msg.Body, boundary).NextPart()
+            if err != nil {
+                t.Fatal(err)
+            }
+            body, _ := io.ReadAll(part)
+            email.Text = string(body)
+        } else {
+            var body io.Reader = msg.Body
+            if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+                body = quotedprintable.NewReader(body)
+            }
+            text, _ := io.ReadAll(body)
+            email.Text = string(text)
+        }
+        emails = append(emails, email)
+    }
+    sort.SliceStable(emails, func(i, j int) bool { return emails[i].To < emails[j].To })
+    return emails
+}
+
+type transferNotifierFixture struct {
+    notifier      TransferNotifier
+    notifications NotificationService
+    digests       *fakeDigestRepo
+    smtp          *smtpStandIn
+}
+
+// newTransferNotifierFixture notifies over email through the SMTP stand-in about transfers between
+// anna (account 1, ru) and john (account 2, en), with a threshold of 1 000 RUB.
+func newTransferNotifierFixture(t *testing.T) *transferNotifierFixture {
+    smtp := startSMTPStandIn(t)
+    host, port := smtp.addr()
+    users := &fakeUserRepo{users: map[int]*models.User{
+        1: {ID: 1, Username: "anna", FullName: "Анна Смирнова", Email: "anna@example.com", PreferredLanguage: "ru"},
+        2: {ID: 2, Username: "john", FullName: "John Smith", Email: "john@example.com", PreferredLanguage: "en"},
+    }}
+    accounts := &fakeAccountRepo{accounts: map[int]*models.Account{
+        1: {ID: 1, UserID: 1, Number: "40817810000000001111", Balance: 5000, Currency: "RUB"},
+        2: {ID: 2, UserID: 2, Number: "40817840000000002222", Balance: 300, Currency: "USD"},
+        3: {ID: 3, UserID: 1, Number: "40817810000000003333", Currency: "RUB"},
+    }}
+    notifications, err := NewNotificationService(&fakeNotificationRepo{}, users,
+        NewEmailChannel(NewExternalService(host, port, "bank@example.com", "", "", "")))
+    if err != nil {
+        t.Fatal(err)
+    }
+    digests := &fakeDigestRepo{}
+    rates := NewStaticRateSource(map[string]float64{"USD": 90})
+    return &transferNotifierFixture{
+        notifier:      NewTransferNotifier(notifications, digests, accounts, users, rates, 1000),
+        notifications: notifications,
+        digests:       digests,
+        smtp:          smtp,
+    }
+}
+
+func transferEvent(t *testing.T, id, from, fromUser, to, toUser int, amount float64, currency string, toAmount float64, toCurrency string, at time.Time) models.OutboxEvent {
+    payload, err := json.Marshal(TransferCompleted{
+        TransactionID: id,
+        Type:          models.TxTransfer,
+        FromAccountID: from,
+        FromUserID:    fromUser,
+        ToAccountID:   to,
+        ToUserID:      toUser,
+        Amount:        amount,
+        Currency:      currency,
+        ToAmount:      toAmount,
+        ToCurrency:    toCurrency,
+        At:            at,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return models.OutboxEvent{Type: EventTransferCompleted, Payload: payload}
+}
+
+func TestTransferAboveThresholdNotifiesBothSides(t *testing.T) {
+    f := newTransferNotifierFixture(t)
+    at := time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC)
+
+    if err := f.notifier.HandleEvent(transferEvent(t, 1, 1, 1, 2, 2, 9000, "RUB", 100, "USD", at)); err != nil {
+        t.Fatal(err)
+    }
+    f.notifications.Send(time.Now())
+
+    emails := f.smtp.received(t)
+    if len(emails) != 2 {
+        t.Fatalf("received %d emails, want 2", len(emails))
+    }
+    sender, recipient := emails[0], emails[1]
+    if sender.To != "anna@example.com" || sender.Subject != "Перевод 9\u00a0000,00 RUB отправлен" {
+        t.Errorf("sender email = %+v", sender)
+    }
+    if !strings.Contains(sender.Text, "получатель — John S., *2222") || !strings.Contains(sender.Text, "Остаток: 5\u00a0000,00 RUB") {
+        t.Errorf("sender text = %q", sender.Text)
+    }
+    if recipient.To != "john@example.com" || recipient.Subject != "You received 100.00 USD" {
+        t.Errorf("recipient email = %+v", recipient)
+    }
+    if !strings.Contains(recipient.Text, "from Анна С. was credited to account *2222") || !strings.Contains(recipient.Text, "Balance: 300.00 USD") {
+        t.Errorf("recipient text = %q", recipient.Text)
+    }
+    if len(f.digests.items) != 0 {
+        t.Errorf("a transfer above the threshold went to the digest")
+    }
+}
+
+func TestSmallTransfersGoToDailyDigest(t *testing.T) {
+    f := newTransferNotifierFixture(t)
+    day := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+
+    events := []models.OutboxEvent{
+        transferEvent(t, 1, 1, 1, 2, 2, 450, "RUB", 5, "USD", day.Add(10*time.Hour)),
+        transferEvent(t, 2, 2, 2, 1, 1, 10, "USD", 900, "RUB", day.Add(12*time.Hour)),
+        // Between two accounts of the same user: not reported at all
+        transferEvent(t, 3, 1, 1, 3, 1, 50000, "RUB", 50000, "RUB", day.Add(13*time.Hour)),
+    }
+    for _, e := range events {
+        if err := f.notifier.HandleEvent(e); err != nil {
+            t.Fatal(err)
+        }
+    }
+    f.notifications.Send(time.Now())
+    if emails := f.smtp.received(t); len(emails) != 0 {
+        t.Fatalf("small transfers were sent right away: %+v", emails)
+    }
+    if len(f.digests.items) != 4 {
+        t.Fatalf("digest has %d items, want both sides of two transfers", len(f.digests.items))
+    }
+
+    // Not before the day is over
+    f.notifier.SendDigests(day.Add(23 * time.Hour))
+    f.notifications.Send(time.Now())
+    if emails := f.smtp.received(t); len(emails) != 0 {
+        t.Fatalf("digest sent before the end of the day: %+v", emails)
+    }
+
+    next := day.AddDate(0, 0, 1).Add(time.Hour)
+    f.notifier.SendDigests(next)
+    f.notifier.SendDigests(next)
+    f.notifications.Send(time.Now())
+
+    emails := f.smtp.received(t)
+    if len(emails) != 2 {
+        t.Fatalf("received %d digests, want one per user", len(emails))
+    }
+    anna, john := emails[0], emails[1]
+    if anna.To != "anna@example.com" || !strings.Contains(anna.Text, "\u2212450,00 RUB →") || !strings.Contains(anna.Text, "+900,00 RUB от") {
+        t.Errorf("anna's digest = %+v", anna)
+    }
+    if john.To != "john@example.com" || john.Subject != "Your transfers for Mar 5, 2026" ||
+        !strings.Contains(john.Text, "+5.00 USD from Анна С.") || !strings.Contains(john.Text, "-10.00 USD to Анна С., *1111") {
+        t.Errorf("john's digest = %+v", john)
+    }
+    for _, item := range f.digests.items {
+        if item.SentAt == nil {
+            t.Errorf("digest item %d not marked sent", item.ID)
+        }
+    }
+}
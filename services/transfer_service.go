@@ -2,55 +2,483 @@ package services
 
 import (
     "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "banking_service_project/fraud"
     "banking_service_project/models"
     "banking_service_project/repositories"
+    "banking_service_project/utils"
+)
+
+// Transfers to other users from this amount (in rubles) need a TOTP code.
+const SecondFactorThreshold = 100000
+
+var (
+    ErrRecipientNotFound = errors.New("recipient not found")
+    ErrTransferBlocked   = errors.New("transfer blocked by fraud screening")
+
+    errHeldDecided = errors.New("held transfer has already been decided")
 )
 
+// TransferHeldError is returned when fraud screening queues a transfer for staff review instead of executing it.
+type TransferHeldError struct {
+    HeldTransferID int
+}
+
+func (e *TransferHeldError) Error() string {
+    return fmt.Sprintf("transfer held for review (#%d)", e.HeldTransferID)
+}
+
+// RecipientPreview is shown to the sender to confirm who a transfer by phone/username/email or
+// account number goes to.
+type RecipientPreview struct {
+    Name     string `json:"recipient_name"`
+    Currency string `json:"currency"`
+}
+
 type TransferService interface {
     Transfer(fromAccountID, toAccountID int, amount float64) (*models.Transaction, error)
+    TransferWith(fromAccountID, toAccountID int, amount float64, then func(dbTx *repositories.Tx, tx *models.Transaction) error) (*models.Transaction, error)
+    PreviewRecipient(recipient string) (*RecipientPreview, error)
+    TransferToRecipient(userID, fromAccountID int, recipient string, amount float64) (*models.Transaction, error)
+    ListHeld(status string) ([]models.HeldTransfer, error)
+    ApproveHeld(id int, then func(dbTx *repositories.Tx, tx *models.Transaction) error) (*models.Transaction, error)
+    RejectHeld(id int, then func(dbTx *repositories.Tx) error) error
+    Sweep(dbTx *repositories.Tx, fromAcc, toAcc *models.Account) (*models.Transaction, error)
+    RequiresSecondFactor(fromAccountID, toAccountID int, amount float64) (bool, error)
 }
 
 type transferService struct {
     accountRepo     repositories.AccountRepository
-    transactionRepo repositories.TransactionRepository
+    userRepo        repositories.UserRepository
+    heldRepo        repositories.HeldTransferRepository
+    limitService    LimitService
+    fraudEngine     fraud.Engine
+    rateSource      RateSource
+    store           repositories.Store
+    fxSpread        float64 // percent taken off the mid rate on cross-currency transfers
 }
 
-func NewTransferService(accountRepo repositories.AccountRepository, transactionRepo repositories.TransactionRepository) TransferService {
-    return &transferService{accountRepo: accountRepo, transactionRepo: transactionRepo}
+func NewTransferService(accountRepo repositories.AccountRepository, userRepo repositories.UserRepository, heldRepo repositories.HeldTransferRepository, limitService LimitService, fraudEngine fraud.Engine, rateSource RateSource, store repositories.Store, fxSpread float64) TransferService {
+    return &transferService{
+        accountRepo:     accountRepo,
+        userRepo:        userRepo,
+        heldRepo:        heldRepo,
+        limitService:    limitService,
+        fraudEngine:     fraudEngine,
+        rateSource:      rateSource,
+        store:           store,
+        fxSpread:        fxSpread,
+    }
 }
 
 func (s *transferService) Transfer(fromAccountID, toAccountID int, amount float64) (*models.Transaction, error) {
+    return s.transfer(fromAccountID, toAccountID, amount, true, nil)
+}
+
+// TransferWith is Transfer with then run in the transfer's database transaction, so that what it
+// writes is committed together with the transfer or not at all.
+func (s *transferService) TransferWith(fromAccountID, toAccountID int, amount float64, then func(dbTx *repositories.Tx, tx *models.Transaction) error) (*models.Transaction, error) {
+    return s.transfer(fromAccountID, toAccountID, amount, true, then)
+}
+
+// transfer moves money between accounts; screen is false only when staff release a held transfer,
+// which skips the sender checks and fraud screening. then, if given, runs in the same database
+// transaction after the money has moved; an error from it undoes the transfer.
+func (s *transferService) transfer(fromAccountID, toAccountID int, amount float64, screen bool, then func(dbTx *repositories.Tx, tx *models.Transaction) error) (*models.Transaction, error) {
+    if amount <= 0 {
+        return nil, errors.New("amount must be positive")
+    }
+    if fromAccountID == toAccountID {
+        return nil, errors.New("cannot transfer to the same account")
+    }
     fromAcc, err := s.accountRepo.GetByID(fromAccountID)
     if err != nil {
         return nil, errors.New("from account not found")
     }
     if fromAcc.Balance < amount {
-        return nil, errors.New("insufficient funds")
+        return nil, ErrInsufficientFunds
     }
     toAcc, err := s.accountRepo.GetByID(toAccountID)
     if err != nil {
         return nil, errors.New("to account not found")
     }
+    // Statuses apply also when staff release a held transfer
+    if err := checkDebit(fromAcc); err != nil {
+        return nil, err
+    }
+    if err := checkCredit(toAcc); err != nil {
+        return nil, err
+    }
+    if err := s.limitService.Check(fromAcc, toAcc, amount); err != nil {
+        return nil, err
+    }
+    if screen {
+        sender, err := s.userRepo.GetByID(fromAcc.UserID)
+        if err != nil {
+            return nil, err
+        }
+        if sender.EmailVerifiedAt == nil {
+            return nil, ErrEmailNotVerified
+        }
+    }
+    if screen && fromAcc.UserID != toAcc.UserID {
+        if err := s.screen(fromAcc, toAcc, amount); err != nil {
+            return nil, err
+        }
+    }
 
-    // Perform debit and credit
-    newFromBalance := fromAcc.Balance - amount
-    newToBalance := toAcc.Balance + amount
-
-    if err := s.accountRepo.UpdateBalance(fromAccountID, newFromBalance); err != nil {
+    var tx *models.Transaction
+    err = s.store.InTx(func(dbTx *repositories.Tx) error {
+        // Locking all of the sender's accounts also serializes the sender's transfers for the limits
+        locked, err := dbTx.Accounts.GetForUpdate(fromAcc.UserID, fromAccountID, toAccountID)
+        if err != nil {
+            return err
+        }
+        // Checked again under the lock: the balance or a status may have changed meanwhile
+        if err := checkDebit(locked[fromAccountID]); err != nil {
+            return err
+        }
+        if err := checkCredit(locked[toAccountID]); err != nil {
+            return err
+        }
+        if err := s.limitService.CheckInTx(dbTx, locked[fromAccountID], locked[toAccountID], amount); err != nil {
+            return err
+        }
+        tx, err = s.move(dbTx, locked[fromAccountID], locked[toAccountID], amount, models.TxTransfer)
+        if err != nil || then == nil {
+            return err
+        }
+        return then(dbTx, tx)
+    })
+    if err != nil {
         return nil, err
     }
-    if err := s.accountRepo.UpdateBalance(toAccountID, newToBalance); err != nil {
+    return tx, nil
+}
+
+// Sweep moves the whole balance between two accounts of the same user when the first one is being
+// closed, as part of the closing transaction dbTx in which both accounts have been locked with
+// GetForUpdate. Limits and screening do not apply, but the source must be active.
+func (s *transferService) Sweep(dbTx *repositories.Tx, fromAcc, toAcc *models.Account) (*models.Transaction, error) {
+    if fromAcc.UserID != toAcc.UserID {
+        return nil, errors.New("funds can only be swept between accounts of the same user")
+    }
+    if fromAcc.Status != models.AccountActive {
+        return nil, &AccountStatusError{AccountID: fromAcc.ID, Status: fromAcc.Status}
+    }
+    if err := checkCredit(toAcc); err != nil {
         return nil, err
     }
+    if fromAcc.Balance <= 0 {
+        return nil, errors.New("nothing to sweep")
+    }
+    return s.move(dbTx, fromAcc, toAcc, fromAcc.Balance, models.TxAccountClosure)
+}
+
+// move debits fromAcc and credits toAcc, converting the amount if the currencies differ. Both
+// accounts must have been locked in dbTx with GetForUpdate.
+func (s *transferService) move(dbTx *repositories.Tx, fromAcc, toAcc *models.Account, amount float64, txType string) (*models.Transaction, error) {
+    if fromAcc.Balance < amount {
+        return nil, ErrInsufficientFunds
+    }
+    // Amount is always in the sender's currency; the recipient is credited in theirs.
+    toAmount := amount
+    rate := 1.0
+    spread := 0.0
+    if fromAcc.Currency != toAcc.Currency {
+        mid, err := crossRate(s.rateSource, fromAcc.Currency, toAcc.Currency, time.Now())
+        if err != nil {
+            return nil, err
+        }
+        spread = s.fxSpread
+        rate = mid * (1 - spread/100)
+        toAmount = roundMoney(amount * rate)
+    }
 
     tx := &models.Transaction{
-        FromAccountID: fromAccountID,
-        ToAccountID:   toAccountID,
+        FromAccountID: fromAcc.ID,
+        ToAccountID:   toAcc.ID,
         Amount:        amount,
-        Type:          "transfer",
+        Currency:      fromAcc.Currency,
+        ToAmount:      toAmount,
+        ToCurrency:    toAcc.Currency,
+        ExchangeRate:  rate,
+        FXSpread:      spread,
+        Type:          txType,
+    }
+    if _, err := dbTx.Accounts.AddToBalance(fromAcc.ID, -amount); err != nil {
+        return nil, err
+    }
+    if _, err := dbTx.Accounts.AddToBalance(toAcc.ID, toAmount); err != nil {
+        return nil, err
+    }
+    if err := dbTx.Transactions.Create(tx); err != nil {
+        return nil, err
     }
-    if err := s.transactionRepo.Create(tx); err != nil {
+    err := publish(dbTx.Outbox, EventTransferCompleted, TransferCompleted{
+        TransactionID: tx.ID,
+        Type:          txType,
+        FromAccountID: fromAcc.ID,
+        FromUserID:    fromAcc.UserID,
+        ToAccountID:   toAcc.ID,
+        ToUserID:      toAcc.UserID,
+        Amount:        amount,
+        Currency:      fromAcc.Currency,
+        ToAmount:      toAmount,
+        ToCurrency:    toAcc.Currency,
+        At:            tx.CreatedAt,
+    })
+    if err != nil {
         return nil, err
     }
     return tx, nil
 }
+
+func (s *transferService) screen(fromAcc, toAcc *models.Account, amount float64) error {
+    now := time.Now()
+    rate, err := s.rateSource.RubRate(fromAcc.Currency, now)
+    if err != nil {
+        return err
+    }
+    result, err := s.fraudEngine.Evaluate(fraud.Transfer{
+        UserID:        fromAcc.UserID,
+        FromAccountID: fromAcc.ID,
+        ToAccountID:   toAcc.ID,
+        ToUserID:      toAcc.UserID,
+        AmountRub:     roundMoney(amount * rate),
+        At:            now,
+    })
+    if err != nil {
+        return err
+    }
+
+    switch result.Decision {
+    case fraud.Block:
+        return ErrTransferBlocked
+    case fraud.Hold:
+        held := &models.HeldTransfer{
+            UserID:        fromAcc.UserID,
+            FromAccountID: fromAcc.ID,
+            ToAccountID:   toAcc.ID,
+            Amount:        amount,
+            Reasons:       result.Reasons,
+            Status:        models.HeldPending,
+        }
+        if err := s.heldRepo.Create(held); err != nil {
+            return err
+        }
+        return &TransferHeldError{HeldTransferID: held.ID}
+    }
+    return nil
+}
+
+// RequiresSecondFactor reports whether a transfer is large enough to need a TOTP code.
+// toAccountID is 0 when the recipient is given by phone, email or username.
+func (s *transferService) RequiresSecondFactor(fromAccountID, toAccountID int, amount float64) (bool, error) {
+    fromAcc, err := s.accountRepo.GetByID(fromAccountID)
+    if err != nil {
+        return false, errors.New("from account not found")
+    }
+    if toAccountID != 0 {
+        if toAcc, err := s.accountRepo.GetByID(toAccountID); err == nil && toAcc.UserID == fromAcc.UserID {
+            return false, nil
+        }
+    }
+    rate, err := s.rateSource.RubRate(fromAcc.Currency, time.Now())
+    if err != nil {
+        return false, err
+    }
+    return amount*rate >= SecondFactorThreshold, nil
+}
+
+func (s *transferService) ListHeld(status string) ([]models.HeldTransfer, error) {
+    if status == "" {
+        status = models.HeldPending
+    }
+    return s.heldRepo.GetByStatus(status)
+}
+
+// ApproveHeld executes a held transfer. Balance and limits are checked again at this point. The
+// transfer is claimed in the same database transaction that moves the money, so it cannot run twice.
+// then, if given, runs in that transaction too.
+func (s *transferService) ApproveHeld(id int, then func(dbTx *repositories.Tx, tx *models.Transaction) error) (*models.Transaction, error) {
+    held, err := s.pendingHeld(id)
+    if err != nil {
+        return nil, err
+    }
+    if held.ExternalTransferID != nil {
+        return s.releaseExternal(held, then)
+    }
+    return s.transfer(held.FromAccountID, held.ToAccountID, held.Amount, false, func(dbTx *repositories.Tx, tx *models.Transaction) error {
+        if err := decideHeld(dbTx, held.ID, models.HeldApproved, &tx.ID); err != nil || then == nil {
+            return err
+        }
+        return then(dbTx, tx)
+    })
+}
+
+// RejectHeld drops a held transfer; then, if given, runs in the same database transaction.
+func (s *transferService) RejectHeld(id int, then func(dbTx *repositories.Tx) error) error {
+    held, err := s.pendingHeld(id)
+    if err != nil {
+        return err
+    }
+    return s.store.InTx(func(dbTx *repositories.Tx) error {
+        if err := decideHeld(dbTx, held.ID, models.HeldRejected, nil); err != nil {
+            return err
+        }
+        if held.ExternalTransferID != nil {
+            t, err := dbTx.ExternalTransfers.GetByID(*held.ExternalTransferID)
+            if err != nil {
+                return err
+            }
+            if _, err := refundExternal(dbTx, t, "rejected after fraud review"); err != nil {
+                return err
+            }
+        }
+        if then == nil {
+            return nil
+        }
+        return then(dbTx)
+    })
+}
+
+// releaseExternal queues a held transfer to another bank for submission. The money was debited when
+// the transfer was made, so only the account status is checked again.
+func (s *transferService) releaseExternal(held *models.HeldTransfer, then func(dbTx *repositories.Tx, tx *models.Transaction) error) (*models.Transaction, error) {
+    var debit *models.Transaction
+    err := s.store.InTx(func(dbTx *repositories.Tx) error {
+        locked, err := dbTx.Accounts.GetForUpdate(0, held.FromAccountID)
+        if err != nil {
+            return err
+        }
+        if err := checkDebit(locked[held.FromAccountID]); err != nil {
+            return err
+        }
+        t, err := dbTx.ExternalTransfers.GetByID(*held.ExternalTransferID)
+        if err != nil {
+            return err
+        }
+        if err := decideHeld(dbTx, held.ID, models.HeldApproved, &t.TransactionID); err != nil {
+            return err
+        }
+        ok, err := dbTx.ExternalTransfers.Release(t.ID)
+        if err != nil {
+            return err
+        }
+        if !ok {
+            return errHeldDecided
+        }
+        if debit, err = dbTx.Transactions.GetByID(t.TransactionID); err != nil || then == nil {
+            return err
+        }
+        return then(dbTx, debit)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return debit, nil
+}
+
+func decideHeld(dbTx *repositories.Tx, id int, status string, transactionID *int) error {
+    ok, err := dbTx.HeldTransfers.Decide(id, status, transactionID)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return errHeldDecided
+    }
+    return nil
+}
+
+func (s *transferService) pendingHeld(id int) (*models.HeldTransfer, error) {
+    held, err := s.heldRepo.GetByID(id)
+    if err != nil {
+        return nil, err
+    }
+    if held.Status != models.HeldPending {
+        return nil, errHeldDecided
+    }
+    return held, nil
+}
+
+func (s *transferService) PreviewRecipient(recipient string) (*RecipientPreview, error) {
+    user, acc, err := s.resolveRecipient(recipient)
+    if err != nil {
+        return nil, err
+    }
+    return &RecipientPreview{Name: maskName(user), Currency: acc.Currency}, nil
+}
+
+func (s *transferService) TransferToRecipient(userID, fromAccountID int, recipient string, amount float64) (*models.Transaction, error) {
+    fromAcc, err := s.accountRepo.GetByID(fromAccountID)
+    if err != nil || fromAcc.UserID != userID {
+        return nil, errors.New("from account not found")
+    }
+    _, toAcc, err := s.resolveRecipient(recipient)
+    if err != nil {
+        return nil, err
+    }
+    return s.Transfer(fromAccountID, toAcc.ID, amount)
+}
+
+// resolveRecipient finds a user by email, phone number or username and returns their default account.
+// An account number resolves to that account.
+func (s *transferService) resolveRecipient(recipient string) (*models.User, *models.Account, error) {
+    recipient = strings.TrimSpace(recipient)
+    if recipient == "" {
+        return nil, nil, ErrRecipientNotFound
+    }
+    if utils.IsAccountNumber(recipient) {
+        acc, err := s.accountRepo.GetByNumber(recipient)
+        if err != nil || acc.Status == models.AccountClosed {
+            return nil, nil, ErrRecipientNotFound
+        }
+        user, err := s.userRepo.GetByID(acc.UserID)
+        if err != nil || user.ClosedAt != nil {
+            return nil, nil, ErrRecipientNotFound
+        }
+        return user, acc, nil
+    }
+
+    var user *models.User
+    var err error
+    if strings.Contains(recipient, "@") {
+        user, err = s.userRepo.GetByEmail(recipient)
+    } else if phone, phoneErr := utils.NormalizePhone(recipient); phoneErr == nil {
+        user, err = s.userRepo.GetByPhone(phone)
+    } else {
+        user, err = s.userRepo.GetByUsername(recipient)
+    }
+    if err != nil || user.ClosedAt != nil {
+        return nil, nil, ErrRecipientNotFound
+    }
+    if user.DefaultAccountID == nil {
+        return nil, nil, errors.New("recipient has no account to receive transfers")
+    }
+    acc, err := s.accountRepo.GetByID(*user.DefaultAccountID)
+    if err != nil {
+        return nil, nil, ErrRecipientNotFound
+    }
+    return user, acc, nil
+}
+
+// maskName turns "Ivan Petrov" into "Ivan P."; users without a full name are shown by the first
+// letter of their username.
+func maskName(user *models.User) string {
+    parts := strings.Fields(user.FullName)
+    if len(parts) == 0 {
+        r := []rune(user.Username)
+        if len(r) == 0 {
+            return "***"
+        }
+        return string(r[0]) + "***"
+    }
+    if len(parts) == 1 {
+        return parts[0]
+    }
+    return parts[0] + " " + string([]rune(parts[1])[0]) + "."
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+    "errors"
+    "math"
+    "strings"
+    "testing"
+    "time"
+
+    "banking_service_project/fraud"
+    "banking_service_project/models"
+)
+
+func TestCrossRate(t *testing.T) {
+    src := NewStaticRateSource(map[string]float64{"USD": 90, "EUR": 99})
+
+    tests := []struct {
+        from, to string
+        want     float64
+        wantErr  bool
+    }{
+        {from: "USD", to: "RUB", want: 90},
+        {from: "RUB", to: "USD", want: 1.0 / 90},
+        {from: "EUR", to: "USD", want: 1.1},
+        {from: "RUB", to: "RUB", want: 1},
+        {from: "GBP", to: "RUB", wantErr: true},
+        {from: "RUB", to: "GBP", wantErr: true},
+    }
+    for _, tt := range tests {
+        got, err := crossRate(src, tt.from, tt.to, time.Now())
+        if tt.wantErr {
+            if err == nil {
+                t.Errorf("%s->%s: expected an error for a currency without a rate", tt.from, tt.to)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s->%s: %v", tt.from, tt.to, err)
+        } else if math.Abs(got-tt.want) > 1e-9 {
+            t.Errorf("%s->%s = %v, want %v", tt.from, tt.to, got, tt.want)
+        }
+    }
+}
+
+func TestTransferConversion(t *testing.T) {
+    tests := []struct {
+        name         string
+        fromCurrency string
+        toCurrency   string
+        amount       float64
+        wantToAmount float64
+        wantRate     float64
+        wantSpread   float64
+    }{
+        {"same currency", "RUB", "RUB", 300, 300, 1, 0},
+        {"to rubles", "USD", "RUB", 100, 8910, 89.1, 1},
+        {"from rubles", "RUB", "USD", 9000, 99, 0.011, 1},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            accounts := &fakeAccountRepo{accounts: map[int]*models.Account{
+                1: {ID: 1, UserID: 10, Balance: 10000, Currency: tt.fromCurrency, Status: models.AccountActive},
+                2: {ID: 2, UserID: 20, Balance: 0, Currency: tt.toCurrency, Status: models.AccountActive},
+            }}
+            transactions := &fakeTransactionRepo{}
+            store := newFakeStore(accounts, transactions)
+            s := NewTransferService(accounts, verifiedUsers(10, 20), nil, noLimits{}, fraud.NewEngine(), NewStaticRateSource(map[string]float64{"USD": 90}), store, 1)
+
+            tx, err := s.Transfer(1, 2, tt.amount)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if tx.Amount != tt.amount || tx.Currency != tt.fromCurrency || tx.ToAmount != tt.wantToAmount || tx.ToCurrency != tt.toCurrency {
+                t.Errorf("legs = %v %s -> %v %s, want %v %s -> %v %s", tx.Amount, tx.Currency, tx.ToAmount, tx.ToCurrency,
+                    tt.amount, tt.fromCurrency, tt.wantToAmount, tt.toCurrency)
+            }
+            if math.Abs(tx.ExchangeRate-tt.wantRate) > 1e-9 || tx.FXSpread != tt.wantSpread {
+                t.Errorf("rate = %v, spread = %v, want %v and %v", tx.ExchangeRate, tx.FXSpread, tt.wantRate, tt.wantSpread)
+            }
+            if accounts.accounts[1].Balance != 10000-tt.amount || accounts.accounts[2].Balance != tt.wantToAmount {
+                t.Errorf("balances = %v and %v", accounts.accounts[1].Balance, accounts.accounts[2].Balance)
+            }
+            if len(transactions.created) != 1 {
+                t.Errorf("recorded %d transactions, want 1", len(transactions.created))
+            }
+            events := store.outbox().events
+            if len(events) != 1 || events[0].Type != EventTransferCompleted {
+                t.Fatalf("events = %v, want one %s", events, EventTransferCompleted)
+            }
+            // Both users' webhooks receive the event
+            if strings.Contains(string(events[0].Payload), "balance") {
+                t.Errorf("event payload exposes a balance: %s", events[0].Payload)
+            }
+        })
+    }
+}
+
+func TestTransferFailsWithoutRate(t *testing.T) {
+    accounts := &fakeAccountRepo{accounts: map[int]*models.Account{
+        1: {ID: 1, UserID: 10, Balance: 100, Currency: "GBP", Status: models.AccountActive},
+        2: {ID: 2, UserID: 20, Currency: "RUB", Status: models.AccountActive},
+    }}
+    s := NewTransferService(accounts, verifiedUsers(10, 20), nil, noLimits{}, fraud.NewEngine(), NewStaticRateSource(nil), newFakeStore(accounts, &fakeTransactionRepo{}), 1)
+
+    if _, err := s.Transfer(1, 2, 50); err == nil {
+        t.Fatal("expected an error without a GBP rate")
+    }
+    if accounts.accounts[1].Balance != 100 || accounts.accounts[2].Balance != 0 {
+        t.Error("a failed conversion must not move money")
+    }
+}
+
+func TestResolveRecipient(t *testing.T) {
+    defaultAccount := 5
+    users := &fakeUserRepo{users: map[int]*models.User{
+        1: {ID: 1, Username: "ivan", Email: "ivan@example.com", Phone: "+79123456789", FullName: "Иван Петров", DefaultAccountID: &defaultAccount},
+        2: {ID: 2, Username: "noacc", Email: "noacc@example.com"},
+    }}
+    accounts := &fakeAccountRepo{accounts: map[int]*models.Account{5: {ID: 5, UserID: 1, Currency: "USD", Status: models.AccountActive}}}
+    s := NewTransferService(accounts, users, nil, noLimits{}, fraud.NewEngine(), NewStaticRateSource(nil), newFakeStore(accounts, &fakeTransactionRepo{}), 1)
+
+    tests := []struct {
+        recipient string
+        wantName  string
+        wantErr   bool
+    }{
+        {recipient: "ivan@example.com", wantName: "Иван П."},
+        {recipient: "8 (912) 345-67-89", wantName: "Иван П."},
+        {recipient: " ivan ", wantName: "Иван П."},
+        {recipient: "petr", wantErr: true},
+        {recipient: "noacc", wantErr: true},
+        {recipient: "", wantErr: true},
+    }
+    for _, tt := range tests {
+        preview, err := s.PreviewRecipient(tt.recipient)
+        if tt.wantErr {
+            if err == nil {
+                t.Errorf("%q: expected an error", tt.recipient)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%q: %v", tt.recipient, err)
+        } else if preview.Name != tt.wantName || preview.Currency != "USD" {
+            t.Errorf("%q = %+v, want %s in USD", tt.recipient, preview, tt.wantName)
+        }
+    }
+}
+
+func TestMaskName(t *testing.T) {
+    tests := []struct {
+        user models.User
+        want string
+    }{
+        {models.User{FullName: "Ivan Petrov", Username: "ivan"}, "Ivan P."},
+        {models.User{FullName: "Анна Мария Смирнова"}, "Анна М."},
+        {models.User{FullName: "Cher"}, "Cher"},
+        {models.User{Username: "оля"}, "о***"},
+        {models.User{}, "***"},
+    }
+    for _, tt := range tests {
+        if got := maskName(&tt.user); got != tt.want {
+            t.Errorf("maskName(%+v) = %q, want %q", tt.user, got, tt.want)
+        }
+    }
+}
+
+func TestTransferRequiresVerifiedEmail(t *testing.T) {
+    accounts := &fakeAccountRepo{accounts: map[int]*models.Account{
+        1: {ID: 1, UserID: 10, Balance: 100, Currency: "RUB", Status: models.AccountActive},
+        2: {ID: 2, UserID: 20, Currency: "RUB", Status: models.AccountActive},
+    }}
+    users := &fakeUserRepo{users: map[int]*models.User{10: {ID: 10}, 20: {ID: 20}}}
+    s := NewTransferService(accounts, users, nil, noLimits{}, fraud.NewEngine(), NewStaticRateSource(nil), newFakeStore(accounts, &fakeTransactionRepo{}), 1)
+
+    if _, err := s.Transfer(1, 2, 50); err != ErrEmailNotVerified {
+        t.Fatalf("err = %v, want ErrEmailNotVerified", err)
+    }
+    if accounts.accounts[1].Balance != 100 {
+        t.Error("an unverified sender must not move money")
+    }
+}
+
+func TestTransferAccountStatuses(t *testing.T) {
+    tests := []struct {
+        from, to string
+        wantErr  bool
+    }{
+        {models.AccountActive, models.AccountActive, false},
+        {models.AccountActive, models.AccountDebitBlocked, false},
+        {models.AccountDebitBlocked, models.AccountActive, true},
+        {models.AccountFrozen, models.AccountActive, true},
+        {models.AccountActive, models.AccountFrozen, true},
+        {models.AccountActive, models.AccountClosed, true},
+    }
+    for _, tt := range tests {
+        accounts := &fakeAccountRepo{accounts: map[int]*models.Account{
+            1: {ID: 1, UserID: 10, Balance: 100, Currency: "RUB", Status: tt.from},
+            2: {ID: 2, UserID: 20, Currency: "RUB", Status: tt.to},
+        }}
+        s := NewTransferService(accounts, verifiedUsers(10, 20), nil, noLimits{}, fraud.NewEngine(), NewStaticRateSource(nil), newFakeStore(accounts, &fakeTransactionRepo{}), 1)
+
+        _, err := s.Transfer(1, 2, 50)
+        var statusErr *AccountStatusError
+        if tt.wantErr && !errors.As(err, &statusErr) {
+            t.Errorf("%s -> %s: err = %v, want an account status error", tt.from, tt.to, err)
+        }
+        if !tt.wantErr && err != nil {
+            t.Errorf("%s -> %s: %v", tt.from, tt.to, err)
+        }
+    }
+}
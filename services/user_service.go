@@ -0,0 +1,232 @@
+package services
+
+import (
+    "errors"
+    "log"
+    "strings"
+
+    "golang.org/x/crypto/bcrypt"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+    "banking_service_project/utils"
+)
+
+var (
+    ErrUnsupportedLanguage = errors.New("unsupported language")
+    ErrSamePassword        = errors.New("new password must differ from the current one")
+    ErrNonZeroBalance      = errors.New("all accounts must have a zero balance before closing the profile")
+    ErrOpenCredits         = errors.New("all credits must be repaid before closing the profile")
+)
+
+var supportedLanguages = map[string]bool{"ru": true, "en": true}
+
+// ProfileUpdate lists the fields to change; nil fields keep their value.
+type ProfileUpdate struct {
+    Username          *string `json:"username"`
+    Email             *string `json:"email"`
+    Phone             *string `json:"phone"`
+    FullName          *string `json:"full_name"`
+    PreferredLanguage *string `json:"preferred_language"`
+}
+
+type UserService interface {
+    GetProfile(userID int) (*models.User, error)
+    UpdateProfile(userID int, update ProfileUpdate) (*models.User, error)
+    ChangePassword(userID int, sessionID, currentPassword, newPassword string) error
+    CloseProfile(userID int, password string) error
+}
+
+type userService struct {
+    userRepo            repositories.UserRepository
+    tokenRepo           repositories.TokenRepository
+    store               repositories.Store
+    authService         AuthService
+    notificationService NotificationService
+    passwordPolicy      *PasswordPolicy
+}
+
+func NewUserService(userRepo repositories.UserRepository, tokenRepo repositories.TokenRepository, store repositories.Store, authService AuthService, notificationService NotificationService, passwordPolicy *PasswordPolicy) UserService {
+    return &userService{
+        userRepo:            userRepo,
+        tokenRepo:           tokenRepo,
+        store:               store,
+        authService:         authService,
+        notificationService: notificationService,
+        passwordPolicy:      passwordPolicy,
+    }
+}
+
+func (s *userService) GetProfile(userID int) (*models.User, error) {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    if user.ClosedAt != nil {
+        return nil, ErrUserClosed
+    }
+    return user, nil
+}
+
+// UpdateProfile applies the given fields. A new email has to be confirmed again: it is marked
+// unverified and a verification link is sent to it.
+func (s *userService) UpdateProfile(userID int, update ProfileUpdate) (*models.User, error) {
+    user, err := s.GetProfile(userID)
+    if err != nil {
+        return nil, err
+    }
+
+    if update.Username != nil {
+        username := strings.TrimSpace(*update.Username)
+        if username == "" {
+            return nil, errors.New("username must not be empty")
+        }
+        if username != user.Username {
+            if _, err := s.userRepo.GetByUsername(username); err == nil {
+                return nil, errors.New("username already in use")
+            }
+            user.Username = username
+        }
+    }
+
+    emailChanged := false
+    if update.Email != nil {
+        email := strings.TrimSpace(*update.Email)
+        if !strings.Contains(email, "@") {
+            return nil, errors.New("invalid email")
+        }
+        if !strings.EqualFold(email, user.Email) {
+            if _, err := s.userRepo.GetByEmail(email); err == nil {
+                return nil, errors.New("email already in use")
+            }
+            user.Email = email
+            user.EmailVerifiedAt = nil
+            emailChanged = true
+        }
+    }
+
+    if update.Phone != nil {
+        phone := strings.TrimSpace(*update.Phone)
+        if phone != "" {
+            normalized, err := utils.NormalizePhone(phone)
+            if err != nil {
+                return nil, err
+            }
+            phone = normalized
+        }
+        if phone != "" && phone != user.Phone {
+            if _, err := s.userRepo.GetByPhone(phone); err == nil {
+                return nil, errors.New("phone already in use")
+            }
+        }
+        user.Phone = phone
+    }
+
+    if update.FullName != nil {
+        user.FullName = strings.TrimSpace(*update.FullName)
+    }
+
+    if update.PreferredLanguage != nil {
+        lang := strings.ToLower(strings.TrimSpace(*update.PreferredLanguage))
+        if !supportedLanguages[lang] {
+            return nil, ErrUnsupportedLanguage
+        }
+        user.PreferredLanguage = lang
+    }
+
+    if err := s.userRepo.UpdateProfile(user); err != nil {
+        return nil, err
+    }
+    if emailChanged {
+        if err := s.authService.SendVerificationEmail(user.ID); err != nil {
+            log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+        }
+    }
+    return user, nil
+}
+
+// ChangePassword sets a new password after checking the current one. Other sessions are logged out;
+// the session that made the change stays signed in.
+func (s *userService) ChangePassword(userID int, sessionID, currentPassword, newPassword string) error {
+    user, err := s.GetProfile(userID)
+    if err != nil {
+        return err
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+        return ErrInvalidCredentials
+    }
+    if currentPassword == newPassword {
+        return ErrSamePassword
+    }
+    if err := s.passwordPolicy.Validate(newPassword, user.Username, user.Email); err != nil {
+        return err
+    }
+    hashedPass, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+    if err != nil {
+        return err
+    }
+    if err := s.userRepo.UpdatePassword(user.ID, string(hashedPass)); err != nil {
+        return err
+    }
+    if err := s.tokenRepo.RevokeOtherSessions(user.ID, sessionID); err != nil {
+        return err
+    }
+
+    if err := s.notificationService.Notify(user.ID, TemplatePasswordChanged, nil); err != nil {
+        log.Printf("Failed to send password change notification to user %d: %v", user.ID, err)
+    }
+    return nil
+}
+
+// CloseProfile closes the user's profile for good. It is refused while any account holds money or
+// owes it, a credit still has unpaid payments or a transfer to another bank is in progress. The
+// accounts are closed with the profile, and all sessions are revoked.
+func (s *userService) CloseProfile(userID int, password string) error {
+    user, err := s.GetProfile(userID)
+    if err != nil {
+        return err
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+        return ErrInvalidCredentials
+    }
+
+    // Locking every account of the user keeps money from arriving or leaving between the checks
+    // and the closure.
+    return s.store.InTx(func(tx *repositories.Tx) error {
+        accounts, err := tx.Accounts.GetForUpdate(userID)
+        if err != nil {
+            return err
+        }
+        for _, acc := range accounts {
+            if acc.Balance != 0 {
+                return ErrNonZeroBalance
+            }
+            openTransfers, err := tx.ExternalTransfers.CountOpenByAccount(acc.ID)
+            if err != nil {
+                return err
+            }
+            if openTransfers > 0 {
+                return ErrAccountHasTransfers
+            }
+        }
+        openCredits, err := tx.Credits.CountOpenByUser(userID)
+        if err != nil {
+            return err
+        }
+        if openCredits > 0 {
+            return ErrOpenCredits
+        }
+        for _, acc := range accounts {
+            if acc.Status == models.AccountClosed {
+                continue
+            }
+            if err := tx.Accounts.SetStatus(acc.ID, models.AccountClosed, "profile closed by the customer", userID); err != nil {
+                return err
+            }
+        }
+        if err := tx.Users.Close(userID); err != nil {
+            return err
+        }
+        return tx.Tokens.RevokeUserTokens(userID)
+    })
+}
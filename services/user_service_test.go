@@ -0,0 +1,90 @@
+package services
+
+import (
+    "errors"
+    "testing"
+
+    "golang.org/x/crypto/bcrypt"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+func TestCloseProfile(t *testing.T) {
+    hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name        string
+        balance     float64
+        openCredits int
+        transfer    string
+        wantErr     error
+    }{
+        {name: "empty accounts"},
+        {name: "money left", balance: 0.01, wantErr: ErrNonZeroBalance},
+        {name: "debt", balance: -5, wantErr: ErrNonZeroBalance},
+        {name: "unpaid credit", openCredits: 1, wantErr: ErrOpenCredits},
+        {name: "transfer to another bank in progress", transfer: models.ExternalSubmitted, wantErr: ErrAccountHasTransfers},
+        {name: "settled transfer", transfer: models.ExternalSettled},
+    }
+    for _, tt := range tests {
+        accounts := &fakeAccountRepo{accounts: map[int]*models.Account{
+            1: {ID: 1, UserID: 7, Currency: "RUB", Status: models.AccountActive},
+            2: {ID: 2, UserID: 7, Currency: "USD", Balance: tt.balance, Status: models.AccountActive},
+            3: {ID: 3, UserID: 8, Currency: "RUB", Status: models.AccountActive},
+        }}
+        users := &fakeUserRepo{users: map[int]*models.User{7: {ID: 7, Password: string(hash)}}}
+        tokens := &fakeTokenRepo{}
+        external := &fakeExternalRepo{}
+        if tt.transfer != "" {
+            external.Create(&models.ExternalTransfer{FromAccountID: 1, Status: tt.transfer})
+        }
+        store := &fakeStore{tx: &repositories.Tx{
+            Accounts:          accounts,
+            Users:             users,
+            Tokens:            tokens,
+            Credits:           &fakeCreditRepo{openByUser: map[int]int{7: tt.openCredits}},
+            ExternalTransfers: external,
+        }}
+        s := NewUserService(users, tokens, store, nil, nil, nil)
+
+        err := s.CloseProfile(7, "correct horse")
+        if !errors.Is(err, tt.wantErr) {
+            t.Errorf("%s: got %v, want %v", tt.name, err, tt.wantErr)
+            continue
+        }
+        wantStatus := models.AccountClosed
+        if tt.wantErr != nil {
+            wantStatus = models.AccountActive
+        }
+        for _, id := range []int{1, 2} {
+            if got := accounts.accounts[id].Status; got != wantStatus {
+                t.Errorf("%s: account %d is %s, want %s", tt.name, id, got, wantStatus)
+            }
+        }
+        if accounts.accounts[3].Status != models.AccountActive {
+            t.Errorf("%s: another user's account was closed", tt.name)
+        }
+        if closed := users.users[7].ClosedAt != nil; closed != (tt.wantErr == nil) {
+            t.Errorf("%s: profile closed = %v", tt.name, closed)
+        }
+        if revoked := len(tokens.revokedUsers) > 0; revoked != (tt.wantErr == nil) {
+            t.Errorf("%s: sessions revoked = %v", tt.name, revoked)
+        }
+    }
+}
+
+func TestCloseProfileChecksPassword(t *testing.T) {
+    hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+    if err != nil {
+        t.Fatal(err)
+    }
+    users := &fakeUserRepo{users: map[int]*models.User{7: {ID: 7, Password: string(hash)}}}
+    s := NewUserService(users, &fakeTokenRepo{}, &fakeStore{tx: &repositories.Tx{}}, nil, nil, nil)
+    if err := s.CloseProfile(7, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+        t.Fatalf("got %v, want ErrInvalidCredentials", err)
+    }
+}
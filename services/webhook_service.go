@@ -0,0 +1,368 @@
+package services
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "syscall"
+    "time"
+
+    "banking_service_project/models"
+    "banking_service_project/repositories"
+)
+
+const (
+    maxWebhooksPerUser     = 10
+    maxWebhookAttempts     = 8
+    webhookBatchSize       = 50
+    webhookTimeout         = 10 * time.Second
+    webhookDisableAfter    = 24 * time.Hour
+    webhookSignatureHeader = "X-Webhook-Signature"
+    webhookTimestampHeader = "X-Webhook-Timestamp"
+)
+
+// WebhookEventTypes are the events customers can subscribe to.
+var WebhookEventTypes = []string{
+    EventTransferCompleted,
+    EventCreditApproved,
+    EventInstallmentPaid,
+    EventPaymentOverdue,
+    EventCardIssued,
+    EventExternalTransferSettled,
+    EventExternalTransferReturned,
+    EventInterestPosted,
+}
+
+var ErrInvalidWebhookURL = errors.New("webhook URL must be an absolute https URL")
+
+// WebhookService lets customers receive events about their accounts at their own URLs. It
+// subscribes to the EventDispatcher and queues a delivery per matching endpoint; a worker sends
+// them signed with the endpoint's secret, retrying with a growing delay. An endpoint that has not
+// accepted a single request for webhookDisableAfter is disabled until the customer enables it.
+type WebhookService interface {
+    CreateEndpoint(userID int, rawURL string, eventTypes []string) (*models.WebhookEndpoint, error)
+    ListEndpoints(userID int) ([]models.WebhookEndpoint, error)
+    DeleteEndpoint(userID, id int) error
+    EnableEndpoint(userID, id int) (*models.WebhookEndpoint, error)
+    ListDeliveries(userID, endpointID, limit int) ([]models.WebhookDelivery, error)
+    GetDelivery(userID, endpointID, deliveryID int) (*models.WebhookDelivery, []models.WebhookAttempt, error)
+    Redeliver(userID, endpointID, deliveryID int) error
+    HandleEvent(event models.OutboxEvent) error
+    Send(now time.Time)
+    StartWorker(interval time.Duration)
+}
+
+type webhookService struct {
+    webhookRepo     repositories.WebhookRepository
+    externalService ExternalService
+    client          *http.Client
+    allowInsecure   bool
+}
+
+// NewWebhookService creates the service. allowInsecure permits plain http and private or loopback
+// addresses, which is only meant for development.
+func NewWebhookService(webhookRepo repositories.WebhookRepository, externalService ExternalService, allowInsecure bool) WebhookService {
+    dialer := &net.Dialer{Timeout: webhookTimeout}
+    if !allowInsecure {
+        dialer.Control = refusePrivateAddress
+    }
+    client := &http.Client{
+        Timeout:   webhookTimeout,
+        Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: webhookTimeout},
+        // A redirect is treated as a failure rather than followed to a URL nobody checked
+        CheckRedirect: func(*http.Request, []*http.Request) error {
+            return http.ErrUseLastResponse
+        },
+    }
+    return &webhookService{webhookRepo: webhookRepo, externalService: externalService, client: client, allowInsecure: allowInsecure}
+}
+
+func (s *webhookService) CreateEndpoint(userID int, rawURL string, eventTypes []string) (*models.WebhookEndpoint, error) {
+    u, err := url.Parse(rawURL)
+    if err != nil || u.Host == "" || u.User != nil || !(u.Scheme == "https" || s.allowInsecure && u.Scheme == "http") {
+        return nil, ErrInvalidWebhookURL
+    }
+    if len(eventTypes) == 0 {
+        return nil, errors.New("at least one event type is required")
+    }
+    seen := make(map[string]bool)
+    var types []string
+    for _, t := range eventTypes {
+        if !isWebhookEventType(t) {
+            return nil, fmt.Errorf("unknown event type %q", t)
+        }
+        if !seen[t] {
+            seen[t] = true
+            types = append(types, t)
+        }
+    }
+    existing, err := s.webhookRepo.GetEndpointsByUser(userID)
+    if err != nil {
+        return nil, err
+    }
+    if len(existing) >= maxWebhooksPerUser {
+        return nil, fmt.Errorf("at most %d webhooks can be registered", maxWebhooksPerUser)
+    }
+    secret, err := randomToken(32)
+    if err != nil {
+        return nil, err
+    }
+    endpoint := &models.WebhookEndpoint{UserID: userID, URL: u.String(), EventTypes: types, Secret: secret}
+    if err := s.webhookRepo.CreateEndpoint(endpoint); err != nil {
+        return nil, err
+    }
+    return endpoint, nil
+}
+
+func (s *webhookService) ListEndpoints(userID int) ([]models.WebhookEndpoint, error) {
+    endpoints, err := s.webhookRepo.GetEndpointsByUser(userID)
+    if err != nil {
+        return nil, err
+    }
+    for i := range endpoints {
+        endpoints[i].Secret = ""
+    }
+    return endpoints, nil
+}
+
+func (s *webhookService) DeleteEndpoint(userID, id int) error {
+    if _, err := s.endpoint(userID, id); err != nil {
+        return err
+    }
+    return s.webhookRepo.DeleteEndpoint(id)
+}
+
+// EnableEndpoint turns a disabled endpoint back on; deliveries still pending for it are resumed.
+func (s *webhookService) EnableEndpoint(userID, id int) (*models.WebhookEndpoint, error) {
+    if _, err := s.endpoint(userID, id); err != nil {
+        return nil, err
+    }
+    if err := s.webhookRepo.Enable(id); err != nil {
+        return nil, err
+    }
+    return s.endpoint(userID, id)
+}
+
+func (s *webhookService) ListDeliveries(userID, endpointID, limit int) ([]models.WebhookDelivery, error) {
+    if _, err := s.endpoint(userID, endpointID); err != nil {
+        return nil, err
+    }
+    return s.webhookRepo.GetDeliveriesByEndpoint(endpointID, limit)
+}
+
+func (s *webhookService) GetDelivery(userID, endpointID, deliveryID int) (*models.WebhookDelivery, []models.WebhookAttempt, error) {
+    d, err := s.delivery(userID, endpointID, deliveryID)
+    if err != nil {
+        return nil, nil, err
+    }
+    attempts, err := s.webhookRepo.GetAttempts(d.ID)
+    if err != nil {
+        return nil, nil, err
+    }
+    return d, attempts, nil
+}
+
+func (s *webhookService) Redeliver(userID, endpointID, deliveryID int) error {
+    if _, err := s.delivery(userID, endpointID, deliveryID); err != nil {
+        return err
+    }
+    return s.webhookRepo.Redeliver(deliveryID, time.Now())
+}
+
+// HandleEvent queues the event for the endpoints of every customer it concerns.
+func (s *webhookService) HandleEvent(event models.OutboxEvent) error {
+    var owners struct {
+        UserID     int `json:"user_id"`
+        FromUserID int `json:"from_user_id"`
+        ToUserID   int `json:"to_user_id"`
+    }
+    if err := json.Unmarshal(event.Payload, &owners); err != nil {
+        return err
+    }
+    seen := make(map[int]bool)
+    for _, userID := range []int{owners.UserID, owners.FromUserID, owners.ToUserID} {
+        if userID == 0 || seen[userID] {
+            continue
+        }
+        seen[userID] = true
+        endpoints, err := s.webhookRepo.GetSubscribedEndpoints(userID, event.Type)
+        if err != nil {
+            return err
+        }
+        for _, e := range endpoints {
+            d := &models.WebhookDelivery{EndpointID: e.ID, EventID: event.ID, EventType: event.Type, Payload: event.Payload}
+            if err := s.webhookRepo.CreateDelivery(d); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// Send makes one attempt for every delivery that is due.
+func (s *webhookService) Send(now time.Time) {
+    deliveries, err := s.webhookRepo.GetDueDeliveries(now, webhookBatchSize)
+    if err != nil {
+        log.Printf("Failed to load webhook deliveries: %v", err)
+        return
+    }
+    endpoints := make(map[int]*models.WebhookEndpoint)
+    for i := range deliveries {
+        d := &deliveries[i]
+        e, ok := endpoints[d.EndpointID]
+        if !ok {
+            if e, err = s.webhookRepo.GetEndpoint(d.EndpointID); err != nil {
+                log.Printf("Failed to load webhook %d: %v", d.EndpointID, err)
+                continue
+            }
+            endpoints[d.EndpointID] = e
+        }
+        if !e.Active {
+            continue
+        }
+        s.attempt(e, d, now)
+    }
+}
+
+func (s *webhookService) StartWorker(interval time.Duration) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for now := range ticker.C {
+            s.Send(now)
+        }
+    }()
+}
+
+func (s *webhookService) attempt(e *models.WebhookEndpoint, d *models.WebhookDelivery, now time.Time) {
+    started := time.Now()
+    code, err := s.post(e, d)
+    attempt := &models.WebhookAttempt{DeliveryID: d.ID, DurationMS: int(time.Since(started) / time.Millisecond), AttemptedAt: started}
+    if code != 0 {
+        attempt.ResponseCode = &code
+    }
+    if err != nil {
+        attempt.Error = err.Error()
+    }
+    if err := s.webhookRepo.AddAttempt(attempt); err != nil {
+        log.Printf("Failed to record attempt of webhook delivery %d: %v", d.ID, err)
+    }
+
+    attempts := d.Attempts + 1
+    if err == nil {
+        if err := s.webhookRepo.MarkDelivered(d.ID, attempts, code, now); err != nil {
+            log.Printf("Failed to mark webhook delivery %d as delivered: %v", d.ID, err)
+        }
+        if e.FailingSince != nil {
+            if err := s.webhookRepo.ClearFailing(e.ID); err != nil {
+                log.Printf("Failed to reset webhook %d: %v", e.ID, err)
+            }
+            e.FailingSince = nil
+        }
+        return
+    }
+
+    if err := s.webhookRepo.RecordFailure(d.ID, attempts, attempt.ResponseCode, attempt.Error, now.Add(time.Minute<<uint(attempts-1)), attempts >= maxWebhookAttempts); err != nil {
+        log.Printf("Failed to record failure of webhook delivery %d: %v", d.ID, err)
+    }
+    since, ferr := s.webhookRepo.MarkFailing(e.ID, now)
+    if ferr != nil {
+        log.Printf("Failed to record failure of webhook %d: %v", e.ID, ferr)
+        return
+    }
+    e.FailingSince = &since
+    if now.Sub(since) >= webhookDisableAfter {
+        reason := fmt.Sprintf("no successful delivery since %s; last error: %s", since.UTC().Format(time.RFC3339), attempt.Error)
+        if err := s.webhookRepo.Disable(e.ID, reason); err != nil {
+            log.Printf("Failed to disable webhook %d: %v", e.ID, err)
+            return
+        }
+        e.Active = false
+        log.Printf("Disabled webhook %d of user %d: %s", e.ID, e.UserID, reason)
+    }
+}
+
+// post sends the delivery and returns the response status; any status other than 2xx is an error.
+// The signature is HMAC-SHA256 over "<timestamp>.<body>" with the endpoint's secret.
+func (s *webhookService) post(e *models.WebhookEndpoint, d *models.WebhookDelivery) (int, error) {
+    body, err := json.Marshal(struct {
+        ID   int             `json:"id"` // event ID, the same for every redelivery
+        Type string          `json:"type"`
+        Data json.RawMessage `json:"data"`
+    }{d.EventID, d.EventType, d.Payload})
+    if err != nil {
+        return 0, err
+    }
+    timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+    req, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(body))
+    if err != nil {
+        return 0, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Webhook-Id", strconv.Itoa(d.ID))
+    req.Header.Set("X-Webhook-Event", d.EventType)
+    req.Header.Set(webhookTimestampHeader, timestamp)
+    req.Header.Set(webhookSignatureHeader, "sha256="+s.externalService.ComputeHMAC(timestamp+"."+string(body), e.Secret))
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+    }
+    return resp.StatusCode, nil
+}
+
+func (s *webhookService) endpoint(userID, id int) (*models.WebhookEndpoint, error) {
+    e, err := s.webhookRepo.GetEndpoint(id)
+    if err != nil || e.UserID != userID {
+        return nil, errors.New("webhook not found")
+    }
+    e.Secret = ""
+    return e, nil
+}
+
+func (s *webhookService) delivery(userID, endpointID, deliveryID int) (*models.WebhookDelivery, error) {
+    if _, err := s.endpoint(userID, endpointID); err != nil {
+        return nil, err
+    }
+    d, err := s.webhookRepo.GetDelivery(deliveryID)
+    if err != nil || d.EndpointID != endpointID {
+        return nil, errors.New("delivery not found")
+    }
+    return d, nil
+}
+
+func isWebhookEventType(t string) bool {
+    for _, known := range WebhookEventTypes {
+        if t == known {
+            return true
+        }
+    }
+    return false
+}
+
+// refusePrivateAddress keeps webhooks from reaching the bank's own network. It runs on the resolved
+// address, so a public host name pointing at a private address is refused too.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return err
+    }
+    ip := net.ParseIP(host)
+    if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+        ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+        return fmt.Errorf("address %s is not allowed", host)
+    }
+    return nil
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "math/big"
+    "strings"
+)
+
+// Account numbers follow the Russian chart of accounts:
+//
+//     40817 810 K 0000 1234567
+//     ^     ^   ^ ^    ^
+//     |     |   | |    personal account
+//     |     |   | branch
+//     |     |   control key
+//     |     currency (810 for rubles, ISO 4217 numeric code otherwise)
+//     balance account
+const AccountNumberLength = 20
+
+const accountBranch = "0000"
+
+var accountKeyWeights = [3]int{7, 1, 3}
+
+// accountCurrencyCodes maps ISO 4217 codes to the numeric codes used in account numbers.
+var accountCurrencyCodes = map[string]string{
+    "RUB": "810",
+    "USD": "840",
+    "EUR": "978",
+    "CNY": "156",
+    "GBP": "826",
+    "CHF": "756",
+    "JPY": "392",
+    "KZT": "398",
+    "BYN": "933",
+    "AMD": "051",
+    "TRY": "949",
+    "AED": "784",
+    "HKD": "344",
+    "INR": "356",
+}
+
+// GenerateAccountNumber returns a random account number in balanceAccount and currency with the
+// control key computed for the bank's BIC.
+func GenerateAccountNumber(balanceAccount, currency, bic string) (string, error) {
+    if len(balanceAccount) != 5 || !allDigits(balanceAccount) {
+        return "", errors.New("balance account must be 5 digits")
+    }
+    code, ok := AccountCurrencyCode(currency)
+    if !ok {
+        return "", fmt.Errorf("no account currency code for %s", currency)
+    }
+    personal, err := rand.Int(rand.Reader, big.NewInt(10000000))
+    if err != nil {
+        return "", err
+    }
+    number := fmt.Sprintf("%s%s0%s%07d", balanceAccount, code, accountBranch, personal.Int64())
+    key, err := accountKey(number, bic)
+    if err != nil {
+        return "", err
+    }
+    return number[:8] + string(rune('0'+key)) + number[9:], nil
+}
+
+// AccountCurrencyCode returns the numeric code a currency has in account numbers.
+func AccountCurrencyCode(currency string) (string, bool) {
+    code, ok := accountCurrencyCodes[strings.ToUpper(currency)]
+    return code, ok
+}
+
+// IsAccountNumber reports whether s looks like an account number, without checking the key.
+func IsAccountNumber(s string) bool {
+    return len(s) == AccountNumberLength && allDigits(s)
+}
+
+// ValidBIC checks the form of a bank identification code: 9 digits starting with 04 for Russia.
+func ValidBIC(bic string) bool {
+    return len(bic) == 9 && allDigits(bic) && strings.HasPrefix(bic, "04")
+}
+
+// ValidAccountNumber checks the control key of an account number held at the bank with the given BIC.
+func ValidAccountNumber(number, bic string) bool {
+    if !IsAccountNumber(number) {
+        return false
+    }
+    sum, err := accountKeySum(number, bic)
+    return err == nil && sum%10 == 0
+}
+
+// accountKey computes the control key: the number is checksummed with a zero in the key position.
+func accountKey(number, bic string) (int, error) {
+    sum, err := accountKeySum(number[:8]+"0"+number[9:], bic)
+    if err != nil {
+        return 0, err
+    }
+    return sum % 10 * 3 % 10, nil
+}
+
+// accountKeySum weighs the last three digits of the BIC followed by the account number with
+// 7, 1, 3 repeating and adds up the last digits of the products.
+func accountKeySum(number, bic string) (int, error) {
+    if !ValidBIC(bic) {
+        return 0, errors.New("invalid BIC")
+    }
+    digits := bic[6:] + number
+    sum := 0
+    for i, c := range digits {
+        sum += int(c-'0') * accountKeyWeights[i%3] % 10
+    }
+    return sum, nil
+}
+
+func allDigits(s string) bool {
+    for _, c := range s {
+        if c < '0' || c > '9' {
+            return false
+        }
+    }
+    return s != ""
+}
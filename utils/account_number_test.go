@@ -0,0 +1,62 @@
+package utils
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestValidAccountNumber(t *testing.T) {
+    tests := []struct {
+        number string
+        bic    string
+        want   bool
+    }{
+        {"40702810438000034726", "044525225", true},
+        {"40702810538000034726", "044525225", false}, // wrong control key
+        {"40702810438000034727", "044525225", false}, // mistyped last digit
+        {"40702810438000034726", "044525974", false}, // same number at another bank
+        {"40702810438000034726", "123456789", false}, // not a Russian BIC
+        {"4070281043800003472", "044525225", false},
+        {"4070281043800003472a", "044525225", false},
+        {"", "044525225", false},
+    }
+    for _, tt := range tests {
+        if got := ValidAccountNumber(tt.number, tt.bic); got != tt.want {
+            t.Errorf("ValidAccountNumber(%q, %q) = %v, want %v", tt.number, tt.bic, got, tt.want)
+        }
+    }
+}
+
+func TestGenerateAccountNumber(t *testing.T) {
+    tests := []struct {
+        balanceAccount string
+        currency       string
+        wantPrefix     string
+        wantErr        bool
+    }{
+        {balanceAccount: "40817", currency: "RUB", wantPrefix: "40817810"},
+        {balanceAccount: "40817", currency: "usd", wantPrefix: "40817840"},
+        {balanceAccount: "42301", currency: "AMD", wantPrefix: "42301051"},
+        {balanceAccount: "40817", currency: "XYZ", wantErr: true},
+        {balanceAccount: "4081", currency: "RUB", wantErr: true},
+    }
+    for _, tt := range tests {
+        number, err := GenerateAccountNumber(tt.balanceAccount, tt.currency, "044525225")
+        if tt.wantErr {
+            if err == nil {
+                t.Errorf("%s %s: expected an error", tt.balanceAccount, tt.currency)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s %s: %v", tt.balanceAccount, tt.currency, err)
+            continue
+        }
+        if !strings.HasPrefix(number, tt.wantPrefix) || number[9:13] != accountBranch || !ValidAccountNumber(number, "044525225") {
+            t.Errorf("%s %s: generated %s", tt.balanceAccount, tt.currency, number)
+        }
+    }
+    if _, err := GenerateAccountNumber("40817", "RUB", "0445"); err == nil {
+        t.Error("expected an error for an invalid BIC")
+    }
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+    "bufio"
+    "crypto/sha1"
+    "encoding/hex"
+    "errors"
+    "os"
+    "strings"
+)
+
+// BreachedPasswords is a set of SHA-1 hashes of leaked passwords, indexed the way the Pwned
+// Passwords range API is: by the first five hex characters of the hash, so a lookup only touches
+// the suffixes sharing that prefix and the password itself is never kept in plain text.
+type BreachedPasswords struct {
+    ranges map[string]map[string]struct{}
+    count  int
+}
+
+// LoadBreachedPasswords reads a file with one uppercase or lowercase SHA-1 hex hash per line,
+// optionally followed by ":<count>" as in the Pwned Passwords downloads. Empty lines and lines
+// starting with # are skipped.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    b := &BreachedPasswords{ranges: make(map[string]map[string]struct{})}
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        hash, _, _ := strings.Cut(line, ":")
+        hash = strings.ToUpper(hash)
+        if len(hash) != 40 {
+            return nil, errors.New("breached passwords file: invalid hash " + hash)
+        }
+        b.add(hash)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+    return b, nil
+}
+
+func (b *BreachedPasswords) Contains(password string) bool {
+    if b == nil {
+        return false
+    }
+    sum := sha1.Sum([]byte(password))
+    hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+    _, ok := b.ranges[hash[:5]][hash[5:]]
+    return ok
+}
+
+func (b *BreachedPasswords) Len() int {
+    if b == nil {
+        return 0
+    }
+    return b.count
+}
+
+func (b *BreachedPasswords) add(hash string) {
+    prefix, suffix := hash[:5], hash[5:]
+    if b.ranges[prefix] == nil {
+        b.ranges[prefix] = make(map[string]struct{})
+    }
+    if _, ok := b.ranges[prefix][suffix]; !ok {
+        b.ranges[prefix][suffix] = struct{}{}
+        b.count++
+    }
+}
@@ -0,0 +1,203 @@
+package utils
+
+import (
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "log"
+    "math/big"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a JWT signing key identified by kid (the key file name without .pem).
+type SigningKey struct {
+    ID         string
+    Method     jwt.SigningMethod
+    Private    crypto.Signer
+    ActiveFrom time.Time // the key is published at once but signs only from this moment
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    Alg string `json:"alg"`
+    N   string `json:"n,omitempty"`
+    E   string `json:"e,omitempty"`
+    Crv string `json:"crv,omitempty"`
+    X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+    Keys []JWK `json:"keys"`
+}
+
+// KeyRing holds the private keys found in a directory: RSA keys sign with RS256, Ed25519 keys with EdDSA.
+//
+// To rotate, put a new key file into the directory. It appears in the JWKS right away and starts
+// signing once overlap has passed since the file was written, so verifiers have time to fetch it.
+// The old key keeps verifying tokens until its file is removed, which should happen no earlier than
+// the access token lifetime after the switch.
+type KeyRing struct {
+    dir     string
+    overlap time.Duration
+
+    mu   sync.RWMutex
+    keys map[string]*SigningKey
+}
+
+func LoadKeyRing(dir string, overlap time.Duration) (*KeyRing, error) {
+    k := &KeyRing{dir: dir, overlap: overlap}
+    if err := k.Reload(); err != nil {
+        return nil, err
+    }
+    return k, nil
+}
+
+// Reload rereads the key directory. On error the previously loaded keys stay in use.
+func (k *KeyRing) Reload() error {
+    files, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+    if err != nil {
+        return err
+    }
+    keys := make(map[string]*SigningKey)
+    for _, file := range files {
+        key, err := loadSigningKey(file)
+        if err != nil {
+            return fmt.Errorf("%s: %w", file, err)
+        }
+        key.ActiveFrom = key.ActiveFrom.Add(k.overlap)
+        keys[key.ID] = key
+    }
+    if len(keys) == 0 {
+        return errors.New("no signing keys found in " + k.dir)
+    }
+
+    k.mu.Lock()
+    k.keys = keys
+    k.mu.Unlock()
+    return nil
+}
+
+func (k *KeyRing) StartReload(interval time.Duration) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for range ticker.C {
+            if err := k.Reload(); err != nil {
+                log.Printf("Failed to reload JWT signing keys: %v", err)
+            }
+        }
+    }()
+}
+
+// SigningKey returns the most recent key that is already active. Right after the first key is
+// created none is active yet, and the oldest key is used.
+func (k *KeyRing) SigningKey() *SigningKey {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+
+    now := time.Now()
+    var active, oldest *SigningKey
+    for _, key := range k.keys {
+        if !key.ActiveFrom.After(now) && (active == nil || key.ActiveFrom.After(active.ActiveFrom)) {
+            active = key
+        }
+        if oldest == nil || key.ActiveFrom.Before(oldest.ActiveFrom) {
+            oldest = key
+        }
+    }
+    if active != nil {
+        return active
+    }
+    return oldest
+}
+
+func (k *KeyRing) VerificationKey(kid string) (*SigningKey, bool) {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+    key, ok := k.keys[kid]
+    return key, ok
+}
+
+// JWKS returns the public halves of all keys, sorted by kid.
+func (k *KeyRing) JWKS() JWKSet {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+
+    set := JWKSet{Keys: []JWK{}}
+    for _, key := range k.keys {
+        jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+        switch pub := key.Private.Public().(type) {
+        case *rsa.PublicKey:
+            jwk.Kty = "RSA"
+            jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+            jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+        case ed25519.PublicKey:
+            jwk.Kty = "OKP"
+            jwk.Crv = "Ed25519"
+            jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+        }
+        set.Keys = append(set.Keys, jwk)
+    }
+    sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+    return set
+}
+
+// loadSigningKey reads a PEM private key in PKCS#8 form, or PKCS#1 for RSA.
+func loadSigningKey(file string) (*SigningKey, error) {
+    data, err := os.ReadFile(file)
+    if err != nil {
+        return nil, err
+    }
+    info, err := os.Stat(file)
+    if err != nil {
+        return nil, err
+    }
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, errors.New("no PEM data")
+    }
+
+    var parsed interface{}
+    if block.Type == "RSA PRIVATE KEY" {
+        parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+    } else {
+        parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    key := &SigningKey{
+        ID:         strings.TrimSuffix(filepath.Base(file), ".pem"),
+        ActiveFrom: info.ModTime(),
+    }
+    switch priv := parsed.(type) {
+    case *rsa.PrivateKey:
+        if priv.N.BitLen() < 2048 {
+            return nil, errors.New("RSA keys must be at least 2048 bits")
+        }
+        key.Method = jwt.SigningMethodRS256
+        key.Private = priv
+    case ed25519.PrivateKey:
+        key.Method = jwt.SigningMethodEdDSA
+        key.Private = priv
+    default:
+        return nil, errors.New("only RSA and Ed25519 keys are supported")
+    }
+    return key, nil
+}
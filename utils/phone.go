@@ -0,0 +1,32 @@
+package utils
+
+import (
+    "errors"
+    "strings"
+)
+
+// NormalizePhone converts a Russian phone number written in any common form
+// (8 (912) 345-67-89, +7 912 345 67 89, 9123456789) to +7XXXXXXXXXX.
+func NormalizePhone(phone string) (string, error) {
+    var digits strings.Builder
+    for _, c := range phone {
+        switch {
+        case c >= '0' && c <= '9':
+            digits.WriteRune(c)
+        case c == '+' || c == ' ' || c == '-' || c == '(' || c == ')':
+        default:
+            return "", errors.New("invalid phone number")
+        }
+    }
+    d := digits.String()
+    switch {
+    case len(d) == 10:
+        d = "7" + d
+    case len(d) == 11 && d[0] == '8':
+        d = "7" + d[1:]
+    }
+    if len(d) != 11 || d[0] != '7' {
+        return "", errors.New("invalid phone number")
+    }
+    return "+" + d, nil
+}
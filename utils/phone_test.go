@@ -0,0 +1,33 @@
+package utils
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+    tests := []struct {
+        in      string
+        want    string
+        wantErr bool
+    }{
+        {in: "+7 912 345 67 89", want: "+79123456789"},
+        {in: "8 (912) 345-67-89", want: "+79123456789"},
+        {in: "9123456789", want: "+79123456789"},
+        {in: "79123456789", want: "+79123456789"},
+        {in: "+1 912 345 67 89", wantErr: true},
+        {in: "912345678", wantErr: true},
+        {in: "8 912 345 67 89 0", wantErr: true},
+        {in: "ivan.petrov", wantErr: true},
+        {in: "", wantErr: true},
+    }
+    for _, tt := range tests {
+        got, err := NormalizePhone(tt.in)
+        if tt.wantErr {
+            if err == nil {
+                t.Errorf("NormalizePhone(%q) = %q, want an error", tt.in, got)
+            }
+            continue
+        }
+        if err != nil || got != tt.want {
+            t.Errorf("NormalizePhone(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+        }
+    }
+}
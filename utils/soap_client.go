@@ -0,0 +1,164 @@
+package utils
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/beevik/etree"
+)
+
+const (
+    CBRDailyInfoURL = "https://www.cbr.ru/DailyInfoWebServ/DailyInfo.asmx"
+    cbrNamespace    = "http://web.cbr.ru/"
+    soapNamespace   = "http://schemas.xmlsoap.org/soap/envelope/"
+)
+
+var soapHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// CurrencyRate is one row of the CBR daily rates table: Rate rubles are paid for Nominal units of Code.
+type CurrencyRate struct {
+    Code    string
+    Nominal int
+    Rate    float64
+}
+
+// CallSOAP wraps the element produced by build into a SOAP 1.1 envelope, posts it to url
+// and returns the parsed response document.
+func CallSOAP(url, action string, build func(body *etree.Element)) (*etree.Document, error) {
+    req := etree.NewDocument()
+    req.CreateProcInst("xml", `version="1.0" encoding="utf-8"`)
+    envelope := req.CreateElement("soap:Envelope")
+    envelope.CreateAttr("xmlns:soap", soapNamespace)
+    build(envelope.CreateElement("soap:Body"))
+
+    payload, err := req.WriteToBytes()
+    if err != nil {
+        return nil, err
+    }
+    httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+    if err != nil {
+        return nil, err
+    }
+    httpReq.Header.Set("Content-Type", "text/xml; charset=utf-8")
+    httpReq.Header.Set("SOAPAction", action)
+
+    resp, err := soapHTTPClient.Do(httpReq)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    respBody, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, err
+    }
+
+    // Faults come back with a 500 status, so look for one before checking the code.
+    doc := etree.NewDocument()
+    if err := doc.ReadFromBytes(respBody); err != nil {
+        return nil, fmt.Errorf("soap call %s failed: %s", action, resp.Status)
+    }
+    if fault := doc.FindElement("//Fault"); fault != nil {
+        msg := "unknown error"
+        if fs := fault.SelectElement("faultstring"); fs != nil {
+            msg = strings.TrimSpace(fs.Text())
+        }
+        return nil, fmt.Errorf("soap fault: %s", msg)
+    }
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("soap call %s failed: %s", action, resp.Status)
+    }
+    return doc, nil
+}
+
+// GetCursOnDate fetches the official CBR exchange rates in force on the given date. The returned
+// date is the one the rates were published for, which differs from the requested one on weekends
+// and holidays.
+func GetCursOnDate(date time.Time) (time.Time, []CurrencyRate, error) {
+    doc, err := CallSOAP(CBRDailyInfoURL, cbrNamespace+"GetCursOnDate", func(body *etree.Element) {
+        call := body.CreateElement("GetCursOnDate")
+        call.CreateAttr("xmlns", cbrNamespace)
+        call.CreateElement("On_date").SetText(date.Format("2006-01-02T15:04:05"))
+    })
+    if err != nil {
+        return time.Time{}, nil, err
+    }
+
+    onDate := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+    if data := doc.FindElement("//ValuteData"); data != nil {
+        if parsed, err := time.Parse("20060102", data.SelectAttrValue("OnDate", "")); err == nil {
+            onDate = parsed
+        }
+    }
+
+    var rates []CurrencyRate
+    for _, row := range doc.FindElements("//ValuteCursOnDate") {
+        code := row.SelectElement("VchCode")
+        nominal := row.SelectElement("Vnom")
+        curs := row.SelectElement("Vcurs")
+        if code == nil || nominal == nil || curs == nil {
+            continue
+        }
+        nom, err := strconv.ParseFloat(strings.TrimSpace(nominal.Text()), 64)
+        if err != nil {
+            return time.Time{}, nil, err
+        }
+        rate, err := strconv.ParseFloat(strings.TrimSpace(curs.Text()), 64)
+        if err != nil {
+            return time.Time{}, nil, err
+        }
+        rates = append(rates, CurrencyRate{
+            Code:    strings.TrimSpace(code.Text()),
+            Nominal: int(nom),
+            Rate:    rate,
+        })
+    }
+    if len(rates) == 0 {
+        return time.Time{}, nil, errors.New("cbr returned no exchange rates")
+    }
+    return onDate, rates, nil
+}
+
+// GetKeyRate returns the most recent CBR key rate (in percent) set between from and to.
+func GetKeyRate(from, to time.Time) (float64, error) {
+    doc, err := CallSOAP(CBRDailyInfoURL, cbrNamespace+"KeyRate", func(body *etree.Element) {
+        call := body.CreateElement("KeyRate")
+        call.CreateAttr("xmlns", cbrNamespace)
+        call.CreateElement("fromDate").SetText(from.Format("2006-01-02T15:04:05"))
+        call.CreateElement("ToDate").SetText(to.Format("2006-01-02T15:04:05"))
+    })
+    if err != nil {
+        return 0, err
+    }
+
+    var latest time.Time
+    rate := -1.0
+    for _, row := range doc.FindElements("//KR") {
+        dt := row.SelectElement("DT")
+        value := row.SelectElement("Rate")
+        if dt == nil || value == nil {
+            continue
+        }
+        day, err := time.Parse(time.RFC3339, strings.TrimSpace(dt.Text()))
+        if err != nil {
+            return 0, err
+        }
+        if day.Before(latest) {
+            continue
+        }
+        parsed, err := strconv.ParseFloat(strings.TrimSpace(value.Text()), 64)
+        if err != nil {
+            return 0, err
+        }
+        latest, rate = day, parsed
+    }
+    if rate < 0 {
+        return 0, errors.New("cbr returned no key rate")
+    }
+    return rate, nil
+}
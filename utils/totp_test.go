@@ -0,0 +1,68 @@
+package utils
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+// Base32 of the ASCII secret "12345678901234567890" from the RFC 6238 test vectors.
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+    tests := []struct {
+        name   string
+        secret string
+        code   string
+        at     int64
+        wantOK bool
+    }{
+        {"rfc vector at 59", rfcTOTPSecret, "287082", 59, true},
+        {"rfc vector at 1111111109", rfcTOTPSecret, "081804", 1111111109, true},
+        {"rfc vector at 1234567890", rfcTOTPSecret, "005924", 1234567890, true},
+        {"rfc vector at 2000000000", rfcTOTPSecret, "279037", 2000000000, true},
+        {"lowercase secret", strings.ToLower(rfcTOTPSecret), "279037", 2000000000, true},
+        {"one step late", rfcTOTPSecret, "005924", 1234567890 + 30, true},
+        {"one step early", rfcTOTPSecret, "005924", 1234567890 - 30, true},
+        {"two steps late", rfcTOTPSecret, "005924", 1234567890 + 60, false},
+        {"wrong code", rfcTOTPSecret, "005925", 1234567890, false},
+        {"short code", rfcTOTPSecret, "05924", 1234567890, false},
+        {"broken secret", "not base32!", "005924", 1234567890, false},
+    }
+    for _, tt := range tests {
+        _, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.at, 0))
+        if ok != tt.wantOK {
+            t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.wantOK)
+        }
+    }
+}
+
+func TestValidateTOTPReturnsMatchedStep(t *testing.T) {
+    step, ok := ValidateTOTP(rfcTOTPSecret, "005924", time.Unix(1234567890+30, 0))
+    if !ok || step != 1234567890/30 {
+        t.Errorf("step = %d, %v, want %d", step, ok, 1234567890/30)
+    }
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+    secret, err := GenerateTOTPSecret()
+    if err != nil {
+        t.Fatal(err)
+    }
+    code := totpCode(mustDecodeTOTP(t, secret), time.Now().Unix()/totpPeriod)
+    if _, ok := ValidateTOTP(secret, code, time.Now()); !ok {
+        t.Error("a code for a fresh secret does not validate")
+    }
+    uri := TOTPURI("Bank", "ivan@example.com", secret)
+    if !strings.HasPrefix(uri, "otpauth://totp/Bank:ivan@example.com?") || !strings.Contains(uri, "secret="+secret) {
+        t.Errorf("unexpected URI %s", uri)
+    }
+}
+
+func mustDecodeTOTP(t *testing.T, secret string) []byte {
+    key, err := totpEncoding.DecodeString(secret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return key
+}